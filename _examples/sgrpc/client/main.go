@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"log"
 	"net"
-	"net/netip"
 	"time"
 
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
@@ -22,33 +21,31 @@ import (
 var (
 	Message    = flag.String("message", "", "Message to send to the gRPC echo server")
 	ServerAddr = flag.String("server-addr", "1-ff00:0:111,127.0.0.1:5000", "Address of the echo server")
+	KnownHosts = flag.String("known-hosts", "", "Trust store file to pin the server key on first use (default: no verification)")
 )
 
 func NewPanQuicDialer(tlsCfg *tls.Config) func(context.Context, string) (net.Conn, error) {
-	dialer := func(ctx context.Context, addr string) (net.Conn, error) {
-		panAddr, err := pan.ResolveUDPAddr(ctx, addr)
-		if err != nil {
-			return nil, err
-		}
-
-		clientQuicConfig := &quic.Config{KeepAlivePeriod: 15 * time.Second}
-		session, err := pan.DialQUIC(ctx, netip.AddrPort{}, panAddr, "", tlsCfg, clientQuicConfig)
-		if err != nil {
-			return nil, fmt.Errorf("did not dial: %w", err)
-		}
-		return quicutil.NewSingleStream(session)
+	dialer := &pan.Dialer{
+		TLSConfig:  tlsCfg,
+		QUICConfig: &quic.Config{KeepAlivePeriod: 15 * time.Second},
+	}
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "quic", addr)
 	}
-
-	return dialer
 }
 
 func main() {
 	flag.Parse()
 
-	tlsCfg := &tls.Config{
-		InsecureSkipVerify: true,
-		NextProtos:         []string{"echo_service"},
+	tlsCfg := &tls.Config{InsecureSkipVerify: true}
+	if *KnownHosts != "" {
+		store, err := quicutil.LoadTrustStore(*KnownHosts)
+		if err != nil {
+			log.Fatalf("failed to load trust store: %v", err)
+		}
+		tlsCfg = store.TLSConfig()
 	}
+	tlsCfg.NextProtos = []string{"echo_service"}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
@@ -30,6 +30,7 @@ func (*echoServer) Echo(ctx context.Context,
 
 var (
 	ServerAddr = flag.String("server-addr", "127.0.0.1:5000", "Address the server should listen on")
+	KeyFile    = flag.String("key", "", "Persistent private key file, generated if it does not exist (default: ephemeral key)")
 )
 
 func main() {
@@ -44,8 +45,16 @@ func main() {
 	grpcServer := grpc.NewServer()
 	pb.RegisterEchoServiceServer(grpcServer, echoServer)
 
+	certs := quicutil.MustGenerateSelfSignedCert()
+	if *KeyFile != "" {
+		cert, err := quicutil.LoadOrGenerateSelfSignedCert(*KeyFile)
+		if err != nil {
+			log.Fatalf("failed to load key: %v", err)
+		}
+		certs = []tls.Certificate{*cert}
+	}
 	tlsCfg := &tls.Config{
-		Certificates: quicutil.MustGenerateSelfSignedCert(),
+		Certificates: certs,
 		NextProtos:   []string{"echo_service"},
 	}
 
@@ -53,7 +62,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to listen SCION QUIC on %s: %v", *ServerAddr, err)
 	}
-	lis := quicutil.SingleStreamListener{QUICListener: quicListener}
+	lis := &quicutil.SingleStreamListener{QUICListener: quicListener}
 	log.Println("listen on", quicListener.Addr())
 
 	if err := grpcServer.Serve(lis); err != nil {
@@ -45,6 +45,20 @@ const (
 	MinPort uint16 = 1024
 )
 
+// Version is the version of the bwtester protocol, see the bwtester README.
+type Version uint8
+
+const (
+	// Version1 is the original protocol, with single-letter commands and gob
+	// encoded parameters and results.
+	Version1 Version = 1
+	// Version2 is the protocol with version handshake, session IDs and a
+	// binary encoding, see protocol.go.
+	Version2 Version = 2
+	// LatestVersion is the latest protocol version supported.
+	LatestVersion = Version2
+)
+
 type Parameters struct {
 	BwtestDuration time.Duration
 	PacketSize     int64
@@ -73,28 +87,37 @@ func Check(e error) {
 }
 
 type prgFiller struct {
-	aes cipher.Block
-	buf []byte
+	aes     cipher.Block
+	buf     []byte
+	version Version
 }
 
-func newPrgFiller(key []byte) *prgFiller {
+func newPrgFiller(key []byte, version Version) *prgFiller {
 	aesCipher, err := aes.NewCipher(key)
 	Check(err)
 	return &prgFiller{
-		aes: aesCipher,
-		buf: make([]byte, aes.BlockSize),
+		aes:     aesCipher,
+		buf:     make([]byte, aes.BlockSize),
+		version: version,
 	}
 }
 
 // Fill the buffer with AES PRG in counter mode
 // The value of the ith 16-byte block is simply an encryption of i under the key
+// In Version1, all full blocks are written to the beginning of the buffer, so
+// that the data is mostly left zero; this is kept for compatibility with
+// Version1 peers.
 func (f *prgFiller) Fill(iv int, data []byte) {
 	memzero(f.buf)
 	i := uint32(iv)
 	j := 0
 	for j <= len(data)-aes.BlockSize {
 		binary.LittleEndian.PutUint32(f.buf, i)
-		f.aes.Encrypt(data, f.buf) // BUG(matzf): this should be data[j:]! data is mostly left zero.
+		if f.version == Version1 {
+			f.aes.Encrypt(data, f.buf)
+		} else {
+			f.aes.Encrypt(data[j:], f.buf)
+		}
 		j = j + aes.BlockSize
 		i = i + uint32(aes.BlockSize)
 	}
@@ -150,14 +173,16 @@ func DecodeParameters(buf []byte) (Parameters, int, error) {
 	return v, is - bb.Len(), err
 }
 
-func HandleDCConnSend(bwp Parameters, udpConnection io.Writer) error {
+// HandleDCConnSend sends the packets of a bandwidth test with the parameters,
+// with the payload of the protocol version.
+func HandleDCConnSend(bwp Parameters, version Version, udpConnection io.Writer) error {
 	sb := make([]byte, bwp.PacketSize)
 	t0 := time.Now()
 	interPktInterval := bwp.BwtestDuration
 	if bwp.NumPackets > 1 {
 		interPktInterval = bwp.BwtestDuration / time.Duration(bwp.NumPackets-1)
 	}
-	prgFiller := newPrgFiller(bwp.PrgKey)
+	prgFiller := newPrgFiller(bwp.PrgKey, version)
 	for i := int64(0); i < bwp.NumPackets; i++ {
 		time.Sleep(time.Until(t0.Add(interPktInterval * time.Duration(i))))
 		// Send packet now
@@ -172,7 +197,9 @@ func HandleDCConnSend(bwp Parameters, udpConnection io.Writer) error {
 	return nil
 }
 
-func HandleDCConnReceive(bwp Parameters, udpConnection io.Reader) Result {
+// HandleDCConnReceive receives the packets of a bandwidth test with the
+// parameters, with the payload of the protocol version, and returns the result.
+func HandleDCConnReceive(bwp Parameters, version Version, udpConnection io.Reader) Result {
 	var numPacketsReceived int64
 	var correctlyReceived int64
 	interPacketArrivalTime := make(map[int]int64, bwp.NumPackets)
@@ -180,7 +207,7 @@ func HandleDCConnReceive(bwp Parameters, udpConnection io.Reader) Result {
 	// Make the receive buffer a bit larger to enable detection of packets that are too large
 	recBuf := make([]byte, bwp.PacketSize+1)
 	cmpBuf := make([]byte, bwp.PacketSize)
-	prgFiller := newPrgFiller(bwp.PrgKey)
+	prgFiller := newPrgFiller(bwp.PrgKey, version)
 	for correctlyReceived < bwp.NumPackets {
 		n, err := udpConnection.Read(recBuf)
 		if err != nil { // Deadline exceeded or read error
@@ -0,0 +1,295 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwtest
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Control messages of protocol Version2.
+//
+// Every message starts with a header of two bytes, the protocol version and
+// the message type. The response to a request has the type of the request.
+// All integers are big-endian. See the bwtester README for the layout of the
+// messages.
+//
+// The first byte of Version1 messages is 'N' or 'R', so versions up to 'N'-1
+// can be told apart from Version1.
+
+// MessageType is the type of a Version2 control message.
+type MessageType uint8
+
+const (
+	// MsgHello negotiates the protocol version: the client sends its latest
+	// version, the server responds with the version to use.
+	MsgHello MessageType = 1
+	// MsgNewTest requests a new bandwidth test.
+	MsgNewTest MessageType = 2
+	// MsgResult requests the result of the client->server direction of a
+	// bandwidth test.
+	MsgResult MessageType = 3
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case MsgHello:
+		return "hello"
+	case MsgNewTest:
+		return "new test"
+	case MsgResult:
+		return "result"
+	}
+	return fmt.Sprintf("unknown (%d)", uint8(t))
+}
+
+// Status is the status of a Version2 response.
+type Status uint8
+
+const (
+	// StatusOK indicates success; the test was started, or the response
+	// contains the result.
+	StatusOK Status = 0
+	// StatusRetry asks the client to send the request again after the wait
+	// time of the response.
+	StatusRetry Status = 1
+	// StatusNotFound indicates that there is no result for the session.
+	StatusNotFound Status = 2
+	// StatusInvalid indicates that the request was rejected, e.g. because of
+	// invalid parameters.
+	StatusInvalid Status = 3
+)
+
+const (
+	headerLen     = 2
+	sessionLen    = 8
+	parametersLen = 8 + 4 + 8 + 2 + 16
+	resultLen     = 6 * 8
+	prgKeyLen     = 16
+)
+
+// SessionID identifies a bandwidth test. It is chosen randomly by the client,
+// so that a client can retry requests, e.g. from a different address, and
+// only the client can fetch the result.
+type SessionID uint64
+
+// NewSessionID returns a random session ID.
+func NewSessionID() (SessionID, error) {
+	var b [sessionLen]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return SessionID(binary.BigEndian.Uint64(b[:])), nil
+}
+
+func (id SessionID) String() string {
+	return fmt.Sprintf("%016x", uint64(id))
+}
+
+// Request is a Version2 request from the client to the server.
+type Request struct {
+	Version Version
+	Type    MessageType
+	Session SessionID // MsgNewTest and MsgResult
+	// ClientBwp and ServerBwp are the parameters for the client->server and
+	// server->client direction, for MsgNewTest.
+	ClientBwp Parameters
+	ServerBwp Parameters
+}
+
+// Response is a Version2 response from the server to the client.
+type Response struct {
+	Version Version
+	Type    MessageType
+	Session SessionID // MsgNewTest and MsgResult
+	Status  Status    // MsgNewTest and MsgResult
+	// Wait is the time to wait before retrying the request, for StatusRetry.
+	// Encoded in milliseconds.
+	Wait time.Duration
+	// Result is the result, for MsgResult with StatusOK. The PrgKey is not
+	// encoded.
+	Result Result
+}
+
+// IsVersion1 returns whether the message is a Version1 message.
+func IsVersion1(msg []byte) bool {
+	return len(msg) > 0 && (msg[0] == 'N' || msg[0] == 'R')
+}
+
+// EncodeRequest encodes the request.
+func EncodeRequest(req Request) ([]byte, error) {
+	buf := []byte{byte(req.Version), byte(req.Type)}
+	switch req.Type {
+	case MsgHello:
+	case MsgNewTest:
+		buf = binary.BigEndian.AppendUint64(buf, uint64(req.Session))
+		var err error
+		if buf, err = appendParameters(buf, req.ClientBwp); err != nil {
+			return nil, fmt.Errorf("client->server parameters: %w", err)
+		}
+		if buf, err = appendParameters(buf, req.ServerBwp); err != nil {
+			return nil, fmt.Errorf("server->client parameters: %w", err)
+		}
+	case MsgResult:
+		buf = binary.BigEndian.AppendUint64(buf, uint64(req.Session))
+	default:
+		return nil, fmt.Errorf("unknown message type %d", req.Type)
+	}
+	return buf, nil
+}
+
+// DecodeRequest decodes a request. The version is not checked, apart from
+// rejecting Version1 messages; requests of a later version than Version2 are
+// decoded as Version2.
+func DecodeRequest(buf []byte) (Request, error) {
+	if len(buf) < headerLen {
+		return Request{}, errors.New("message too short")
+	}
+	if IsVersion1(buf) {
+		return Request{}, errors.New("version 1 message")
+	}
+	req := Request{Version: Version(buf[0]), Type: MessageType(buf[1])}
+	payload := buf[headerLen:]
+	var expectedLen int
+	switch req.Type {
+	case MsgHello:
+		return req, nil // may carry additional data in later versions
+	case MsgNewTest:
+		expectedLen = sessionLen + 2*parametersLen
+	case MsgResult:
+		expectedLen = sessionLen
+	default:
+		return req, fmt.Errorf("unknown message type %d", req.Type)
+	}
+	if len(payload) != expectedLen {
+		return req, fmt.Errorf("invalid length %d for message type %d", len(buf), req.Type)
+	}
+	req.Session = SessionID(binary.BigEndian.Uint64(payload))
+	if req.Type == MsgNewTest {
+		req.ClientBwp = decodeParameters(payload[sessionLen:])
+		req.ServerBwp = decodeParameters(payload[sessionLen+parametersLen:])
+	}
+	return req, nil
+}
+
+// EncodeResponse encodes the response.
+func EncodeResponse(resp Response) ([]byte, error) {
+	buf := []byte{byte(resp.Version), byte(resp.Type)}
+	switch resp.Type {
+	case MsgHello:
+		return buf, nil
+	case MsgNewTest, MsgResult:
+	default:
+		return nil, fmt.Errorf("unknown message type %d", resp.Type)
+	}
+	buf = binary.BigEndian.AppendUint64(buf, uint64(resp.Session))
+	buf = append(buf, byte(resp.Status))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(resp.Wait/time.Millisecond))
+	if resp.Type == MsgResult && resp.Status == StatusOK {
+		buf = appendResult(buf, resp.Result)
+	}
+	return buf, nil
+}
+
+// DecodeResponse decodes a response.
+func DecodeResponse(buf []byte) (Response, error) {
+	if len(buf) < headerLen {
+		return Response{}, errors.New("message too short")
+	}
+	resp := Response{Version: Version(buf[0]), Type: MessageType(buf[1])}
+	payload := buf[headerLen:]
+	switch resp.Type {
+	case MsgHello:
+		return resp, nil
+	case MsgNewTest, MsgResult:
+	default:
+		return resp, fmt.Errorf("unknown message type %d", resp.Type)
+	}
+	const statusLen = sessionLen + 1 + 4
+	if len(payload) < statusLen {
+		return resp, errors.New("message too short")
+	}
+	resp.Session = SessionID(binary.BigEndian.Uint64(payload))
+	resp.Status = Status(payload[sessionLen])
+	resp.Wait = time.Duration(binary.BigEndian.Uint32(payload[sessionLen+1:])) * time.Millisecond
+	expectedLen := statusLen
+	if resp.Type == MsgResult && resp.Status == StatusOK {
+		expectedLen += resultLen
+	}
+	if len(payload) != expectedLen {
+		return resp, fmt.Errorf("invalid length %d for message type %d", len(buf), resp.Type)
+	}
+	if expectedLen > statusLen {
+		resp.Result = decodeResult(payload[statusLen:])
+	}
+	return resp, nil
+}
+
+// appendParameters appends the encoded parameters: duration in nanoseconds
+// (8 bytes), packet size (4 bytes), number of packets (8 bytes), port
+// (2 bytes) and PRG key (16 bytes).
+func appendParameters(buf []byte, bwp Parameters) ([]byte, error) {
+	if len(bwp.PrgKey) != prgKeyLen {
+		return nil, fmt.Errorf("invalid key size: %d != %d", len(bwp.PrgKey), prgKeyLen)
+	}
+	if bwp.BwtestDuration < 0 || bwp.PacketSize < 0 || bwp.PacketSize > MaxPacketSize || bwp.NumPackets < 0 {
+		return nil, errors.New("negative or too large value")
+	}
+	buf = binary.BigEndian.AppendUint64(buf, uint64(bwp.BwtestDuration))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(bwp.PacketSize))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(bwp.NumPackets))
+	buf = binary.BigEndian.AppendUint16(buf, bwp.Port)
+	return append(buf, bwp.PrgKey...), nil
+}
+
+func decodeParameters(buf []byte) Parameters {
+	return Parameters{
+		BwtestDuration: time.Duration(binary.BigEndian.Uint64(buf)),
+		PacketSize:     int64(binary.BigEndian.Uint32(buf[8:])),
+		NumPackets:     int64(binary.BigEndian.Uint64(buf[12:])),
+		Port:           binary.BigEndian.Uint16(buf[20:]),
+		PrgKey:         append([]byte(nil), buf[22:22+prgKeyLen]...),
+	}
+}
+
+// appendResult appends the encoded result: number of packets received,
+// number of packets correctly received, and the variance, minimum, average
+// and maximum of the interarrival time in nanoseconds, each 8 bytes.
+func appendResult(buf []byte, res Result) []byte {
+	for _, v := range []int64{
+		res.NumPacketsReceived, res.CorrectlyReceived,
+		res.IPAvar, res.IPAmin, res.IPAavg, res.IPAmax,
+	} {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(v))
+	}
+	return buf
+}
+
+func decodeResult(buf []byte) Result {
+	v := func(i int) int64 {
+		return int64(binary.BigEndian.Uint64(buf[8*i:]))
+	}
+	return Result{
+		NumPacketsReceived: v(0),
+		CorrectlyReceived:  v(1),
+		IPAvar:             v(2),
+		IPAmin:             v(3),
+		IPAavg:             v(4),
+		IPAmax:             v(5),
+	}
+}
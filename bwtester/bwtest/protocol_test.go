@@ -0,0 +1,160 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bwtest
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testParameters(port uint16) Parameters {
+	return Parameters{
+		BwtestDuration: 3 * time.Second,
+		PacketSize:     1000,
+		NumPackets:     30,
+		PrgKey:         bytes.Repeat([]byte{byte(port)}, 16),
+		Port:           port,
+	}
+}
+
+func TestRequest(t *testing.T) {
+	cases := []struct {
+		name string
+		req  Request
+		len  int
+	}{
+		{"hello", Request{Version: Version2, Type: MsgHello}, 2},
+		{"new test", Request{
+			Version:   Version2,
+			Type:      MsgNewTest,
+			Session:   0x0102030405060708,
+			ClientBwp: testParameters(40001),
+			ServerBwp: testParameters(40002),
+		}, 2 + 8 + 2*38},
+		{"result", Request{Version: Version2, Type: MsgResult, Session: 42}, 2 + 8},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buf, err := EncodeRequest(c.req)
+			require.NoError(t, err)
+			assert.Len(t, buf, c.len)
+			assert.False(t, IsVersion1(buf))
+			decoded, err := DecodeRequest(buf)
+			require.NoError(t, err)
+			assert.Equal(t, c.req, decoded)
+
+			_, err = DecodeRequest(append(buf, 0))
+			if c.req.Type != MsgHello {
+				assert.Error(t, err, "trailing bytes")
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		bwp := testParameters(40001)
+		bwp.PrgKey = bwp.PrgKey[:8]
+		_, err := EncodeRequest(Request{Version: Version2, Type: MsgNewTest, ClientBwp: bwp, ServerBwp: bwp})
+		assert.Error(t, err)
+		_, err = DecodeRequest([]byte{'N', 0, 0})
+		assert.Error(t, err, "version 1")
+		_, err = DecodeRequest([]byte{byte(Version2), 42})
+		assert.Error(t, err, "unknown type")
+		_, err = DecodeRequest([]byte{byte(Version2), byte(MsgNewTest), 0})
+		assert.Error(t, err, "truncated")
+	})
+}
+
+func TestResponse(t *testing.T) {
+	result := Result{
+		NumPacketsReceived: 30,
+		CorrectlyReceived:  29,
+		IPAvar:             1000,
+		IPAmin:             -1,
+		IPAavg:             100000000,
+		IPAmax:             100001000,
+	}
+	cases := []struct {
+		name string
+		resp Response
+		len  int
+	}{
+		{"hello", Response{Version: Version2, Type: MsgHello}, 2},
+		{"new test retry", Response{Version: Version2, Type: MsgNewTest, Session: 1,
+			Status: StatusRetry, Wait: 1500 * time.Millisecond}, 2 + 13},
+		{"result", Response{Version: Version2, Type: MsgResult, Session: 1, Result: result}, 2 + 13 + 48},
+		{"result not found", Response{Version: Version2, Type: MsgResult, Session: 1,
+			Status: StatusNotFound}, 2 + 13},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buf, err := EncodeResponse(c.resp)
+			require.NoError(t, err)
+			assert.Len(t, buf, c.len)
+			decoded, err := DecodeResponse(buf)
+			require.NoError(t, err)
+			assert.Equal(t, c.resp, decoded)
+		})
+	}
+}
+
+func TestPrgFiller(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 16)
+	data := make([]byte, 100)
+
+	newPrgFiller(key, Version2).Fill(0, data)
+	for i := 0; i+16 <= len(data); i += 16 {
+		assert.NotEqual(t, make([]byte, 16), data[i:i+16], "block at %d filled", i)
+	}
+	other := make([]byte, 100)
+	newPrgFiller(key, Version2).Fill(100, other)
+	assert.NotEqual(t, data, other)
+
+	// Version1 leaves all but the first and the last (partial) block zero
+	v1 := make([]byte, 100)
+	newPrgFiller(key, Version1).Fill(0, v1)
+	assert.Equal(t, make([]byte, 80), v1[16:96])
+	assert.Equal(t, data[96:], v1[96:])
+}
+
+// packetConn is a connection for the packets of a bandwidth test, for which
+// written packets are read back.
+type packetConn struct {
+	packets chan []byte
+}
+
+func (c *packetConn) Write(b []byte) (int, error) {
+	c.packets <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+func (c *packetConn) Read(b []byte) (int, error) {
+	return copy(b, <-c.packets), nil
+}
+
+func TestHandleDCConn(t *testing.T) {
+	for _, version := range []Version{Version1, Version2} {
+		bwp := testParameters(40001)
+		bwp.BwtestDuration = 10 * time.Millisecond
+		bwp.NumPackets = 10
+		conn := &packetConn{packets: make(chan []byte, bwp.NumPackets)}
+		require.NoError(t, HandleDCConnSend(bwp, version, conn))
+		res := HandleDCConnReceive(bwp, version, conn)
+		assert.Equal(t, bwp.NumPackets, res.CorrectlyReceived, "version %d", version)
+	}
+}
@@ -42,9 +42,10 @@ const (
 	DefaultBW               = 3000
 	WildcardChar            = "?"
 
-	MaxTries               = 5 // Number of times to try to reach server
-	Timeout  time.Duration = time.Millisecond * 500
-	MaxRTT   time.Duration = time.Millisecond * 1000
+	MaxTries                 = 5 // Number of times to try to reach server
+	HelloTries               = 2 // Number of times to try the version handshake before falling back to version 1
+	Timeout    time.Duration = time.Millisecond * 500
+	MaxRTT     time.Duration = time.Millisecond * 1000
 )
 
 func prepareAESKey() []byte {
@@ -339,6 +340,16 @@ func runBwtest(local netip.AddrPort, serverCCAddr pan.UDPAddr, policy pan.Policy
 	if err != nil {
 		return
 	}
+	version, err := negotiateVersion(ccConn)
+	if err != nil {
+		return
+	}
+	var session bwtest.SessionID
+	if version >= bwtest.Version2 {
+		if session, err = bwtest.NewSessionID(); err != nil {
+			return
+		}
+	}
 
 	dcLocal := netip.AddrPortFrom(local.Addr(), 0)
 	// Address of server data channel (DC)
@@ -357,11 +368,15 @@ func runBwtest(local netip.AddrPort, serverCCAddr pan.UDPAddr, policy pan.Policy
 	// Start receiver before even sending the request so it will be ready.
 	receiveRes := make(chan bwtest.Result, 1)
 	go func() {
-		receiveRes <- bwtest.HandleDCConnReceive(serverBwp, dcConn)
+		receiveRes <- bwtest.HandleDCConnReceive(serverBwp, version, dcConn)
 	}()
 
 	// Send the request; when this finishes, the server may have already started blasting.
-	err = requestNewBwtest(ccConn, clientBwp, serverBwp)
+	if version >= bwtest.Version2 {
+		err = requestNewBwtestV2(ccConn, session, clientBwp, serverBwp)
+	} else {
+		err = requestNewBwtest(ccConn, clientBwp, serverBwp)
+	}
 	if err != nil {
 		return
 	}
@@ -383,7 +398,7 @@ func runBwtest(local netip.AddrPort, serverCCAddr pan.UDPAddr, policy pan.Policy
 	}
 
 	// Start blasting client->server
-	err = bwtest.HandleDCConnSend(clientBwp, dcConn)
+	err = bwtest.HandleDCConnSend(clientBwp, version, dcConn)
 	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
 		dcConn.Close()
 		return
@@ -393,10 +408,137 @@ func runBwtest(local netip.AddrPort, serverCCAddr pan.UDPAddr, policy pan.Policy
 	clientRes = <-receiveRes
 	dcConn.Close()
 
-	serverRes, err = requestResults(ccConn, clientBwp.PrgKey)
+	if version >= bwtest.Version2 {
+		serverRes, err = requestResultsV2(ccConn, session)
+	} else {
+		serverRes, err = requestResults(ccConn, clientBwp.PrgKey)
+	}
 	return
 }
 
+// negotiateVersion performs the version handshake with the server. Servers
+// that only support version 1 do not respond to the handshake, in which case
+// version 1 is used.
+func negotiateVersion(ccConn net.Conn) (bwtest.Version, error) {
+	request, err := bwtest.EncodeRequest(bwtest.Request{
+		Version: bwtest.LatestVersion,
+		Type:    bwtest.MsgHello,
+	})
+	if err != nil {
+		return 0, err
+	}
+	response, err := exchangeV2(ccConn, request, bwtest.MsgHello, 0, HelloTries)
+	if errors.Is(err, errNoResponse) {
+		fmt.Println("Server does not support protocol version 2, using version 1")
+		return bwtest.Version1, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if response.Version < bwtest.Version2 || response.Version > bwtest.LatestVersion {
+		return 0, fmt.Errorf("server selected unsupported protocol version %d", response.Version)
+	}
+	return response.Version, nil
+}
+
+// requestNewBwtestV2 makes a new bandwidth test request at the server, with
+// protocol version 2.
+// Returns nil once the server has accepted the request and an error otherwise.
+func requestNewBwtestV2(ccConn net.Conn, session bwtest.SessionID, clientBwp, serverBwp bwtest.Parameters) error {
+	request, err := bwtest.EncodeRequest(bwtest.Request{
+		Version:   bwtest.Version2,
+		Type:      bwtest.MsgNewTest,
+		Session:   session,
+		ClientBwp: clientBwp,
+		ServerBwp: serverBwp,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = exchangeV2(ccConn, request, bwtest.MsgNewTest, session, MaxTries)
+	return err
+}
+
+// requestResultsV2 fetches the result of the client->server direction of the
+// bandwidth test from the server, with protocol version 2.
+func requestResultsV2(ccConn net.Conn, session bwtest.SessionID) (bwtest.Result, error) {
+	request, err := bwtest.EncodeRequest(bwtest.Request{
+		Version: bwtest.Version2,
+		Type:    bwtest.MsgResult,
+		Session: session,
+	})
+	if err != nil {
+		return bwtest.Result{}, err
+	}
+	response, err := exchangeV2(ccConn, request, bwtest.MsgResult, session, MaxTries)
+	if err != nil {
+		return bwtest.Result{}, err
+	}
+	return response.Result, nil
+}
+
+var errNoResponse = errors.New("could not receive a server response, MaxTries attempted without success")
+
+// exchangeV2 sends a version 2 request and returns the response of the
+// expected type for the session, retrying lost requests up to maxTries times
+// and waiting as requested by the server. Returns an error if the server
+// rejected the request.
+func exchangeV2(ccConn net.Conn, request []byte, msgType bwtest.MessageType,
+	session bwtest.SessionID, maxTries int) (bwtest.Response, error) {
+
+	buf := make([]byte, 2000)
+	for numtries := 0; numtries < maxTries; {
+		_, err := ccConn.Write(request)
+		if err != nil {
+			return bwtest.Response{}, err
+		}
+
+		err = ccConn.SetReadDeadline(time.Now().Add(MaxRTT))
+		if err != nil {
+			return bwtest.Response{}, err
+		}
+		n, err := ccConn.Read(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			numtries++
+			continue
+		} else if err != nil {
+			return bwtest.Response{}, err
+		}
+
+		response, err := bwtest.DecodeResponse(buf[:n])
+		if err != nil || bwtest.IsVersion1(buf[:n]) {
+			fmt.Println("Incorrect server response, trying again")
+			time.Sleep(Timeout)
+			numtries++
+			continue
+		}
+		if response.Type == bwtest.MsgHello && msgType != bwtest.MsgHello {
+			return bwtest.Response{}, fmt.Errorf("server does not support protocol version 2 (version %d)",
+				response.Version)
+		}
+		if response.Type != msgType || response.Session != session {
+			// Response to an earlier request
+			numtries++
+			continue
+		}
+		switch response.Status {
+		case bwtest.StatusOK:
+			return response, nil
+		case bwtest.StatusRetry:
+			// The server asks us to wait for some amount of time
+			// Don't increase numtries in this case
+			time.Sleep(response.Wait)
+			continue
+		case bwtest.StatusNotFound:
+			return bwtest.Response{}, errors.New("results could not be found")
+		case bwtest.StatusInvalid:
+			return bwtest.Response{}, errors.New("request rejected by the server, invalid parameters")
+		default:
+			return bwtest.Response{}, fmt.Errorf("unknown response status %d", response.Status)
+		}
+	}
+	return bwtest.Response{}, errNoResponse
+}
+
 // requestNewBwtest makes a new bandwidth test request at the server.
 // Returns nil once the server has accepted the request and an error otherwise.
 func requestNewBwtest(ccConn net.Conn, clientBwp, serverBwp bwtest.Parameters) error {
@@ -36,106 +36,257 @@ const (
 func main() {
 	var listen pan.IPPortValue
 	kingpin.Flag("listen", "Address to listen on").Default(":40002").SetValue(&listen)
+	allowIAs := kingpin.Flag("allow-ia", "Only accept requests from this ISD-AS (repeatable, 0 is a wildcard, e.g. 1-0)").Strings()
+	denyIAs := kingpin.Flag("deny-ia", "Reject requests from this ISD-AS (repeatable, 0 is a wildcard)").Strings()
+	pathACL := kingpin.Flag("path-acl", "ACL entry applied to the path of requests (repeatable, in order), e.g. '- 1-ff00:0:110#2'").Strings()
+	rate := kingpin.Flag("rate-limit", "Maximum rate of request packets per second per client host (0 for unlimited)").Default("0").Float64()
+	maxClients := kingpin.Flag("max-clients", "Maximum number of client hosts tracked (0 for unlimited)").Default("0").Int()
 	kingpin.Parse()
 
-	err := runServer(listen.Get())
+	firewall, err := newFirewall(*allowIAs, *denyIAs, *pathACL, *rate, *maxClients)
+	bwtest.Check(err)
+	err = runServer(listen.Get(), firewall)
 	bwtest.Check(err)
 }
 
-func runServer(listen netip.AddrPort) error {
-	receivePacketBuffer := make([]byte, 2500)
-
-	var currentBwtest string
-	var currentBwtestFinish time.Time
-	currentResult := make(chan bwtest.Result)
+// newFirewall creates the firewall for the control connection from the
+// command line flags.
+func newFirewall(allowIAs, denyIAs, pathACL []string, rate float64, maxClients int) (*pan.Firewall, error) {
+	parseIAs := func(s []string) ([]pan.IA, error) {
+		ias := make([]pan.IA, len(s))
+		for i := range s {
+			ia, err := pan.ParseIA(s[i])
+			if err != nil {
+				return nil, err
+			}
+			ias[i] = ia
+		}
+		return ias, nil
+	}
+	allow, err := parseIAs(allowIAs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --allow-ia: %w", err)
+	}
+	deny, err := parseIAs(denyIAs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --deny-ia: %w", err)
+	}
+	var acl *pan.ACL
+	if len(pathACL) > 0 {
+		a, err := pan.NewACL(pathACL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --path-acl: %w", err)
+		}
+		acl = &a
+	}
+	return pan.NewFirewall(pan.FirewallConfig{
+		Allow:      allow,
+		Deny:       deny,
+		ACL:        acl,
+		Rate:       rate,
+		MaxRemotes: maxClients,
+	}), nil
+}
 
-	results := make(resultsMap)
+func runServer(listen netip.AddrPort, firewall *pan.Firewall) error {
+	receivePacketBuffer := make([]byte, 2500)
 
-	ctx := context.Background()
 	ccSelector := pan.NewDefaultReplySelector()
-	ccConn, err := pan.ListenUDP(context.Background(), listen, pan.WithReplySelector(ccSelector))
+	ccConn, err := pan.ListenUDP(context.Background(), listen,
+		pan.WithReplySelector(ccSelector), pan.WithInboundFilter(firewall))
 	if err != nil {
 		return err
 	}
 	serverCCAddr := ccConn.LocalAddr().(pan.UDPAddr)
+	srv := newServer(func(clientCCAddr pan.UDPAddr, version bwtest.Version,
+		clientBwp, serverBwp bwtest.Parameters, res chan<- bwtest.Result) (time.Time, error) {
+
+		path := ccSelector.Path(context.Background(), clientCCAddr)
+		return startBwtestBackground(serverCCAddr, clientCCAddr, path, version, clientBwp, serverBwp, res)
+	})
 	for {
 		// Handle client requests
 		n, clientCCAddr, err := ccConn.ReadFrom(receivePacketBuffer)
 		if err != nil {
 			return err
 		}
-		request := receivePacketBuffer[:n]
-		if n < 1 || (request[0] != 'N' && request[0] != 'R') {
-			continue
+		response := srv.handle(receivePacketBuffer[:n], clientCCAddr.(pan.UDPAddr))
+		if response != nil {
+			_, _ = ccConn.WriteTo(response, clientCCAddr)
 		}
+	}
+}
 
-		// Check (non-blocking) for result from test running in background:
-		select {
-		case res := <-currentResult:
-			results.insert(currentBwtest, res)
-			currentBwtest = ""
-			currentBwtestFinish = time.Time{}
-		default:
-		}
+// startFunc starts a bandwidth test in the background, see
+// startBwtestBackground.
+type startFunc func(clientCCAddr pan.UDPAddr, version bwtest.Version,
+	clientBwp, serverBwp bwtest.Parameters, res chan<- bwtest.Result) (time.Time, error)
 
-		clientCCAddrStr := clientCCAddr.String()
-		fmt.Println("Received request:", string(request[0]), clientCCAddrStr)
-
-		if request[0] == 'N' {
-			// New bwtest request
-			if len(currentBwtest) != 0 {
-				fmt.Println("A bwtest is already ongoing", currentBwtest)
-				if clientCCAddrStr == currentBwtest {
-					// The request is from the same client for which the current test is already ongoing
-					// If the response packet was dropped, then the client would send another request
-					// We simply send another response packet, indicating success
-					fmt.Println("clientCCAddrStr == currentBwtest")
-					writeResponseN(ccConn, clientCCAddr, 0)
-				} else {
-					// A bwtest is currently ongoing, so send back remaining duration
-					writeResponseN(ccConn, clientCCAddr, retryWaitTime(currentBwtestFinish))
-				}
-				continue
-			}
+// sessionKey identifies a bandwidth test. Version 1 tests are identified by
+// the client address, version 2 tests by the session ID chosen by the client.
+type sessionKey struct {
+	client  string
+	session bwtest.SessionID
+}
 
-			clientBwp, serverBwp, err := decodeRequestN(request)
-			if err != nil {
-				continue
-			}
-			path := ccSelector.Path(ctx, clientCCAddr.(pan.UDPAddr))
-			finishTime, err := startBwtestBackground(serverCCAddr, clientCCAddr.(pan.UDPAddr), path,
-				clientBwp, serverBwp, currentResult)
-			if err != nil {
-				// Ask the client to try again in 1 second
-				writeResponseN(ccConn, clientCCAddr, 1)
-				continue
-			}
-			currentBwtest = clientCCAddrStr
-			currentBwtestFinish = finishTime
-			// Send back success
-			writeResponseN(ccConn, clientCCAddr, 0)
-		} else if request[0] == 'R' {
-			if clientCCAddrStr == currentBwtest {
-				// test is still ongoing, send back remaining duration
-				writeResponseR(ccConn, clientCCAddr, retryWaitTime(currentBwtestFinish), nil)
-				continue
+func (k sessionKey) String() string {
+	if k.client != "" {
+		return k.client
+	}
+	return "session " + k.session.String()
+}
+
+// server handles the requests on the control connection. It runs a single
+// bandwidth test at a time.
+type server struct {
+	start         startFunc
+	current       sessionKey // the ongoing test, if ongoing
+	ongoing       bool
+	currentFinish time.Time
+	currentResult chan bwtest.Result
+	results       resultsMap
+}
+
+func newServer(start startFunc) *server {
+	return &server{
+		start:         start,
+		currentResult: make(chan bwtest.Result),
+		results:       make(resultsMap),
+	}
+}
+
+// handle handles a request from the client and returns the response, or nil
+// if the request is ignored.
+func (s *server) handle(request []byte, clientCCAddr pan.UDPAddr) []byte {
+	if len(request) < 1 {
+		return nil
+	}
+	// Check (non-blocking) for result from test running in background:
+	select {
+	case res := <-s.currentResult:
+		s.results.insert(s.current, res)
+		s.current = sessionKey{}
+		s.ongoing = false
+		s.currentFinish = time.Time{}
+	default:
+	}
+
+	if bwtest.IsVersion1(request) {
+		return s.handleV1(request, clientCCAddr)
+	}
+	return s.handleV2(request, clientCCAddr)
+}
+
+// handleV1 handles a version 1 request, 'N' or 'R'.
+func (s *server) handleV1(request []byte, clientCCAddr pan.UDPAddr) []byte {
+	clientCCAddrStr := clientCCAddr.String()
+	key := sessionKey{client: clientCCAddrStr}
+	fmt.Println("Received request:", string(request[0]), clientCCAddrStr)
+
+	if request[0] == 'N' {
+		// New bwtest request
+		if s.ongoing {
+			fmt.Println("A bwtest is already ongoing", s.current)
+			if key == s.current {
+				// The request is from the same client for which the current test is already ongoing
+				// If the response packet was dropped, then the client would send another request
+				// We simply send another response packet, indicating success
+				fmt.Println("clientCCAddrStr == currentBwtest")
+				return responseN(0)
 			}
+			// A bwtest is currently ongoing, so send back remaining duration
+			return responseN(retryWaitTime(s.currentFinish))
+		}
+
+		clientBwp, serverBwp, err := decodeRequestN(request)
+		if err != nil {
+			return nil
+		}
+		if err := s.startTest(key, clientCCAddr, bwtest.Version1, clientBwp, serverBwp); err != nil {
+			// Ask the client to try again in 1 second
+			return responseN(1)
+		}
+		// Send back success
+		return responseN(0)
+	}
+
+	if s.ongoing && key == s.current {
+		// test is still ongoing, send back remaining duration
+		return responseR(retryWaitTime(s.currentFinish), nil)
+	}
+	v, ok := s.results[key]
+	if !ok || !bytes.Equal(v.PrgKey, request[1:]) {
+		// There are no results for this client or incorrect PRG, return an error
+		return responseR(127, nil)
+	}
+	return responseR(0, &v.Result)
+}
+
+// handleV2 handles a request of version 2 or later.
+func (s *server) handleV2(request []byte, clientCCAddr pan.UDPAddr) []byte {
+	req, err := bwtest.DecodeRequest(request)
+	if err != nil {
+		return nil
+	}
+	fmt.Println("Received request:", req.Type, req.Session, clientCCAddr)
+	if req.Type == bwtest.MsgHello || req.Version != bwtest.Version2 {
+		// Version handshake; also the response to any request of a later
+		// version, so that the client falls back to this version.
+		return encodeResponse(bwtest.Response{Version: bwtest.Version2, Type: bwtest.MsgHello})
+	}
 
-			v, ok := results[clientCCAddrStr]
-			if !ok || !bytes.Equal(v.PrgKey, request[1:]) {
-				// There are no results for this client or incorrect PRG, return an error
-				writeResponseR(ccConn, clientCCAddr, 127, nil)
-				continue
+	key := sessionKey{session: req.Session}
+	resp := bwtest.Response{Version: bwtest.Version2, Type: req.Type, Session: req.Session}
+	switch req.Type {
+	case bwtest.MsgNewTest:
+		_, finished := s.results[key]
+		switch {
+		case (s.ongoing && key == s.current) || finished:
+			// Retransmitted request, the response was lost
+			resp.Status = bwtest.StatusOK
+		case s.ongoing:
+			resp.Status = bwtest.StatusRetry
+			resp.Wait = retryWaitDuration(s.currentFinish)
+		case validateBwtestParameters(req.ClientBwp) != nil || validateBwtestParameters(req.ServerBwp) != nil:
+			resp.Status = bwtest.StatusInvalid
+		default:
+			err := s.startTest(key, clientCCAddr, bwtest.Version2, req.ClientBwp, req.ServerBwp)
+			if err != nil {
+				resp.Status = bwtest.StatusRetry
+				resp.Wait = time.Second
 			}
-			writeResponseR(ccConn, clientCCAddr, 0, &v.Result)
 		}
+	case bwtest.MsgResult:
+		if s.ongoing && key == s.current {
+			resp.Status = bwtest.StatusRetry
+			resp.Wait = retryWaitDuration(s.currentFinish)
+		} else if v, ok := s.results[key]; ok {
+			resp.Result = v.Result
+		} else {
+			resp.Status = bwtest.StatusNotFound
+		}
+	}
+	return encodeResponse(resp)
+}
+
+func (s *server) startTest(key sessionKey, clientCCAddr pan.UDPAddr, version bwtest.Version,
+	clientBwp, serverBwp bwtest.Parameters) error {
+
+	finishTime, err := s.start(clientCCAddr, version, clientBwp, serverBwp, s.currentResult)
+	if err != nil {
+		return err
 	}
+	s.current = key
+	s.ongoing = true
+	s.currentFinish = finishTime
+	return nil
 }
 
 // startBwtestBackground starts a bandwidth test, in the background.
 // Returns the expected finish time of the test, or any error during the setup.
 func startBwtestBackground(serverCCAddr pan.UDPAddr, clientCCAddr pan.UDPAddr,
-	path *pan.Path, clientBwp, serverBwp bwtest.Parameters, res chan<- bwtest.Result) (time.Time, error) {
+	path *pan.Path, version bwtest.Version, clientBwp, serverBwp bwtest.Parameters,
+	res chan<- bwtest.Result) (time.Time, error) {
 
 	// Data Connection addresses:
 	clientDCAddr := clientCCAddr
@@ -167,11 +318,11 @@ func startBwtestBackground(serverCCAddr pan.UDPAddr, clientCCAddr pan.UDPAddr,
 
 	sendDone := make(chan struct{})
 	go func() {
-		_ = bwtest.HandleDCConnSend(serverBwp, dcConn)
+		_ = bwtest.HandleDCConnSend(serverBwp, version, dcConn)
 		close(sendDone)
 	}()
 	go func() {
-		r := bwtest.HandleDCConnReceive(clientBwp, dcConn)
+		r := bwtest.HandleDCConnReceive(clientBwp, version, dcConn)
 		<-sendDone
 		dcConn.Close()
 		res <- r
@@ -179,23 +330,20 @@ func startBwtestBackground(serverCCAddr pan.UDPAddr, clientCCAddr pan.UDPAddr,
 	return finishTime, nil
 }
 
-// writeResponseN writes the response to an 'N' (new bandwidth test) request.
+// responseN returns the response to an 'N' (new bandwidth test) request.
 // The waitTime field is
 //   - 0:   Ok, the test starts immediately
 //   - N>0: please try again in N seconds
-func writeResponseN(ccConn net.PacketConn, addr net.Addr, waitTime byte) {
-	var response [2]byte
-	response[0] = 'N'
-	response[1] = waitTime
-	_, _ = ccConn.WriteTo(response[:], addr)
+func responseN(waitTime byte) []byte {
+	return []byte{'N', waitTime}
 }
 
-// writeResponseN writes the response to an 'R' (fetch results) request.
+// responseR returns the response to an 'R' (fetch results) request.
 // The code field is
 //   - 0:   Ok, the rest of the response is the encoded result
 //   - N>0: please try again in N seconds
 //   - 127: error, go away (why 127? I guess we have 7-bit bytes or something...)
-func writeResponseR(ccConn net.PacketConn, addr net.Addr, code byte, res *bwtest.Result) {
+func responseR(code byte, res *bwtest.Result) []byte {
 	response := make([]byte, 2000)
 	response[0] = 'R'
 	response[1] = code
@@ -203,7 +351,17 @@ func writeResponseR(ccConn net.PacketConn, addr net.Addr, code byte, res *bwtest
 	if res != nil {
 		n, _ = bwtest.EncodeResult(*res, response[2:])
 	}
-	_, _ = ccConn.WriteTo(response[:2+n], addr)
+	return response[:2+n]
+}
+
+// encodeResponse encodes a version 2 response, or returns nil if it cannot be
+// encoded.
+func encodeResponse(resp bwtest.Response) []byte {
+	buf, err := bwtest.EncodeResponse(resp)
+	if err != nil {
+		return nil
+	}
+	return buf
 }
 
 // retryWaitTime gives back the "encoded" number of seconds for a client to wait until t.
@@ -217,6 +375,12 @@ func retryWaitTime(t time.Time) byte {
 	return byte(remTime/time.Second) + 1
 }
 
+// retryWaitDuration gives back the time for a client to wait until t, in
+// version 2 responses. Clips to at least 100 milliseconds.
+func retryWaitDuration(t time.Time) time.Duration {
+	return max(time.Until(t), 100*time.Millisecond)
+}
+
 // decodeRequestN decodes and checks the bandwidth test parameters contained in
 // an 'N' (new bandwidth test) request.
 func decodeRequestN(request []byte) (clientBwp, serverBwp bwtest.Parameters, err error) {
@@ -245,6 +409,9 @@ func decodeRequestN(request []byte) (clientBwp, serverBwp bwtest.Parameters, err
 }
 
 func validateBwtestParameters(bwp bwtest.Parameters) error {
+	if bwp.BwtestDuration < 0 {
+		return fmt.Errorf("negative duration: %s", bwp.BwtestDuration)
+	}
 	if bwp.BwtestDuration > bwtest.MaxDuration {
 		return fmt.Errorf("duration exceeds max: %s > %s", bwp.BwtestDuration, bwtest.MaxDuration)
 	}
@@ -254,6 +421,9 @@ func validateBwtestParameters(bwp bwtest.Parameters) error {
 	if bwp.PacketSize > bwtest.MaxPacketSize {
 		return fmt.Errorf("packet size exceeds max: %d > %d", bwp.PacketSize, bwtest.MaxPacketSize)
 	}
+	if bwp.NumPackets < 0 {
+		return fmt.Errorf("negative number of packets: %d", bwp.NumPackets)
+	}
 	if bwp.Port < bwtest.MinPort {
 		return fmt.Errorf("invalid port: %d", bwp.Port)
 	}
@@ -268,11 +438,11 @@ type bwtestResultWithExpiry struct {
 	Expiry time.Time
 }
 
-type resultsMap map[string]bwtestResultWithExpiry
+type resultsMap map[sessionKey]bwtestResultWithExpiry
 
-func (r resultsMap) insert(client string, res bwtest.Result) {
+func (r resultsMap) insert(key sessionKey, res bwtest.Result) {
 	r.purgeExpired()
-	r[client] = bwtestResultWithExpiry{
+	r[key] = bwtestResultWithExpiry{
 		Result: res,
 		Expiry: time.Now().Add(resultExpiry),
 	}
@@ -0,0 +1,152 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netsec-ethz/scion-apps/bwtester/bwtest"
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// testServer is a server for which tests are not run, but finished with
+// finish.
+type testServer struct {
+	*server
+	results  chan<- bwtest.Result
+	versions []bwtest.Version
+}
+
+func newTestServer() *testServer {
+	ts := &testServer{}
+	ts.server = newServer(func(clientCCAddr pan.UDPAddr, version bwtest.Version,
+		clientBwp, serverBwp bwtest.Parameters, res chan<- bwtest.Result) (time.Time, error) {
+
+		ts.results = res
+		ts.versions = append(ts.versions, version)
+		return time.Now().Add(clientBwp.BwtestDuration), nil
+	})
+	return ts
+}
+
+// finish finishes the ongoing test with the result.
+func (ts *testServer) finish(res bwtest.Result) {
+	go func() { ts.results <- res }()
+	for ts.ongoing {
+		ts.handle([]byte{'X'}, pan.UDPAddr{}) // ignored request to collect the result
+	}
+}
+
+func testParameters(port uint16) bwtest.Parameters {
+	return bwtest.Parameters{
+		BwtestDuration: 3 * time.Second,
+		PacketSize:     1000,
+		NumPackets:     30,
+		PrgKey:         bytes.Repeat([]byte{byte(port)}, 16),
+		Port:           port,
+	}
+}
+
+func TestServerV2(t *testing.T) {
+	ts := newTestServer()
+	client := pan.MustParseUDPAddr("1-ff00:0:110,10.0.0.1:40001")
+	other := pan.MustParseUDPAddr("1-ff00:0:111,10.0.0.2:40001")
+
+	request := func(req bwtest.Request, from pan.UDPAddr) bwtest.Response {
+		t.Helper()
+		if req.Version == 0 {
+			req.Version = bwtest.Version2
+		}
+		buf, err := bwtest.EncodeRequest(req)
+		require.NoError(t, err)
+		resp, err := bwtest.DecodeResponse(ts.handle(buf, from))
+		require.NoError(t, err)
+		return resp
+	}
+	newTest := func(session bwtest.SessionID) bwtest.Request {
+		return bwtest.Request{
+			Type:      bwtest.MsgNewTest,
+			Session:   session,
+			ClientBwp: testParameters(40001),
+			ServerBwp: testParameters(40002),
+		}
+	}
+
+	hello := request(bwtest.Request{Version: 3, Type: bwtest.MsgHello}, client)
+	assert.Equal(t, bwtest.Response{Version: bwtest.Version2, Type: bwtest.MsgHello}, hello)
+	hello = request(bwtest.Request{Version: 3, Type: bwtest.MsgResult, Session: 1}, client)
+	assert.Equal(t, bwtest.MsgHello, hello.Type, "later version")
+
+	resp := request(newTest(1), client)
+	assert.Equal(t, bwtest.StatusOK, resp.Status)
+	assert.Equal(t, bwtest.SessionID(1), resp.Session)
+	assert.Equal(t, []bwtest.Version{bwtest.Version2}, ts.versions)
+	resp = request(newTest(1), other)
+	assert.Equal(t, bwtest.StatusOK, resp.Status, "retransmitted, from other address")
+	resp = request(newTest(2), client)
+	assert.Equal(t, bwtest.StatusRetry, resp.Status, "busy")
+	assert.Greater(t, resp.Wait, 2*time.Second)
+	resp = request(bwtest.Request{Type: bwtest.MsgResult, Session: 1}, client)
+	assert.Equal(t, bwtest.StatusRetry, resp.Status, "ongoing")
+
+	// version 1 request during version 2 test
+	v1Response := ts.handle([]byte{'R'}, client)
+	assert.Equal(t, []byte{'R', 127}, v1Response)
+
+	result := bwtest.Result{NumPacketsReceived: 30, CorrectlyReceived: 30}
+	ts.finish(result)
+	resp = request(bwtest.Request{Type: bwtest.MsgResult, Session: 1}, other)
+	assert.Equal(t, bwtest.StatusOK, resp.Status)
+	assert.Equal(t, result, resp.Result)
+	resp = request(bwtest.Request{Type: bwtest.MsgResult, Session: 2}, client)
+	assert.Equal(t, bwtest.StatusNotFound, resp.Status)
+
+	invalid := newTest(2)
+	invalid.ClientBwp.BwtestDuration = time.Hour
+	resp = request(invalid, client)
+	assert.Equal(t, bwtest.StatusInvalid, resp.Status)
+	assert.Len(t, ts.versions, 1)
+}
+
+func TestServerV1(t *testing.T) {
+	ts := newTestServer()
+	client := pan.MustParseUDPAddr("1-ff00:0:110,10.0.0.1:40001")
+
+	clientBwp, serverBwp := testParameters(40001), testParameters(40002)
+	request := make([]byte, 2000)
+	request[0] = 'N'
+	nc, err := bwtest.EncodeParameters(clientBwp, request[1:])
+	require.NoError(t, err)
+	ns, err := bwtest.EncodeParameters(serverBwp, request[1+nc:])
+	require.NoError(t, err)
+	request = request[:1+nc+ns]
+
+	assert.Equal(t, []byte{'N', 0}, ts.handle(request, client))
+	assert.Equal(t, []bwtest.Version{bwtest.Version1}, ts.versions)
+	assert.Equal(t, []byte{'N', 0}, ts.handle(request, client), "retransmitted")
+
+	result := bwtest.Result{NumPacketsReceived: 30, CorrectlyReceived: 29, PrgKey: clientBwp.PrgKey}
+	ts.finish(result)
+	response := ts.handle(append([]byte{'R'}, clientBwp.PrgKey...), client)
+	require.Equal(t, []byte{'R', 0}, response[:2])
+	decoded, _, err := bwtest.DecodeResult(response[2:])
+	require.NoError(t, err)
+	assert.Equal(t, result, decoded)
+}
@@ -0,0 +1,103 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/netip"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsec-ethz/scion-apps/pkg/quicutil"
+)
+
+var (
+	datagramNextProtos = []string{quicutil.DatagramProto}
+)
+
+// datagramWriter splits writes into datagrams of at most the maximum datagram
+// size of the connection. io.Copy writes chunks of up to 32KiB.
+type datagramWriter struct {
+	*quicutil.DatagramConn
+}
+
+func (w datagramWriter) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n := min(len(b)-written, w.MaxDatagramSize())
+		if _, err := w.DatagramConn.Write(b[written : written+n]); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// DoListenQUICDatagram listens on a QUIC socket, exchanging data in QUIC datagrams
+func DoListenQUICDatagram(port uint16) (chan io.ReadWriteCloser, error) {
+	certs, err := serverCertificates()
+	if err != nil {
+		return nil, err
+	}
+	quicListener, err := pan.ListenQUIC(
+		context.Background(),
+		netip.AddrPortFrom(netip.Addr{}, port),
+		&tls.Config{
+			Certificates: certs,
+			NextProtos:   datagramNextProtos,
+		},
+		&quic.Config{KeepAlivePeriod: 15 * time.Second, EnableDatagrams: true},
+	)
+	if err != nil {
+		return nil, err
+	}
+	listener := quicutil.DatagramListener{QUICListener: quicListener}
+
+	conns := make(chan io.ReadWriteCloser)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				logError("Can't accept", "err", err)
+				continue
+			}
+			conns <- datagramWriter{conn.(*quicutil.DatagramConn)}
+		}
+	}()
+
+	return conns, nil
+}
+
+// DoDialQUICDatagram dials with a QUIC socket, exchanging data in QUIC datagrams
+func DoDialQUICDatagram(remote string, policy pan.Policy) (io.ReadWriteCloser, error) {
+	tlsCfg, err := clientTLSConfig(datagramNextProtos)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &pan.Dialer{
+		Policy:     policy,
+		TLSConfig:  tlsCfg,
+		QUICConfig: &quic.Config{KeepAlivePeriod: 15 * time.Second},
+	}
+	conn, err := dialer.DialContext(context.Background(), "quic-datagram", remote)
+	if err != nil {
+		return nil, err
+	}
+	return datagramWriter{conn.(*quicutil.DatagramConn)}, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netsec-ethz/scion-apps/pkg/quicutil"
+)
+
+// datagramRecorder is a QUIC connection recording the datagrams sent, with a
+// limit on the datagram size.
+type datagramRecorder struct {
+	net.Conn  // not implemented
+	maxSize   int
+	datagrams [][]byte
+}
+
+func (r *datagramRecorder) SendDatagram(b []byte) error {
+	if len(b) > r.maxSize {
+		return &quic.DatagramTooLargeError{MaxDatagramPayloadSize: int64(r.maxSize)}
+	}
+	r.datagrams = append(r.datagrams, append([]byte(nil), b...))
+	return nil
+}
+
+func (r *datagramRecorder) ReceiveDatagram(context.Context) ([]byte, error) {
+	panic("not implemented")
+}
+
+func (r *datagramRecorder) ConnectionState() quic.ConnectionState {
+	return quic.ConnectionState{SupportsDatagrams: true}
+}
+
+func (r *datagramRecorder) CloseWithError(quic.ApplicationErrorCode, string) error {
+	return nil
+}
+
+func TestDatagramWriter(t *testing.T) {
+	recorder := &datagramRecorder{maxSize: 1000}
+	conn, err := quicutil.NewDatagramConn(recorder)
+	require.NoError(t, err)
+	w := datagramWriter{conn}
+
+	// the first write learns the size limit from the failed datagram
+	_, err = w.Write(make([]byte, 1100))
+	var tooLarge *quic.DatagramTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, 1000, conn.MaxDatagramSize())
+
+	data := bytes.Repeat([]byte("0123456789"), 250)
+	n, err := w.Write(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	require.Len(t, recorder.datagrams, 3)
+	assert.Len(t, recorder.datagrams[0], 1000)
+	assert.Len(t, recorder.datagrams[1], 1000)
+	assert.Len(t, recorder.datagrams[2], 500)
+	assert.Equal(t, data, bytes.Join(recorder.datagrams, nil))
+}
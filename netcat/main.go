@@ -33,7 +33,12 @@ var (
 	extraByte bool
 	listen    bool
 
-	udpMode bool
+	udpMode      bool
+	datagramMode bool
+
+	pin            bool
+	knownHostsFile string
+	keyFile        string
 
 	repeatAfter             bool
 	repeatDuring            bool
@@ -45,6 +50,7 @@ var (
 	verboseMode bool
 
 	interactive bool
+	pathChoice  string
 	sequence    string
 	preference  string
 )
@@ -66,7 +72,11 @@ func printUsage() {
 	fmt.Println("  -q: after EOF on stdin, wait the specified duration and then quit. Implies -N.")
 	fmt.Println("  -c: Instead of piping the connection to stdin/stdout, run the given command using /bin/sh")
 	fmt.Println("  -u: UDP mode")
+	fmt.Println("  -datagram: QUIC datagram mode; data is sent in unreliable, encrypted QUIC datagrams. Incompatible with -u flag")
 	fmt.Println("  -b: Send or expect an extra (throw-away) byte before the actual data")
+	fmt.Println("  -pin: Verify the server key, pinning it on first use (trust on first use). Not supported with -u flag")
+	fmt.Println("  -known-hosts: Trust store file for -pin, instead of the default file. Implies -pin")
+	fmt.Println("  -key: Persistent private key file of the server, generated if it does not exist. Requires -l flag")
 	fmt.Println("  -v: Enable verbose mode")
 }
 
@@ -75,12 +85,18 @@ func main() {
 	flag.BoolVar(&extraByte, "b", false, "Expect extra byte")
 	flag.BoolVar(&listen, "l", false, "Listen mode")
 	flag.BoolVar(&udpMode, "u", false, "UDP mode")
+	flag.BoolVar(&datagramMode, "datagram", false, "QUIC datagram mode")
+	flag.BoolVar(&pin, "pin", false, "Verify the server key, pinning it on first use")
+	flag.StringVar(&knownHostsFile, "known-hosts", "", "Trust store file for -pin. Implies -pin")
+	flag.StringVar(&keyFile, "key", "", "Persistent private key file of the server")
 	flag.BoolVar(&repeatAfter, "k", false, "Accept new connections after connection end")
 	flag.BoolVar(&repeatDuring, "K", false, "Accept multiple connections concurrently")
 	flag.BoolVar(&shutdownAfterEOF, "N", false, "Shutdown the network socket after EOF on the input.")
 	flag.DurationVar(&shutdownAfterEOFTimeout, "q", 0, "After EOF on stdin, wait the specified number of seconds and then quit. Implies -N.")
 	flag.StringVar(&commandString, "c", "", "Command")
 	flag.BoolVar(&interactive, "interactive", false, "Prompt user for interactive path selection")
+	flag.StringVar(&pathChoice, "path-choice", "", "Paths to use instead of prompting, as path indices "+
+		"(e.g. \"0 2-3\") or sequence of hop predicates. Implies -interactive")
 	flag.StringVar(&sequence, "sequence", "", "Sequence of space separated hop predicates to specify path")
 	flag.StringVar(&preference, "preference", "", "Preference sorting order for paths. "+
 		"Comma-separated list of available sorting options: "+
@@ -106,6 +122,15 @@ func main() {
 	if repeatDuring && !listen {
 		log.Fatalf("-K flag requires -l flag!")
 	}
+	if udpMode && datagramMode {
+		log.Fatalf("-u and -datagram flags are exclusive!")
+	}
+	if udpMode && (pin || knownHostsFile != "" || keyFile != "") {
+		log.Fatalf("-pin, -known-hosts and -key flags are not supported in UDP mode!")
+	}
+	if keyFile != "" && !listen {
+		log.Fatalf("-key flag requires -l flag!")
+	}
 	if repeatAfter && udpMode && commandString == "" {
 		log.Fatalf("-k flag in UDP mode requires -c flag!")
 	}
@@ -127,7 +152,7 @@ func main() {
 		}
 	} else {
 		remoteAddr := tail[0]
-		policy, err := pan.PolicyFromCommandline(sequence, preference, interactive)
+		policy, err := pan.PolicyFromCommandlineWithChoice(sequence, preference, interactive, pathChoice)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -256,6 +281,8 @@ func doDial(remoteAddr string, policy pan.Policy) (io.ReadWriteCloser, error) {
 	var err error
 	if udpMode {
 		conn, err = DoDialUDP(remoteAddr, policy)
+	} else if datagramMode {
+		conn, err = DoDialQUICDatagram(remoteAddr, policy)
 	} else {
 		conn, err = DoDialQUIC(remoteAddr, policy)
 	}
@@ -280,6 +307,8 @@ func doListen(port uint16) (chan io.ReadWriteCloser, error) {
 	var err error
 	if udpMode {
 		conns, err = DoListenUDP(port)
+	} else if datagramMode {
+		conns, err = DoListenQUICDatagram(port)
 	} else {
 		conns, err = DoListenQUIC(port)
 	}
@@ -28,16 +28,59 @@ import (
 )
 
 var (
-	nextProtos = []string{quicutil.SingleStreamProto}
+	nextProtos = quicutil.SingleStreamProtos
 )
 
+// clientTLSConfig returns the TLS configuration for dialing. Unless a trust
+// store is configured (-pin), the server certificate is not verified.
+func clientTLSConfig(nextProtos []string) (*tls.Config, error) {
+	tlsCfg := &tls.Config{InsecureSkipVerify: true}
+	if pin || knownHostsFile != "" {
+		path := knownHostsFile
+		if path == "" {
+			var err error
+			if path, err = quicutil.DefaultTrustStorePath(); err != nil {
+				return nil, err
+			}
+		}
+		store, err := quicutil.LoadTrustStore(path)
+		if err != nil {
+			return nil, err
+		}
+		store.ConfirmNewHost = func(host, fingerprint string) bool {
+			logDebug("Pinning key of new host", "host", host, "fingerprint", fingerprint, "file", path)
+			return true
+		}
+		tlsCfg = store.TLSConfig()
+	}
+	tlsCfg.NextProtos = nextProtos
+	return tlsCfg, nil
+}
+
+// serverCertificates returns the certificate for listening, for the
+// persistent key (-key) if configured.
+func serverCertificates() ([]tls.Certificate, error) {
+	if keyFile == "" {
+		return quicutil.MustGenerateSelfSignedCert(), nil
+	}
+	cert, err := quicutil.LoadOrGenerateSelfSignedCert(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return []tls.Certificate{*cert}, nil
+}
+
 // DoListenQUIC listens on a QUIC socket
 func DoListenQUIC(port uint16) (chan io.ReadWriteCloser, error) {
+	certs, err := serverCertificates()
+	if err != nil {
+		return nil, err
+	}
 	quicListener, err := pan.ListenQUIC(
 		context.Background(),
 		netip.AddrPortFrom(netip.Addr{}, port),
 		&tls.Config{
-			Certificates: quicutil.MustGenerateSelfSignedCert(),
+			Certificates: certs,
 			NextProtos:   nextProtos,
 		},
 		&quic.Config{KeepAlivePeriod: 15 * time.Second},
@@ -45,7 +88,7 @@ func DoListenQUIC(port uint16) (chan io.ReadWriteCloser, error) {
 	if err != nil {
 		return nil, err
 	}
-	listener := quicutil.SingleStreamListener{QUICListener: quicListener}
+	listener := &quicutil.SingleStreamListener{QUICListener: quicListener}
 
 	conns := make(chan io.ReadWriteCloser)
 	go func() {
@@ -65,25 +108,14 @@ func DoListenQUIC(port uint16) (chan io.ReadWriteCloser, error) {
 
 // DoDialQUIC dials with a QUIC socket
 func DoDialQUIC(remote string, policy pan.Policy) (io.ReadWriteCloser, error) {
-	remoteAddr, err := pan.ResolveUDPAddr(context.TODO(), remote)
+	tlsCfg, err := clientTLSConfig(nextProtos)
 	if err != nil {
 		return nil, err
 	}
-	sess, err := pan.DialQUIC(
-		context.Background(),
-		netip.AddrPort{},
-		remoteAddr,
-		pan.MangleSCIONAddr(remote),
-		&tls.Config{
-			InsecureSkipVerify: true,
-			NextProtos:         nextProtos,
-		},
-		&quic.Config{KeepAlivePeriod: 15 * time.Second},
-		pan.WithPolicy(policy),
-	)
-	if err != nil {
-		return nil, err
+	dialer := &pan.Dialer{
+		Policy:     policy,
+		TLSConfig:  tlsCfg,
+		QUICConfig: &quic.Config{KeepAlivePeriod: 15 * time.Second},
 	}
-
-	return quicutil.NewSingleStream(sess)
+	return dialer.DialContext(context.Background(), "quic", remote)
 }
@@ -141,7 +141,7 @@ func DefaultIAPairs() []sintegration.IAPair {
 			}
 			if !has64 && is6(p.Src) && is4(p.Dst) {
 				filtered = append(filtered, p)
-				has46 = true
+				has64 = true
 			}
 			if !has66 && is6(p.Src) && is6(p.Dst) {
 				filtered = append(filtered, p)
@@ -217,6 +217,8 @@ func getSCIONDAddress(ia addr.IA) (addr string, err error) {
 	return sintegration.GetSCIONDAddress(sintegration.GenFile(sintegration.SCIONDAddressesFile), ia)
 }
 
+// defaultLocalIPAddress returns the local IP over which the control service
+// or, e.g. on an IPv6-only host, any of the border routers are reached.
 func defaultLocalIPAddress(sciondAddress string) (net.IP, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
@@ -228,7 +230,22 @@ func defaultLocalIPAddress(sciondAddress string) (net.IP, error) {
 	if err != nil {
 		return nil, err
 	}
-	return addrutil.ResolveLocal(hostInLocalAS)
+	interfaces, err := sciondConn.Interfaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []net.IP{hostInLocalAS}
+	for _, a := range interfaces {
+		candidates = append(candidates, a.Addr().AsSlice())
+	}
+	for _, c := range candidates {
+		var localIP net.IP
+		localIP, err = addrutil.ResolveLocal(c)
+		if err == nil {
+			return localIP, nil
+		}
+	}
+	return nil, err
 }
 
 func connSciond(ctx context.Context, sciondAddress string) (daemon.Connector, error) {
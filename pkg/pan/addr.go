@@ -19,6 +19,7 @@ import (
 	"net"
 	"net/netip"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/scionproto/scion/pkg/addr"
@@ -207,39 +208,82 @@ func mustParseSCIONAddr(s string) scionAddr {
 }
 
 var (
-	hostPortRegexp = regexp.MustCompile(`^((?:[-.\da-zA-Z]+)|(?:\d+-[\d:A-Fa-f]+,(?:\[[^\]]+\]|[^\[\]:]+))):(\d+)$`)
+	hostPortRegexp = regexp.MustCompile(`^(?:\[(\d+-[\d:A-Fa-f]+,[^\[\]]+)\]|((?:[-.\da-zA-Z]+)|(?:\d+-[\d:A-Fa-f]+,(?:\[[^\]]+\]|[^\[\]:]+)))):(\d+)$`)
 )
 
 const (
-	hostPortRegexpHostIndex = 1
-	hostPortRegexpPortIndex = 2
+	hostPortRegexpBracketedHostIndex = 1
+	hostPortRegexpHostIndex          = 2
+	hostPortRegexpPortIndex          = 3
 )
 
 // SplitHostPort splits a host:port string into host and port variables.
 // This is analogous to net.SplitHostPort, which however refuses to handle SCION addresses.
-// The address can be of the form of a SCION address (i.e. of the form "ISD-AS,[IP]:port")
-// or in the form of "hostname:port".
+// The address can be of the form of a SCION address (i.e. of the form "ISD-AS,[IP]:port"
+// or "[ISD-AS,IP]:port") or in the form of "hostname:port".
+// As in net.SplitHostPort, the brackets enclosing the entire host are removed.
 func SplitHostPort(hostport string) (host, port string, err error) {
 	match := hostPortRegexp.FindStringSubmatch(hostport)
 	if match != nil {
-		return match[hostPortRegexpHostIndex], match[hostPortRegexpPortIndex], nil
+		host = match[hostPortRegexpHostIndex]
+		if host == "" {
+			host = match[hostPortRegexpBracketedHostIndex]
+		}
+		return host, match[hostPortRegexpPortIndex], nil
 	}
 	return "", "", fmt.Errorf("pan.SplitHostPort: invalid address (%q)", hostport)
 }
 
 // MangleSCIONAddr mangles a SCION address string (if it is one) so it can be
 // safely used in the host part of a URL.
+//
+// A URL host can only be enclosed in brackets if it is an IPv6 address, and
+// otherwise it must not contain any colons (RFC 3986, §3.2.2). The colons in
+// the ISD-AS and the IP are therefore replaced with underscores, e.g.
+// "1-ff00:0:110,[::1]:80" is mangled to "1-ff00_0_110,__1:80".
+// UnmangleSCIONAddr reverts this.
 func MangleSCIONAddr(address string) string {
-	raddr, err := snet.ParseUDPAddr(address)
+	raddr, err := ParseUDPAddr(address)
 	if err != nil {
 		return address
 	}
 
-	// Turn this into [IA,IP]:port format. This is a valid host in a URI, as per
-	// the "IP-literal" case in RFC 3986, §3.2.2.
-	mangledAddr := fmt.Sprintf("[%s,%s]", raddr.IA, raddr.Host.IP)
-	if raddr.Host.Port != 0 {
-		mangledAddr += fmt.Sprintf(":%d", raddr.Host.Port)
+	mangledAddr := strings.ReplaceAll(raddr.scionAddr().String(), ":", "_")
+	if raddr.Port != 0 {
+		mangledAddr += fmt.Sprintf(":%d", raddr.Port)
 	}
 	return mangledAddr
 }
+
+var (
+	mangledAddrRegexp = regexp.MustCompile(`^(\d+-[_\dA-Fa-f]+,[_.\dA-Fa-f]+)(?::(\d+))?$`)
+)
+
+const (
+	mangledAddrRegexpAddrIndex = 1
+	mangledAddrRegexpPortIndex = 2
+)
+
+// UnmangleSCIONAddr reverts MangleSCIONAddr, for a mangled SCION address with
+// an optional port, such as the address passed to the DialContext function of
+// a net/http.Transport. The result can be parsed with ParseUDPAddr.
+// Any other address, e.g. a hostname, is returned unchanged.
+func UnmangleSCIONAddr(address string) string {
+	match := mangledAddrRegexp.FindStringSubmatch(address)
+	if match == nil {
+		return address
+	}
+	a, err := parseSCIONAddr(strings.ReplaceAll(match[mangledAddrRegexpAddrIndex], "_", ":"))
+	if err != nil {
+		return address
+	}
+	portStr := match[mangledAddrRegexpPortIndex]
+	if portStr == "" {
+		return a.String()
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return address
+	}
+	return a.WithPort(uint16(port)).String()
+}
@@ -45,3 +45,64 @@ func TestUDPAddrIsValid(t *testing.T) {
 		assert.Equal(t, c.isValid, withPort.IsValid(), fmt.Sprintf("%s IsValid?", withPort))
 	}
 }
+
+func TestParseUDPAddr(t *testing.T) {
+	ia := pan.MustParseIA("1-ff00:0:110")
+	cases := []struct {
+		input     string
+		assertErr assert.ErrorAssertionFunc
+		expected  pan.UDPAddr
+	}{
+		{"1-ff00:0:110,127.0.0.1:80", assert.NoError, pan.UDPAddr{IA: ia, IP: netip.MustParseAddr("127.0.0.1"), Port: 80}},
+		{"1-ff00:0:110,[127.0.0.1]:80", assert.NoError, pan.UDPAddr{IA: ia, IP: netip.MustParseAddr("127.0.0.1"), Port: 80}},
+		{"[1-ff00:0:110,127.0.0.1]:80", assert.NoError, pan.UDPAddr{IA: ia, IP: netip.MustParseAddr("127.0.0.1"), Port: 80}},
+		{"1-ff00:0:110,[::1]:80", assert.NoError, pan.UDPAddr{IA: ia, IP: netip.MustParseAddr("::1"), Port: 80}},
+		{"[1-ff00:0:110,::1]:80", assert.NoError, pan.UDPAddr{IA: ia, IP: netip.MustParseAddr("::1"), Port: 80}},
+		{"1-ff00:0:110,[2001:db8::1]:443", assert.NoError, pan.UDPAddr{IA: ia, IP: netip.MustParseAddr("2001:db8::1"), Port: 443}},
+		{"1-ff00:0:110,[::1]", assert.NoError, pan.UDPAddr{IA: ia, IP: netip.MustParseAddr("::1")}},
+		{"1-ff00:0:110,::1", assert.NoError, pan.UDPAddr{IA: ia, IP: netip.MustParseAddr("::1")}},
+		{"1-ff00:0:110,[::ffff:127.0.0.1]:80", assert.NoError, pan.UDPAddr{IA: ia, IP: netip.MustParseAddr("127.0.0.1"), Port: 80}},
+		{"[1-ff00:0:110,::1]", assert.Error, pan.UDPAddr{}},
+		{"1-ff00:0:110,[::1", assert.Error, pan.UDPAddr{}},
+		{"[::1]:80", assert.Error, pan.UDPAddr{}},
+	}
+	for _, c := range cases {
+		actual, err := pan.ParseUDPAddr(c.input)
+		if !c.assertErr(t, err, "input '%s'", c.input) {
+			continue
+		}
+		assert.Equal(t, c.expected, actual, "bad result for input '%s'", c.input)
+		if err == nil {
+			roundTrip, err := pan.ParseUDPAddr(actual.String())
+			assert.NoError(t, err)
+			assert.Equal(t, actual, roundTrip, "String() not parsed back for input '%s'", c.input)
+		}
+	}
+}
+
+func TestMangleSCIONAddr(t *testing.T) {
+	cases := []struct {
+		input     string
+		mangled   string
+		unmangled string
+	}{
+		{"foo", "foo", "foo"},
+		{"foo:80", "foo:80", "foo:80"},
+		{"[::1]:80", "[::1]:80", "[::1]:80"},
+		{"1-ff00:0:110,127.0.0.1", "1-ff00_0_110,127.0.0.1", "1-ff00:0:110,127.0.0.1"},
+		{"1-ff00:0:110,127.0.0.1:80", "1-ff00_0_110,127.0.0.1:80", "1-ff00:0:110,127.0.0.1:80"},
+		{"[1-ff00:0:110,127.0.0.1]:80", "1-ff00_0_110,127.0.0.1:80", "1-ff00:0:110,127.0.0.1:80"},
+		{"1-ff00:0:110,::1", "1-ff00_0_110,__1", "1-ff00:0:110,::1"},
+		{"1-ff00:0:110,[::1]:80", "1-ff00_0_110,__1:80", "1-ff00:0:110,[::1]:80"},
+		{"[1-ff00:0:110,::1]:80", "1-ff00_0_110,__1:80", "1-ff00:0:110,[::1]:80"},
+		{"1-ff00:0:110,[2001:db8::1]:80", "1-ff00_0_110,2001_db8__1:80", "1-ff00:0:110,[2001:db8::1]:80"},
+		{"1-64512,10.0.0.1:80", "1-64512,10.0.0.1:80", "1-64512,10.0.0.1:80"},
+	}
+	for _, c := range cases {
+		mangled := pan.MangleSCIONAddr(c.input)
+		assert.Equal(t, c.mangled, mangled, "bad mangled address for input '%s'", c.input)
+		assert.Equal(t, c.unmangled, pan.UnmangleSCIONAddr(mangled), "bad unmangled address for input '%s'", c.input)
+	}
+	assert.Equal(t, "1-ff00_0_110,__1:99999", pan.UnmangleSCIONAddr("1-ff00_0_110,__1:99999"), "invalid port")
+	assert.Equal(t, "1-ff00_0_110,1_2:80", pan.UnmangleSCIONAddr("1-ff00_0_110,1_2:80"), "invalid IP")
+}
@@ -0,0 +1,736 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/private/common"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/slayers/path/empty"
+	"github.com/scionproto/scion/pkg/slayers/path/scion"
+	"github.com/scionproto/scion/pkg/snet"
+	snetpath "github.com/scionproto/scion/pkg/snet/path"
+	"github.com/scionproto/scion/private/topology/underlay"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Message is a single datagram for the batched I/O operations ReadBatch and
+// WriteBatch.
+type Message struct {
+	// Buffer is the payload to send with WriteBatch, or the buffer to read the
+	// payload into with ReadBatch.
+	Buffer []byte
+	// N is the number of payload bytes read, set by ReadBatch.
+	N int
+	// Addr is the remote address. Set by ReadBatch on a ListenConn and required
+	// for WriteBatch on a ListenConn. Ignored on a Conn.
+	Addr UDPAddr
+	// Path is the path via which the message was received, reversed, i.e. the
+	// path to reply on. Only set by ReadBatch on a ListenConn.
+	Path *Path
+}
+
+const (
+	// maxBatchSize is the maximum number of packets passed to the kernel in
+	// a single sendmmsg/recvmmsg call.
+	maxBatchSize = 64
+	// maxGROBatchSize is the maximum number of buffers passed to recvmmsg if
+	// GRO is enabled. Each buffer may hold many coalesced packets.
+	maxGROBatchSize = 8
+	// maxHeaderCacheEntries bounds the number of cached packet headers per
+	// connection. The cache is simply reset when this is exceeded.
+	maxHeaderCacheEntries = 64
+	// groBufferSize is the size of the receive buffers if GRO is enabled, large
+	// enough for the biggest coalesced packet.
+	groBufferSize = 65535
+)
+
+// packetBufferPool pools buffers for serialized packets.
+var packetBufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, common.SupportedMTU)
+		return &b
+	},
+}
+
+// groBufferPool pools receive buffers for coalesced packets.
+var groBufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, groBufferSize)
+		return &b
+	},
+}
+
+// batchConn is the kernel interface for batched I/O, implemented by
+// golang.org/x/net/ipv4.PacketConn and ipv6.PacketConn. On Linux, these use
+// recvmmsg and sendmmsg; on other platforms, they process a single message
+// per call.
+type batchConn interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// fastPath provides direct access to the UDP socket underlying a
+// snet.SCIONPacketConn, for sending and receiving pre-serialized packets.
+type fastPath struct {
+	conn     *net.UDPConn
+	batch    batchConn
+	scmp     snet.SCMPHandler
+	topology snet.Topology
+
+	gsoMutex sync.Mutex
+	gso      bool
+
+	// gro is set if the kernel may coalesce received packets. pending holds
+	// the packets received but not returned by the previous read, either
+	// split off a coalesced buffer that did not fit, or following an SCMP
+	// error. pendingErr is the SCMP error to return after the packets
+	// preceding it. All are protected by the readMutex of the baseUDPConn.
+	gro        bool
+	pending    []pendingPacket
+	pendingErr error
+	// scratch space for readBatch, also protected by the readMutex.
+	readBufs []*[]byte
+	readIn   []batchIn
+	readMsgs []ipv4.Message
+
+	headersMutex sync.Mutex
+	headers      map[packetHeaderKey]*packetHeader
+}
+
+func newFastPath(raw snet.PacketConn) *fastPath {
+	sc, ok := raw.(*snet.SCIONPacketConn)
+	if !ok || sc.Conn == nil {
+		return nil
+	}
+	var batch batchConn
+	if local, ok := sc.Conn.LocalAddr().(*net.UDPAddr); ok && local.IP.To4() != nil {
+		batch = ipv4.NewPacketConn(sc.Conn)
+	} else {
+		batch = ipv6.NewPacketConn(sc.Conn)
+	}
+	return &fastPath{
+		conn:     sc.Conn,
+		batch:    batch,
+		scmp:     sc.SCMPHandler,
+		topology: sc.Topology,
+		gso:      gsoSupported(sc.Conn),
+		gro:      enableGRO(sc.Conn),
+		headers:  make(map[packetHeaderKey]*packetHeader),
+	}
+}
+
+// fastPath returns the fastPath for this connection, or nil if the raw
+// connection does not allow direct socket access.
+// Once the fastPath is created, the socket must only be read via the fastPath,
+// as received packets may be coalesced.
+func (c *baseUDPConn) fastPath() *fastPath {
+	c.fastPathOnce.Do(func() {
+		c.fast = newFastPath(c.raw)
+	})
+	return c.fast
+}
+
+type packetHeaderKey struct {
+	src, dst UDPAddr
+	path     *Path
+}
+
+// packetHeader is a pre-serialized SCION/UDP header for a fixed source,
+// destination and path. Building a packet from it only requires updating the
+// length fields and the checksum.
+type packetHeader struct {
+	raw []byte
+	// scionLen is the length of the SCION header, i.e. the offset of the UDP
+	// header in raw.
+	scionLen int
+	// pseudoSum is the partial checksum over the addresses of the pseudo header.
+	pseudoSum uint32
+}
+
+// header returns the cached packetHeader for the given src, dst and path,
+// serializing a new one if necessary.
+func (f *fastPath) header(src, dst UDPAddr, path *Path) (*packetHeader, error) {
+	key := packetHeaderKey{src: src, dst: dst, path: path}
+	f.headersMutex.Lock()
+	h, ok := f.headers[key]
+	f.headersMutex.Unlock()
+	if ok {
+		return h, nil
+	}
+
+	h, err := newPacketHeader(src, dst, path)
+	if err != nil {
+		return nil, err
+	}
+	f.headersMutex.Lock()
+	if len(f.headers) >= maxHeaderCacheEntries {
+		f.headers = make(map[packetHeaderKey]*packetHeader)
+	}
+	f.headers[key] = h
+	f.headersMutex.Unlock()
+	return h, nil
+}
+
+func newPacketHeader(src, dst UDPAddr, path *Path) (*packetHeader, error) {
+	var dataplanePath snet.DataplanePath = snetpath.Empty{}
+	if path != nil {
+		dataplanePath = path.ForwardingPath.dataplanePath
+	}
+	pkt := &snet.Packet{
+		PacketInfo: snet.PacketInfo{
+			Source:      snet.SCIONAddress{IA: addr.IA(src.IA), Host: addr.HostIP(src.IP)},
+			Destination: snet.SCIONAddress{IA: addr.IA(dst.IA), Host: addr.HostIP(dst.IP)},
+			Path:        dataplanePath,
+			Payload: snet.UDPPayload{
+				SrcPort: src.Port,
+				DstPort: dst.Port,
+			},
+		},
+	}
+	if err := pkt.Serialize(); err != nil {
+		return nil, err
+	}
+	raw := append([]byte(nil), pkt.Bytes...)
+	scionLen := int(raw[5]) * 4
+	if scionLen+8 != len(raw) {
+		return nil, errors.New("unexpected SCION header length")
+	}
+	// The addresses (IAs and hosts) start at offset 12 and are followed by the
+	// path. Host address lengths are encoded as multiples of 4 bytes.
+	dstHostLen := 4 * (int(raw[9]>>4&0x3) + 1)
+	srcHostLen := 4 * (int(raw[9]&0x3) + 1)
+	addrEnd := 12 + 16 + dstHostLen + srcHostLen
+	return &packetHeader{
+		raw:       raw,
+		scionLen:  scionLen,
+		pseudoSum: checksumAdd(0, raw[12:addrEnd]),
+	}, nil
+}
+
+// build writes the full packet for the payload b into buf and returns the
+// slice of buf containing the packet.
+func (h *packetHeader) build(buf, b []byte) ([]byte, error) {
+	n := len(h.raw) + len(b)
+	if n > len(buf) {
+		return nil, errors.New("packet size is bigger than max possible value")
+	}
+	pkt := buf[:n]
+	copy(pkt, h.raw)
+	copy(pkt[len(h.raw):], b)
+
+	udpLen := 8 + len(b)
+	binary.BigEndian.PutUint16(pkt[6:], uint16(udpLen))               // SCION payload length
+	binary.BigEndian.PutUint16(pkt[h.scionLen+4:], uint16(udpLen))    // UDP length
+	binary.BigEndian.PutUint16(pkt[h.scionLen+6:], 0)                 // UDP checksum
+	sum := h.pseudoSum + uint32(udpLen>>16) + uint32(udpLen&0xffff) + // pseudo header
+		uint32(slayers.L4UDP)
+	binary.BigEndian.PutUint16(pkt[h.scionLen+6:], internetChecksum(sum, pkt[h.scionLen:]))
+	return pkt, nil
+}
+
+// batchOut is a packet prepared for sending with writeBatch.
+type batchOut struct {
+	pkt     []byte
+	buf     *[]byte
+	nextHop netip.AddrPort
+	path    *Path
+}
+
+// writePackets sends the prepared packets, using sendmmsg and, if available,
+// UDP generic segmentation offload.
+// Returns the number of packets sent.
+func (f *fastPath) writePackets(out []batchOut) (int, error) {
+	f.gsoMutex.Lock()
+	gso := f.gso
+	f.gsoMutex.Unlock()
+
+	msgs := make([]ipv4.Message, 0, len(out))
+	segments := make([]int, 0, len(out)) // number of packets in each message
+	for i := 0; i < len(out); {
+		j := i + 1
+		if gso {
+			j = gsoRunEnd(out, i)
+		}
+		buffers := make([][]byte, j-i)
+		for k := i; k < j; k++ {
+			buffers[k-i] = out[k].pkt
+		}
+		msg := ipv4.Message{
+			Buffers: buffers,
+			Addr:    net.UDPAddrFromAddrPort(out[i].nextHop),
+		}
+		if j-i > 1 {
+			msg.OOB = appendUDPSegmentSize(nil, len(out[i].pkt))
+		}
+		msgs = append(msgs, msg)
+		segments = append(segments, j-i)
+		i = j
+	}
+
+	sent := 0
+	for m := 0; m < len(msgs); {
+		n, err := f.batch.WriteBatch(msgs[m:], 0)
+		if err != nil {
+			if gso && isGSOError(err) {
+				// GSO is not supported on this path (e.g. no checksum offload on
+				// the interface). Disable it and retry without.
+				f.gsoMutex.Lock()
+				f.gso = false
+				f.gsoMutex.Unlock()
+				more, err := f.writePackets(out[sent:])
+				return sent + more, err
+			}
+			return sent, err
+		}
+		for _, s := range segments[m : m+n] {
+			sent += s
+		}
+		m += n
+	}
+	return sent, nil
+}
+
+// gsoRunEnd returns the end of the run of packets starting at i that can be
+// sent as a single GSO message; all packets go to the same next hop and have
+// the same size, except the last which may be shorter.
+func gsoRunEnd(out []batchOut, i int) int {
+	const maxSegments = 64
+	const maxTotal = 65000
+	size := len(out[i].pkt)
+	total := size
+	j := i + 1
+	for ; j < len(out) && j-i < maxSegments; j++ {
+		if out[j].nextHop != out[i].nextHop || len(out[j].pkt) > size || total+len(out[j].pkt) > maxTotal {
+			break
+		}
+		total += len(out[j].pkt)
+		if len(out[j].pkt) < size {
+			return j + 1
+		}
+	}
+	return j
+}
+
+// batchIn is a packet received with readPackets.
+type batchIn struct {
+	pkt     snet.Packet
+	lastHop netip.AddrPort
+}
+
+// pendingPacket is a received packet that has not been decoded yet.
+type pendingPacket struct {
+	raw  []byte
+	from netip.AddrPort
+}
+
+// readBufferPool returns the pool for receive buffers passed to readPackets.
+func (f *fastPath) readBufferPool() *sync.Pool {
+	if f.gro {
+		return &groBufferPool
+	}
+	return &packetBufferPool
+}
+
+// readPackets receives packets with recvmmsg, into the pooled buffers bufs.
+// Packets are decoded, SCMP messages are passed to the SCMP handler. Packets
+// left over from a previous call are returned first.
+// If the SCMP handler returns an error, the packets decoded before are
+// returned and the error is returned by the next call; the packets after it
+// are kept for the calls after that.
+// Returns the number of packets in, which may be 0 if all packets received
+// were dropped.
+func (f *fastPath) readPackets(bufs []*[]byte, in []batchIn) (int, error) {
+	if err := f.pendingErr; err != nil {
+		f.pendingErr = nil
+		return 0, err
+	}
+	k := 0
+	for len(f.pending) > 0 && k < len(in) {
+		p := f.pending[0]
+		f.pending = f.pending[1:]
+		ok, err := f.decode(p.raw, p.from, &in[k])
+		if err != nil {
+			return f.deferError(k, err)
+		}
+		if ok {
+			k++
+		}
+	}
+	if len(f.pending) == 0 {
+		f.pending = nil
+	}
+	if k > 0 {
+		return k, nil
+	}
+
+	if len(f.readMsgs) < len(bufs) {
+		f.readMsgs = make([]ipv4.Message, len(bufs))
+		for i := range f.readMsgs {
+			f.readMsgs[i].Buffers = make([][]byte, 1)
+			if f.gro {
+				f.readMsgs[i].OOB = make([]byte, groOOBSize)
+			}
+		}
+	}
+	msgs := f.readMsgs[:len(bufs)]
+	for i, b := range bufs {
+		msgs[i].Buffers[0] = *b
+		msgs[i].OOB = msgs[i].OOB[:cap(msgs[i].OOB)]
+	}
+	n, err := f.batch.ReadBatch(msgs, 0)
+	if err != nil {
+		return 0, err
+	}
+	var decodeErr error
+	for _, msg := range msgs[:n] {
+		udpAddr, ok := msg.Addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		from := udpAddr.AddrPort()
+		b := msg.Buffers[0][:msg.N]
+		segmentSize := len(b)
+		if f.gro {
+			if s := groSegmentSize(msg.OOB[:msg.NN]); s > 0 {
+				segmentSize = s
+			}
+		}
+		for len(b) > 0 {
+			seg := b[:min(segmentSize, len(b))]
+			b = b[len(seg):]
+			if k == len(in) || decodeErr != nil {
+				// the buffer is reused, keep a copy for the next call
+				f.pending = append(f.pending, pendingPacket{
+					raw:  append([]byte(nil), seg...),
+					from: from,
+				})
+				continue
+			}
+			ok, err := f.decode(seg, from, &in[k])
+			if err != nil {
+				decodeErr = err
+				continue
+			}
+			if ok {
+				k++
+			}
+		}
+	}
+	if decodeErr != nil {
+		return f.deferError(k, decodeErr)
+	}
+	return k, nil
+}
+
+// deferError returns the k packets decoded before the SCMP error err, and
+// keeps err for the next call of readPackets. If there are no such packets,
+// err is returned immediately.
+func (f *fastPath) deferError(k int, err error) (int, error) {
+	if k == 0 {
+		return 0, err
+	}
+	f.pendingErr = err
+	return k, nil
+}
+
+// decode decodes the packet raw received from the underlay address from into
+// in. SCMP messages are passed to the SCMP handler.
+// Returns false if the packet is dropped.
+func (f *fastPath) decode(raw []byte, from netip.AddrPort, in *batchIn) (bool, error) {
+	pkt := snet.Packet{Bytes: raw}
+	if err := pkt.Decode(); err != nil {
+		return false, nil // drop packets that cannot be decoded, as snet does
+	}
+	lastHop := from
+	if f.isShimDispatcher(from) {
+		var err error
+		if lastHop, err = f.lastHop(&pkt); err != nil {
+			return false, nil
+		}
+	}
+	if _, ok := pkt.Payload.(snet.SCMPPayload); ok {
+		if f.scmp == nil {
+			return false, nil
+		}
+		return false, f.scmp.Handle(&pkt)
+	}
+	*in = batchIn{pkt: pkt, lastHop: lastHop}
+	return true, nil
+}
+
+// isShimDispatcher checks whether the packet was forwarded by the shim
+// dispatcher, analogous to snet.SCIONPacketConn.
+func (f *fastPath) isShimDispatcher(from netip.AddrPort) bool {
+	local := f.conn.LocalAddr().(*net.UDPAddr).AddrPort()
+	return from.Port() == underlay.EndhostPort &&
+		(from.Addr().Unmap() == local.Addr().Unmap() || from.Addr().IsLoopback())
+}
+
+// lastHop determines the actual last hop of packets forwarded by the shim
+// dispatcher, analogous to snet.SCIONPacketConn. Only SCION and empty paths
+// are supported.
+func (f *fastPath) lastHop(pkt *snet.Packet) (netip.AddrPort, error) {
+	rpath, ok := pkt.Path.(snet.RawPath)
+	if !ok {
+		return netip.AddrPort{}, errors.New("unsupported path type")
+	}
+	switch rpath.PathType {
+	case empty.PathType:
+		if pkt.Source.Host.Type() != addr.HostTypeIP {
+			return netip.AddrPort{}, errors.New("unexpected source address in packet")
+		}
+		port := uint16(underlay.EndhostPort)
+		if udp, ok := pkt.Payload.(snet.UDPPayload); ok {
+			port = udp.SrcPort
+		}
+		return netip.AddrPortFrom(pkt.Source.Host.IP(), port), nil
+	case scion.PathType:
+		var sp scion.Raw
+		if err := sp.DecodeFromBytes(rpath.Raw); err != nil {
+			return netip.AddrPort{}, err
+		}
+		info, err := sp.GetCurrentInfoField()
+		if err != nil {
+			return netip.AddrPort{}, err
+		}
+		hf, err := sp.GetCurrentHopField()
+		if err != nil {
+			return netip.AddrPort{}, err
+		}
+		ifID := hf.ConsIngress
+		if !info.ConsDir {
+			ifID = hf.ConsEgress
+		}
+		a, ok := f.topology.Interface(ifID)
+		if !ok {
+			return netip.AddrPort{}, errors.New("interface number not found")
+		}
+		return a, nil
+	default:
+		return netip.AddrPort{}, errors.New("unsupported path type")
+	}
+}
+
+// writeBatch sends the messages. The route function determines destination
+// and path for each message.
+// Falls back to writeMsg if the connection does not allow batched I/O.
+// Returns the number of messages sent.
+func (c *baseUDPConn) writeBatch(src UDPAddr, msgs []Message,
+	route func(m *Message) (UDPAddr, *Path, pathDecision, error)) (int, error) {
+
+	f := c.fastPath()
+	if f == nil || c.emulator != nil {
+		for i := range msgs {
+			dst, path, decision, err := route(&msgs[i])
+			if err != nil {
+				return i, err
+			}
+			if _, err := c.writeMsg(src, dst, path, msgs[i].Buffer, decision); err != nil {
+				return i, err
+			}
+		}
+		return len(msgs), nil
+	}
+
+	total := 0
+	for len(msgs) > 0 {
+		chunk := msgs
+		if len(chunk) > maxBatchSize {
+			chunk = chunk[:maxBatchSize]
+		}
+		n, err := c.writeBatchChunk(f, src, chunk, route)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		msgs = msgs[len(chunk):]
+	}
+	return total, nil
+}
+
+func (c *baseUDPConn) writeBatchChunk(f *fastPath, src UDPAddr, msgs []Message,
+	route func(m *Message) (UDPAddr, *Path, pathDecision, error)) (int, error) {
+
+	out := make([]batchOut, 0, len(msgs))
+	defer func() {
+		for _, o := range out {
+			packetBufferPool.Put(o.buf)
+		}
+	}()
+	decisions := make([]pathDecision, 0, len(msgs))
+	var routeErr error
+	for i := range msgs {
+		dst, path, decision, err := route(&msgs[i])
+		if err != nil {
+			routeErr = err
+			break
+		}
+		nextHop, err := nextHopFor(src, dst, path)
+		if err != nil {
+			routeErr = err
+			break
+		}
+		h, err := f.header(src, dst, path)
+		if err != nil {
+			routeErr = err
+			break
+		}
+		buf := packetBufferPool.Get().(*[]byte)
+		pkt, err := h.build(*buf, msgs[i].Buffer)
+		if err != nil {
+			packetBufferPool.Put(buf)
+			routeErr = err
+			break
+		}
+		out = append(out, batchOut{pkt: pkt, buf: buf, nextHop: nextHop, path: path})
+		decisions = append(decisions, decision)
+	}
+
+	c.writeMutex.Lock()
+	n, err := f.writePackets(out)
+	c.writeMutex.Unlock()
+	if c.capture != nil {
+		local := c.localUnderlay()
+		for i, o := range out[:n] {
+			c.capture.sent(o.pkt, local, o.nextHop, o.path, decisions[i])
+		}
+	}
+	for i, o := range out[:n] {
+		c.countSent(o.path, len(msgs[i].Buffer))
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, routeErr
+}
+
+// nextHopFor returns the underlay next hop for a packet from src to dst via
+// path, and checks the same invariants as writeMsg.
+func nextHopFor(src, dst UDPAddr, path *Path) (netip.AddrPort, error) {
+	if src.IA == dst.IA {
+		return netip.AddrPortFrom(dst.IP, underlay.EndhostPort), nil
+	}
+	if path == nil {
+		return netip.AddrPort{}, errNoPathTo(dst.IA)
+	}
+	if src.IA != path.Source || dst.IA != path.Destination {
+		return netip.AddrPort{}, errors.New("path does not match source and destination")
+	}
+	return path.ForwardingPath.underlay, nil
+}
+
+// readBatch reads at least one message. For each message read, the remote
+// address and the forwarding path on which the packet was received are
+// stored in the corresponding entries of msgs and fwPaths.
+// Falls back to reading a single message via snet if the connection does not
+// allow batched I/O.
+// Returns the number of messages read.
+func (c *baseUDPConn) readBatch(msgs []Message, fwPaths []ForwardingPath) (int, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+	f := c.fastPath()
+	if f == nil {
+		n, remote, fw, err := c.readMsgSlow(msgs[0].Buffer)
+		if err != nil {
+			return 0, err
+		}
+		msgs[0].N, msgs[0].Addr, fwPaths[0] = n, remote, fw
+		return 1, nil
+	}
+
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+
+	if len(msgs) > maxBatchSize {
+		msgs = msgs[:maxBatchSize]
+	}
+	numBufs := len(msgs)
+	if f.gro && numBufs > maxGROBatchSize {
+		numBufs = maxGROBatchSize
+	}
+	pool := f.readBufferPool()
+	if cap(f.readBufs) < numBufs {
+		f.readBufs = make([]*[]byte, numBufs)
+	}
+	bufs := f.readBufs[:numBufs]
+	for i := range bufs {
+		bufs[i] = pool.Get().(*[]byte)
+	}
+	defer func() {
+		for i, b := range bufs {
+			pool.Put(b)
+			bufs[i] = nil
+		}
+	}()
+	if cap(f.readIn) < len(msgs) {
+		f.readIn = make([]batchIn, len(msgs))
+	}
+	in := f.readIn[:len(msgs)]
+	for {
+		n, err := f.readPackets(bufs, in)
+		if err != nil {
+			return 0, err
+		}
+		k := 0
+		for _, p := range in[:n] {
+			udp, ok := p.pkt.Payload.(snet.UDPPayload)
+			if !ok || p.pkt.Source.Host.Type() != addr.HostTypeIP {
+				continue // ignore non-UDP packet or non-IP source
+			}
+			fw := ForwardingPath{
+				dataplanePath: p.pkt.Path,
+				underlay:      p.lastHop,
+			}
+			if c.capture != nil {
+				var fingerprint PathFingerprint
+				if rp, ok := p.pkt.Path.(snet.RawPath); ok && len(rp.Raw) > 0 {
+					fingerprint, _ = reversePathFingerprint(rp)
+				}
+				c.capture.received(p.pkt.Bytes, p.lastHop, c.localUnderlay(), fingerprint)
+			}
+			if c.connStats != nil {
+				c.connStats.received(p.pkt.Path, len(udp.Payload))
+			}
+			remote := UDPAddr{
+				IA:   IA(p.pkt.Source.IA),
+				IP:   p.pkt.Source.Host.IP(),
+				Port: udp.SrcPort,
+			}
+			payload := udp.Payload
+			if c.intercept != nil {
+				if payload, ok = c.intercept(remote, fw, payload); !ok {
+					continue
+				}
+			}
+			msgs[k].N = copy(msgs[k].Buffer, payload)
+			msgs[k].Addr = remote
+			msgs[k].Path = nil
+			fwPaths[k] = fw
+			k++
+		}
+		if k > 0 {
+			return k, nil
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// gsoSupported checks whether the kernel supports UDP generic segmentation
+// offload (UDP_SEGMENT) on conn.
+// Sending with GSO may still fail if the network interface does not support
+// it, see isGSOError.
+func gsoSupported(conn *net.UDPConn) bool {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var serr error
+	if err := rawConn.Control(func(fd uintptr) {
+		_, serr = unix.GetsockoptInt(int(fd), unix.IPPROTO_UDP, unix.UDP_SEGMENT)
+	}); err != nil {
+		return false
+	}
+	return serr == nil
+}
+
+// appendUDPSegmentSize appends the control message setting the GSO segment
+// size to b.
+func appendUDPSegmentSize(b []byte, size int) []byte {
+	const dataLen = 2 // payload is a uint16
+	start := len(b)
+	b = append(b, make([]byte, unix.CmsgSpace(dataLen))...)
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&b[start]))
+	h.Level = syscall.IPPROTO_UDP
+	h.Type = unix.UDP_SEGMENT
+	h.SetLen(unix.CmsgLen(dataLen))
+	*(*uint16)(unsafe.Pointer(&b[start+unix.CmsgSpace(0)])) = uint16(size)
+	return b
+}
+
+// enableGRO enables UDP generic receive offload (UDP_GRO) on conn, i.e. the
+// kernel may coalesce multiple packets from the same flow into a single
+// buffer. Returns false if not supported.
+func enableGRO(conn *net.UDPConn) bool {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var serr error
+	if err := rawConn.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.IPPROTO_UDP, unix.UDP_GRO, 1)
+	}); err != nil {
+		return false
+	}
+	return serr == nil
+}
+
+// groOOBSize is the size of the buffer for the UDP_GRO control message.
+var groOOBSize = unix.CmsgSpace(4)
+
+// groSegmentSize returns the segment size from the UDP_GRO control message in
+// oob, or 0 if there is none, i.e. if the packet was not coalesced.
+func groSegmentSize(oob []byte) int {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0
+	}
+	for _, m := range msgs {
+		if m.Header.Level == syscall.IPPROTO_UDP && m.Header.Type == unix.UDP_GRO && len(m.Data) >= 4 {
+			return int(*(*int32)(unsafe.Pointer(&m.Data[0])))
+		}
+	}
+	return 0
+}
+
+// isGSOError checks whether the error is caused by the network interface not
+// supporting GSO; udp_send_skb returns EIO if the device does not have TX
+// checksum offload, which is required for UDP_SEGMENT.
+func isGSOError(err error) bool {
+	var serr *os.SyscallError
+	if errors.As(err, &serr) {
+		return serr.Err == unix.EIO
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package pan
+
+import "net"
+
+func gsoSupported(conn *net.UDPConn) bool {
+	return false
+}
+
+func appendUDPSegmentSize(b []byte, size int) []byte {
+	return b
+}
+
+func isGSOError(err error) bool {
+	return false
+}
+
+func enableGRO(conn *net.UDPConn) bool {
+	return false
+}
+
+const groOOBSize = 0
+
+func groSegmentSize(oob []byte) int {
+	return 0
+}
@@ -0,0 +1,344 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers/path"
+	"github.com/scionproto/scion/pkg/slayers/path/scion"
+	"github.com/scionproto/scion/pkg/snet"
+	snetpath "github.com/scionproto/scion/pkg/snet/path"
+	"github.com/stretchr/testify/require"
+)
+
+// loopbackPair creates two baseUDPConns on loopback sockets, with paths
+// between them. The paths are not valid SCION paths in any real network, but
+// they are decodable and the underlay next hop points to the peer socket.
+type loopbackPair struct {
+	a, b         *baseUDPConn
+	addrA, addrB UDPAddr
+	pathAB       *Path
+	pathBA       *Path
+}
+
+func newLoopbackPair(tb testing.TB) *loopbackPair {
+	return newLoopbackPairAt(tb, netip.MustParseAddr("127.0.0.1"))
+}
+
+// newLoopbackPairAt creates a loopbackPair on the given loopback IP, e.g. "::1"
+// for an IPv6-only pair.
+func newLoopbackPairAt(tb testing.TB, ip netip.Addr) *loopbackPair {
+	tb.Helper()
+	iaA := MustParseIA("1-ff00:0:110")
+	iaB := MustParseIA("1-ff00:0:111")
+
+	p := &loopbackPair{}
+	rawA, addrA := openLoopback(tb, iaA, ip)
+	rawB, addrB := openLoopback(tb, iaB, ip)
+	p.a, p.addrA = &baseUDPConn{raw: rawA}, addrA
+	p.b, p.addrB = &baseUDPConn{raw: rawB}, addrB
+	p.pathAB = testLoopbackPath(tb, iaA, iaB, netip.AddrPortFrom(p.addrB.IP, p.addrB.Port))
+	p.pathBA = testLoopbackPath(tb, iaB, iaA, netip.AddrPortFrom(p.addrA.IP, p.addrA.Port))
+	return p
+}
+
+// openLoopback opens a raw SCION connection on a loopback socket with the
+// given IP, pretending to be in the given ISD-AS.
+func openLoopback(tb testing.TB, ia IA, ip netip.Addr) (*snet.SCIONPacketConn, UDPAddr) {
+	tb.Helper()
+	conn, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(netip.AddrPortFrom(ip, 0)))
+	require.NoError(tb, err)
+	tb.Cleanup(func() { conn.Close() })
+	raw := &snet.SCIONPacketConn{
+		Conn:        conn,
+		SCMPHandler: DefaultSCMPHandler{},
+		Topology: snet.Topology{
+			Interface: func(uint16) (netip.AddrPort, bool) { return netip.AddrPort{}, false },
+		},
+	}
+	ap := conn.LocalAddr().(*net.UDPAddr).AddrPort()
+	return raw, UDPAddr{IA: ia, IP: ap.Addr(), Port: ap.Port()}
+}
+
+func testLoopbackPath(tb testing.TB, src, dst IA, underlay netip.AddrPort) *Path {
+	tb.Helper()
+	ts := uint32(time.Now().Unix())
+	sp := scion.Decoded{
+		Base: scion.Base{
+			PathMeta: scion.MetaHdr{SegLen: [3]uint8{2, 0, 0}},
+			NumINF:   1,
+			NumHops:  2,
+		},
+		InfoFields: []path.InfoField{{ConsDir: true, Timestamp: ts}},
+		HopFields: []path.HopField{
+			{ConsIngress: 0, ConsEgress: 1, ExpTime: 63},
+			{ConsIngress: 2, ConsEgress: 0, ExpTime: 63},
+		},
+	}
+	raw := make([]byte, sp.Len())
+	require.NoError(tb, sp.SerializeTo(raw))
+	return &Path{
+		Source:      src,
+		Destination: dst,
+		ForwardingPath: ForwardingPath{
+			dataplanePath: snetpath.SCION{Raw: raw},
+			underlay:      underlay,
+		},
+		Fingerprint: "1 2",
+		Expiry:      expiryFromDecoded(sp),
+	}
+}
+
+func TestLoopbackWriteReadMsg(t *testing.T) {
+	p := newLoopbackPair(t)
+	for _, payload := range []string{"", "a", "hello", string(make([]byte, 1200))} {
+		_, err := p.a.writeMsg(p.addrA, p.addrB, p.pathAB, []byte(payload), decidedBy("test"))
+		require.NoError(t, err)
+		buf := make([]byte, 1500)
+		n, remote, fw, err := p.b.readMsg(buf)
+		require.NoError(t, err)
+		require.Equal(t, payload, string(buf[:n]))
+		require.Equal(t, p.addrA, remote)
+		rp, err := reversePathFromForwardingPath(remote.IA, p.addrB.IA, fw)
+		require.NoError(t, err)
+		require.Equal(t, PathFingerprint("2 1"), rp.Fingerprint)
+	}
+}
+
+func TestLoopbackReadBatchSCMPError(t *testing.T) {
+	p := newLoopbackPair(t)
+	p.b.fastPath()
+	send := func(i int) {
+		_, err := p.a.writeMsg(p.addrA, p.addrB, p.pathAB, []byte(fmt.Sprintf("message %d", i)), decidedBy("test"))
+		require.NoError(t, err)
+	}
+	for i := 0; i < 3; i++ {
+		send(i)
+	}
+	scmp := &snet.Packet{
+		PacketInfo: snet.PacketInfo{
+			Source:      snet.SCIONAddress{IA: addr.IA(p.addrA.IA), Host: addr.HostIP(p.addrA.IP)},
+			Destination: snet.SCIONAddress{IA: addr.IA(p.addrB.IA), Host: addr.HostIP(p.addrB.IP)},
+			Path:        p.pathAB.ForwardingPath.dataplanePath,
+			Payload:     snet.SCMPDestinationUnreachable{Payload: []byte("quoted")},
+		},
+	}
+	require.NoError(t, p.a.raw.WriteTo(scmp, net.UDPAddrFromAddrPort(p.pathAB.ForwardingPath.underlay)))
+	for i := 3; i < 6; i++ {
+		send(i)
+	}
+	time.Sleep(10 * time.Millisecond) // let all packets arrive, to be read in a single batch
+
+	in := make([]Message, 10)
+	for i := range in {
+		in[i].Buffer = make([]byte, 1500)
+	}
+	fwPaths := make([]ForwardingPath, len(in))
+	received := 0
+	scmpErrors := 0
+	for received < 6 {
+		n, err := p.b.readBatch(in, fwPaths)
+		if err != nil {
+			require.ErrorAs(t, err, &SCMPError{})
+			require.Equal(t, 3, received, "SCMP error after the preceding packets")
+			scmpErrors++
+			continue
+		}
+		for i := 0; i < n; i++ {
+			require.Equal(t, fmt.Sprintf("message %d", received), string(in[i].Buffer[:in[i].N]))
+			received++
+		}
+	}
+	require.Equal(t, 1, scmpErrors)
+}
+
+func TestPacketHeaderBuild(t *testing.T) {
+	p := newLoopbackPair(t)
+	for _, path := range []*Path{p.pathAB, nil} {
+		dst := p.addrB
+		if path == nil {
+			dst.IA = p.addrA.IA
+		}
+		h, err := newPacketHeader(p.addrA, dst, path)
+		require.NoError(t, err)
+		for _, size := range []int{0, 1, 7, 1200} {
+			payload := make([]byte, size)
+			for i := range payload {
+				payload[i] = byte(i)
+			}
+			var dataplanePath snet.DataplanePath = snetpath.Empty{}
+			if path != nil {
+				dataplanePath = path.ForwardingPath.dataplanePath
+			}
+			expected := &snet.Packet{
+				PacketInfo: snet.PacketInfo{
+					Source:      snet.SCIONAddress{IA: addr.IA(p.addrA.IA), Host: addr.HostIP(p.addrA.IP)},
+					Destination: snet.SCIONAddress{IA: addr.IA(dst.IA), Host: addr.HostIP(dst.IP)},
+					Path:        dataplanePath,
+					Payload: snet.UDPPayload{
+						SrcPort: p.addrA.Port,
+						DstPort: dst.Port,
+						Payload: payload,
+					},
+				},
+			}
+			require.NoError(t, expected.Serialize())
+			buf := make([]byte, 1500)
+			actual, err := h.build(buf, payload)
+			require.NoError(t, err)
+			require.Equal(t, []byte(expected.Bytes), actual, fmt.Sprintf("payload size %d", size))
+		}
+	}
+}
+
+func TestLoopbackWriteReadBatch(t *testing.T) {
+	p := newLoopbackPair(t)
+	// set up the receiver first, so that GRO (if supported) is enabled when the
+	// packets arrive and more packets are received than fit into a single read.
+	p.b.fastPath()
+	const count = 10
+	out := make([]Message, count)
+	for i := range out {
+		out[i].Buffer = []byte(fmt.Sprintf("message %d", i))
+	}
+	n, err := p.a.writeBatch(p.addrA, out, func(*Message) (UDPAddr, *Path, pathDecision, error) {
+		return p.addrB, p.pathAB, decidedBy("test"), nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, count, n)
+
+	received := 0
+	for received < count {
+		in := make([]Message, 4)
+		for i := range in {
+			in[i].Buffer = make([]byte, 1500)
+		}
+		fwPaths := make([]ForwardingPath, len(in))
+		n, err := p.b.readBatch(in, fwPaths)
+		require.NoError(t, err)
+		for i := 0; i < n; i++ {
+			require.Equal(t, fmt.Sprintf("message %d", received), string(in[i].Buffer[:in[i].N]))
+			require.Equal(t, p.addrA, in[i].Addr)
+			rp, err := reversePathFromForwardingPath(in[i].Addr.IA, p.addrB.IA, fwPaths[i])
+			require.NoError(t, err)
+			require.Equal(t, PathFingerprint("2 1"), rp.Fingerprint)
+			received++
+		}
+	}
+}
+
+const benchmarkPayloadSize = 1200
+
+func BenchmarkWriteMsg(b *testing.B) {
+	p := newLoopbackPair(b)
+	go drainUDP(p.b)
+	payload := make([]byte, benchmarkPayloadSize)
+	b.SetBytes(benchmarkPayloadSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.a.writeMsg(p.addrA, p.addrB, p.pathAB, payload, decidedBy("bench")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadMsg(b *testing.B) {
+	p := newLoopbackPair(b)
+	payload := make([]byte, benchmarkPayloadSize)
+	buf := make([]byte, 1500)
+	b.SetBytes(benchmarkPayloadSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// keep few packets in flight to avoid drops in the socket buffer
+		if _, err := p.a.writeMsg(p.addrA, p.addrB, p.pathAB, payload, decidedBy("bench")); err != nil {
+			b.Fatal(err)
+		}
+		if _, _, _, err := p.b.readMsg(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriteBatch(b *testing.B) {
+	p := newLoopbackPair(b)
+	go drainUDP(p.b)
+	msgs := make([]Message, maxBatchSize)
+	for i := range msgs {
+		msgs[i].Buffer = make([]byte, benchmarkPayloadSize)
+	}
+	route := func(*Message) (UDPAddr, *Path, pathDecision, error) {
+		return p.addrB, p.pathAB, decidedBy("bench"), nil
+	}
+	b.SetBytes(benchmarkPayloadSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i += len(msgs) {
+		batch := msgs
+		if b.N-i < len(batch) {
+			batch = batch[:b.N-i]
+		}
+		if _, err := p.a.writeBatch(p.addrA, batch, route); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadBatch(b *testing.B) {
+	p := newLoopbackPair(b)
+	p.b.fastPath()
+	const batchSize = 16
+	out := make([]Message, batchSize)
+	in := make([]Message, batchSize)
+	for i := range out {
+		out[i].Buffer = make([]byte, benchmarkPayloadSize)
+		in[i].Buffer = make([]byte, 1500)
+	}
+	fwPaths := make([]ForwardingPath, batchSize)
+	route := func(*Message) (UDPAddr, *Path, pathDecision, error) {
+		return p.addrB, p.pathAB, decidedBy("bench"), nil
+	}
+	b.SetBytes(benchmarkPayloadSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i += batchSize {
+		// the writes are included in the measurement, as in BenchmarkReadMsg
+		if _, err := p.a.writeBatch(p.addrA, out, route); err != nil {
+			b.Fatal(err)
+		}
+		for pending := batchSize; pending > 0; {
+			n, err := p.b.readBatch(in, fwPaths)
+			if err != nil {
+				b.Fatal(err)
+			}
+			pending -= n
+		}
+	}
+}
+
+// drainUDP reads and discards everything from the underlying UDP socket of c,
+// until it is closed.
+func drainUDP(c *baseUDPConn) {
+	conn := c.raw.(*snet.SCIONPacketConn).Conn
+	buf := make([]byte, 9000)
+	for {
+		if _, _, err := conn.ReadFrom(buf); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+// captureEnvVar is the environment variable that enables packet capture for
+// all connections of the process. The value is the path of the pcapng file
+// to write.
+const captureEnvVar = "SCION_PAN_CAPTURE"
+
+const (
+	pcapngBlockSHB = 0x0A0D0D0A
+	pcapngBlockIDB = 0x00000001
+	pcapngBlockEPB = 0x00000006
+
+	pcapngByteOrderMagic = 0x1A2B3C4D
+	pcapngLinkTypeRaw    = 101 // LINKTYPE_RAW, IPv4 or IPv6 without link layer header
+	pcapngSnapLen        = 0   // no limit
+
+	pcapngOptEnd     = 0
+	pcapngOptComment = 1
+	pcapngOptEPBFlag = 2
+
+	pcapngFlagInbound  = 0x1
+	pcapngFlagOutbound = 0x2
+)
+
+// packetCapture writes the packets sent and received on a connection in the
+// pcapng format.
+// The SCION packets are wrapped in synthetic IP/UDP headers with the
+// underlay addresses, so that the SCION dissector in wireshark picks them up
+// as it would for packets captured on the wire.
+// A packetCapture can be shared by multiple connections.
+type packetCapture struct {
+	mutex         sync.Mutex
+	w             io.Writer
+	headerWritten bool
+	err           error
+}
+
+func newPacketCapture(w io.Writer) *packetCapture {
+	return &packetCapture{w: w}
+}
+
+// envPacketCapture returns the process wide packetCapture configured with the
+// SCION_PAN_CAPTURE environment variable, or nil if this is not set.
+var envPacketCapture = sync.OnceValue(func() *packetCapture {
+	filename, ok := os.LookupEnv(captureEnvVar)
+	if !ok || filename == "" {
+		return nil
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: unable to open %s=%s: %v\n", captureEnvVar, filename, err)
+		return nil
+	}
+	return newPacketCapture(f)
+})
+
+// pathDecision describes how the path of a sent packet was chosen, for the
+// comment of the captured packet. It is passed by value on every write, and
+// only formatted if the packet is captured.
+type pathDecision struct {
+	reason   string // why the path was chosen, by the selector or otherwise
+	selector any    // selector that chose the path
+	copy     int    // index of a redundant copy, starting at 1
+	copies   int    // number of redundant copies
+}
+
+// pathExplainer is implemented by selectors that can explain why they chose a
+// path, for the comments in the packet capture.
+type pathExplainer interface {
+	explainPath(path *Path) string
+}
+
+func decidedBy(reason string) pathDecision {
+	return pathDecision{reason: reason}
+}
+
+// selectedBy returns the decision for a path chosen by the selector. The
+// selector is only asked for its reason if the packet is captured.
+func selectedBy(capture *packetCapture, selector any, path *Path) pathDecision {
+	d := pathDecision{selector: selector}
+	if capture != nil && path != nil {
+		if e, ok := selector.(pathExplainer); ok {
+			d.reason = e.explainPath(path)
+		}
+	}
+	return d
+}
+
+func (d pathDecision) String() string {
+	switch {
+	case d.selector != nil && d.reason != "":
+		return fmt.Sprintf("chosen by %T, %s", d.selector, d.reason)
+	case d.selector != nil:
+		return fmt.Sprintf("chosen by %T", d.selector)
+	case d.copies > 0:
+		return fmt.Sprintf("redundant copy %d/%d", d.copy, d.copies)
+	default:
+		return d.reason
+	}
+}
+
+// sent records an outgoing packet. The decision describes why this path was
+// chosen, e.g. the selector or an explicit path.
+func (c *packetCapture) sent(pkt []byte, local, nextHop netip.AddrPort, path *Path, decision pathDecision) {
+	if c == nil {
+		return
+	}
+	comment := fmt.Sprintf("sent; %s", decision)
+	if path != nil {
+		comment += fmt.Sprintf("; path %s [%s]", path.Fingerprint, path)
+	}
+	c.record(pkt, local, nextHop, pcapngFlagOutbound, comment)
+}
+
+// received records an incoming packet. fingerprint is the fingerprint of the
+// reverse of the path on which the packet was received, i.e. the fingerprint
+// of the path that would be used for a reply.
+func (c *packetCapture) received(pkt []byte, lastHop, local netip.AddrPort, fingerprint PathFingerprint) {
+	if c == nil {
+		return
+	}
+	comment := "received"
+	if fingerprint != "" {
+		comment += fmt.Sprintf("; reply path %s", fingerprint)
+	}
+	c.record(pkt, lastHop, local, pcapngFlagInbound, comment)
+}
+
+func (c *packetCapture) record(pkt []byte, src, dst netip.AddrPort, flags uint32, comment string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err != nil {
+		return // give up after first error, capture is best effort
+	}
+	if !c.headerWritten {
+		if c.err = c.writeHeader(); c.err != nil {
+			return
+		}
+		c.headerWritten = true
+	}
+	data := encapsulateUnderlay(pkt, src, dst)
+	c.err = c.writeEPB(time.Now(), data, flags, comment)
+}
+
+func (c *packetCapture) writeHeader() error {
+	shb := make([]byte, 0, 28)
+	shb = binary.LittleEndian.AppendUint32(shb, pcapngBlockSHB)
+	shb = binary.LittleEndian.AppendUint32(shb, 28)
+	shb = binary.LittleEndian.AppendUint32(shb, pcapngByteOrderMagic)
+	shb = binary.LittleEndian.AppendUint16(shb, 1) // major version
+	shb = binary.LittleEndian.AppendUint16(shb, 0) // minor version
+	shb = binary.LittleEndian.AppendUint64(shb, 0xFFFFFFFFFFFFFFFF)
+	shb = binary.LittleEndian.AppendUint32(shb, 28)
+
+	idb := make([]byte, 0, 20)
+	idb = binary.LittleEndian.AppendUint32(idb, pcapngBlockIDB)
+	idb = binary.LittleEndian.AppendUint32(idb, 20)
+	idb = binary.LittleEndian.AppendUint16(idb, pcapngLinkTypeRaw)
+	idb = binary.LittleEndian.AppendUint16(idb, 0) // reserved
+	idb = binary.LittleEndian.AppendUint32(idb, pcapngSnapLen)
+	idb = binary.LittleEndian.AppendUint32(idb, 20)
+
+	_, err := c.w.Write(append(shb, idb...))
+	return err
+}
+
+func (c *packetCapture) writeEPB(ts time.Time, data []byte, flags uint32, comment string) error {
+	var opts []byte
+	opts = appendPcapngOption(opts, pcapngOptEPBFlag, binary.LittleEndian.AppendUint32(nil, flags))
+	opts = appendPcapngOption(opts, pcapngOptComment, []byte(comment))
+	opts = appendPcapngOption(opts, pcapngOptEnd, nil)
+
+	blockLen := 28 + pad4(len(data)) + len(opts) + 4
+	micros := uint64(ts.UnixMicro()) // default if_tsresol is microseconds
+
+	b := make([]byte, 0, blockLen)
+	b = binary.LittleEndian.AppendUint32(b, pcapngBlockEPB)
+	b = binary.LittleEndian.AppendUint32(b, uint32(blockLen))
+	b = binary.LittleEndian.AppendUint32(b, 0) // interface ID
+	b = binary.LittleEndian.AppendUint32(b, uint32(micros>>32))
+	b = binary.LittleEndian.AppendUint32(b, uint32(micros))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	b = append(b, make([]byte, pad4(len(data))-len(data))...)
+	b = append(b, opts...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(blockLen))
+
+	_, err := c.w.Write(b)
+	return err
+}
+
+func appendPcapngOption(b []byte, code uint16, value []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+	b = append(b, value...)
+	return append(b, make([]byte, pad4(len(value))-len(value))...)
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// encapsulateUnderlay prepends an IPv4 or IPv6 and UDP header for the given
+// underlay addresses to the SCION packet.
+func encapsulateUnderlay(pkt []byte, src, dst netip.AddrPort) []byte {
+	srcIP, dstIP := src.Addr().Unmap(), dst.Addr().Unmap()
+	udpLen := 8 + len(pkt)
+
+	var b []byte
+	if srcIP.Is4() && dstIP.Is4() {
+		b = make([]byte, 0, 20+udpLen)
+		b = append(b, 0x45, 0) // version 4, IHL 5, TOS 0
+		b = binary.BigEndian.AppendUint16(b, uint16(20+udpLen))
+		b = append(b, 0, 0, 0x40, 0) // ID 0, flags DF
+		b = append(b, 64, 17, 0, 0)  // TTL, protocol UDP, checksum placeholder
+		b = append(b, srcIP.AsSlice()...)
+		b = append(b, dstIP.AsSlice()...)
+		binary.BigEndian.PutUint16(b[10:], internetChecksum(0, b[:20]))
+	} else {
+		srcIP, dstIP = netip.AddrFrom16(srcIP.As16()), netip.AddrFrom16(dstIP.As16())
+		b = make([]byte, 0, 40+udpLen)
+		b = append(b, 0x60, 0, 0, 0) // version 6, traffic class and flow label 0
+		b = binary.BigEndian.AppendUint16(b, uint16(udpLen))
+		b = append(b, 17, 64) // next header UDP, hop limit
+		b = append(b, srcIP.AsSlice()...)
+		b = append(b, dstIP.AsSlice()...)
+	}
+	udpOffset := len(b)
+	b = binary.BigEndian.AppendUint16(b, src.Port())
+	b = binary.BigEndian.AppendUint16(b, dst.Port())
+	b = binary.BigEndian.AppendUint16(b, uint16(udpLen))
+	b = append(b, 0, 0) // checksum placeholder
+	b = append(b, pkt...)
+
+	// UDP checksum over pseudo header and UDP datagram
+	var pseudo []byte
+	pseudo = append(pseudo, srcIP.AsSlice()...)
+	pseudo = append(pseudo, dstIP.AsSlice()...)
+	pseudo = append(pseudo, 0, 17)
+	pseudo = binary.BigEndian.AppendUint16(pseudo, uint16(udpLen))
+	sum := internetChecksum(checksumAdd(0, pseudo), b[udpOffset:])
+	if sum == 0 {
+		sum = 0xFFFF
+	}
+	binary.BigEndian.PutUint16(b[udpOffset+6:], sum)
+	return b
+}
+
+func internetChecksum(initial uint32, b []byte) uint16 {
+	sum := checksumAdd(initial, b)
+	for sum > 0xFFFF {
+		sum = (sum >> 16) + (sum & 0xFFFF)
+	}
+	return ^uint16(sum)
+}
+
+func checksumAdd(sum uint32, b []byte) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xFFFF {
+		sum = (sum >> 16) + (sum & 0xFFFF)
+	}
+	return sum
+}
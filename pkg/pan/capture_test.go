@@ -0,0 +1,118 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketCapture(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := newPacketCapture(buf)
+
+	local := netip.MustParseAddrPort("10.0.0.1:31000")
+	remote := netip.MustParseAddrPort("10.0.0.2:30041")
+	path := &Path{
+		Fingerprint: "1 2",
+		Metadata: &PathMetadata{Interfaces: []PathInterface{
+			{IA: MustParseIA("1-ff00:0:110"), IfID: 1},
+			{IA: MustParseIA("1-ff00:0:111"), IfID: 2},
+		}},
+	}
+	selector := &DefaultSelector{}
+	selector.Initialize(UDPAddr{}, UDPAddr{}, []*Path{{Fingerprint: "3 4"}, path})
+	selector.current = 1
+	c.sent([]byte("hello"), local, remote, path, selectedBy(c, selector, path))
+	c.received([]byte("world!"), remote, local, "2 1")
+
+	blocks := parsePcapngBlocks(t, buf.Bytes())
+	require.Len(t, blocks, 4)
+	assert.Equal(t, uint32(pcapngBlockSHB), blocks[0].typ)
+	assert.Equal(t, uint32(pcapngBlockIDB), blocks[1].typ)
+	assert.Equal(t, uint16(pcapngLinkTypeRaw), binary.LittleEndian.Uint16(blocks[1].body))
+
+	for i, expected := range []struct {
+		payload string
+		src     netip.AddrPort
+		dst     netip.AddrPort
+		comment string
+	}{
+		{"hello", local, remote, "sent; chosen by *pan.DefaultSelector, path 2 of 2 in policy order, " +
+			"after failover from down notifications; path 1 2 [1-ff00:0:110 1>2 1-ff00:0:111]"},
+		{"world!", remote, local, "received; reply path 2 1"},
+	} {
+		epb := blocks[2+i]
+		assert.Equal(t, uint32(pcapngBlockEPB), epb.typ)
+		capLen := binary.LittleEndian.Uint32(epb.body[12:])
+		data := epb.body[20 : 20+capLen]
+		// IPv4 + UDP header in front of the SCION packet
+		assert.Equal(t, expected.payload, string(data[28:]))
+		assert.Equal(t, expected.src.Addr().AsSlice(), data[12:16])
+		assert.Equal(t, expected.dst.Addr().AsSlice(), data[16:20])
+		assert.Equal(t, expected.src.Port(), binary.BigEndian.Uint16(data[20:]))
+		assert.Equal(t, expected.dst.Port(), binary.BigEndian.Uint16(data[22:]))
+		assert.Equal(t, uint16(0), internetChecksum(0, data[:20]))
+		opts := string(epb.body[20+pad4(int(capLen)):])
+		assert.True(t, strings.Contains(opts, expected.comment), opts)
+	}
+}
+
+func TestSelectedByWithoutCapture(t *testing.T) {
+	selector := &DefaultSelector{}
+	path := &Path{Fingerprint: "1 2"}
+	selector.Initialize(UDPAddr{}, UDPAddr{}, []*Path{path})
+	assert.Equal(t, "chosen by *pan.DefaultSelector", selectedBy(nil, selector, path).String())
+	assert.Equal(t, "chosen by *pan.DefaultSelector, first of 1 paths in policy order",
+		selectedBy(newPacketCapture(&bytes.Buffer{}), selector, path).String())
+}
+
+func TestEncapsulateUnderlayIPv6(t *testing.T) {
+	src := netip.MustParseAddrPort("[fd00::1]:31000")
+	dst := netip.MustParseAddrPort("[fd00::2]:30041")
+	data := encapsulateUnderlay([]byte("hello"), src, dst)
+	require.Len(t, data, 40+8+5)
+	assert.Equal(t, byte(0x60), data[0])
+	assert.Equal(t, uint16(8+5), binary.BigEndian.Uint16(data[4:]))
+	assert.Equal(t, src.Addr().AsSlice(), data[8:24])
+	assert.Equal(t, dst.Addr().AsSlice(), data[24:40])
+	assert.NotEqual(t, uint16(0), binary.BigEndian.Uint16(data[46:]), "UDP checksum mandatory for IPv6")
+}
+
+type pcapngBlock struct {
+	typ  uint32
+	body []byte
+}
+
+func parsePcapngBlocks(t *testing.T, b []byte) []pcapngBlock {
+	var blocks []pcapngBlock
+	for len(b) > 0 {
+		require.GreaterOrEqual(t, len(b), 12)
+		typ := binary.LittleEndian.Uint32(b)
+		l := int(binary.LittleEndian.Uint32(b[4:]))
+		require.Equal(t, 0, l%4)
+		require.LessOrEqual(t, l, len(b))
+		require.Equal(t, uint32(l), binary.LittleEndian.Uint32(b[l-4:]))
+		blocks = append(blocks, pcapngBlock{typ: typ, body: b[8 : l-4]})
+		b = b[l:]
+	}
+	return blocks
+}
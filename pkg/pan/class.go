@@ -0,0 +1,309 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TrafficClass describes the requirements of the traffic sent with a packet.
+// The traffic class is passed to the path selector in the context of
+// Conn.WriteWithCtx or ListenConn.WriteToWithCtx, see WithTrafficClass.
+type TrafficClass int
+
+const (
+	// TrafficClassDefault is the class of packets without explicit traffic class.
+	TrafficClassDefault TrafficClass = iota
+	// TrafficClassInteractive is for small, latency sensitive messages, e.g.
+	// keystrokes in an interactive session.
+	TrafficClassInteractive
+	// TrafficClassBulk is for throughput oriented transfers, e.g. file copies.
+	TrafficClassBulk
+	// TrafficClassBackground is for traffic that should not interfere with
+	// other traffic, e.g. prefetching or synchronization.
+	TrafficClassBackground
+)
+
+func (c TrafficClass) String() string {
+	switch c {
+	case TrafficClassDefault:
+		return "default"
+	case TrafficClassInteractive:
+		return "interactive"
+	case TrafficClassBulk:
+		return "bulk"
+	case TrafficClassBackground:
+		return "background"
+	default:
+		return fmt.Sprintf("TrafficClass(%d)", int(c))
+	}
+}
+
+type contextKey string
+
+var (
+	// TrafficClassKey is the context key for the TrafficClass of a packet.
+	TrafficClassKey = contextKey("pan.TrafficClass")
+	// DeadlineHintKey is the context key for the deadline hint of a packet, a
+	// time.Time by which the packet should arrive at the destination.
+	// This is a hint for the path selection; packets are sent regardless of
+	// whether the deadline can be met.
+	DeadlineHintKey = contextKey("pan.DeadlineHint")
+)
+
+// WithTrafficClass returns a copy of ctx with the traffic class set.
+func WithTrafficClass(ctx context.Context, class TrafficClass) context.Context {
+	return context.WithValue(ctx, TrafficClassKey, class)
+}
+
+// TrafficClassFromContext returns the traffic class set in ctx, or
+// TrafficClassDefault if none is set.
+func TrafficClassFromContext(ctx context.Context) TrafficClass {
+	if ctx == nil {
+		return TrafficClassDefault
+	}
+	if class, ok := ctx.Value(TrafficClassKey).(TrafficClass); ok {
+		return class
+	}
+	return TrafficClassDefault
+}
+
+// WithDeadlineHint returns a copy of ctx with the deadline hint set.
+func WithDeadlineHint(ctx context.Context, deadline time.Time) context.Context {
+	return context.WithValue(ctx, DeadlineHintKey, deadline)
+}
+
+// DeadlineHintFromContext returns the deadline hint set in ctx, if any.
+func DeadlineHintFromContext(ctx context.Context) (time.Time, bool) {
+	if ctx == nil {
+		return time.Time{}, false
+	}
+	deadline, ok := ctx.Value(DeadlineHintKey).(time.Time)
+	return deadline, ok
+}
+
+// ClassSelector is a Selector keeping a separate ranking of the paths for each
+// traffic class. For each packet, it uses the current path for the traffic
+// class from the context passed to Path, see WithTrafficClass.
+//
+// By default, interactive traffic uses the path with the lowest latency and
+// bulk traffic the path with the highest bandwidth, based on the path
+// metadata. Background traffic avoids the paths used for interactive and bulk
+// traffic, if possible. The default class uses the order of the connection's
+// Policy.
+//
+// If a packet has a deadline hint that cannot be met with the expected latency
+// of the path for its class, the path for interactive traffic is used.
+// The expected latency is the latency measured for the path (e.g. by a
+// PingingSelector on another connection), or the latency from the path
+// metadata.
+//
+// As for the DefaultSelector, SCMP down notifications affecting the path for
+// a class trigger failover to the next path in the ranking for that class.
+type ClassSelector struct {
+	mutex    sync.Mutex
+	policies map[TrafficClass]Policy
+	remote   scionAddr
+	paths    []*Path
+	ranked   map[TrafficClass][]*Path
+	current  map[TrafficClass]int
+	timeNow  func() time.Time
+}
+
+// NewClassSelector creates a ClassSelector with the default rankings.
+func NewClassSelector() *ClassSelector {
+	return NewClassSelectorWithPolicies(map[TrafficClass]Policy{
+		TrafficClassInteractive: LowestLatency{},
+		TrafficClassBulk:        HighestBandwidth{},
+	})
+}
+
+// NewClassSelectorWithPolicies creates a ClassSelector using the given policies
+// to rank the paths for each traffic class. Classes without policy use the
+// order of the connection's Policy, except for TrafficClassBackground, which
+// uses this order but avoids the paths used for the other classes.
+func NewClassSelectorWithPolicies(policies map[TrafficClass]Policy) *ClassSelector {
+	return &ClassSelector{
+		policies: policies,
+		ranked:   make(map[TrafficClass][]*Path),
+		current:  make(map[TrafficClass]int),
+		timeNow:  time.Now,
+	}
+}
+
+func (s *ClassSelector) Path(ctx context.Context) *Path {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.paths) == 0 {
+		return nil
+	}
+	class := TrafficClassFromContext(ctx)
+	path := s.currentPath(class)
+	if deadline, ok := DeadlineHintFromContext(ctx); ok && class != TrafficClassInteractive {
+		if latency, known := expectedLatency(s.remote, path); !known || latency > deadline.Sub(s.timeNow()) {
+			return s.currentPath(TrafficClassInteractive)
+		}
+	}
+	return path
+}
+
+func (s *ClassSelector) Initialize(local, remote UDPAddr, paths []*Path) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.remote = remote.scionAddr()
+	s.rank(paths)
+}
+
+func (s *ClassSelector) Refresh(paths []*Path) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.rank(paths)
+}
+
+func (s *ClassSelector) PathDown(pf PathFingerprint, pi PathInterface) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for class, ranked := range s.ranked {
+		if len(ranked) == 0 {
+			continue
+		}
+		current := ranked[s.current[class]]
+		if pf == current.Fingerprint || (current.Metadata != nil && isInterfaceOnPath(current, pi)) {
+			if better := stats.FirstMoreAlive(current, ranked); better >= 0 {
+				s.current[class] = better
+			}
+		}
+	}
+}
+
+func (s *ClassSelector) Close() error {
+	return nil
+}
+
+func (s *ClassSelector) explainPath(path *Path) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var classes []string
+	for _, class := range []TrafficClass{
+		TrafficClassDefault, TrafficClassInteractive, TrafficClassBulk, TrafficClassBackground,
+	} {
+		if current := s.currentPath(class); current != nil && current.Fingerprint == path.Fingerprint {
+			classes = append(classes, class.String())
+		}
+	}
+	if len(classes) == 0 {
+		return "path no longer known"
+	}
+	return "current path for traffic class " + strings.Join(classes, ", ")
+}
+
+// currentPath returns the current path for the class. Assumes that the paths
+// are not empty.
+func (s *ClassSelector) currentPath(class TrafficClass) *Path {
+	if _, ok := s.ranked[class]; !ok {
+		class = TrafficClassDefault
+	}
+	return s.ranked[class][s.current[class]]
+}
+
+// rank computes the ranking of the paths for each class. The current path for
+// a class is kept if it is still available.
+func (s *ClassSelector) rank(paths []*Path) {
+	ranked := map[TrafficClass][]*Path{
+		TrafficClassDefault: paths,
+	}
+	for class, policy := range s.policies {
+		// policies may sort in place
+		ranked[class] = policy.Filter(append([]*Path(nil), paths...))
+	}
+	if _, ok := ranked[TrafficClassBackground]; !ok && len(paths) > 0 {
+		ranked[TrafficClassBackground] = avoidPaths(paths,
+			firstPath(ranked[TrafficClassInteractive]), firstPath(ranked[TrafficClassBulk]))
+	}
+
+	current := make(map[TrafficClass]int, len(ranked))
+	for class, r := range ranked {
+		current[class] = 0
+		if old, ok := s.ranked[class]; ok && len(old) > 0 {
+			fingerprint := old[s.current[class]].Fingerprint
+			for i, p := range r {
+				if p.Fingerprint == fingerprint {
+					current[class] = i
+					break
+				}
+			}
+		}
+		if len(r) == 0 {
+			// the policy for this class rejected all paths; fall back to default
+			delete(ranked, class)
+		}
+	}
+	s.paths = paths
+	s.ranked = ranked
+	s.current = current
+}
+
+func firstPath(paths []*Path) *Path {
+	if len(paths) == 0 {
+		return nil
+	}
+	return paths[0]
+}
+
+// avoidPaths returns a copy of paths, where the paths to avoid are moved to the
+// end.
+func avoidPaths(paths []*Path, avoid ...*Path) []*Path {
+	isAvoided := func(p *Path) bool {
+		for _, a := range avoid {
+			if a != nil && a.Fingerprint == p.Fingerprint {
+				return true
+			}
+		}
+		return false
+	}
+	ret := make([]*Path, 0, len(paths))
+	var avoided []*Path
+	for _, p := range paths {
+		if isAvoided(p) {
+			avoided = append(avoided, p)
+		} else {
+			ret = append(ret, p)
+		}
+	}
+	return append(ret, avoided...)
+}
+
+// expectedLatency returns the expected one-way latency for a packet on path
+// to dst, based on the measured round trip time or, if not available, the
+// path metadata.
+func expectedLatency(dst scionAddr, path *Path) (time.Duration, bool) {
+	if rtt, ok := stats.Latency(dst, path.Fingerprint); ok {
+		return rtt / 2, true
+	}
+	if path.Metadata == nil || len(path.Metadata.Interfaces) == 0 {
+		return 0, false
+	}
+	latency, unknown := path.Metadata.latencySum()
+	return latency, len(unknown) == 0
+}
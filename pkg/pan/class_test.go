@@ -0,0 +1,122 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrafficClassContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, TrafficClassDefault, TrafficClassFromContext(ctx))
+	assert.Equal(t, TrafficClassDefault, TrafficClassFromContext(nil)) //nolint:staticcheck
+	_, ok := DeadlineHintFromContext(ctx)
+	assert.False(t, ok)
+
+	deadline := time.Now().Add(time.Second)
+	ctx = WithDeadlineHint(WithTrafficClass(ctx, TrafficClassBulk), deadline)
+	assert.Equal(t, TrafficClassBulk, TrafficClassFromContext(ctx))
+	d, ok := DeadlineHintFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, deadline, d)
+
+	assert.Equal(t, "interactive", TrafficClassInteractive.String())
+	assert.Equal(t, "TrafficClass(7)", TrafficClass(7).String())
+}
+
+func TestClassSelector(t *testing.T) {
+	asA := MustParseIA("1-ff00:0:110")
+	asB := MustParseIA("1-ff00:0:111")
+	remote := UDPAddr{IA: asB, IP: netip.MustParseAddr("192.0.2.1"), Port: 1234}
+
+	makePath := func(fingerprint PathFingerprint, ifID IfID, latency time.Duration, bandwidth uint64) *Path {
+		return &Path{
+			Source:      asA,
+			Destination: asB,
+			Fingerprint: fingerprint,
+			Metadata: &PathMetadata{
+				Interfaces: []PathInterface{{IA: asA, IfID: ifID}, {IA: asB, IfID: ifID}},
+				Latency:    []time.Duration{latency},
+				Bandwidth:  []uint64{bandwidth},
+			},
+		}
+	}
+	fast := makePath("fast", 1, 10*time.Millisecond, 100)
+	wide := makePath("wide", 2, 50*time.Millisecond, 1000)
+	other := makePath("other", 3, 30*time.Millisecond, 10)
+	paths := func() []*Path { return []*Path{other, wide, fast} }
+
+	ctxFor := func(class TrafficClass) context.Context {
+		return WithTrafficClass(context.Background(), class)
+	}
+
+	t.Run("ranking", func(t *testing.T) {
+		stats = newPathStatsDB()
+		s := NewClassSelector()
+		assert.Nil(t, s.Path(context.Background()))
+		s.Initialize(UDPAddr{}, remote, paths())
+		assert.Equal(t, other, s.Path(context.Background()))
+		assert.Equal(t, other, s.Path(ctxFor(TrafficClassDefault)))
+		assert.Equal(t, fast, s.Path(ctxFor(TrafficClassInteractive)))
+		assert.Equal(t, wide, s.Path(ctxFor(TrafficClassBulk)))
+		assert.Equal(t, other, s.Path(ctxFor(TrafficClassBackground)))
+		assert.Equal(t, other, s.Path(ctxFor(TrafficClass(42))), "unknown class uses default")
+	})
+
+	t.Run("deadline hint", func(t *testing.T) {
+		stats = newPathStatsDB()
+		s := NewClassSelector()
+		now := time.Now()
+		s.timeNow = func() time.Time { return now }
+		s.Initialize(UDPAddr{}, remote, paths())
+
+		bulk := ctxFor(TrafficClassBulk)
+		assert.Equal(t, wide, s.Path(WithDeadlineHint(bulk, now.Add(100*time.Millisecond))))
+		assert.Equal(t, fast, s.Path(WithDeadlineHint(bulk, now.Add(20*time.Millisecond))))
+
+		// measured latency takes precedence over metadata
+		stats.RecordLatency(remote.scionAddr(), wide.Fingerprint, 20*time.Millisecond)
+		assert.Equal(t, wide, s.Path(WithDeadlineHint(bulk, now.Add(20*time.Millisecond))))
+	})
+
+	t.Run("refresh keeps current", func(t *testing.T) {
+		stats = newPathStatsDB()
+		s := NewClassSelectorWithPolicies(nil)
+		s.Initialize(UDPAddr{}, remote, paths())
+		assert.Equal(t, other, s.Path(context.Background()))
+		s.Refresh([]*Path{fast, other})
+		assert.Equal(t, other, s.Path(context.Background()), "current path is kept")
+		s.Refresh([]*Path{wide, fast})
+		assert.Equal(t, wide, s.Path(context.Background()), "current path gone, first path")
+	})
+
+	t.Run("path down", func(t *testing.T) {
+		stats = newPathStatsDB()
+		s := NewClassSelector()
+		s.Initialize(UDPAddr{}, remote, paths())
+
+		down := fast.Metadata.Interfaces[0]
+		stats.recordPathDown(fast.Fingerprint, down)
+		s.PathDown(fast.Fingerprint, down)
+		assert.Equal(t, other, s.Path(ctxFor(TrafficClassInteractive)))
+		assert.Equal(t, wide, s.Path(ctxFor(TrafficClassBulk)), "other classes unaffected")
+		assert.Equal(t, other, s.Path(ctxFor(TrafficClassDefault)))
+	})
+}
@@ -16,6 +16,8 @@ package pan
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -42,7 +44,23 @@ var (
 //   - an option --preference <preference>, sorting order for paths.
 //     Comma-separated list of available sorting options.
 //   - an option --sequence <sequence>, describing a hop-predicate sequence filter
+//
+// See PolicyFromCommandlineWithChoice for the additional --path-choice option.
 func PolicyFromCommandline(sequence string, preference string, interactive bool) (Policy, error) {
+	return PolicyFromCommandlineWithChoice(sequence, preference, interactive, "")
+}
+
+// PolicyFromCommandlineWithChoice is PolicyFromCommandline with the additional
+// option
+//   - an option --path-choice <choice>, the paths to use instead of prompting
+//     for --interactive, as path indices or a hop-predicate sequence. Implies
+//     --interactive. Required if stdin is not a terminal, unless paths to the
+//     destination were chosen before.
+//
+// The interactive path choices are remembered in DefaultPathChoicesFile.
+func PolicyFromCommandlineWithChoice(sequence string, preference string, interactive bool,
+	pathChoice string) (Policy, error) {
+
 	chain := PolicyChain{}
 	if sequence != "" {
 		seq, err := NewSequence(sequence)
@@ -62,9 +80,12 @@ func PolicyFromCommandline(sequence string, preference string, interactive bool)
 			}
 		}
 	}
-	if interactive {
+	if interactive || pathChoice != "" {
 		chain = append(chain, &InteractiveSelection{
-			Prompter: CommandlinePrompter{},
+			Prompter: CommandlinePrompter{
+				Choice:      pathChoice,
+				ChoicesFile: DefaultPathChoicesFile(),
+			},
 		})
 	}
 	if len(chain) == 1 {
@@ -73,3 +94,15 @@ func PolicyFromCommandline(sequence string, preference string, interactive bool)
 		return chain, nil
 	}
 }
+
+// DefaultPathChoicesFile returns the file in which interactive path choices
+// are remembered by default, scion/path-choices.json in the user's
+// configuration directory. Returns an empty string if there is no
+// configuration directory.
+func DefaultPathChoicesFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "scion", "path-choices.json")
+}
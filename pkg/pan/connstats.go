@@ -0,0 +1,295 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/snet"
+)
+
+// ConnStats is a snapshot of the statistics of a connection, as returned by
+// Conn.Stats and ListenConn.Stats.
+// The byte counts are the sizes of the UDP payloads, including the messages
+// exchanged internally by pan, e.g. for source address validation.
+type ConnStats struct {
+	PacketsSent     uint64 `json:"packets_sent"`
+	BytesSent       uint64 `json:"bytes_sent"`
+	PacketsReceived uint64 `json:"packets_received"`
+	BytesReceived   uint64 `json:"bytes_received"`
+	// Paths are the counters for each path, in the order of first use.
+	// Packets within the local AS are only included in the totals, as are the
+	// packets on further paths once the maximum number of paths is recorded.
+	Paths []PathCounters `json:"paths,omitempty"`
+	// CurrentPath is the path last chosen by the path selector of a Conn.
+	CurrentPath *PathSwitch `json:"current_path,omitempty"`
+	// PreviousPaths are the paths chosen before CurrentPath, the most recent
+	// first.
+	PreviousPaths []PathSwitch `json:"previous_paths,omitempty"`
+	// SCMPErrors counts the SCMP messages received, by type and code.
+	SCMPErrors map[string]uint64 `json:"scmp_errors,omitempty"`
+}
+
+// PathCounters are the counters for one path in ConnStats.
+// Received packets are counted for the path on which replies are sent, i.e.
+// the reverse of the path on which they were received.
+type PathCounters struct {
+	Fingerprint PathFingerprint `json:"fingerprint"`
+	// Path is the path in human readable form, if the path was used for
+	// sending.
+	Path            string    `json:"path,omitempty"`
+	PacketsSent     uint64    `json:"packets_sent"`
+	BytesSent       uint64    `json:"bytes_sent"`
+	PacketsReceived uint64    `json:"packets_received"`
+	BytesReceived   uint64    `json:"bytes_received"`
+	LastSent        time.Time `json:"last_sent,omitzero"`
+	LastReceived    time.Time `json:"last_received,omitzero"`
+}
+
+// PathSwitch records the time during which a path was chosen by the path
+// selector.
+type PathSwitch struct {
+	Fingerprint PathFingerprint `json:"fingerprint"`
+	Path        string          `json:"path"`
+	Since       time.Time       `json:"since"`
+	// Until is zero for the current path.
+	Until time.Time `json:"until,omitzero"`
+}
+
+// connStats collects the statistics for a connection.
+type connStats struct {
+	mutex    sync.Mutex
+	totals   ConnStats
+	paths    map[PathFingerprint]*PathCounters
+	order    []PathFingerprint
+	current  *PathSwitch
+	previous []PathSwitch
+	scmp     map[string]uint64
+	// lastRaw is the raw dataplane path of the last packet received, and
+	// lastFingerprint the fingerprint of its reverse. Cached, as consecutive
+	// packets are usually received on the same path.
+	lastRaw         []byte
+	lastFingerprint PathFingerprint
+	timeNow         func() time.Time
+}
+
+func newConnStats() *connStats {
+	return &connStats{
+		paths:   make(map[PathFingerprint]*PathCounters),
+		scmp:    make(map[string]uint64),
+		timeNow: time.Now,
+	}
+}
+
+// pathCounters returns the counters for the path with fingerprint pf, or nil
+// if no more paths are recorded.
+// Must be called with the mutex held.
+func (s *connStats) pathCounters(pf PathFingerprint) *PathCounters {
+	pc, ok := s.paths[pf]
+	if !ok {
+		if len(s.paths) >= maxConnStatsPaths {
+			return nil
+		}
+		pc = &PathCounters{Fingerprint: pf}
+		s.paths[pf] = pc
+		s.order = append(s.order, pf)
+	}
+	return pc
+}
+
+// sent records a packet with a payload of n bytes sent via path.
+func (s *connStats) sent(path *Path, n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.totals.PacketsSent++
+	s.totals.BytesSent += uint64(n)
+	if path == nil {
+		return
+	}
+	if pc := s.pathCounters(path.Fingerprint); pc != nil {
+		if pc.Path == "" {
+			pc.Path = path.String()
+		}
+		pc.PacketsSent++
+		pc.BytesSent += uint64(n)
+		pc.LastSent = s.timeNow()
+	}
+}
+
+// received records a packet with a payload of n bytes received via the
+// dataplane path dp.
+func (s *connStats) received(dp snet.DataplanePath, n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.totals.PacketsReceived++
+	s.totals.BytesReceived += uint64(n)
+	rp, ok := dp.(snet.RawPath)
+	if !ok || len(rp.Raw) == 0 {
+		return
+	}
+	if !bytes.Equal(rp.Raw, s.lastRaw) {
+		pf, err := reversePathFingerprint(rp)
+		if err != nil {
+			return
+		}
+		s.lastRaw = append(s.lastRaw[:0], rp.Raw...)
+		s.lastFingerprint = pf
+	}
+	if pc := s.pathCounters(s.lastFingerprint); pc != nil {
+		pc.PacketsReceived++
+		pc.BytesReceived += uint64(n)
+		pc.LastReceived = s.timeNow()
+	}
+}
+
+// selected records the path chosen by the path selector.
+func (s *connStats) selected(path *Path) {
+	if path == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.current != nil && s.current.Fingerprint == path.Fingerprint {
+		return
+	}
+	now := s.timeNow()
+	if s.current != nil {
+		prev := *s.current
+		prev.Until = now
+		if len(s.previous) >= maxConnStatsPreviousPaths {
+			s.previous = s.previous[:maxConnStatsPreviousPaths-1]
+		}
+		s.previous = append([]PathSwitch{prev}, s.previous...)
+	}
+	s.current = &PathSwitch{
+		Fingerprint: path.Fingerprint,
+		Path:        path.String(),
+		Since:       now,
+	}
+}
+
+func (s *connStats) scmpReceived(typeCode slayers.SCMPTypeCode) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.scmp[typeCode.String()]++
+}
+
+// snapshot returns a copy of the current statistics.
+func (s *connStats) snapshot() ConnStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ret := s.totals
+	for _, pf := range s.order {
+		ret.Paths = append(ret.Paths, *s.paths[pf])
+	}
+	if s.current != nil {
+		current := *s.current
+		ret.CurrentPath = &current
+	}
+	ret.PreviousPaths = append([]PathSwitch(nil), s.previous...)
+	if len(s.scmp) > 0 {
+		ret.SCMPErrors = make(map[string]uint64, len(s.scmp))
+		for k, v := range s.scmp {
+			ret.SCMPErrors[k] = v
+		}
+	}
+	return ret
+}
+
+// statsSCMPHandler counts the SCMP messages received in the connStats before
+// passing them on to the SCMP handler of the connection.
+type statsSCMPHandler struct {
+	handler snet.SCMPHandler
+	stats   *connStats
+}
+
+func (h statsSCMPHandler) Handle(pkt *snet.Packet) error {
+	if scmp, ok := pkt.Payload.(snet.SCMPPayload); ok {
+		h.stats.scmpReceived(slayers.CreateSCMPTypeCode(scmp.Type(), scmp.Code()))
+	}
+	return h.handler.Handle(pkt)
+}
+
+// QUICStats is a snapshot of the statistics of a QUICConn, with the
+// statistics of the underlying Conn and the state of the QUIC congestion
+// controller.
+type QUICStats struct {
+	ConnStats
+	SmoothedRTT      time.Duration `json:"smoothed_rtt"`
+	MinRTT           time.Duration `json:"min_rtt"`
+	LatestRTT        time.Duration `json:"latest_rtt"`
+	CongestionWindow uint64        `json:"congestion_window"`
+	BytesInFlight    uint64        `json:"bytes_in_flight"`
+}
+
+// quicMetrics records the metrics reported by the QUIC connection tracer.
+type quicMetrics struct {
+	mutex            sync.Mutex
+	smoothedRTT      time.Duration
+	minRTT           time.Duration
+	latestRTT        time.Duration
+	congestionWindow uint64
+	bytesInFlight    uint64
+}
+
+func (m *quicMetrics) tracer() *logging.ConnectionTracer {
+	return &logging.ConnectionTracer{
+		UpdatedMetrics: func(rttStats *logging.RTTStats, cwnd, bytesInFlight logging.ByteCount, _ int) {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			m.smoothedRTT = rttStats.SmoothedRTT()
+			m.minRTT = rttStats.MinRTT()
+			m.latestRTT = rttStats.LatestRTT()
+			m.congestionWindow = uint64(cwnd)
+			m.bytesInFlight = uint64(bytesInFlight)
+		},
+	}
+}
+
+func (m *quicMetrics) addTo(s *QUICStats) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	s.SmoothedRTT = m.smoothedRTT
+	s.MinRTT = m.minRTT
+	s.LatestRTT = m.latestRTT
+	s.CongestionWindow = m.congestionWindow
+	s.BytesInFlight = m.bytesInFlight
+}
+
+// withMetricsTracer returns a copy of the quic.Config, with a tracer recording
+// the metrics in m in addition to the tracer configured, if any.
+func withMetricsTracer(conf *quic.Config, m *quicMetrics) *quic.Config {
+	if conf == nil {
+		conf = &quic.Config{}
+	} else {
+		conf = conf.Clone()
+	}
+	configured := conf.Tracer
+	conf.Tracer = func(ctx context.Context, p logging.Perspective, id quic.ConnectionID) *logging.ConnectionTracer {
+		if configured != nil {
+			if t := configured(ctx, p, id); t != nil {
+				return logging.NewMultiplexedConnectionTracer(t, m.tracer())
+			}
+		}
+		return m.tracer()
+	}
+	return conf
+}
@@ -0,0 +1,163 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+	"github.com/scionproto/scion/pkg/slayers"
+	"github.com/scionproto/scion/pkg/snet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnStats(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s := newConnStats()
+	s.timeNow = func() time.Time { return now }
+	a := &Path{Fingerprint: "a"}
+	b := &Path{Fingerprint: "b"}
+
+	s.selected(a)
+	s.sent(a, 100)
+	s.sent(a, 50)
+	s.sent(nil, 10)
+	now = now.Add(time.Second)
+	s.selected(a)
+	s.selected(b)
+	s.sent(b, 20)
+	now = now.Add(time.Second)
+	s.selected(a)
+	s.scmpReceived(slayers.CreateSCMPTypeCode(slayers.SCMPTypeExternalInterfaceDown, 0))
+	s.scmpReceived(slayers.CreateSCMPTypeCode(slayers.SCMPTypeExternalInterfaceDown, 0))
+
+	stats := s.snapshot()
+	assert.Equal(t, uint64(4), stats.PacketsSent)
+	assert.Equal(t, uint64(180), stats.BytesSent)
+	require.Len(t, stats.Paths, 2)
+	assert.Equal(t, PathCounters{
+		Fingerprint: "a",
+		Path:        a.String(),
+		PacketsSent: 2,
+		BytesSent:   150,
+		LastSent:    time.Unix(1000, 0),
+	}, stats.Paths[0])
+	assert.Equal(t, PathFingerprint("b"), stats.Paths[1].Fingerprint)
+	assert.Equal(t, uint64(20), stats.Paths[1].BytesSent)
+
+	assert.Equal(t, &PathSwitch{Fingerprint: "a", Path: a.String(), Since: time.Unix(1002, 0)}, stats.CurrentPath)
+	assert.Equal(t, []PathSwitch{
+		{Fingerprint: "b", Path: b.String(), Since: time.Unix(1001, 0), Until: time.Unix(1002, 0)},
+		{Fingerprint: "a", Path: a.String(), Since: time.Unix(1000, 0), Until: time.Unix(1001, 0)},
+	}, stats.PreviousPaths)
+	assert.Equal(t, map[string]uint64{"ExternalInterfaceDown": 2}, stats.SCMPErrors)
+
+	// the snapshot is not affected by later updates
+	s.sent(a, 1)
+	assert.Equal(t, uint64(2), stats.Paths[0].PacketsSent)
+
+	encoded, err := json.Marshal(stats)
+	require.NoError(t, err)
+	var decoded ConnStats
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	reencoded, err := json.Marshal(decoded)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(encoded), string(reencoded))
+
+	t.Run("previous paths bounded", func(t *testing.T) {
+		s := newConnStats()
+		for i := 0; i < 2*maxConnStatsPreviousPaths; i++ {
+			s.selected(&Path{Fingerprint: PathFingerprint(rune('a' + i%2))})
+		}
+		assert.Len(t, s.snapshot().PreviousPaths, maxConnStatsPreviousPaths)
+	})
+}
+
+func TestConnStatsLoopback(t *testing.T) {
+	p := newLoopbackPair(t)
+	p.a.connStats = newConnStats()
+	p.b.connStats = newConnStats()
+
+	for _, payload := range []string{"hello", "world!"} {
+		_, err := p.a.writeMsg(p.addrA, p.addrB, p.pathAB, []byte(payload), decidedBy("test"))
+		require.NoError(t, err)
+		buf := make([]byte, 100)
+		_, _, _, err = p.b.readMsg(buf)
+		require.NoError(t, err)
+	}
+	_, err := p.a.writeBatch(p.addrA, []Message{{Buffer: []byte("a")}, {Buffer: []byte("bc")}},
+		func(m *Message) (UDPAddr, *Path, pathDecision, error) {
+			return p.addrB, p.pathAB, decidedBy("test"), nil
+		})
+	require.NoError(t, err)
+	msgs := []Message{{Buffer: make([]byte, 100)}, {Buffer: make([]byte, 100)}}
+	for read := 0; read < 2; {
+		n, err := p.b.readBatch(msgs[:2-read], make([]ForwardingPath, 2))
+		require.NoError(t, err)
+		read += n
+	}
+
+	sent := p.a.Stats()
+	assert.Equal(t, uint64(4), sent.PacketsSent)
+	assert.Equal(t, uint64(14), sent.BytesSent)
+	require.Len(t, sent.Paths, 1)
+	assert.Equal(t, p.pathAB.Fingerprint, sent.Paths[0].Fingerprint)
+	assert.Equal(t, uint64(4), sent.Paths[0].PacketsSent)
+
+	received := p.b.Stats()
+	assert.Equal(t, uint64(4), received.PacketsReceived)
+	assert.Equal(t, uint64(14), received.BytesReceived)
+	require.Len(t, received.Paths, 1, "all packets received on the same path")
+	// the test paths traverse the interfaces 1 and 2
+	assert.Equal(t, PathFingerprint("2 1"), received.Paths[0].Fingerprint, "counted for the reply path")
+	assert.Equal(t, uint64(4), received.Paths[0].PacketsReceived)
+
+	assert.Equal(t, ConnStats{}, (&baseUDPConn{}).Stats(), "no statistics")
+}
+
+func TestStatsSCMPHandler(t *testing.T) {
+	s := newConnStats()
+	h := statsSCMPHandler{handler: DefaultSCMPHandler{}, stats: s}
+	pkt := &snet.Packet{
+		PacketInfo: snet.PacketInfo{
+			Payload: snet.SCMPDestinationUnreachable{},
+		},
+	}
+	err := h.Handle(pkt)
+	assert.Error(t, err, "passed on to the handler")
+	assert.Equal(t, map[string]uint64{
+		slayers.CreateSCMPTypeCode(slayers.SCMPTypeDestinationUnreachable, 0).String(): 1,
+	}, s.snapshot().SCMPErrors)
+}
+
+func TestQUICMetrics(t *testing.T) {
+	m := &quicMetrics{}
+	conf := withMetricsTracer(nil, m)
+	tracer := conf.Tracer(t.Context(), logging.PerspectiveClient, quic.ConnectionID{})
+	var rtt logging.RTTStats
+	rtt.UpdateRTT(20*time.Millisecond, 0)
+	tracer.UpdatedMetrics(&rtt, 12000, 3000, 2)
+
+	var stats QUICStats
+	m.addTo(&stats)
+	assert.Equal(t, 20*time.Millisecond, stats.SmoothedRTT)
+	assert.Equal(t, 20*time.Millisecond, stats.MinRTT)
+	assert.Equal(t, uint64(12000), stats.CongestionWindow)
+	assert.Equal(t, uint64(3000), stats.BytesInFlight)
+}
@@ -22,10 +22,18 @@ import (
 
 var ErrNoPath = errors.New("no path")
 
+// ErrPathExpired is returned when writing to a remote for which only expired
+// paths are available. Errors wrapping ErrPathExpired also wrap ErrNoPath.
+var ErrPathExpired = errors.New("all paths expired")
+
 func errNoPathTo(ia IA) error {
 	return fmt.Errorf("%w to %s", ErrNoPath, ia)
 }
 
+func errPathExpiredTo(ia IA) error {
+	return fmt.Errorf("%w to %s: %w", ErrNoPath, ia, ErrPathExpired)
+}
+
 const (
 	// pathRefreshMinInterval is the minimum time between two path refreshs
 	pathRefreshMinInterval = 10 * time.Second
@@ -39,12 +47,52 @@ const (
 	// that is no longer returned from a path query is dropped from the cache.
 	pathPruneLeadTime = pathRefreshMinInterval
 
+	// pathQueryTimeout is the timeout for a single path query. A query is
+	// shared by all callers waiting for paths to the same destination, so it
+	// is not aborted when the caller that started it gives up.
+	pathQueryTimeout = 10 * time.Second
+	// maxConcurrentPathQueries bounds the number of path queries running
+	// at the same time, for different destinations.
+	maxConcurrentPathQueries = 16
+	// noPathMinBackoff and noPathMaxBackoff bound the time during which no
+	// new path query is made for a destination for which the last query
+	// returned no paths. The time doubles for every such query.
+	noPathMinBackoff = time.Second
+	noPathMaxBackoff = time.Minute
+
+	// defaultPathExpiryMargin specifies when, relative to its expiry, a
+	// connection stops using a path if other paths are available.
+	defaultPathExpiryMargin = 30 * time.Second
+
 	pathDownNotificationTimeout         = 10 * time.Second
 	pathDownNotificationChannelCapacity = 8
 
 	defaultSelectorMaxReplyPaths = 4
 
 	statsNumLatencySamples = 4
+
+	// maxConnStatsPaths bounds the number of paths with individual counters
+	// in the statistics of a connection.
+	maxConnStatsPaths = 256
+	// maxConnStatsPreviousPaths bounds the number of previously chosen paths
+	// recorded in the statistics of a connection.
+	maxConnStatsPreviousPaths = 16
+
+	// udpHeaderLen is the length of the SCION/UDP header.
+	udpHeaderLen = 8
+
+	// defaultQUICPacketSize is the size of the QUIC packets sent by quic-go,
+	// if it is not configured. Path MTU discovery is not available on SCION.
+	defaultQUICPacketSize = 1280
+	// minQUICPacketSize and maxQUICPacketSize bound the packet size
+	// accepted by quic-go.
+	minQUICPacketSize = 1200
+	maxQUICPacketSize = 1452
+	// quicDatagramOverhead is an upper bound for the overhead of a QUIC short
+	// header packet with a single DATAGRAM frame: 1 byte header flags, up to
+	// 20 bytes connection ID, up to 4 bytes packet number, 16 bytes AEAD tag
+	// and 3 bytes frame type and length.
+	quicDatagramOverhead = 1 + 20 + 4 + 16 + 3
 )
 
 // maxTime is the maximum usable time value (https://stackoverflow.com/a/32620397)
@@ -0,0 +1,199 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Dialer contains options for connecting to an address over SCION.
+// Its DialContext method has the signature of net.Dialer.DialContext, so that
+// it can be plugged into libraries that accept a custom dial function, like
+// net/http.Transport, grpc.WithContextDialer or database drivers.
+//
+// The zero value is a Dialer without any options.
+type Dialer struct {
+	// Local is the local address. See note on wildcard addresses in the
+	// package documentation.
+	Local netip.AddrPort
+	// Policy is the path policy for the connections.
+	Policy Policy
+	// NewSelector, if set, creates the path selector for each connection.
+	// A selector holds per-connection state, and so cannot be shared between
+	// connections.
+	NewSelector func() Selector
+	// ConnOptions are additional options for the connections.
+	ConnOptions []ConnOptions
+	// TLSConfig is the TLS configuration for the QUIC networks. If it does not
+	// define any application protocols (NextProtos), the protocols of the
+	// network are used. If nil, a configuration that does NOT verify the
+	// server certificate is used, like for shttp.
+	TLSConfig *tls.Config
+	// QUICConfig is the configuration for the QUIC networks, may be nil.
+	QUICConfig *quic.Config
+	// Timeout is the maximum amount of time a dial, including name resolution
+	// and the QUIC handshake, will wait for a connection to be established.
+	// The default is no timeout, apart from the deadline of the context.
+	Timeout time.Duration
+}
+
+// DialContext connects to the address on the named network.
+//
+// The supported networks are "udp", returning a Conn, and the networks
+// registered with RegisterQUICNetwork. The package quicutil registers "quic",
+// for a single, bi-directional QUIC stream (see quicutil.SingleStream) and
+// "quic-datagram", for QUIC datagrams.
+//
+// The address is resolved with ResolveUDPAddr, after reverting a mangled SCION
+// address (see UnmangleSCIONAddr).
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	var quicNetwork QUICNetwork
+	if network != "udp" {
+		var ok bool
+		quicNetwork, ok = lookupQUICNetwork(network)
+		if !ok {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: net.UnknownNetworkError(network)}
+		}
+	}
+	remote, err := ResolveUDPAddr(ctx, UnmangleSCIONAddr(address))
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	if network == "udp" {
+		conn, err := DialUDP(ctx, d.Local, remote, d.connOptions()...)
+		if err != nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Addr: remote, Err: err}
+		}
+		return conn, nil
+	}
+
+	tlsConf := d.tlsConfig(quicNetwork)
+	quicConf := d.QUICConfig
+	if quicNetwork.EnableDatagrams {
+		quicConf = withDatagrams(quicConf)
+	}
+	session, err := DialQUIC(ctx, d.Local, remote, MangleSCIONAddr(address), tlsConf, quicConf, d.connOptions()...)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Addr: remote, Err: err}
+	}
+	conn, err := quicNetwork.NewConn(session)
+	if err != nil {
+		_ = session.CloseWithError(0x101, "dial error")
+		return nil, &net.OpError{Op: "dial", Net: network, Addr: remote, Err: err}
+	}
+	return conn, nil
+}
+
+func (d *Dialer) connOptions() []ConnOptions {
+	opts := append([]ConnOptions{WithPolicy(d.Policy)}, d.ConnOptions...)
+	if d.NewSelector != nil {
+		opts = append(opts, WithSelector(d.NewSelector()))
+	}
+	return opts
+}
+
+// tlsConfig returns a copy of the TLS configuration for the network; DialQUIC
+// modifies the ServerName.
+func (d *Dialer) tlsConfig(n QUICNetwork) *tls.Config {
+	var tlsConf *tls.Config
+	if d.TLSConfig != nil {
+		tlsConf = d.TLSConfig.Clone()
+	} else {
+		tlsConf = &tls.Config{InsecureSkipVerify: true}
+	}
+	if len(tlsConf.NextProtos) == 0 {
+		tlsConf.NextProtos = append([]string(nil), n.NextProtos...)
+	}
+	return tlsConf
+}
+
+func withDatagrams(quicConf *quic.Config) *quic.Config {
+	if quicConf == nil {
+		return &quic.Config{EnableDatagrams: true}
+	}
+	quicConf = quicConf.Clone()
+	quicConf.EnableDatagrams = true
+	return quicConf
+}
+
+// QUICNetwork describes a network of Dialer.DialContext that is layered on a
+// QUIC connection.
+type QUICNetwork struct {
+	// NextProtos are the application protocols (ALPN) used if the TLS
+	// configuration of the Dialer defines none.
+	NextProtos []string
+	// EnableDatagrams enables QUIC datagrams (RFC 9221) on the connection.
+	EnableDatagrams bool
+	// NewConn returns the net.Conn on the established QUIC connection.
+	NewConn func(*QUICConn) (net.Conn, error)
+}
+
+var (
+	quicNetworksMutex sync.RWMutex
+	quicNetworks      = make(map[string]QUICNetwork)
+)
+
+// RegisterQUICNetwork makes a network available to Dialer.DialContext.
+// This is intended to be called from the init function of the package
+// implementing the network, analogous to database/sql.Register.
+// If RegisterQUICNetwork is called twice with the same name, or if NewConn is
+// nil, it panics.
+func RegisterQUICNetwork(name string, network QUICNetwork) {
+	quicNetworksMutex.Lock()
+	defer quicNetworksMutex.Unlock()
+	if network.NewConn == nil {
+		panic("nil NewConn not allowed")
+	}
+	if name == "udp" {
+		panic("RegisterQUICNetwork cannot replace network \"udp\"")
+	}
+	if _, dup := quicNetworks[name]; dup {
+		panic(fmt.Sprintf("RegisterQUICNetwork called twice for network %q", name))
+	}
+	quicNetworks[name] = network
+}
+
+// QUICNetworks returns a sorted list of the names of the registered QUIC networks.
+func QUICNetworks() []string {
+	quicNetworksMutex.RLock()
+	defer quicNetworksMutex.RUnlock()
+	names := make([]string, 0, len(quicNetworks))
+	for name := range quicNetworks {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func lookupQUICNetwork(name string) (QUICNetwork, bool) {
+	quicNetworksMutex.RLock()
+	defer quicNetworksMutex.RUnlock()
+	n, ok := quicNetworks[name]
+	return n, ok
+}
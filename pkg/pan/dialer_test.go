@@ -0,0 +1,125 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/scionproto/scion/pkg/snet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialer(t *testing.T) {
+	p := newLoopbackPair(t)
+	peer, peerAddr := p.b, p.addrB
+	useTestHostContext(t, hostContext{
+		ia: p.addrA.IA,
+		paths: PathProviderFunc(func(ctx context.Context, src, dst IA) ([]*Path, error) {
+			return []*Path{p.pathAB}, nil
+		}),
+		topology: snet.Topology{
+			PortRange: snet.TopologyPortRange{Start: 31000, End: 32767},
+			Interface: func(uint16) (netip.AddrPort, bool) { return netip.AddrPort{}, false },
+		},
+		hostInLocalAS: netip.MustParseAddr("127.0.0.1"),
+	})
+	ctx := context.Background()
+
+	t.Run("udp", func(t *testing.T) {
+		selectors := 0
+		d := &Dialer{
+			NewSelector: func() Selector {
+				selectors++
+				return NewDefaultSelector()
+			},
+		}
+		for _, address := range []string{peerAddr.String(), MangleSCIONAddr(peerAddr.String())} {
+			conn, err := d.DialContext(ctx, "udp", address)
+			require.NoError(t, err, address)
+			_, err = conn.Write([]byte(address))
+			require.NoError(t, err)
+			buf := make([]byte, 100)
+			require.NoError(t, peer.SetReadDeadline(time.Now().Add(time.Second)))
+			n, _, _, err := peer.readMsg(buf)
+			require.NoError(t, err)
+			assert.Equal(t, address, string(buf[:n]))
+			assert.NoError(t, conn.Close())
+		}
+		assert.Equal(t, 2, selectors, "one selector per connection")
+	})
+
+	t.Run("unknown network", func(t *testing.T) {
+		_, err := (&Dialer{}).DialContext(ctx, "tcp", peerAddr.String())
+		var unknown net.UnknownNetworkError
+		assert.True(t, errors.As(err, &unknown), "unexpected error %v", err)
+	})
+
+	t.Run("invalid address", func(t *testing.T) {
+		_, err := (&Dialer{}).DialContext(ctx, "udp", "1-ff00:0:111,[::1")
+		var opErr *net.OpError
+		assert.True(t, errors.As(err, &opErr), "unexpected error %v", err)
+	})
+}
+
+func TestDialerConfig(t *testing.T) {
+	n := QUICNetwork{NextProtos: []string{"foo"}}
+
+	d := &Dialer{}
+	tlsConf := d.tlsConfig(n)
+	assert.True(t, tlsConf.InsecureSkipVerify)
+	assert.Equal(t, []string{"foo"}, tlsConf.NextProtos)
+
+	d.TLSConfig = &tls.Config{ServerName: "bar"}
+	tlsConf = d.tlsConfig(n)
+	tlsConf.ServerName = "modified"
+	assert.False(t, tlsConf.InsecureSkipVerify)
+	assert.Equal(t, []string{"foo"}, tlsConf.NextProtos)
+	assert.Equal(t, "bar", d.TLSConfig.ServerName, "copy of the TLS config")
+	assert.Empty(t, d.TLSConfig.NextProtos)
+
+	d.TLSConfig.NextProtos = []string{"baz"}
+	assert.Equal(t, []string{"baz"}, d.tlsConfig(n).NextProtos)
+
+	assert.True(t, withDatagrams(nil).EnableDatagrams)
+	quicConf := &quic.Config{KeepAlivePeriod: time.Second}
+	assert.True(t, withDatagrams(quicConf).EnableDatagrams)
+	assert.Equal(t, time.Second, withDatagrams(quicConf).KeepAlivePeriod)
+	assert.False(t, quicConf.EnableDatagrams, "copy of the QUIC config")
+}
+
+func TestRegisterQUICNetwork(t *testing.T) {
+	newConn := func(*QUICConn) (net.Conn, error) { return nil, nil }
+	RegisterQUICNetwork("test-network", QUICNetwork{NewConn: newConn})
+	t.Cleanup(func() {
+		quicNetworksMutex.Lock()
+		defer quicNetworksMutex.Unlock()
+		delete(quicNetworks, "test-network")
+	})
+	assert.Contains(t, QUICNetworks(), "test-network")
+	_, ok := lookupQUICNetwork("test-network")
+	assert.True(t, ok)
+
+	assert.Panics(t, func() { RegisterQUICNetwork("test-network", QUICNetwork{NewConn: newConn}) })
+	assert.Panics(t, func() { RegisterQUICNetwork("udp", QUICNetwork{NewConn: newConn}) })
+	assert.Panics(t, func() { RegisterQUICNetwork("test-nil", QUICNetwork{}) })
+}
@@ -0,0 +1,345 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/scionproto/scion/pkg/snet"
+)
+
+// Impairment describes the network conditions emulated for packets sent over
+// a path.
+type Impairment struct {
+	// Delay is added to every packet.
+	Delay time.Duration
+	// Jitter is the maximum of a uniformly distributed random delay added on
+	// top of Delay. Jitter may reorder packets.
+	Jitter time.Duration
+	// Loss is the probability that a packet is dropped.
+	Loss float64
+	// BurstLossEnter and BurstLossExit define a Gilbert-Elliott loss model;
+	// BurstLossEnter is the probability to switch from the good to the bad
+	// state, BurstLossExit the probability to switch back. In the bad state,
+	// all packets are dropped. Disabled if BurstLossEnter is 0.
+	BurstLossEnter float64
+	BurstLossExit  float64
+	// Reorder is the probability that a packet is held back by ReorderDelay,
+	// in addition to any other delay.
+	Reorder      float64
+	ReorderDelay time.Duration
+	// Duplicate is the probability that a packet is sent twice.
+	Duplicate float64
+	// Rate limits the throughput, in bits of UDP payload per second. Unlimited
+	// if 0.
+	Rate uint64
+	// QueueLimit is the maximum queueing delay caused by the rate limit; packets
+	// that would be queued for longer are dropped. Defaults to 100ms.
+	QueueLimit time.Duration
+}
+
+const defaultEmulatorQueueLimit = 100 * time.Millisecond
+
+// Emulator applies configurable impairments to the packets sent on pan
+// connections. This allows to exercise path selection logic in tests,
+// without relying on real network failures or on privileged tools like netem.
+//
+// Impairments are configured per path (by fingerprint) or per interface.
+// For a packet sent over a path, the impairment for the path fingerprint is
+// used if set, otherwise the impairment for the first matching interface on
+// the path, otherwise the default impairment.
+// Note that reply paths on a ListenConn have no path metadata; for these,
+// interfaces are matched only by the interface ID.
+//
+// An Emulator is attached to connections with the WithEmulator or
+// WithListenEmulator options. Only packets sent are affected; to impair both
+// directions, an emulator needs to be attached to both ends.
+type Emulator struct {
+	mutex       sync.Mutex
+	rand        *rand.Rand
+	def         Impairment
+	paths       map[PathFingerprint]Impairment
+	interfaces  []interfaceImpairment
+	down        []*downWindow
+	pathStates  map[PathFingerprint]*emulatorPathState
+	notifyDown  func(PathFingerprint, PathInterface)
+	timeNow     func() time.Time
+	afterFunc   func(time.Duration, func())
+	sendPending sync.WaitGroup
+}
+
+type interfaceImpairment struct {
+	iface      PathInterface
+	impairment Impairment
+}
+
+type downWindow struct {
+	iface      PathInterface
+	start, end time.Time
+	// notified records the paths for which the down notification was sent
+	// during this window; notified once per path, not per dropped packet.
+	notified map[PathFingerprint]struct{}
+}
+
+type emulatorPathState struct {
+	burstLoss bool
+	nextFree  time.Time
+}
+
+// NewEmulator creates an Emulator without any impairments. The seed
+// initializes the random number generator, for reproducible tests.
+func NewEmulator(seed int64) *Emulator {
+	return &Emulator{
+		rand:       rand.New(rand.NewSource(seed)),
+		paths:      make(map[PathFingerprint]Impairment),
+		pathStates: make(map[PathFingerprint]*emulatorPathState),
+		notifyDown: stats.NotifyPathDown,
+		timeNow:    time.Now,
+		afterFunc: func(d time.Duration, f func()) {
+			time.AfterFunc(d, f)
+		},
+	}
+}
+
+// SetDefault sets the impairment for all paths not matched by any more specific
+// rule.
+func (e *Emulator) SetDefault(imp Impairment) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.def = imp
+}
+
+// SetPath sets the impairment for the path with fingerprint pf.
+func (e *Emulator) SetPath(pf PathFingerprint, imp Impairment) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.paths[pf] = imp
+}
+
+// SetInterface sets the impairment for all paths traversing the interface pi.
+func (e *Emulator) SetInterface(pi PathInterface, imp Impairment) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for i := range e.interfaces {
+		if e.interfaces[i].iface == pi {
+			e.interfaces[i].impairment = imp
+			return
+		}
+	}
+	e.interfaces = append(e.interfaces, interfaceImpairment{iface: pi, impairment: imp})
+}
+
+// Clear removes all impairments and scheduled link down windows.
+func (e *Emulator) Clear() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.def = Impairment{}
+	e.paths = make(map[PathFingerprint]Impairment)
+	e.interfaces = nil
+	e.down = nil
+	e.pathStates = make(map[PathFingerprint]*emulatorPathState)
+}
+
+// LinkDown schedules the interface pi to be down from start, for the given
+// duration. Packets sent over a path traversing a down interface are dropped
+// and, like a border router would, an SCMP external interface down
+// notification is injected for the path. The notification is injected once per
+// path and down window.
+func (e *Emulator) LinkDown(pi PathInterface, start time.Time, duration time.Duration) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.down = append(e.down, &downWindow{
+		iface:    pi,
+		start:    start,
+		end:      start.Add(duration),
+		notified: make(map[PathFingerprint]struct{}),
+	})
+}
+
+// Flush blocks until all delayed packets have been sent.
+func (e *Emulator) Flush() {
+	e.sendPending.Wait()
+}
+
+// send applies the impairments to a packet sent over path and invokes
+// sendFunc for each copy of the packet that survives, possibly with a delay.
+// The packet must not be reused by the caller.
+func (e *Emulator) send(path *Path, pkt *snet.Packet, sendFunc func(*snet.Packet) error) error {
+	delays := e.decide(path, packetLen(pkt))
+	for i, d := range delays {
+		p := pkt
+		if i > 0 {
+			p = clonePacket(pkt)
+		}
+		if d <= 0 {
+			if err := sendFunc(p); err != nil {
+				return err
+			}
+			continue
+		}
+		e.sendPending.Add(1)
+		e.afterFunc(d, func() {
+			defer e.sendPending.Done()
+			_ = sendFunc(p) // errors of delayed packets are lost, like on a real network
+		})
+	}
+	return nil
+}
+
+// decide determines the fate of a packet of the given size sent over path.
+// Returns the delays after which copies of the packet are to be sent; an
+// empty result means that the packet is dropped.
+func (e *Emulator) decide(path *Path, size int) []time.Duration {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	now := e.timeNow()
+	var pf PathFingerprint
+	if path != nil {
+		pf = path.Fingerprint
+	}
+	if w := e.downWindow(path, now); w != nil {
+		if _, ok := w.notified[pf]; !ok {
+			w.notified[pf] = struct{}{}
+			// notify asynchronously, the notifier may call back into selectors
+			go e.notifyDown(pf, w.iface)
+		}
+		return nil
+	}
+
+	imp := e.impairment(path)
+	state := e.pathStates[pf]
+	if state == nil {
+		state = &emulatorPathState{}
+		e.pathStates[pf] = state
+	}
+
+	if imp.BurstLossEnter > 0 {
+		if state.burstLoss {
+			state.burstLoss = e.rand.Float64() >= imp.BurstLossExit
+		} else {
+			state.burstLoss = e.rand.Float64() < imp.BurstLossEnter
+		}
+		if state.burstLoss {
+			return nil
+		}
+	}
+	if imp.Loss > 0 && e.rand.Float64() < imp.Loss {
+		return nil
+	}
+
+	var queueing time.Duration
+	if imp.Rate > 0 {
+		queueLimit := imp.QueueLimit
+		if queueLimit == 0 {
+			queueLimit = defaultEmulatorQueueLimit
+		}
+		start := now
+		if state.nextFree.After(start) {
+			start = state.nextFree
+		}
+		if start.Sub(now) > queueLimit {
+			return nil
+		}
+		transmission := time.Duration(uint64(size) * 8 * uint64(time.Second) / imp.Rate)
+		state.nextFree = start.Add(transmission)
+		queueing = state.nextFree.Sub(now)
+	}
+
+	copies := 1
+	if imp.Duplicate > 0 && e.rand.Float64() < imp.Duplicate {
+		copies = 2
+	}
+	delays := make([]time.Duration, copies)
+	for i := range delays {
+		d := queueing + imp.Delay
+		if imp.Jitter > 0 {
+			d += time.Duration(e.rand.Int63n(int64(imp.Jitter)))
+		}
+		if imp.Reorder > 0 && e.rand.Float64() < imp.Reorder {
+			d += imp.ReorderDelay
+		}
+		delays[i] = d
+	}
+	return delays
+}
+
+func (e *Emulator) impairment(path *Path) Impairment {
+	if path == nil {
+		return e.def
+	}
+	if imp, ok := e.paths[path.Fingerprint]; ok {
+		return imp
+	}
+	for _, ii := range e.interfaces {
+		if emulatorPathHasInterface(path, ii.iface) {
+			return ii.impairment
+		}
+	}
+	return e.def
+}
+
+// downWindow returns the active down window of an interface on path, or nil if
+// all interfaces of the path are up.
+func (e *Emulator) downWindow(path *Path, now time.Time) *downWindow {
+	if path == nil {
+		return nil
+	}
+	for _, w := range e.down {
+		if !now.Before(w.start) && now.Before(w.end) && emulatorPathHasInterface(path, w.iface) {
+			return w
+		}
+	}
+	return nil
+}
+
+// emulatorPathHasInterface checks whether pi is on path. For paths without
+// metadata, only the interface ID is compared, decoded from the forwarding
+// path.
+func emulatorPathHasInterface(path *Path, pi PathInterface) bool {
+	if path.Metadata != nil {
+		return isInterfaceOnPath(path, pi)
+	}
+	ifIDs, err := path.interfaceIDs()
+	if err != nil {
+		return false
+	}
+	for _, ifID := range ifIDs {
+		if ifID == pi.IfID {
+			return true
+		}
+	}
+	return false
+}
+
+func packetLen(pkt *snet.Packet) int {
+	if udp, ok := pkt.Payload.(snet.UDPPayload); ok {
+		return len(udp.Payload)
+	}
+	return len(pkt.Bytes)
+}
+
+// clonePacket returns a copy of pkt that does not share any buffers that the
+// caller may reuse.
+func clonePacket(pkt *snet.Packet) *snet.Packet {
+	clone := &snet.Packet{PacketInfo: pkt.PacketInfo}
+	if udp, ok := pkt.Payload.(snet.UDPPayload); ok {
+		udp.Payload = append([]byte(nil), udp.Payload...)
+		clone.Payload = udp
+	}
+	return clone
+}
@@ -0,0 +1,164 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/snet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmulatorDecide(t *testing.T) {
+	ia := MustParseIA("1-ff00:0:110")
+	pathA := &Path{
+		Fingerprint: "1 2",
+		Metadata: &PathMetadata{
+			Interfaces: []PathInterface{{IA: ia, IfID: 1}, {IA: ia, IfID: 2}},
+		},
+	}
+	// no metadata, as for reply paths
+	pathB := &Path{Fingerprint: "3 4", ForwardingPath: testForwardingPath(t, 3, 4)}
+
+	t.Run("no impairment", func(t *testing.T) {
+		e := NewEmulator(1)
+		assert.Equal(t, []time.Duration{0}, e.decide(pathA, 100))
+		assert.Equal(t, []time.Duration{0}, e.decide(nil, 100))
+	})
+
+	t.Run("precedence", func(t *testing.T) {
+		e := NewEmulator(1)
+		e.SetDefault(Impairment{Delay: 1 * time.Millisecond})
+		e.SetInterface(PathInterface{IA: ia, IfID: 2}, Impairment{Delay: 2 * time.Millisecond})
+		e.SetInterface(PathInterface{IA: ia, IfID: 4}, Impairment{Delay: 4 * time.Millisecond})
+		assert.Equal(t, []time.Duration{2 * time.Millisecond}, e.decide(pathA, 100))
+		assert.Equal(t, []time.Duration{4 * time.Millisecond}, e.decide(pathB, 100))
+		e.SetPath(pathA.Fingerprint, Impairment{Delay: 3 * time.Millisecond})
+		assert.Equal(t, []time.Duration{3 * time.Millisecond}, e.decide(pathA, 100))
+		assert.Equal(t, []time.Duration{1 * time.Millisecond}, e.decide(nil, 100))
+	})
+
+	t.Run("loss and duplication", func(t *testing.T) {
+		e := NewEmulator(1)
+		e.SetPath(pathA.Fingerprint, Impairment{Loss: 1})
+		e.SetPath(pathB.Fingerprint, Impairment{Duplicate: 1})
+		assert.Empty(t, e.decide(pathA, 100))
+		assert.Len(t, e.decide(pathB, 100), 2)
+	})
+
+	t.Run("random loss rate", func(t *testing.T) {
+		e := NewEmulator(1)
+		e.SetDefault(Impairment{Loss: 0.25})
+		lost := 0
+		for i := 0; i < 10000; i++ {
+			if len(e.decide(pathA, 100)) == 0 {
+				lost++
+			}
+		}
+		assert.InDelta(t, 2500, lost, 250)
+	})
+
+	t.Run("burst loss", func(t *testing.T) {
+		e := NewEmulator(1)
+		e.SetDefault(Impairment{BurstLossEnter: 0.01, BurstLossExit: 0.1})
+		lost, bursts := 0, 0
+		prevLost := false
+		for i := 0; i < 10000; i++ {
+			l := len(e.decide(pathA, 100)) == 0
+			if l {
+				lost++
+				if !prevLost {
+					bursts++
+				}
+			}
+			prevLost = l
+		}
+		require.Greater(t, bursts, 0)
+		assert.Greater(t, float64(lost)/float64(bursts), 5.0, "losses should be bursty")
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		e := NewEmulator(1)
+		now := time.Now()
+		e.timeNow = func() time.Time { return now }
+		e.SetDefault(Impairment{Rate: 8000, QueueLimit: 250 * time.Millisecond}) // 1000 bytes/s
+		assert.Equal(t, []time.Duration{100 * time.Millisecond}, e.decide(pathA, 100))
+		assert.Equal(t, []time.Duration{200 * time.Millisecond}, e.decide(pathA, 100))
+		assert.Equal(t, []time.Duration{300 * time.Millisecond}, e.decide(pathA, 100))
+		assert.Empty(t, e.decide(pathA, 100), "queue limit exceeded")
+		now = now.Add(1 * time.Second)
+		assert.Equal(t, []time.Duration{100 * time.Millisecond}, e.decide(pathA, 100))
+	})
+
+	t.Run("link down", func(t *testing.T) {
+		e := NewEmulator(1)
+		now := time.Now()
+		e.timeNow = func() time.Time { return now }
+		notifications := make(chan pathDownNotification, 10)
+		e.notifyDown = func(pf PathFingerprint, pi PathInterface) {
+			notifications <- pathDownNotification{Fingerprint: pf, Interface: pi}
+		}
+		down := PathInterface{IA: ia, IfID: 2}
+		e.LinkDown(down, now.Add(time.Second), time.Second)
+
+		assert.Len(t, e.decide(pathA, 100), 1)
+		now = now.Add(1500 * time.Millisecond)
+		for i := 0; i < 100; i++ {
+			assert.Empty(t, e.decide(pathA, 100))
+		}
+		assert.Len(t, e.decide(pathB, 100), 1)
+		n := <-notifications
+		assert.Equal(t, pathA.Fingerprint, n.Fingerprint)
+		assert.Equal(t, down, n.Interface)
+		now = now.Add(time.Second)
+		assert.Len(t, e.decide(pathA, 100), 1)
+
+		// notified once per down window, not per dropped packet
+		e.LinkDown(down, now, time.Second)
+		assert.Empty(t, e.decide(pathA, 100))
+		n = <-notifications
+		assert.Equal(t, pathA.Fingerprint, n.Fingerprint)
+		time.Sleep(10 * time.Millisecond)
+		assert.Empty(t, notifications)
+	})
+}
+
+func TestEmulatorSend(t *testing.T) {
+	e := NewEmulator(1)
+	e.SetDefault(Impairment{Delay: 10 * time.Millisecond, Duplicate: 1})
+
+	payload := []byte("hello")
+	pkt := &snet.Packet{
+		PacketInfo: snet.PacketInfo{
+			Payload: snet.UDPPayload{Payload: payload},
+		},
+	}
+	sent := make(chan *snet.Packet, 2)
+	// as in writeMsg, the emulator gets a copy not sharing the caller's buffers
+	err := e.send(nil, clonePacket(pkt), func(p *snet.Packet) error {
+		sent <- p
+		return nil
+	})
+	require.NoError(t, err)
+	copy(payload, "xxxxx") // caller reuses buffer after send
+	e.Flush()
+	require.Len(t, sent, 2)
+	a, b := <-sent, <-sent
+	assert.NotSame(t, a, b)
+	assert.Equal(t, "hello", string(a.Payload.(snet.UDPPayload).Payload))
+	assert.Equal(t, "hello", string(b.Payload.(snet.UDPPayload).Payload))
+}
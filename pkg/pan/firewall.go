@@ -0,0 +1,269 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+)
+
+// InboundFilter decides which packets are accepted on a ListenConn.
+type InboundFilter interface {
+	// Accept is invoked for each packet received, before the reply path is
+	// recorded in the ReplySelector. The path is reversed, i.e. it's the path
+	// from here to remote; it is nil if remote is in the local AS.
+	// Packets for which Accept returns false are dropped.
+	Accept(remote UDPAddr, path *Path) bool
+}
+
+const (
+	defaultFirewallRemoteIdleTimeout = 5 * time.Minute
+	// firewallSweepInterval limits how often the table of tracked remotes is
+	// scanned for idle entries when it is full.
+	firewallSweepInterval = time.Second
+)
+
+// FirewallConfig configures a Firewall.
+type FirewallConfig struct {
+	// Allow lists the ISD-ASes from which packets are accepted. If empty,
+	// packets from all ISD-ASes not in Deny are accepted. An ISD or AS of 0 is a
+	// wildcard, e.g. 1-0 matches all ASes in ISD 1.
+	Allow []IA
+	// Deny lists the ISD-ASes from which packets are dropped. Takes precedence
+	// over Allow. Wildcards as for Allow.
+	Deny []IA
+	// ACL is applied to the reverse path of each packet received from a remote
+	// AS; packets on paths not accepted by the ACL are dropped.
+	// Only the interface IDs and the ISD-AS of the first and last hop are known
+	// for paths of received packets. The ISD-AS of the intermediate hops is
+	// unknown (0), so these hops only match the ACL entries matching any
+	// ISD-AS; effectively, the ACL can only restrict the interfaces used in the
+	// local and in the remote AS.
+	ACL *ACL
+	// Rate limits the number of packets per second accepted from each remote
+	// host (ISD-AS and IP). Unlimited if 0.
+	Rate float64
+	// Burst is the number of packets that can be accepted from a remote host
+	// at once, exceeding Rate. Defaults to Rate, but at least 1.
+	Burst int
+	// MaxRemotes limits the number of remote hosts tracked for rate limiting.
+	// Packets from new remote hosts are dropped while the limit is reached.
+	// Remote hosts are forgotten after RemoteIdleTimeout. Unlimited if 0.
+	MaxRemotes int
+	// RemoteIdleTimeout is the time after which an inactive remote host is no
+	// longer tracked. Defaults to 5 minutes.
+	RemoteIdleTimeout time.Duration
+}
+
+// FirewallMetrics counts the packets accepted and dropped by a Firewall, by
+// reason for dropping.
+type FirewallMetrics struct {
+	Accepted uint64
+	// DroppedIA counts packets dropped due to the Allow or Deny lists.
+	DroppedIA uint64
+	// DroppedPath counts packets dropped due to the path ACL.
+	DroppedPath uint64
+	// DroppedRate counts packets dropped due to the rate limit.
+	DroppedRate uint64
+	// DroppedRemotes counts packets dropped due to the MaxRemotes limit.
+	DroppedRemotes uint64
+}
+
+// Dropped returns the total number of packets dropped.
+func (m FirewallMetrics) Dropped() uint64 {
+	return m.DroppedIA + m.DroppedPath + m.DroppedRate + m.DroppedRemotes
+}
+
+// Firewall is an InboundFilter accepting or rejecting packets by source
+// ISD-AS, path and rate.
+// A Firewall is attached to a ListenConn or QUICListener with the
+// WithInboundFilter option.
+type Firewall struct {
+	config FirewallConfig
+	burst  float64
+
+	mutex     sync.Mutex
+	remotes   map[scionAddr]*tokenBucket
+	lastSweep time.Time
+	timeNow   func() time.Time
+
+	accepted       atomic.Uint64
+	droppedIA      atomic.Uint64
+	droppedPath    atomic.Uint64
+	droppedRate    atomic.Uint64
+	droppedRemotes atomic.Uint64
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewFirewall creates a Firewall with the given configuration.
+func NewFirewall(config FirewallConfig) *Firewall {
+	if config.RemoteIdleTimeout == 0 {
+		config.RemoteIdleTimeout = defaultFirewallRemoteIdleTimeout
+	}
+	burst := float64(config.Burst)
+	if burst == 0 {
+		burst = math.Max(1, math.Ceil(config.Rate))
+	}
+	return &Firewall{
+		config:  config,
+		burst:   burst,
+		remotes: make(map[scionAddr]*tokenBucket),
+		timeNow: time.Now,
+	}
+}
+
+// Accept implements InboundFilter.
+func (f *Firewall) Accept(remote UDPAddr, path *Path) bool {
+	if !f.acceptIA(remote.IA) {
+		f.droppedIA.Add(1)
+		return false
+	}
+	if f.config.ACL != nil && path != nil && !f.acceptPath(path) {
+		f.droppedPath.Add(1)
+		return false
+	}
+	if f.config.Rate > 0 || f.config.MaxRemotes > 0 {
+		if ok, counter := f.acceptRate(remote.scionAddr()); !ok {
+			counter.Add(1)
+			return false
+		}
+	}
+	f.accepted.Add(1)
+	return true
+}
+
+// Metrics returns the number of packets accepted and dropped so far.
+func (f *Firewall) Metrics() FirewallMetrics {
+	return FirewallMetrics{
+		Accepted:       f.accepted.Load(),
+		DroppedIA:      f.droppedIA.Load(),
+		DroppedPath:    f.droppedPath.Load(),
+		DroppedRate:    f.droppedRate.Load(),
+		DroppedRemotes: f.droppedRemotes.Load(),
+	}
+}
+
+func (f *Firewall) acceptIA(ia IA) bool {
+	for _, d := range f.config.Deny {
+		if iaMatches(d, ia) {
+			return false
+		}
+	}
+	if len(f.config.Allow) == 0 {
+		return true
+	}
+	for _, a := range f.config.Allow {
+		if iaMatches(a, ia) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptRate checks the rate limit and the limit on the number of tracked
+// remotes. If the packet is to be dropped, returns the corresponding counter.
+func (f *Firewall) acceptRate(remote scionAddr) (bool, *atomic.Uint64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	now := f.timeNow()
+	b, ok := f.remotes[remote]
+	if !ok {
+		if f.config.MaxRemotes > 0 && len(f.remotes) >= f.config.MaxRemotes {
+			f.sweep(now)
+			if len(f.remotes) >= f.config.MaxRemotes {
+				return false, &f.droppedRemotes
+			}
+		}
+		b = &tokenBucket{tokens: f.burst, last: now}
+		f.remotes[remote] = b
+	}
+	elapsed := now.Sub(b.last)
+	b.last = now
+	if f.config.Rate == 0 {
+		return true, nil
+	}
+	b.tokens = math.Min(f.burst, b.tokens+elapsed.Seconds()*f.config.Rate)
+	if b.tokens < 1 {
+		return false, &f.droppedRate
+	}
+	b.tokens--
+	return true, nil
+}
+
+// sweep removes the remotes that have been idle for longer than the
+// RemoteIdleTimeout. To bound the effort when flooded with packets from new
+// remotes, this scans the table at most once per firewallSweepInterval.
+func (f *Firewall) sweep(now time.Time) {
+	if now.Sub(f.lastSweep) < firewallSweepInterval {
+		return
+	}
+	f.lastSweep = now
+	for r, b := range f.remotes {
+		if now.Sub(b.last) > f.config.RemoteIdleTimeout {
+			delete(f.remotes, r)
+		}
+	}
+}
+
+// iaMatches checks whether ia matches the pattern, where an ISD or AS of 0 in
+// the pattern is a wildcard.
+func iaMatches(pattern, ia IA) bool {
+	p, a := addr.IA(pattern), addr.IA(ia)
+	return (p.ISD() == 0 || p.ISD() == a.ISD()) && (p.AS() == 0 || p.AS() == a.AS())
+}
+
+// acceptPath checks the path against the ACL. Paths that cannot be decoded are
+// rejected.
+func (f *Firewall) acceptPath(path *Path) bool {
+	p, err := receivedPathWithMetadata(path)
+	if err != nil {
+		return false
+	}
+	return len(f.config.ACL.Filter([]*Path{p})) > 0
+}
+
+// receivedPathWithMetadata returns a copy of the path of a received packet,
+// with the path interfaces decoded from the forwarding path. Only the
+// ISD-AS of the first and last hop are known; for all other interfaces the
+// ISD-AS is left as 0.
+func receivedPathWithMetadata(path *Path) (*Path, error) {
+	if path.Metadata != nil {
+		return path, nil
+	}
+	ifIDs, err := path.interfaceIDs()
+	if err != nil {
+		return nil, err
+	}
+	interfaces := make([]PathInterface, len(ifIDs))
+	for i, ifID := range ifIDs {
+		interfaces[i].IfID = ifID
+	}
+	if len(interfaces) > 0 {
+		interfaces[0].IA = path.Source
+		interfaces[len(interfaces)-1].IA = path.Destination
+	}
+	p := *path
+	p.Metadata = &PathMetadata{Interfaces: interfaces}
+	return &p, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	snetpath "github.com/scionproto/scion/pkg/snet/path"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirewall(t *testing.T) {
+	local := MustParseIA("1-ff00:0:110")
+	remote := func(ia string, ip string) UDPAddr {
+		return UDPAddr{IA: MustParseIA(ia), IP: netip.MustParseAddr(ip), Port: 1234}
+	}
+
+	t.Run("allow and deny", func(t *testing.T) {
+		f := NewFirewall(FirewallConfig{
+			Allow: []IA{MustParseIA("1-0"), MustParseIA("2-ff00:0:210")},
+			Deny:  []IA{MustParseIA("1-ff00:0:666")},
+		})
+		assert.True(t, f.Accept(remote("1-ff00:0:111", "10.0.0.1"), nil))
+		assert.True(t, f.Accept(remote("2-ff00:0:210", "10.0.0.1"), nil))
+		assert.False(t, f.Accept(remote("2-ff00:0:211", "10.0.0.1"), nil))
+		assert.False(t, f.Accept(remote("1-ff00:0:666", "10.0.0.1"), nil))
+		assert.Equal(t, FirewallMetrics{Accepted: 2, DroppedIA: 2}, f.Metrics())
+	})
+
+	t.Run("path ACL", func(t *testing.T) {
+		// deny paths leaving the local AS via interface 3
+		acl, err := NewACL([]string{"- 1-ff00:0:110#3", "+"})
+		require.NoError(t, err)
+		f := NewFirewall(FirewallConfig{ACL: &acl})
+		r := remote("1-ff00:0:111", "10.0.0.1")
+		ok := &Path{Source: local, Destination: r.IA, ForwardingPath: testForwardingPath(t, 1, 3, 4, 2)}
+		bad := &Path{Source: local, Destination: r.IA, ForwardingPath: testForwardingPath(t, 3, 2)}
+		undecodable := &Path{Source: local, Destination: r.IA, ForwardingPath: ForwardingPath{
+			dataplanePath: snetpath.SCION{Raw: []byte{0xff}},
+		}}
+		assert.True(t, f.Accept(r, ok))
+		assert.False(t, f.Accept(r, bad))
+		assert.False(t, f.Accept(r, undecodable))
+		assert.Nil(t, bad.Metadata, "path of received packet must not be modified")
+		assert.True(t, f.Accept(remote("1-ff00:0:110", "10.0.0.2"), nil), "local AS, no path")
+		assert.Equal(t, FirewallMetrics{Accepted: 2, DroppedPath: 2}, f.Metrics())
+	})
+
+	t.Run("path ACL end points", func(t *testing.T) {
+		acl, err := NewACL([]string{"- 1-ff00:0:111", "+"})
+		require.NoError(t, err)
+		f := NewFirewall(FirewallConfig{ACL: &acl})
+		r := remote("1-ff00:0:111", "10.0.0.1")
+		assert.False(t, f.Accept(r, &Path{Source: local, Destination: r.IA, ForwardingPath: testForwardingPath(t, 1, 2)}))
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		f := NewFirewall(FirewallConfig{Rate: 10, Burst: 2})
+		now := time.Now()
+		f.timeNow = func() time.Time { return now }
+		a := remote("1-ff00:0:111", "10.0.0.1")
+		b := remote("1-ff00:0:111", "10.0.0.2")
+		assert.True(t, f.Accept(a, nil))
+		assert.True(t, f.Accept(a, nil))
+		assert.False(t, f.Accept(a, nil))
+		assert.True(t, f.Accept(b, nil), "separate bucket per remote host")
+		now = now.Add(100 * time.Millisecond)
+		assert.True(t, f.Accept(a, nil))
+		assert.False(t, f.Accept(a, nil))
+		now = now.Add(time.Hour)
+		assert.True(t, f.Accept(a, nil))
+		assert.True(t, f.Accept(a, nil))
+		assert.False(t, f.Accept(a, nil), "burst is capped")
+		assert.Equal(t, FirewallMetrics{Accepted: 6, DroppedRate: 3}, f.Metrics())
+	})
+
+	t.Run("max remotes", func(t *testing.T) {
+		f := NewFirewall(FirewallConfig{MaxRemotes: 2, RemoteIdleTimeout: time.Minute})
+		now := time.Now()
+		f.timeNow = func() time.Time { return now }
+		a := remote("1-ff00:0:111", "10.0.0.1")
+		b := remote("1-ff00:0:111", "10.0.0.2")
+		c := remote("1-ff00:0:111", "10.0.0.3")
+		assert.True(t, f.Accept(a, nil))
+		assert.True(t, f.Accept(b, nil))
+		assert.False(t, f.Accept(c, nil))
+		assert.True(t, f.Accept(a, nil), "already tracked")
+		now = now.Add(30 * time.Second)
+		assert.True(t, f.Accept(a, nil))
+		now = now.Add(31 * time.Second)
+		assert.True(t, f.Accept(c, nil), "b is idle and no longer tracked")
+		assert.Equal(t, uint64(1), f.Metrics().DroppedRemotes)
+		assert.Equal(t, uint64(1), f.Metrics().Dropped())
+	})
+}
@@ -177,6 +177,9 @@ func TestSplitHostPort(t *testing.T) {
 		{"1-ff00:0:0,[1.1.1.1]:80", assert.NoError, "1-ff00:0:0,[1.1.1.1]", "80"},
 		{"1-ff00:0:0,1.1.1.1:80", assert.NoError, "1-ff00:0:0,1.1.1.1", "80"},
 		{"1-ff00:0:0,[::]:80", assert.NoError, "1-ff00:0:0,[::]", "80"},
+		{"1-ff00:0:0,[2001:db8::1]:443", assert.NoError, "1-ff00:0:0,[2001:db8::1]", "443"},
+		{"[1-ff00:0:0,1.1.1.1]:80", assert.NoError, "1-ff00:0:0,1.1.1.1", "80"},
+		{"[1-ff00:0:0,::1]:80", assert.NoError, "1-ff00:0:0,::1", "80"},
 		{"foo:80", assert.NoError, "foo", "80"},
 		{"www.example.com:666", assert.NoError, "www.example.com", "666"},
 		{"1-ff00:0:0,0:0:0:80", assert.Error, "", ""},
@@ -184,6 +187,9 @@ func TestSplitHostPort(t *testing.T) {
 		{"1-ff00:0:0,[1.1.1.1]", assert.Error, "", ""},
 		{"1-ff00:0:0,1.1.1.1", assert.Error, "", ""},
 		{"1-ff00:0:0,[::]", assert.Error, "", ""},
+		{"[1-ff00:0:0,::1]", assert.Error, "", ""},
+		{"[1-ff00:0:0,[::1]]:80", assert.Error, "", ""},
+		{"[foo]:80", assert.Error, "", ""},
 		{"foo", assert.Error, "", ""},
 	}
 	for _, c := range cases {
@@ -16,11 +16,22 @@ package pan
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/scionproto/scion/pkg/snet"
+	"golang.org/x/term"
 )
 
 type InteractiveSelectionType int
@@ -59,37 +70,406 @@ var (
 
 // CommandlinePrompter is a Prompter for InteractiveSelection, prompting the user for textual
 // path selection input on stdin/out.
-type CommandlinePrompter struct{}
+//
+// The paths are listed in a table with their metadata. At the prompt, the
+// list can be sorted and filtered before choosing paths; enter "?" for help.
+//
+// The paths are chosen without prompting if Choice or, if empty, the
+// SCION_PATH_CHOICE environment variable is set. If stdin is not a terminal,
+// e.g. when it is a pipe, the user is never prompted; the paths previously
+// chosen for the destination are used if neither is set.
+type CommandlinePrompter struct {
+	// Choice is the path choice used instead of prompting, typically set from a
+	// --path-choice flag. It is either a list of path indices and ranges, as
+	// entered at the prompt (e.g. "0 2-3"), or a hop predicate sequence (as for
+	// --sequence).
+	Choice string
+	// ChoicesFile is the file in which the chosen paths are remembered for
+	// each destination. Remembered paths are offered as default choice the next
+	// time. Nothing is remembered if empty.
+	ChoicesFile string
+}
 
 func (p CommandlinePrompter) Prompt(paths []*Path, remote IA) []*Path {
 	commandlinePrompterMutex.Lock()
 	defer commandlinePrompterMutex.Unlock()
 
-	fmt.Printf("Paths to %v\n", remote)
-	for i, path := range paths {
-		fmt.Printf("[%2d] %s\n", i, path)
+	tty := term.IsTerminal(int(os.Stdin.Fd()))
+	return p.prompt(os.Stdin, os.Stdout, os.Stderr, tty, paths, remote)
+}
+
+func (p CommandlinePrompter) prompt(in io.Reader, out, errOut io.Writer, tty bool,
+	paths []*Path, remote IA) []*Path {
+
+	var choices pathChoices
+	if p.ChoicesFile != "" {
+		choices = loadPathChoices(p.ChoicesFile)
 	}
+	remembered := Pinned(choices[remote.String()]).Filter(paths)
 
-	var pathIndices []int
-	scanner := bufio.NewScanner(os.Stdin)
+	var chosen []*Path
+	choice := p.Choice
+	if choice == "" {
+		choice = os.Getenv("SCION_PATH_CHOICE")
+	}
+	switch {
+	case choice != "":
+		var err error
+		chosen, err = choosePaths(paths, choice)
+		if err != nil {
+			fmt.Fprintf(errOut, "ERROR: Invalid path choice for %s. %v\n", remote, err)
+			return nil
+		}
+	case tty:
+		chosen = promptPaths(in, out, errOut, paths, remembered, remote)
+	case len(remembered) > 0:
+		chosen = remembered
+	default:
+		fmt.Fprintf(errOut, "ERROR: No terminal to prompt for paths to %s. "+
+			"Set the path choice with --path-choice or SCION_PATH_CHOICE.\n", remote)
+		return nil
+	}
+
+	if choices != nil && len(chosen) > 0 {
+		choices[remote.String()] = pathFingerprints(chosen)
+		if err := choices.save(p.ChoicesFile); err != nil {
+			fmt.Fprintf(errOut, "WARNING: Could not remember path choice. %v\n", err)
+		}
+	}
+	return chosen
+}
+
+// promptPaths prompts the user to choose from the paths, until a valid
+// choice is entered.
+func promptPaths(in io.Reader, out, errOut io.Writer, paths []*Path, remembered []*Path, remote IA) []*Path {
+	table := newPathTable(paths)
+	fmt.Fprintf(out, "Paths to %v\n", remote)
+	table.write(out)
+
+	scanner := bufio.NewScanner(in)
 	for {
-		fmt.Printf("Choose path: ")
+		if len(remembered) > 0 {
+			fmt.Fprintf(out, "Choose path (? for help, empty for previous choice %s): ",
+				fmtPathIndices(table.indices(remembered)))
+		} else {
+			fmt.Fprintf(out, "Choose path (? for help): ")
+		}
 		if !scanner.Scan() {
 			return nil
 		}
+		input := strings.TrimSpace(scanner.Text())
+		cmd, arg, _ := strings.Cut(input, " ")
+		arg = strings.TrimSpace(arg)
 		var err error
-		pathIndices, err = parsePathChoice(scanner.Text(), len(paths)-1)
-		if err == nil {
-			break
+		switch cmd {
+		case "":
+			if len(remembered) > 0 {
+				return remembered
+			}
+			err = errors.New("no path selected")
+		case "?":
+			fmt.Fprint(out, promptHelp)
+		case "s":
+			if err = table.sort(arg); err == nil {
+				table.write(out)
+			}
+		case "f":
+			if err = table.filter(arg); err == nil {
+				table.write(out)
+			}
+		case "d":
+			var i int
+			if i, err = parsePathIndex(arg, len(paths)-1); err == nil {
+				writePathDetails(out, paths[i])
+			}
+		default:
+			var pathIndices []int
+			pathIndices, err = parsePathChoice(input, len(paths)-1)
+			if err == nil {
+				selectedPaths := make([]*Path, 0, len(pathIndices))
+				for _, i := range pathIndices {
+					selectedPaths = append(selectedPaths, paths[i])
+				}
+				return selectedPaths
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(errOut, "ERROR: Invalid path selection. %v\n", err)
 		}
-		fmt.Fprintf(os.Stderr, "ERROR: Invalid path selection. %v\n", err)
 	}
+}
 
-	selectedPaths := make([]*Path, 0, len(pathIndices))
-	for _, i := range pathIndices {
-		selectedPaths = append(selectedPaths, paths[i])
+const promptHelp = `  <indices>    choose the paths, e.g. "0 2-3"
+  s <key>      sort by latency, bandwidth, hops, mtu or expiry; "s" for original order
+  f <sequence> show only paths matching a hop predicate sequence; "f" to show all
+  d <index>    show details of a path
+`
+
+// choosePaths returns the paths chosen by a list of path indices or by a hop
+// predicate sequence.
+func choosePaths(paths []*Path, choice string) ([]*Path, error) {
+	if pathIndices, err := parsePathChoice(choice, len(paths)-1); err == nil {
+		chosen := make([]*Path, 0, len(pathIndices))
+		for _, i := range pathIndices {
+			chosen = append(chosen, paths[i])
+		}
+		return chosen, nil
+	}
+	seq, err := NewSequence(choice)
+	if err != nil {
+		return nil, fmt.Errorf("neither path indices nor sequence: '%v'", choice)
+	}
+	chosen := seq.Filter(paths)
+	if len(chosen) == 0 {
+		return nil, fmt.Errorf("no path matches sequence '%v'", choice)
+	}
+	return chosen, nil
+}
+
+// pathTable is the list of paths shown at the prompt. Paths are always
+// referred to by their index in the original list, also when sorted or
+// filtered.
+type pathTable struct {
+	paths []*Path
+	// order are the indices of the paths shown, in order.
+	order    []int
+	sortKey  string
+	filtered Policy
+}
+
+func newPathTable(paths []*Path) *pathTable {
+	t := &pathTable{paths: paths}
+	t.update()
+	return t
+}
+
+// update applies the sort and filter settings to determine the order.
+func (t *pathTable) update() {
+	shown := append([]*Path{}, t.paths...)
+	if t.filtered != nil {
+		shown = t.filtered.Filter(shown)
+	}
+	switch t.sortKey {
+	case "":
+	case "expiry":
+		sort.SliceStable(shown, func(i, j int) bool {
+			return shown[i].Expiry.After(shown[j].Expiry)
+		})
+	default:
+		shown = preferencePolicies[t.sortKey].Filter(shown)
+	}
+	t.order = t.indices(shown)
+}
+
+func (t *pathTable) sort(key string) error {
+	if _, ok := preferencePolicies[key]; !ok && key != "expiry" && key != "" {
+		return fmt.Errorf("unknown sort key '%s'", key)
+	}
+	t.sortKey = key
+	t.update()
+	return nil
+}
+
+func (t *pathTable) filter(sequence string) error {
+	if sequence == "" {
+		t.filtered = nil
+	} else {
+		seq, err := NewSequence(sequence)
+		if err != nil {
+			return err
+		}
+		t.filtered = seq
+	}
+	t.update()
+	return nil
+}
+
+// indices returns the index of each of the paths in the original list.
+func (t *pathTable) indices(paths []*Path) []int {
+	ret := make([]int, 0, len(paths))
+	for _, p := range paths {
+		for i, q := range t.paths {
+			if p == q {
+				ret = append(ret, i)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+func (t *pathTable) write(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "    \tHops\tLatency\tBandwidth\tMTU\tExpiry\tLinks\tPath")
+	for _, i := range t.order {
+		p := t.paths[i]
+		md := p.Metadata
+		if md == nil || len(md.Interfaces) == 0 {
+			fmt.Fprintf(tw, "[%2d]\t-\t-\t-\t-\t%s\t-\t%s\n", i, fmtExpiry(p.Expiry), p)
+			continue
+		}
+		fmt.Fprintf(tw, "[%2d]\t%d\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			i, len(md.Interfaces)/2+1, fmtLatency(md), fmtBandwidth(md),
+			md.MTU, fmtExpiry(p.Expiry), fmtLinkTypes(md), p)
+	}
+	if len(t.order) < len(t.paths) {
+		fmt.Fprintf(tw, "(%d of %d paths shown)\n", len(t.order), len(t.paths))
+	}
+	tw.Flush()
+}
+
+// fmtLatency formats the total latency of the path. If the latency of some
+// hops is unknown, this is a lower bound.
+func fmtLatency(md *PathMetadata) string {
+	if len(md.Latency) < len(md.Interfaces)-1 {
+		return "?"
+	}
+	sum, unknown := md.latencySum()
+	switch {
+	case len(unknown) == len(md.Interfaces)-1:
+		return "?"
+	case len(unknown) > 0:
+		return ">" + sum.Round(time.Millisecond/10).String()
+	default:
+		return sum.Round(time.Millisecond / 10).String()
+	}
+}
+
+// fmtBandwidth formats the bottleneck bandwidth of the path. If the bandwidth
+// of some hops is unknown, this is an upper bound.
+func fmtBandwidth(md *PathMetadata) string {
+	if len(md.Bandwidth) < len(md.Interfaces)-1 {
+		return "?"
+	}
+	bw, unknown := md.bandwidthMin()
+	switch {
+	case len(unknown) == len(md.Interfaces)-1:
+		return "?"
+	case len(unknown) > 0:
+		return "<" + fmtKbps(bw)
+	default:
+		return fmtKbps(bw)
+	}
+}
+
+func fmtKbps(bw uint64) string {
+	switch {
+	case bw >= 1000000:
+		return fmt.Sprintf("%.1fGbit/s", float64(bw)/1000000)
+	case bw >= 1000:
+		return fmt.Sprintf("%.1fMbit/s", float64(bw)/1000)
+	default:
+		return fmt.Sprintf("%dKbit/s", bw)
+	}
+}
+
+func fmtExpiry(expiry time.Time) string {
+	if expiry.IsZero() {
+		return "-"
+	}
+	d := time.Until(expiry)
+	if d <= 0 {
+		return "expired"
+	}
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	return strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+}
+
+// fmtLinkTypes lists the distinct link types announced on the path.
+func fmtLinkTypes(md *PathMetadata) string {
+	var types []string
+	for _, lt := range md.LinkType {
+		if lt == snet.LinkTypeUnset {
+			continue
+		}
+		if s := lt.String(); !slices.Contains(types, s) {
+			types = append(types, s)
+		}
+	}
+	if len(types) == 0 {
+		return "?"
+	}
+	return strings.Join(types, ",")
+}
+
+func fmtPathIndices(indices []int) string {
+	s := make([]string, len(indices))
+	for i, idx := range indices {
+		s[i] = strconv.Itoa(idx)
+	}
+	return strings.Join(s, " ")
+}
+
+// writePathDetails writes the metadata of path, for each hop.
+func writePathDetails(w io.Writer, path *Path) {
+	fmt.Fprintf(w, "Path:   %s\n", path)
+	if !path.Expiry.IsZero() {
+		fmt.Fprintf(w, "Expiry: %s (in %s)\n", path.Expiry.Format(time.RFC3339), fmtExpiry(path.Expiry))
+	}
+	md := path.Metadata
+	if md == nil {
+		return
+	}
+	fmt.Fprintf(w, "MTU:    %d\n", md.MTU)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "Interface\tLatency\tBandwidth\tLink\tGeo")
+	for i, pi := range md.Interfaces {
+		latency, bandwidth, link, geo := "", "", "", ""
+		if i < len(md.Interfaces)-1 {
+			latency, bandwidth = "?", "?"
+			if i < len(md.Latency) && md.Latency[i] != 0 {
+				latency = md.Latency[i].String()
+			}
+			if i < len(md.Bandwidth) && md.Bandwidth[i] != 0 {
+				bandwidth = fmtKbps(md.Bandwidth[i])
+			}
+			if i%2 == 0 && i/2 < len(md.LinkType) {
+				link = md.LinkType[i/2].String()
+			}
+		}
+		if i < len(md.Geo) && md.Geo[i] != (GeoCoordinates{}) {
+			g := md.Geo[i]
+			geo = fmt.Sprintf("%.4f,%.4f %s", g.Latitude, g.Longitude, g.Address)
+		}
+		fmt.Fprintf(tw, "%s#%d\t%s\t%s\t%s\t%s\n", pi.IA, pi.IfID, latency, bandwidth, link, geo)
+	}
+	tw.Flush()
+	for i, note := range md.Notes {
+		if note != "" {
+			fmt.Fprintf(w, "Note %d: %s\n", i, note)
+		}
+	}
+}
+
+// pathChoices are the paths chosen for each destination, by ISD-AS, as stored
+// in the ChoicesFile of the CommandlinePrompter.
+type pathChoices map[string][]PathFingerprint
+
+// loadPathChoices loads the choices from file. Returns empty choices if the
+// file does not exist or is invalid.
+func loadPathChoices(file string) pathChoices {
+	choices := make(pathChoices)
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return choices
+	}
+	if err := json.Unmarshal(b, &choices); err != nil {
+		return make(pathChoices)
+	}
+	return choices
+}
+
+func (c pathChoices) save(file string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
 	}
-	return selectedPaths
+	return os.WriteFile(file, b, 0o600)
 }
 
 // TODO copied over from nesquic demo with minimal changes. Parsing should be
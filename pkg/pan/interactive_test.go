@@ -0,0 +1,132 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandlinePrompter(t *testing.T) {
+	asA := MustParseIA("1-ff00:0:a")
+	asB := MustParseIA("1-ff00:0:b")
+	asC := MustParseIA("1-ff00:0:c")
+	direct := &Path{
+		Fingerprint: "1 2",
+		Expiry:      time.Now().Add(time.Hour),
+		Metadata: &PathMetadata{
+			Interfaces: []PathInterface{{IA: asA, IfID: 1}, {IA: asB, IfID: 2}},
+			MTU:        1400,
+			Latency:    []time.Duration{50 * time.Millisecond},
+			Bandwidth:  []uint64{10000},
+		},
+	}
+	viaC := &Path{
+		Fingerprint: "3 4 5 6",
+		Expiry:      time.Now().Add(2 * time.Hour),
+		Metadata: &PathMetadata{
+			Interfaces: []PathInterface{{IA: asA, IfID: 3}, {IA: asC, IfID: 4}, {IA: asC, IfID: 5}, {IA: asB, IfID: 6}},
+			MTU:        1472,
+			Latency:    []time.Duration{5 * time.Millisecond, 0, 10 * time.Millisecond},
+			Bandwidth:  []uint64{1000000, 0, 1000000},
+		},
+	}
+	paths := []*Path{direct, viaC}
+
+	prompt := func(p CommandlinePrompter, input string, tty bool) ([]*Path, string, string) {
+		var out, errOut bytes.Buffer
+		chosen := p.prompt(strings.NewReader(input), &out, &errOut, tty, paths, asB)
+		return chosen, out.String(), errOut.String()
+	}
+
+	t.Run("table", func(t *testing.T) {
+		chosen, out, errOut := prompt(CommandlinePrompter{}, "1\n", true)
+		assert.Equal(t, []*Path{viaC}, chosen)
+		assert.Empty(t, errOut)
+		lines := strings.Split(out, "\n")
+		require.Greater(t, len(lines), 3)
+		assert.Equal(t, "Paths to 1-ff00:0:b", lines[0])
+		assert.Regexp(t, `^\[ 0\]\s+2\s+50ms\s+10\.0Mbit/s\s+1400\s+(59m|1h0m)\s+\?\s+1-ff00:0:a 1>2 1-ff00:0:b$`, lines[2])
+		assert.Regexp(t, `^\[ 1\]\s+3\s+>15ms\s+<1\.0Gbit/s\s+1472\s`, lines[3])
+	})
+
+	t.Run("sort and filter", func(t *testing.T) {
+		chosen, out, errOut := prompt(CommandlinePrompter{}, "s mtu\nf 0* 1-ff00:0:c 0*\ns foo\n0\n", true)
+		assert.Equal(t, []*Path{direct}, chosen, "indices refer to the original order")
+		assert.Contains(t, errOut, "unknown sort key 'foo'")
+		tables := strings.Split(out, "Choose path")
+		require.Len(t, tables, 5)
+		assert.Less(t, strings.Index(tables[1], "[ 1]"), strings.Index(tables[1], "[ 0]"), "sorted by MTU")
+		assert.NotContains(t, tables[2], "[ 0]")
+		assert.Contains(t, tables[2], "(1 of 2 paths shown)")
+	})
+
+	t.Run("details and invalid input", func(t *testing.T) {
+		chosen, out, errOut := prompt(CommandlinePrompter{}, "d 1\n7\n\n0-1\n", true)
+		assert.Equal(t, paths, chosen)
+		assert.Contains(t, out, "1-ff00:0:c#4")
+		assert.Contains(t, errOut, "valid indices range: [0, 1]")
+		assert.Contains(t, errOut, "no path selected")
+	})
+
+	t.Run("choice", func(t *testing.T) {
+		chosen, _, errOut := prompt(CommandlinePrompter{Choice: "1"}, "", true)
+		assert.Equal(t, []*Path{viaC}, chosen)
+		assert.Empty(t, errOut)
+
+		chosen, _, _ = prompt(CommandlinePrompter{Choice: "0* 1-ff00:0:c 0*"}, "", false)
+		assert.Equal(t, []*Path{viaC}, chosen)
+
+		chosen, _, errOut = prompt(CommandlinePrompter{Choice: "0* 1-ff00:0:d 0*"}, "", false)
+		assert.Nil(t, chosen)
+		assert.Contains(t, errOut, "no path matches")
+
+		t.Setenv("SCION_PATH_CHOICE", "0")
+		chosen, _, _ = prompt(CommandlinePrompter{}, "", false)
+		assert.Equal(t, []*Path{direct}, chosen)
+	})
+
+	t.Run("no terminal", func(t *testing.T) {
+		t.Setenv("SCION_PATH_CHOICE", "")
+		chosen, out, errOut := prompt(CommandlinePrompter{}, "1\n", false)
+		assert.Nil(t, chosen, "does not read from stdin")
+		assert.Empty(t, out)
+		assert.Contains(t, errOut, "--path-choice")
+	})
+
+	t.Run("remembered", func(t *testing.T) {
+		t.Setenv("SCION_PATH_CHOICE", "")
+		file := filepath.Join(t.TempDir(), "scion", "path-choices.json")
+		p := CommandlinePrompter{ChoicesFile: file}
+		chosen, _, _ := prompt(p, "1 0\n", true)
+		assert.Equal(t, []*Path{viaC, direct}, chosen)
+
+		chosen, out, _ := prompt(p, "\n", true)
+		assert.Equal(t, []*Path{viaC, direct}, chosen)
+		assert.Contains(t, out, "empty for previous choice 1 0")
+
+		chosen, _, errOut := prompt(p, "", false)
+		assert.Equal(t, []*Path{viaC, direct}, chosen, "used without terminal")
+		assert.Empty(t, errOut)
+
+		assert.Equal(t, pathChoices{"1-ff00:0:b": {"3 4 5 6", "1 2"}}, loadPathChoices(file))
+	})
+}
@@ -20,6 +20,8 @@ The main entry points for applications are:
 
   - DialUDP / ListenUDP
   - DialQUIC / ListenQUIC
+  - Dialer, with a DialContext method for libraries that accept a custom
+    dial function, like net/http or grpc.
 
 Both forms of the Dial call allow to specify a Policy and a Selector.
 
@@ -38,9 +40,21 @@ sent, the selector chooses the path.
 The default selector keeps using the first chosen path unless SCMP path down
 notifications are encountered, in which case it will always switch to the next
 alive path.
+Paths about to expire are removed from the paths passed to the selector
+shortly before their expiry, if other paths are available (see
+WithExpiryMargin). If only expired paths remain, writing fails with
+ErrPathExpired.
 Custom selectors implement e.g. active path probing, coupling of multiple
 connections to either use the same path or to use maximally disjoint paths,
 direct performance feedback from the application, etc.
+The ClassSelector chooses the path by the TrafficClass and deadline hint
+passed in the context of WriteWithCtx, e.g. using a low latency path for
+interactive traffic and a high bandwidth path for bulk traffic on the same
+connection.
+With WithRedundancy, a Conn sends each packet over multiple disjoint paths
+at once, using a RedundantSelector; the number of copies adapts to the loss
+measured on each path. The listening side removes the duplicates if enabled
+with WithListenRedundancy.
 
 # Dialed vs Listening
 
@@ -66,11 +80,44 @@ single SCION AS. When running multiple local ASes, e.g. during development, the
 address of the SCION daemon corresponding to the desired AS needs to be
 specified in the SCION_DAEMON_ADDRESS environment variable.
 
+To run without SCION daemon, the local ISD-AS and the border router addresses
+can be loaded from the topology.json file of the local AS, with paths looked up
+by a PathProvider; see UseTopologyFile. With the environment variables
+
+	SCION_TOPOLOGY: /etc/scion/topology.json
+	SCION_PATHS: /etc/scion/paths.json
+
+the paths are read from a static path file, as written by WriteStaticPaths.
+
+Paths are queried from the daemon on demand and cached in a global path pool
+shared by all connections. Concurrent dials to the same destination ISD-AS
+share a single query, and destinations without paths are not queried again
+for a while. Applications that know they will soon connect to a destination
+can use PrefetchPaths to have the paths queried, and kept fresh, in advance.
+
+# Packet Capture
+
+For debugging, all packets sent and received by pan sockets can be written to
+a pcapng file, by setting the environment variable
+
+	SCION_PAN_CAPTURE: /tmp/pan.pcapng
+
+Individual connections can capture to a custom io.Writer using the WithCapture
+and WithListenCapture options.
+The captured packets include the full SCION headers and path, wrapped in a
+UDP/IP header with the underlay addresses, so they can be inspected with
+wireshark's SCION dissector. Each packet is annotated with the fingerprint of
+the path used and the path selector that chose it.
+
 # Wildcard IP Addresses
 
 The SCION end host stack does not currently support binding to wildcard addresses.
 This will hopefully be added eventually, but in the meantime this package resolves
 wildcard addresses to a default local IP address when creating a socket.
+The unspecified addresses "0.0.0.0" and "::" select an IPv4 or IPv6 address,
+respectively; the host's route to the control service or, if that is not
+reachable, to the border routers of the local AS determines the default.
+Paths via a first hop border router of the other address family are not used.
 Binding to one specific local IP address, means that the application will not be reachable at any of
 the other IP addresses of the host. Traffic sent will always appear to originate from this specific
 IP address, even if that's not the correct route to a destination in the local AS.
@@ -81,7 +128,10 @@ Notes
     Path lookup for an unverified peer could easily be abused for various attacks.
   - Recording the reply path for each peer can be vulnerable to source address spoofing. This
     can potentially be abused to hijack connections.
-    The plan is to require source authentication.
+    The plan is to require source authentication. In the meantime, the WithSourceValidation
+    option enables a return routability check before a reply path is recorded, and an
+    InboundFilter like the Firewall can restrict which ISD-ASes and paths are accepted, and limit
+    the number of remotes tracked, see WithInboundFilter.
   - In order to allow more explicit control over paths for the listening side,
     plan is to add an explicit "Dial" function to the ListenerConn. There are a
     few different options for this, and none is particularly great (either
@@ -124,6 +174,7 @@ func (e HostNotFoundError) Error() string {
 }
 
 // Query paths to a particular destination AS.
+// Fails with ErrNoPath if there are no paths to dst.
 func QueryPaths(ctx context.Context, dst IA) ([]*Path, error) {
 	paths, _, err := (&pool).paths(ctx, dst)
 	return paths, err
@@ -27,3 +27,11 @@ func TestErrNoPathTo(t *testing.T) {
 	assert.Equal(t, err.Error(), "no path to 1-ff00:0:1")
 	assert.True(t, errors.Is(err, ErrNoPath))
 }
+
+func TestErrPathExpiredTo(t *testing.T) {
+	ia := MustParseIA("1-ff00:0:1")
+	err := errPathExpiredTo(ia)
+	assert.Equal(t, err.Error(), "no path to 1-ff00:0:1: all paths expired")
+	assert.True(t, errors.Is(err, ErrNoPath))
+	assert.True(t, errors.Is(err, ErrPathExpired))
+}
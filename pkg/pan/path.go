@@ -20,6 +20,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/slayers"
 	"github.com/scionproto/scion/pkg/slayers/path"
 	"github.com/scionproto/scion/pkg/slayers/path/scion"
 	"github.com/scionproto/scion/pkg/snet"
@@ -44,6 +46,12 @@ func (p *Path) String() string {
 	}
 }
 
+// expiresBefore checks whether the path expires before t. Paths with unknown
+// (zero) expiry never expire.
+func (p *Path) expiresBefore(t time.Time) bool {
+	return !p.Expiry.IsZero() && p.Expiry.Before(t)
+}
+
 // DataplaneLen returns the length of the path in the data plane.
 func (p *Path) DataplaneLen() (int, error) {
 	switch dataplanePath := p.ForwardingPath.dataplanePath.(type) {
@@ -60,6 +68,21 @@ func (p *Path) DataplaneLen() (int, error) {
 	}
 }
 
+// MaxPayloadSize returns the maximum size of a UDP payload sent over the path,
+// between the hosts src and dst, such that the SCION packet does not exceed
+// the path MTU. Returns 0 if the MTU is not known.
+func (p *Path) MaxPayloadSize(src, dst netip.Addr) int {
+	if p.Metadata == nil || p.Metadata.MTU == 0 {
+		return 0
+	}
+	pathLen, err := p.DataplaneLen()
+	if err != nil {
+		return 0
+	}
+	hdrLen := slayers.CmnHdrLen + 2*addr.IABytes + src.BitLen()/8 + dst.BitLen()/8 + pathLen
+	return max(int(p.Metadata.MTU)-hdrLen-udpHeaderLen, 0)
+}
+
 // ForwardingPath represents a data plane forwarding path.
 type ForwardingPath struct {
 	dataplanePath snet.DataplanePath
@@ -144,6 +167,17 @@ func reversePathFingerprint(p snet.RawPath) (PathFingerprint, error) {
 	return rpf, nil
 }
 
+// interfaceIDs returns the interface IDs on the path, in order of traversal,
+// decoded from the forwarding path. Unlike the path metadata, this is also
+// available for the paths of received packets.
+func (p *Path) interfaceIDs() ([]IfID, error) {
+	fpi, err := p.ForwardingPath.forwardingPathInfo()
+	if err != nil {
+		return nil, err
+	}
+	return fpi.interfaceIDs, nil
+}
+
 // forwardingPathInfo contains information extracted from a dataplane forwarding path.
 type forwardingPathInfo struct {
 	expiry       time.Time
@@ -15,15 +15,57 @@
 package pan
 
 import (
+	"net/netip"
 	"testing"
 	"time"
 
+	"github.com/scionproto/scion/pkg/slayers/path"
 	"github.com/scionproto/scion/pkg/slayers/path/scion"
 	"github.com/scionproto/scion/pkg/snet"
 	snetpath "github.com/scionproto/scion/pkg/snet/path"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// testForwardingPath returns a single segment forwarding path traversing the
+// interfaces ifIDs, given as pairs of egress and ingress interface.
+func testForwardingPath(tb testing.TB, ifIDs ...IfID) ForwardingPath {
+	tb.Helper()
+	require.Equal(tb, 0, len(ifIDs)%2)
+	numHops := len(ifIDs)/2 + 1
+	hops := make([]path.HopField, numHops)
+	for i, ifID := range ifIDs {
+		if i%2 == 0 {
+			hops[i/2].ConsEgress = uint16(ifID)
+		} else {
+			hops[i/2+1].ConsIngress = uint16(ifID)
+		}
+	}
+	sp := scion.Decoded{
+		Base: scion.Base{
+			PathMeta: scion.MetaHdr{SegLen: [3]uint8{uint8(numHops), 0, 0}},
+			NumINF:   1,
+			NumHops:  numHops,
+		},
+		InfoFields: []path.InfoField{{ConsDir: true, Timestamp: uint32(time.Now().Unix())}},
+		HopFields:  hops,
+	}
+	raw := make([]byte, sp.Len())
+	require.NoError(tb, sp.SerializeTo(raw))
+	return ForwardingPath{dataplanePath: snetpath.SCION{Raw: raw}}
+}
+
+func TestPathInterfaceIDs(t *testing.T) {
+	p := &Path{ForwardingPath: testForwardingPath(t, 1, 3, 4, 2)}
+	ifIDs, err := p.interfaceIDs()
+	require.NoError(t, err)
+	assert.Equal(t, []IfID{1, 3, 4, 2}, ifIDs)
+
+	p = &Path{ForwardingPath: ForwardingPath{dataplanePath: snetpath.SCION{Raw: []byte{0xff}}}}
+	_, err = p.interfaceIDs()
+	assert.Error(t, err)
+}
+
 func TestPathString(t *testing.T) {
 	asA := MustParseIA("1-ff00:0:a")
 	asB := MustParseIA("1-ff00:0:b")
@@ -152,6 +194,23 @@ func TestDataplaneLen(t *testing.T) {
 	}
 }
 
+func TestMaxPayloadSize(t *testing.T) {
+	ia := MustParseIA("1-ff00:0:110")
+	v4 := netip.MustParseAddr("127.0.0.1")
+	v6 := netip.MustParseAddr("::1")
+	p := testLoopbackPath(t, ia, ia, netip.MustParseAddrPort("127.0.0.1:31002"))
+	assert.Equal(t, 0, p.MaxPayloadSize(v4, v4), "unknown MTU")
+
+	p.Metadata = &PathMetadata{MTU: 1472}
+	// common header 12, address header 16 + host addresses, path 4 + 8 + 2*12, UDP 8
+	assert.Equal(t, 1472-12-16-8-36-8, p.MaxPayloadSize(v4, v4))
+	assert.Equal(t, 1472-12-16-32-36-8, p.MaxPayloadSize(v6, v6))
+	assert.Equal(t, 1472-12-16-20-36-8, p.MaxPayloadSize(v4, v6))
+
+	p.Metadata.MTU = 50
+	assert.Equal(t, 0, p.MaxPayloadSize(v4, v4))
+}
+
 func TestInterfacesFromDecoded(t *testing.T) {
 	// Not a great test case...
 	rawPath := []byte("\x00\x00\x20\x80\x00\x00\x01\x11\x00\x00\x01\x00\x01\x00\x02\x22\x00\x00" +
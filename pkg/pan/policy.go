@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"net"
 	"sort"
+	"time"
 
 	"github.com/scionproto/scion/pkg/addr"
 	"github.com/scionproto/scion/pkg/segment/iface"
@@ -90,6 +91,25 @@ func (p Preferred) Filter(paths []*Path) []*Path {
 	return append(preferred, rest...)
 }
 
+// MinRemainingLifetime is a policy that keeps only the paths that are valid for
+// at least the given Lifetime. Paths with unknown expiry are kept.
+// Like all policies, this is evaluated when the paths are refreshed; paths
+// expiring in between are handled by the connection, see WithExpiryMargin.
+type MinRemainingLifetime struct {
+	Lifetime time.Duration
+}
+
+func (p MinRemainingLifetime) Filter(paths []*Path) []*Path {
+	deadline := time.Now().Add(p.Lifetime)
+	filtered := make([]*Path, 0, len(paths))
+	for _, path := range paths {
+		if !path.expiresBefore(deadline) {
+			filtered = append(filtered, path)
+		}
+	}
+	return filtered
+}
+
 // Sequence is a policy filtering paths matching a textual pattern. The sequence pattern is
 // space separated sequence of hop predicates.
 // See https://scion.docs.anapaya.net/en/latest/PathPolicy.html#sequence.
@@ -18,6 +18,7 @@ import (
 	"math/rand"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -469,3 +470,15 @@ func TestACLPolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestMinRemainingLifetimePolicy(t *testing.T) {
+	now := time.Now()
+	expiring := &Path{Fingerprint: "expiring", Expiry: now.Add(time.Minute)}
+	valid := &Path{Fingerprint: "valid", Expiry: now.Add(time.Hour)}
+	expired := &Path{Fingerprint: "expired", Expiry: now.Add(-time.Minute)}
+	unknown := &Path{Fingerprint: "unknown"}
+
+	in := []*Path{expiring, valid, expired, unknown}
+	assert.Equal(t, []*Path{valid, unknown}, MinRemainingLifetime{Lifetime: 10 * time.Minute}.Filter(in))
+	assert.Equal(t, []*Path{expiring, valid, unknown}, MinRemainingLifetime{}.Filter(in))
+}
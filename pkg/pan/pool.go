@@ -21,13 +21,16 @@ import (
 )
 
 // pool is the *global* path pool.
-// - share cache between multiple connections
-// - centrally refresh paths before expiration
+//   - share cache between multiple connections
+//   - centrally refresh paths before expiration
+//   - only one query at a time per destination, and a bounded number of
+//     queries in total
+//   - remember destinations without paths for a while, backing off
+//     exponentially
 var pool pathPool
 
 func init() {
-	pool.refresher = makeRefresher(&pool)
-	pool.entries = make(map[IA]pathPoolDst)
+	pool.init(queryPathsFromHost)
 	// note: start refresher, but won't do anything until paths are added to the pool
 	go pool.refresher.run()
 }
@@ -36,6 +39,13 @@ type pathPool struct {
 	refresher    refresher
 	entriesMutex sync.RWMutex
 	entries      map[IA]pathPoolDst
+	// inflight are the currently running queries, by destination.
+	// Protected by entriesMutex.
+	inflight map[IA]*pathQuery
+	// querySlots bounds the number of concurrent queries.
+	querySlots chan struct{}
+	query      func(ctx context.Context, dst IA) ([]*Path, error)
+	timeNow    func() time.Time
 }
 
 // pathPoolDst is path pool entry for one destination IA
@@ -43,6 +53,20 @@ type pathPoolDst struct {
 	lastQuery      time.Time
 	earliestExpiry time.Time
 	paths          []*Path
+	// noPathUntil is the time until which no query is made after a query
+	// returned no paths or failed with noPathErr. noPathBackoff is the duration
+	// of this period, doubled for each consecutive query without paths.
+	noPathUntil   time.Time
+	noPathBackoff time.Duration
+	noPathErr     error
+}
+
+// pathQuery is a query in progress. The result is available once done is
+// closed.
+type pathQuery struct {
+	done  chan struct{}
+	paths []*Path
+	err   error
 }
 
 type pathPoolSubscriber interface {
@@ -50,6 +74,15 @@ type pathPoolSubscriber interface {
 	pathDownNotifyee
 }
 
+func (p *pathPool) init(query func(ctx context.Context, dst IA) ([]*Path, error)) {
+	p.refresher = makeRefresher(p)
+	p.entries = make(map[IA]pathPoolDst)
+	p.inflight = make(map[IA]*pathQuery)
+	p.querySlots = make(chan struct{}, maxConcurrentPathQueries)
+	p.query = query
+	p.timeNow = time.Now
+}
+
 func (p *pathPool) subscribe(ctx context.Context, dstIA IA,
 	s pathPoolSubscriber) ([]*Path, error) {
 
@@ -67,38 +100,130 @@ func (p *pathPool) unsubscribe(dstIA IA, s pathPoolSubscriber) {
 }
 
 // paths returns paths to dstIA. This _may_ query paths, unless they have recently been queried.
+// Concurrent callers share a single query. If a recent query returned no
+// paths, this fails with ErrNoPath without querying again.
 func (p *pathPool) paths(ctx context.Context, dstIA IA) ([]*Path, bool, error) {
-	p.entriesMutex.RLock()
+	p.entriesMutex.Lock()
+	now := p.timeNow()
 	entry, ok := p.entries[dstIA]
-	p.entriesMutex.RUnlock()
-
-	if ok && !shouldQuery(time.Now(), entry.earliestExpiry, entry.lastQuery) {
+	if ok && len(entry.paths) == 0 && now.Before(entry.noPathUntil) {
+		p.entriesMutex.Unlock()
+		return nil, false, entry.noPathErr
+	}
+	if ok && len(entry.paths) > 0 && !shouldQuery(now, entry.earliestExpiry, entry.lastQuery) {
+		p.entriesMutex.Unlock()
 		return append([]*Path{}, entry.paths...), false, nil
 	}
+	q, running := p.inflight[dstIA]
+	if !running {
+		q = &pathQuery{done: make(chan struct{})}
+		p.inflight[dstIA] = q
+		// Not bound to the caller's cancellation, as the result is shared with
+		// other callers.
+		go p.runQuery(context.WithoutCancel(ctx), dstIA, q)
+	}
+	p.entriesMutex.Unlock()
 
-	paths, err := p.queryPaths(ctx, dstIA)
-	if err != nil {
-		return nil, false, err
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+	if q.err != nil {
+		return nil, false, q.err
+	}
+	return append([]*Path{}, q.paths...), true, nil
+}
+
+// runQuery runs the query q for paths to dstIA and updates the cache entry.
+func (p *pathPool) runQuery(ctx context.Context, dstIA IA, q *pathQuery) {
+	ctx, cancel := context.WithTimeout(ctx, pathQueryTimeout)
+	defer cancel()
+
+	var paths []*Path
+	var err error
+	select {
+	case p.querySlots <- struct{}{}:
+		paths, err = p.query(ctx, dstIA)
+		<-p.querySlots
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	p.entriesMutex.Lock()
+	defer p.entriesMutex.Unlock()
+	entry := p.entries[dstIA]
+	switch {
+	case err == nil:
+		entry.update(p.timeNow(), paths)
+		if len(entry.paths) == 0 {
+			err = errNoPathTo(dstIA)
+			entry.backoff(p.timeNow(), err)
+		}
+		paths = entry.paths
+		p.entries[dstIA] = entry
+	case ctx.Err() == nil && len(entry.paths) == 0:
+		// the query failed, e.g. because the destination is unknown.
+		// Don't retry immediately, but don't remember timeouts either.
+		entry.backoff(p.timeNow(), err)
+		p.entries[dstIA] = entry
+	}
+	q.paths, q.err = paths, err
+	delete(p.inflight, dstIA)
+	close(q.done)
+	p.pruneNoPathLocked(p.timeNow())
+}
+
+// pruneNoPathLocked removes the entries for destinations without paths whose
+// backoff has expired and that have not been queried again since, for
+// noPathMaxBackoff. Until then, the entry is kept so that the backoff keeps
+// growing for destinations that are queried repeatedly.
+func (p *pathPool) pruneNoPathLocked(now time.Time) {
+	for ia, entry := range p.entries {
+		if len(entry.paths) > 0 || entry.noPathUntil.IsZero() {
+			continue
+		}
+		if _, running := p.inflight[ia]; running {
+			continue
+		}
+		if now.After(entry.noPathUntil.Add(noPathMaxBackoff)) {
+			delete(p.entries, ia)
+		}
 	}
-	return paths, true, nil
 }
 
-// queryPaths returns paths to dstIA. Unconditionally requests paths from sciond.
-func (p *pathPool) queryPaths(ctx context.Context, dstIA IA) ([]*Path, error) {
+// queryPathsFromHost returns paths to dstIA. Unconditionally requests paths from sciond.
+func queryPathsFromHost(ctx context.Context, dstIA IA) ([]*Path, error) {
 	host, err := getHost()
 	if err != nil {
 		return nil, err
 	}
-	paths, err := host.queryPaths(ctx, dstIA)
-	if err != nil {
-		return nil, err
+	return host.queryPaths(ctx, dstIA)
+}
+
+// PrefetchPaths marks dst as a "hot" destination, for which connections are
+// expected to be opened soon. The paths to dst are queried in the background
+// and kept fresh in the path pool, so that dialing dst does not need to wait
+// for a path query.
+// Call StopPrefetchPaths when paths to dst are no longer needed.
+func PrefetchPaths(dst IA) {
+	pool.prefetch(dst)
+}
+
+// StopPrefetchPaths undoes PrefetchPaths. Paths to dst remain in the path pool
+// but are no longer refreshed if no connection to dst is open.
+func StopPrefetchPaths(dst IA) {
+	pool.refresher.stopPrefetch(dst)
+}
+
+func (p *pathPool) prefetch(dst IA) {
+	if !p.refresher.prefetch(dst) {
+		return
 	}
-	p.entriesMutex.Lock()
-	defer p.entriesMutex.Unlock()
-	entry := p.entries[dstIA]
-	entry.update(paths)
-	p.entries[dstIA] = entry
-	return append([]*Path{}, paths...), nil
+	go func() {
+		// errors are ignored here, the refresher will retry
+		_, _, _ = p.paths(context.Background(), dst)
+	}()
 }
 
 // cachedPaths returns paths to dstIA. Always returns the cached paths, never queries paths.
@@ -108,8 +233,7 @@ func (p *pathPool) cachedPaths(dst IA) []*Path {
 	return append([]*Path{}, p.entries[dst].paths...)
 }
 
-func (e *pathPoolDst) update(paths []*Path) {
-	now := time.Now()
+func (e *pathPoolDst) update(now time.Time, paths []*Path) {
 	expiryDropTime := now.Add(-pathPruneLeadTime)
 
 	// the updated entry includes all new paths.
@@ -128,21 +252,43 @@ func (e *pathPoolDst) update(paths []*Path) {
 	e.lastQuery = now
 	e.earliestExpiry = earliestPathExpiry(paths)
 	e.paths = paths
+	if len(paths) > 0 {
+		e.noPathUntil = time.Time{}
+		e.noPathBackoff = 0
+		e.noPathErr = nil
+	}
 }
 
-func (p *pathPool) earliestPathExpiry() time.Time {
+// backoff records that a query for paths failed with err, or returned no
+// paths. Until the backoff time has elapsed, err is returned without querying
+// again.
+func (e *pathPoolDst) backoff(now time.Time, err error) {
+	e.noPathBackoff = min(max(2*e.noPathBackoff, noPathMinBackoff), noPathMaxBackoff)
+	e.noPathUntil = now.Add(e.noPathBackoff)
+	e.noPathErr = err
+}
+
+// earliestRefresh returns the earliest time at which the paths to a
+// destination should be refreshed: before the first path expires, or, for
+// destinations without paths, once the backoff has elapsed.
+// Returns false if there are no entries.
+func (p *pathPool) earliestRefresh() (time.Time, bool) {
 	p.entriesMutex.RLock()
 	defer p.entriesMutex.RUnlock()
 	if len(p.entries) == 0 {
-		return time.Time{}
+		return time.Time{}, false
 	}
 	ret := maxTime
 	for _, entry := range p.entries {
-		if entry.earliestExpiry.Before(ret) {
-			ret = entry.earliestExpiry
+		refresh := entry.noPathUntil
+		if len(entry.paths) > 0 {
+			refresh = entry.earliestExpiry.Add(-pathRefreshLeadTime)
+		}
+		if refresh.Before(ret) {
+			ret = refresh
 		}
 	}
-	return ret
+	return ret, true
 }
 
 func earliestPathExpiry(paths []*Path) time.Time {
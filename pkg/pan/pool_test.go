@@ -0,0 +1,225 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathPool(t *testing.T) {
+	dst := MustParseIA("1-ff00:0:111")
+	unreachable := MustParseIA("1-ff00:0:112")
+	path := &Path{Destination: dst, Fingerprint: "a", Expiry: time.Now().Add(time.Hour)}
+
+	t.Run("single flight", func(t *testing.T) {
+		var queries atomic.Int32
+		release := make(chan struct{})
+		var p pathPool
+		p.init(func(ctx context.Context, ia IA) ([]*Path, error) {
+			queries.Add(1)
+			<-release
+			return []*Path{path}, nil
+		})
+
+		const numCallers = 20
+		var wg sync.WaitGroup
+		for i := 0; i < numCallers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				paths, _, err := p.paths(context.Background(), dst)
+				assert.NoError(t, err)
+				assert.Equal(t, []*Path{path}, paths)
+			}()
+		}
+		assert.Eventually(t, func() bool { return queries.Load() == 1 }, time.Second, time.Millisecond)
+		// a caller giving up does not abort the query for the others
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, _, err := p.paths(ctx, dst)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		close(release)
+		wg.Wait()
+		assert.Equal(t, int32(1), queries.Load())
+
+		paths, fresh, err := p.paths(context.Background(), dst)
+		assert.NoError(t, err)
+		assert.False(t, fresh, "cached")
+		assert.Equal(t, []*Path{path}, paths)
+		assert.Equal(t, int32(1), queries.Load())
+	})
+
+	t.Run("negative caching", func(t *testing.T) {
+		var queries atomic.Int32
+		var p pathPool
+		p.init(func(ctx context.Context, ia IA) ([]*Path, error) {
+			queries.Add(1)
+			return nil, nil
+		})
+		now := time.Now()
+		p.timeNow = func() time.Time { return now }
+
+		for i := 0; i < 5; i++ {
+			_, _, err := p.paths(context.Background(), unreachable)
+			assert.ErrorIs(t, err, ErrNoPath)
+		}
+		assert.Equal(t, int32(1), queries.Load())
+
+		// the backoff doubles with each query without paths
+		for i, backoff := range []time.Duration{noPathMinBackoff, 2 * noPathMinBackoff, 4 * noPathMinBackoff} {
+			now = now.Add(backoff - time.Millisecond)
+			_, _, err := p.paths(context.Background(), unreachable)
+			assert.ErrorIs(t, err, ErrNoPath)
+			assert.Equal(t, int32(i+1), queries.Load())
+			now = now.Add(time.Millisecond)
+			_, _, err = p.paths(context.Background(), unreachable)
+			assert.ErrorIs(t, err, ErrNoPath)
+			assert.Equal(t, int32(i+2), queries.Load())
+		}
+		for i := 0; i < 10; i++ {
+			now = now.Add(noPathMaxBackoff)
+			_, _, _ = p.paths(context.Background(), unreachable)
+		}
+		assert.Equal(t, noPathMaxBackoff, p.entries[unreachable].noPathBackoff)
+	})
+
+	t.Run("negative entries", func(t *testing.T) {
+		var p pathPool
+		p.init(func(ctx context.Context, ia IA) ([]*Path, error) {
+			if ia == unreachable {
+				return nil, nil
+			}
+			return []*Path{path}, nil
+		})
+		now := time.Now()
+		p.timeNow = func() time.Time { return now }
+
+		_, _, err := p.paths(context.Background(), dst)
+		require.NoError(t, err)
+		refresh, ok := p.earliestRefresh()
+		assert.True(t, ok)
+		assert.Equal(t, path.Expiry.Add(-pathRefreshLeadTime), refresh)
+
+		// the refresh for a destination without paths is due after the backoff,
+		// not immediately
+		_, _, err = p.paths(context.Background(), unreachable)
+		assert.ErrorIs(t, err, ErrNoPath)
+		refresh, ok = p.earliestRefresh()
+		assert.True(t, ok)
+		assert.Equal(t, now.Add(noPathMinBackoff), refresh)
+
+		// kept while the backoff may still grow, evicted afterwards
+		now = now.Add(noPathMinBackoff + noPathMaxBackoff)
+		p.entries[dst] = pathPoolDst{} // force a query
+		_, _, err = p.paths(context.Background(), dst)
+		require.NoError(t, err)
+		assert.Contains(t, p.entries, unreachable)
+		now = now.Add(time.Millisecond)
+		p.entries[dst] = pathPoolDst{}
+		_, _, err = p.paths(context.Background(), dst)
+		require.NoError(t, err)
+		assert.NotContains(t, p.entries, unreachable)
+		assert.Contains(t, p.entries, dst)
+	})
+
+	t.Run("failed query", func(t *testing.T) {
+		var queries atomic.Int32
+		errQuery := errors.New("unknown destination")
+		var p pathPool
+		p.init(func(ctx context.Context, ia IA) ([]*Path, error) {
+			if queries.Add(1) == 1 {
+				return nil, errQuery
+			}
+			return []*Path{path}, nil
+		})
+		now := time.Now()
+		p.timeNow = func() time.Time { return now }
+
+		_, _, err := p.paths(context.Background(), dst)
+		assert.ErrorIs(t, err, errQuery)
+		_, _, err = p.paths(context.Background(), dst)
+		assert.ErrorIs(t, err, errQuery, "remembered")
+		assert.Equal(t, int32(1), queries.Load())
+
+		now = now.Add(noPathMinBackoff)
+		paths, _, err := p.paths(context.Background(), dst)
+		assert.NoError(t, err)
+		assert.Equal(t, []*Path{path}, paths)
+		assert.Zero(t, p.entries[dst].noPathBackoff, "backoff reset")
+	})
+
+	t.Run("concurrency bound", func(t *testing.T) {
+		var running, maxRunning atomic.Int32
+		var p pathPool
+		p.init(func(ctx context.Context, ia IA) ([]*Path, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			return []*Path{{Destination: ia, Expiry: time.Now().Add(time.Hour)}}, nil
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 3*maxConcurrentPathQueries; i++ {
+			wg.Add(1)
+			go func(ia IA) {
+				defer wg.Done()
+				_, _, err := p.paths(context.Background(), ia)
+				assert.NoError(t, err)
+			}(MustParseIA("1-ff00:0:111") + IA(i+1))
+		}
+		wg.Wait()
+		assert.LessOrEqual(t, maxRunning.Load(), int32(maxConcurrentPathQueries))
+		assert.Len(t, p.entries, 3*maxConcurrentPathQueries)
+	})
+
+	t.Run("prefetch", func(t *testing.T) {
+		queried := make(chan IA, 1)
+		var p pathPool
+		p.init(func(ctx context.Context, ia IA) ([]*Path, error) {
+			queried <- ia
+			return []*Path{path}, nil
+		})
+		go p.refresher.run()
+
+		p.prefetch(dst)
+		p.prefetch(dst)
+		select {
+		case ia := <-queried:
+			assert.Equal(t, dst, ia)
+		case <-time.After(time.Second):
+			require.Fail(t, "no query for prefetched destination")
+		}
+		assert.Len(t, p.refresher.subscribers[dst], 1)
+		assert.Eventually(t, func() bool { return len(p.cachedPaths(dst)) == 1 }, time.Second, time.Millisecond)
+
+		p.refresher.stopPrefetch(dst)
+		assert.Empty(t, p.refresher.subscribers)
+	})
+}
@@ -0,0 +1,219 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"time"
+
+	snetpath "github.com/scionproto/scion/pkg/snet/path"
+)
+
+// PathProvider looks up paths between two ASes.
+// By default, paths are queried from the SCION daemon. Without a daemon, see
+// UseTopologyFile, paths are looked up from a PathProvider like a
+// StaticPathProvider.
+//
+// The returned paths are not modified by the caller. If the next hop of a path
+// is not set, it is determined from the first interface of the path.
+type PathProvider interface {
+	Paths(ctx context.Context, src, dst IA) ([]*Path, error)
+}
+
+// PathProviderFunc is an adapter to use an ordinary function as PathProvider,
+// e.g. for tests.
+type PathProviderFunc func(ctx context.Context, src, dst IA) ([]*Path, error)
+
+func (f PathProviderFunc) Paths(ctx context.Context, src, dst IA) ([]*Path, error) {
+	return f(ctx, src, dst)
+}
+
+// StaticPathProvider is a PathProvider with a fixed set of paths, e.g. loaded
+// from a path file with LoadStaticPathFile.
+type StaticPathProvider struct {
+	paths []*Path
+}
+
+// NewStaticPathProvider returns a PathProvider for the given paths.
+func NewStaticPathProvider(paths []*Path) *StaticPathProvider {
+	return &StaticPathProvider{paths: paths}
+}
+
+// LoadStaticPathFile reads a path file, as written by WriteStaticPaths.
+func LoadStaticPathFile(filename string) (*StaticPathProvider, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	paths, err := ReadStaticPaths(f)
+	if err != nil {
+		return nil, fmt.Errorf("error loading path file %s: %w", filename, err)
+	}
+	return NewStaticPathProvider(paths), nil
+}
+
+func (s *StaticPathProvider) Paths(ctx context.Context, src, dst IA) ([]*Path, error) {
+	var paths []*Path
+	for _, p := range s.paths {
+		if p.Source == src && p.Destination == dst {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// staticPathFile is the JSON format of path files. The hops, next_hop, mtu
+// and expiry fields are named like in the JSON output of `scion showpaths`.
+type staticPathFile struct {
+	Paths []staticPath `json:"paths"`
+}
+
+type staticPath struct {
+	Source      string          `json:"source"`
+	Destination string          `json:"destination"`
+	Hops        []staticPathHop `json:"hops"`
+	NextHop     string          `json:"next_hop,omitempty"`
+	MTU         uint16          `json:"mtu,omitempty"`
+	Expiry      time.Time       `json:"expiry,omitzero"`
+	// Raw is the SCION dataplane path
+	Raw []byte `json:"raw"`
+}
+
+type staticPathHop struct {
+	IA   string `json:"isd_as"`
+	IfID IfID   `json:"id"`
+}
+
+// ReadStaticPaths reads paths in the format written by WriteStaticPaths.
+// If the expiry is not set for a path, it is determined from the dataplane
+// path.
+func ReadStaticPaths(r io.Reader) ([]*Path, error) {
+	var file staticPathFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+	paths := make([]*Path, 0, len(file.Paths))
+	for i, sp := range file.Paths {
+		p, err := sp.path()
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %d: %w", i, err)
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// WriteStaticPaths writes paths to w, so they can be used in a
+// StaticPathProvider on a host without SCION daemon.
+func WriteStaticPaths(w io.Writer, paths []*Path) error {
+	var file staticPathFile
+	for _, p := range paths {
+		sp, err := staticPathFromPath(p)
+		if err != nil {
+			return err
+		}
+		file.Paths = append(file.Paths, sp)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(file)
+}
+
+func (sp staticPath) path() (*Path, error) {
+	src, err := ParseIA(sp.Source)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := ParseIA(sp.Destination)
+	if err != nil {
+		return nil, err
+	}
+	var underlay netip.AddrPort
+	if sp.NextHop != "" {
+		underlay, err = netip.ParseAddrPort(sp.NextHop)
+		if err != nil {
+			return nil, err
+		}
+	}
+	interfaces := make([]PathInterface, len(sp.Hops))
+	for i, hop := range sp.Hops {
+		ia, err := ParseIA(hop.IA)
+		if err != nil {
+			return nil, err
+		}
+		interfaces[i] = PathInterface{IA: ia, IfID: hop.IfID}
+	}
+	fwPath := ForwardingPath{
+		dataplanePath: snetpath.SCION{Raw: sp.Raw},
+		underlay:      underlay,
+	}
+	fpi, err := fwPath.forwardingPathInfo()
+	if err != nil {
+		return nil, err
+	}
+	if len(fpi.interfaceIDs) != len(interfaces) {
+		return nil, fmt.Errorf("%d hops do not match dataplane path with %d interfaces",
+			len(interfaces), len(fpi.interfaceIDs))
+	}
+	expiry := sp.Expiry
+	if expiry.IsZero() {
+		expiry = fpi.expiry
+	}
+	return &Path{
+		Source:         src,
+		Destination:    dst,
+		ForwardingPath: fwPath,
+		Metadata: &PathMetadata{
+			Interfaces: interfaces,
+			MTU:        sp.MTU,
+		},
+		Fingerprint: pathSequenceFromInterfaces(interfaces).Fingerprint(),
+		Expiry:      expiry,
+	}, nil
+}
+
+func staticPathFromPath(p *Path) (staticPath, error) {
+	fwPath := p.ForwardingPath
+	var raw []byte
+	switch dataplanePath := fwPath.dataplanePath.(type) {
+	case snetpath.SCION:
+		raw = dataplanePath.Raw
+	default:
+		return staticPath{}, fmt.Errorf("unsupported path type %T", fwPath.dataplanePath)
+	}
+	if p.Metadata == nil {
+		return staticPath{}, fmt.Errorf("path %s has no metadata", p)
+	}
+	sp := staticPath{
+		Source:      p.Source.String(),
+		Destination: p.Destination.String(),
+		MTU:         p.Metadata.MTU,
+		Expiry:      p.Expiry,
+		Raw:         raw,
+	}
+	if fwPath.underlay.IsValid() {
+		sp.NextHop = fwPath.underlay.String()
+	}
+	for _, pi := range p.Metadata.Interfaces {
+		sp.Hops = append(sp.Hops, staticPathHop{IA: pi.IA.String(), IfID: pi.IfID})
+	}
+	return sp, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"bytes"
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticPaths(t *testing.T) {
+	src := MustParseIA("1-ff00:0:110")
+	dst := MustParseIA("1-ff00:0:111")
+	other := MustParseIA("1-ff00:0:112")
+	p := testLoopbackPath(t, src, dst, netip.MustParseAddrPort("10.0.0.1:31000"))
+	p.Metadata = &PathMetadata{
+		Interfaces: []PathInterface{{IA: src, IfID: 1}, {IA: dst, IfID: 2}},
+		MTU:        1472,
+	}
+	p.Fingerprint = pathSequenceFromInterfaces(p.Metadata.Interfaces).Fingerprint()
+	q := testLoopbackPath(t, src, other, netip.AddrPort{})
+	q.Metadata = &PathMetadata{Interfaces: []PathInterface{{IA: src, IfID: 1}, {IA: other, IfID: 2}}}
+	q.Fingerprint = pathSequenceFromInterfaces(q.Metadata.Interfaces).Fingerprint()
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteStaticPaths(&buf, []*Path{p, q}))
+	paths, err := ReadStaticPaths(&buf)
+	require.NoError(t, err)
+	require.Len(t, paths, 2)
+	for i, expected := range []*Path{p, q} {
+		assert.Equal(t, expected.Source, paths[i].Source)
+		assert.Equal(t, expected.Destination, paths[i].Destination)
+		assert.Equal(t, expected.Fingerprint, paths[i].Fingerprint)
+		assert.Equal(t, expected.Metadata, paths[i].Metadata)
+		assert.Equal(t, expected.ForwardingPath, paths[i].ForwardingPath)
+		assert.True(t, expected.Expiry.Equal(paths[i].Expiry))
+	}
+
+	provider := NewStaticPathProvider(paths)
+	found, err := provider.Paths(context.Background(), src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, []*Path{paths[0]}, found)
+	found, err = provider.Paths(context.Background(), dst, src)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+
+	t.Run("expiry from dataplane path", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteStaticPaths(&buf, []*Path{p}))
+		noExpiry := strings.Replace(buf.String(), `"expiry"`, `"ignored"`, 1)
+		paths, err := ReadStaticPaths(strings.NewReader(noExpiry))
+		require.NoError(t, err)
+		assert.True(t, p.Expiry.Equal(paths[0].Expiry))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		q := *p
+		q.Metadata = &PathMetadata{Interfaces: p.Metadata.Interfaces[:1]}
+		var buf bytes.Buffer
+		require.NoError(t, WriteStaticPaths(&buf, []*Path{&q}))
+		_, err := ReadStaticPaths(&buf)
+		assert.ErrorContains(t, err, "do not match")
+
+		q.Metadata = nil
+		assert.Error(t, WriteStaticPaths(&buf, []*Path{&q}))
+	})
+}
+
+const testTopology = `{
+  "isd_as": "1-ff00:0:110",
+  "mtu": 1472,
+  "dispatched_ports": "31000-32767",
+  "border_routers": {
+    "br1-ff00:0:110-1": {
+      "internal_addr": "10.0.0.1:31002",
+      "interfaces": {
+        "1": {
+          "underlay": {"local": "192.0.2.1:50000", "remote": "192.0.2.2:50000"},
+          "isd_as": "1-ff00:0:111",
+          "link_to": "CHILD",
+          "mtu": 1472
+        }
+      }
+    }
+  },
+  "control_service": {
+    "cs1-ff00:0:110-1": {"addr": "10.0.0.2:31000"}
+  }
+}`
+
+func TestTopologyFile(t *testing.T) {
+	topologyFile := filepath.Join(t.TempDir(), "topology.json")
+	require.NoError(t, os.WriteFile(topologyFile, []byte(testTopology), 0o600))
+
+	local := MustParseIA("1-ff00:0:110")
+	dst := MustParseIA("1-ff00:0:111")
+	p := testLoopbackPath(t, local, dst, netip.AddrPort{})
+	p.Metadata = &PathMetadata{Interfaces: []PathInterface{{IA: local, IfID: 1}, {IA: dst, IfID: 2}}}
+	shared := []*Path{p}
+	provider := PathProviderFunc(func(ctx context.Context, src, dst IA) ([]*Path, error) {
+		assert.Equal(t, local, src)
+		return shared, nil
+	})
+
+	h, err := initHostContextFromTopology(topologyFile, provider)
+	require.NoError(t, err)
+	assert.Equal(t, local, h.ia)
+	assert.Equal(t, "10.0.0.2", h.hostInLocalAS.String())
+	assert.Equal(t, uint16(31000), h.topology.PortRange.Start)
+	assert.Equal(t, uint16(32767), h.topology.PortRange.End)
+	underlay, ok := h.topology.Interface(1)
+	assert.True(t, ok)
+	assert.Equal(t, netip.MustParseAddrPort("10.0.0.1:31002"), underlay)
+	_, ok = h.topology.Interface(2)
+	assert.False(t, ok)
+
+	paths, err := h.queryPaths(context.Background(), dst)
+	require.NoError(t, err)
+	require.Len(t, paths, 1)
+	assert.Equal(t, underlay, paths[0].ForwardingPath.underlay, "next hop from topology")
+	assert.False(t, p.ForwardingPath.underlay.IsValid(), "provider's path not modified")
+	assert.Same(t, p, shared[0], "provider's slice not modified")
+
+	_, err = initHostContextFromTopology(filepath.Join(t.TempDir(), "missing.json"), provider)
+	assert.Error(t, err)
+
+	useTestHostContext(t, h)
+	err = UseTopologyFile(topologyFile, provider)
+	assert.ErrorContains(t, err, "already initialized", "host context not replaced")
+}
@@ -29,6 +29,37 @@ import (
 type QUICConn struct {
 	*quic.Conn
 	UnderlayConn Conn
+	metrics      *quicMetrics
+	packetSize   int
+}
+
+// Stats returns a snapshot of the statistics of the underlying Conn and of
+// the QUIC connection.
+func (s *QUICConn) Stats() QUICStats {
+	stats := QUICStats{ConnStats: s.UnderlayConn.Stats()}
+	if s.metrics != nil {
+		s.metrics.addTo(&stats)
+	}
+	return stats
+}
+
+// MaxDatagramSize returns the maximum payload size of a QUIC datagram
+// (RFC 9221) that can be sent with SendDatagram. This is derived from the size
+// of the QUIC packets and the MTU of the current path.
+// Returns 0 if the peer does not support datagrams.
+func (s *QUICConn) MaxDatagramSize() int {
+	if !s.ConnectionState().SupportsDatagrams {
+		return 0
+	}
+	size := s.packetSize
+	if p := s.UnderlayConn.GetPath(); p != nil {
+		local := s.UnderlayConn.LocalAddr().(UDPAddr)
+		remote := s.UnderlayConn.RemoteAddr().(UDPAddr)
+		if n := p.MaxPayloadSize(local.IP, remote.IP); n > 0 {
+			size = min(size, n)
+		}
+	}
+	return max(size-quicDatagramOverhead, 0)
 }
 
 func (s *QUICConn) CloseWithError(code quic.ApplicationErrorCode, desc string) error {
@@ -41,6 +72,10 @@ func (s *QUICConn) CloseWithError(code quic.ApplicationErrorCode, desc string) e
 //
 // The host parameter is used for SNI.
 // The tls.Config must define an application protocol (using NextProtos).
+// If quicConf is nil, QUIC datagrams are enabled. Unless the quic.Config
+// defines the InitialPacketSize, the packet size is chosen to fit the MTU of
+// all paths to the remote known at the time of the dial, as the packet size
+// cannot be reduced after a failover.
 func DialQUIC(
 	ctx context.Context,
 	local netip.AddrPort,
@@ -56,6 +91,7 @@ func DialQUIC(
 		return nil, err
 	}
 	pconn := connectedPacketConn{conn}
+	metrics := &quicMetrics{}
 	// HACK: we silence the log here to shut up quic-go's warning about trying to
 	// set receive buffer size (it's not a UDPConn, we know).
 	silenceLog()
@@ -72,14 +108,15 @@ func DialQUIC(
 		}
 	}
 
-	session, err := quic.Dial(ctx, pconn, remote, tlsConf, quicConf)
+	quicConf = dialQUICConfig(quicConf, conn)
+	session, err := quic.Dial(ctx, pconn, remote, tlsConf, withMetricsTracer(quicConf, metrics))
 	if err != nil {
 		err := fmt.Errorf("failed to establish QUIC session, over path %v: %w", conn.GetPath(), err)
 		// Close the underlying connection if the QUIC session could not be established.
 		pconn.Close()
 		return nil, err
 	}
-	return &QUICConn{Conn: session, UnderlayConn: conn}, nil
+	return &QUICConn{Conn: session, UnderlayConn: conn, metrics: metrics, packetSize: packetSize(quicConf)}, nil
 }
 
 // DialQUICEarly establishes a new 0-RTT QUIC connection to a server. Analogous to DialQUIC.
@@ -98,15 +135,69 @@ func DialQUICEarly(
 		return nil, err
 	}
 	pconn := connectedPacketConn{conn}
+	metrics := &quicMetrics{}
 	// HACK: we silence the log here to shut up quic-go's warning about trying to
 	// set receive buffer size (it's not a UDPConn, we know).
 	silenceLog()
 	defer unsilenceLog()
-	session, err := quic.DialEarly(ctx, pconn, remote, tlsConf, quicConf)
+	quicConf = dialQUICConfig(quicConf, conn)
+	session, err := quic.DialEarly(ctx, pconn, remote, tlsConf, withMetricsTracer(quicConf, metrics))
 	if err != nil {
 		return nil, err
 	}
-	return &QUICConn{Conn: session, UnderlayConn: conn}, nil
+	return &QUICConn{Conn: session, UnderlayConn: conn, metrics: metrics, packetSize: packetSize(quicConf)}, nil
+}
+
+// dialQUICConfig returns a copy of quicConf for a QUIC connection on conn,
+// with the defaults described in DialQUIC.
+func dialQUICConfig(quicConf *quic.Config, conn Conn) *quic.Config {
+	if quicConf == nil {
+		quicConf = &quic.Config{EnableDatagrams: true}
+	} else {
+		quicConf = quicConf.Clone()
+	}
+	if quicConf.InitialPacketSize == 0 {
+		quicConf.InitialPacketSize = uint16(quicPacketSizeFor(conn))
+	}
+	return quicConf
+}
+
+// quicPacketSizeFor returns the QUIC packet size for a connection on conn.
+// quic-go never reduces the packet size of a connection, so this must fit all
+// paths the connection may fail over to, not only the current path. It is the
+// smallest payload size of the paths known at the time of the dial, where
+// defaultQUICPacketSize is assumed for paths with unknown MTU.
+// QUIC cannot use packets smaller than minQUICPacketSize, so paths with a
+// smaller payload size are not usable for QUIC anyway.
+func quicPacketSizeFor(conn Conn) int {
+	var paths []*Path
+	if c, ok := conn.(interface{ candidatePaths() []*Path }); ok {
+		paths = c.candidatePaths()
+	} else if p := conn.GetPath(); p != nil {
+		paths = []*Path{p}
+	}
+	if len(paths) == 0 {
+		return defaultQUICPacketSize
+	}
+	local := conn.LocalAddr().(UDPAddr)
+	remote := conn.RemoteAddr().(UDPAddr)
+	size := maxQUICPacketSize
+	for _, p := range paths {
+		n := p.MaxPayloadSize(local.IP, remote.IP)
+		if n == 0 {
+			n = defaultQUICPacketSize
+		}
+		size = min(size, n)
+	}
+	return max(size, minQUICPacketSize)
+}
+
+// packetSize returns the size of the QUIC packets sent with quicConf.
+func packetSize(quicConf *quic.Config) int {
+	if quicConf == nil || quicConf.InitialPacketSize == 0 {
+		return defaultQUICPacketSize
+	}
+	return min(max(int(quicConf.InitialPacketSize), minQUICPacketSize), maxQUICPacketSize)
 }
 
 // connectedPacketConn wraps a Conn into a PacketConn interface.
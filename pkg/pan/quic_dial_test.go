@@ -0,0 +1,97 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// pathConn is a Conn with a fixed path, for testing. Only GetPath, LocalAddr
+// and RemoteAddr are implemented.
+type pathConn struct {
+	Conn
+	path          *Path
+	local, remote UDPAddr
+}
+
+func (c pathConn) GetPath() *Path       { return c.path }
+func (c pathConn) LocalAddr() net.Addr  { return c.local }
+func (c pathConn) RemoteAddr() net.Addr { return c.remote }
+
+// candidatesConn is a pathConn with candidate paths, like a dialed Conn.
+type candidatesConn struct {
+	pathConn
+	candidates []*Path
+}
+
+func (c candidatesConn) candidatePaths() []*Path { return c.candidates }
+
+func TestDialQUICConfig(t *testing.T) {
+	ia := MustParseIA("1-ff00:0:110")
+	ip := netip.MustParseAddr("127.0.0.1")
+	p := testLoopbackPath(t, ia, ia, netip.MustParseAddrPort("127.0.0.1:31002"))
+	conn := pathConn{
+		path:   p,
+		local:  UDPAddr{IA: ia, IP: ip, Port: 1},
+		remote: UDPAddr{IA: ia, IP: ip, Port: 2},
+	}
+
+	quicConf := dialQUICConfig(nil, conn)
+	assert.True(t, quicConf.EnableDatagrams, "datagrams enabled by default")
+	assert.Equal(t, uint16(defaultQUICPacketSize), quicConf.InitialPacketSize, "unknown MTU")
+
+	p.Metadata = &PathMetadata{MTU: 1472}
+	quicConf = dialQUICConfig(nil, conn)
+	assert.Equal(t, uint16(p.MaxPayloadSize(ip, ip)), quicConf.InitialPacketSize)
+	assert.Equal(t, p.MaxPayloadSize(ip, ip), packetSize(quicConf))
+
+	p.Metadata.MTU = 1280
+	assert.Equal(t, uint16(minQUICPacketSize), dialQUICConfig(nil, conn).InitialPacketSize)
+	p.Metadata.MTU = 9000
+	assert.Equal(t, uint16(maxQUICPacketSize), dialQUICConfig(nil, conn).InitialPacketSize)
+
+	// the smallest of all candidate paths, as quic-go cannot reduce the packet
+	// size after a failover
+	small := testLoopbackPath(t, ia, ia, netip.MustParseAddrPort("127.0.0.1:31002"))
+	small.Metadata = &PathMetadata{MTU: 1400}
+	unknown := testLoopbackPath(t, ia, ia, netip.MustParseAddrPort("127.0.0.1:31002"))
+	p.Metadata.MTU = 1472
+	withCandidates := candidatesConn{pathConn: conn, candidates: []*Path{p, small}}
+	assert.Equal(t, uint16(small.MaxPayloadSize(ip, ip)), dialQUICConfig(nil, withCandidates).InitialPacketSize)
+	withCandidates.candidates = append(withCandidates.candidates, unknown)
+	assert.Equal(t, uint16(defaultQUICPacketSize), dialQUICConfig(nil, withCandidates).InitialPacketSize)
+	withCandidates.candidates = nil
+	assert.Equal(t, uint16(defaultQUICPacketSize), dialQUICConfig(nil, withCandidates).InitialPacketSize)
+	p.Metadata.MTU = 9000
+
+	explicit := &quic.Config{KeepAlivePeriod: time.Second, InitialPacketSize: 1300}
+	quicConf = dialQUICConfig(explicit, conn)
+	assert.False(t, quicConf.EnableDatagrams, "explicit config not changed")
+	assert.Equal(t, uint16(1300), quicConf.InitialPacketSize)
+	assert.Equal(t, time.Second, quicConf.KeepAlivePeriod)
+
+	explicit.InitialPacketSize = 0
+	quicConf = dialQUICConfig(explicit, conn)
+	assert.Equal(t, uint16(maxQUICPacketSize), quicConf.InitialPacketSize)
+	assert.Zero(t, explicit.InitialPacketSize, "copy of the QUIC config")
+
+	assert.Equal(t, defaultQUICPacketSize, packetSize(nil))
+}
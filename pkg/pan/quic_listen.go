@@ -38,6 +38,7 @@ func (l *QUICListener) Close() error {
 }
 
 // ListenQUIC listens for QUIC connections on a SCION/UDP port.
+// If quicConfig is nil, QUIC datagrams are enabled.
 //
 // See note on wildcard addresses in the package documentation.
 func ListenQUIC(
@@ -56,6 +57,9 @@ func ListenQUIC(
 	// set receive buffer size (it's not a UDPConn, we know).
 	silenceLog()
 	defer unsilenceLog()
+	if quicConfig == nil {
+		quicConfig = &quic.Config{EnableDatagrams: true}
+	}
 	listener, err := quic.Listen(conn, tlsConf, quicConfig)
 	if err != nil {
 		conn.Close()
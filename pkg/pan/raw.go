@@ -39,6 +39,17 @@ type baseUDPConn struct {
 	readBuffer  []byte
 	writeMutex  sync.Mutex
 	writeBuffer []byte
+	capture     *packetCapture
+	emulator    *Emulator
+	connStats   *connStats
+
+	fastPathOnce sync.Once
+	fast         *fastPath
+
+	// intercept, if set, is invoked for each packet received before the payload
+	// is passed to the application. It returns the payload to pass on, or
+	// false if the packet is consumed.
+	intercept func(remote UDPAddr, fw ForwardingPath, payload []byte) ([]byte, bool)
 }
 
 func (c *baseUDPConn) SetDeadline(t time.Time) error {
@@ -53,7 +64,10 @@ func (c *baseUDPConn) SetWriteDeadline(t time.Time) error {
 	return c.raw.SetWriteDeadline(t)
 }
 
-func (c *baseUDPConn) writeMsg(src, dst UDPAddr, path *Path, b []byte) (int, error) {
+// writeMsg sends a single packet to dst via path.
+// The decision describes how the path was chosen; it is only used to annotate
+// the packet capture, if enabled.
+func (c *baseUDPConn) writeMsg(src, dst UDPAddr, path *Path, b []byte, decision pathDecision) (int, error) {
 	// assert:
 	if src.IA != dst.IA && path == nil {
 		panic("writeMsg: need path when src.IA != dst.IA")
@@ -100,17 +114,89 @@ func (c *baseUDPConn) writeMsg(src, dst UDPAddr, path *Path, b []byte) (int, err
 		},
 	}
 
-	err := c.raw.WriteTo(pkt, net.UDPAddrFromAddrPort(nextHop))
-	if err != nil {
+	if c.emulator != nil {
+		// The emulator may send the packet later, so it must not use the shared
+		// buffers.
+		err := c.emulator.send(path, clonePacket(pkt), func(pkt *snet.Packet) error {
+			return c.sendPacket(pkt, nextHop, path, decision)
+		})
+		if err != nil {
+			return 0, err
+		}
+		c.countSent(path, len(b))
+		return len(b), nil
+	}
+	if f := c.fastPath(); f != nil {
+		// Serialize from the cached header for this path, avoiding the
+		// comparatively expensive serialization in snet.
+		h, err := f.header(src, dst, path)
+		if err != nil {
+			return 0, err
+		}
+		raw, err := h.build(c.writeBuffer, b)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := f.conn.WriteToUDPAddrPort(raw, nextHop); err != nil {
+			return 0, err
+		}
+		if c.capture != nil {
+			c.capture.sent(raw, c.localUnderlay(), nextHop, path, decision)
+		}
+		c.countSent(path, len(b))
+		return len(b), nil
+	}
+	if err := c.sendPacket(pkt, nextHop, path, decision); err != nil {
 		return 0, err
 	}
+	c.countSent(path, len(b))
 	return len(b), nil
 }
 
+// Stats returns a snapshot of the statistics of the connection.
+func (c *baseUDPConn) Stats() ConnStats {
+	if c.connStats == nil {
+		return ConnStats{}
+	}
+	return c.connStats.snapshot()
+}
+
+// countSent records a sent packet in the connection statistics, if enabled.
+func (c *baseUDPConn) countSent(path *Path, n int) {
+	if c.connStats != nil {
+		c.connStats.sent(path, n)
+	}
+}
+
+func (c *baseUDPConn) sendPacket(pkt *snet.Packet, nextHop netip.AddrPort, path *Path, decision pathDecision) error {
+	err := c.raw.WriteTo(pkt, net.UDPAddrFromAddrPort(nextHop))
+	if err != nil {
+		return err
+	}
+	if c.capture != nil {
+		c.capture.sent(pkt.Bytes, c.localUnderlay(), nextHop, path, decision)
+	}
+	return nil
+}
+
 // readMsg is a helper for reading a single packet.
 // Internally invokes the configured SCMP handler.
 // Ignores non-UDP packets.
 func (c *baseUDPConn) readMsg(b []byte) (int, UDPAddr, ForwardingPath, error) {
+	if c.fastPath() != nil {
+		var msgs [1]Message
+		var fwPaths [1]ForwardingPath
+		msgs[0].Buffer = b
+		if _, err := c.readBatch(msgs[:], fwPaths[:]); err != nil {
+			return 0, UDPAddr{}, ForwardingPath{}, err
+		}
+		return msgs[0].N, msgs[0].Addr, fwPaths[0], nil
+	}
+	return c.readMsgSlow(b)
+}
+
+// readMsgSlow reads a single packet via the snet.PacketConn.
+func (c *baseUDPConn) readMsgSlow(b []byte) (int, UDPAddr, ForwardingPath, error) {
 	c.readMutex.Lock()
 	defer c.readMutex.Unlock()
 	if c.readBuffer == nil {
@@ -143,11 +229,35 @@ func (c *baseUDPConn) readMsg(b []byte) (int, UDPAddr, ForwardingPath, error) {
 			dataplanePath: pkt.Path,
 			underlay:      underlay,
 		}
-		n := copy(b, udp.Payload)
+		if c.capture != nil {
+			var fingerprint PathFingerprint
+			if rp, ok := pkt.Path.(snet.RawPath); ok && len(rp.Raw) > 0 {
+				fingerprint, _ = reversePathFingerprint(rp)
+			}
+			c.capture.received(pkt.Bytes, underlay, c.localUnderlay(), fingerprint)
+		}
+		if c.connStats != nil {
+			c.connStats.received(pkt.Path, len(udp.Payload))
+		}
+		payload := udp.Payload
+		if c.intercept != nil {
+			if payload, ok = c.intercept(remote, fw, payload); !ok {
+				continue
+			}
+		}
+		n := copy(b, payload)
 		return n, remote, fw, nil
 	}
 }
 
+// localUnderlay returns the underlay address the raw socket is bound to.
+func (c *baseUDPConn) localUnderlay() netip.AddrPort {
+	if addr, ok := c.raw.LocalAddr().(*net.UDPAddr); ok {
+		return addr.AddrPort()
+	}
+	return netip.AddrPort{}
+}
+
 func (c *baseUDPConn) Close() error {
 	return c.raw.Close()
 }
@@ -0,0 +1,637 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Redundant transmission sends each packet written on a Conn over multiple,
+// maximally disjoint paths at once, trading bandwidth for lower loss and
+// latency. It is enabled with WithRedundancy on the dialing side and
+// WithListenRedundancy on the listening side.
+//
+// Each copy of a packet carries a small header, containing a sequence number
+// for removing the duplicates at the receiver, the slot, i.e. the index of the
+// path in the sender's set of disjoint paths, and the slots of all copies of
+// the packet. Shortly after the first copy of a packet arrived, the listening
+// side counts which of the copies were received. It periodically reports the
+// counts for each slot back to the sender. From the reports, the sender
+// estimates the loss on each path and adapts the number of copies, see
+// RedundancyConfig.
+//
+// The listening side replies on a single path, chosen by the ReplySelector,
+// but with the header so that duplicates can still be removed by the Conn.
+// Packets without header are passed on unchanged, so a listener with
+// redundancy enabled can serve normal clients too.
+//
+// The header is not authenticated, like the payload of UDP packets in
+// general. Packets with spoofed source address may interfere with the
+// removal of duplicates.
+
+// redundancyMagic marks the packets with redundancy header.
+var redundancyMagic = [4]byte{0xd5, 0x52, 0x44, 0x8e}
+
+const (
+	redundancyData   byte = 1
+	redundancyReport byte = 2
+
+	// redundancyHeaderLen is the length of the header: magic, type, generation,
+	// slot, the slots of all copies, the session and the sequence number.
+	redundancyHeaderLen = len(redundancyMagic) + 4 + 4 + 4
+	// redundancyReportLen is the length of a report, containing the number
+	// of copies expected and received for each slot.
+	redundancyReportLen = redundancyHeaderLen + 8*maxRedundancyCopies
+
+	// maxRedundancyCopies is the maximum number of copies, i.e. the maximum
+	// number of paths used simultaneously.
+	maxRedundancyCopies = 8
+	// redundancyNoSlot marks packets sent on a single path, outside of the
+	// sender's set of disjoint paths. These are not counted for loss estimation.
+	redundancyNoSlot = 0xff
+
+	// redundancyReportInterval is the minimum interval between two loss reports
+	// sent to a remote.
+	redundancyReportInterval = 200 * time.Millisecond
+	// redundancySettleTime is the time after the first copy of a packet
+	// arrived, after which missing copies are counted as lost.
+	redundancySettleTime = 500 * time.Millisecond
+	// redundancyMinSamples is the minimum number of copies expected on a path
+	// before the loss estimate for the path is updated.
+	redundancyMinSamples = 8
+	// redundancyLossWeight is the weight of a new sample in the moving average
+	// of the loss.
+	redundancyLossWeight = 0.25
+
+	// redundancyWindowSize is the number of sequence numbers, up to the
+	// highest sequence number received, for which duplicates are detected.
+	// Older packets are dropped.
+	redundancyWindowSize = 256
+	// redundancyRemoteIdleTimeout is the time after which the state for an
+	// inactive remote is removed from a ListenConn.
+	redundancyRemoteIdleTimeout = 5 * time.Minute
+	// maxRedundancyRemotes bounds the number of remotes tracked by a
+	// ListenConn. Once reached, packets from new remotes are passed on without
+	// removing duplicates.
+	maxRedundancyRemotes = 1 << 12
+
+	defaultRedundancyMinCopies  = 2
+	defaultRedundancyMaxCopies  = 3
+	defaultRedundancyTargetLoss = 0.001
+)
+
+// RedundancyConfig configures redundant transmission, see WithRedundancy.
+type RedundancyConfig struct {
+	// MinCopies is the minimum number of copies sent of each packet, if enough
+	// paths are available. Defaults to 2.
+	MinCopies int
+	// MaxCopies is the maximum number of copies sent of each packet. Defaults
+	// to MinCopies, but at least 3. At most 8.
+	MaxCopies int
+	// TargetLoss is the acceptable probability that all copies of a packet are
+	// lost. More copies, up to MaxCopies, are sent while the product of the
+	// loss rates estimated for the paths used exceeds TargetLoss.
+	// Defaults to 0.001.
+	TargetLoss float64
+}
+
+func (c RedundancyConfig) withDefaults() RedundancyConfig {
+	if c.MinCopies <= 0 {
+		c.MinCopies = defaultRedundancyMinCopies
+	}
+	if c.MaxCopies <= 0 {
+		c.MaxCopies = defaultRedundancyMaxCopies
+	}
+	c.MinCopies = min(c.MinCopies, maxRedundancyCopies)
+	c.MaxCopies = min(max(c.MaxCopies, c.MinCopies), maxRedundancyCopies)
+	if c.TargetLoss <= 0 {
+		c.TargetLoss = defaultRedundancyTargetLoss
+	}
+	return c
+}
+
+// RedundantSelector is the Selector used for redundant transmission.
+// It keeps a set of up to 8 maximally disjoint paths, preferring paths without
+// down notifications and otherwise the order of the Policy. The loss on each of
+// these paths is estimated from the reports of the receiver. Each packet is
+// sent on the paths with the lowest loss, with the number of copies adapted
+// to the loss.
+//
+// Path returns the first path of the set, e.g. for packets sent with
+// WriteVia.
+type RedundantSelector struct {
+	mutex  sync.Mutex
+	config RedundancyConfig
+	paths  []*Path
+	// set is the set of disjoint paths. The index of a path in set is its slot.
+	set []*Path
+	// generation identifies the current set; the slot counters are reset
+	// whenever the set changes.
+	generation   uint8
+	lastExpected [maxRedundancyCopies]uint32
+	lastReceived [maxRedundancyCopies]uint32
+	loss         map[PathFingerprint]float64
+}
+
+// NewRedundantSelector creates a RedundantSelector with the given
+// configuration.
+func NewRedundantSelector(config RedundancyConfig) *RedundantSelector {
+	return &RedundantSelector{
+		config: config.withDefaults(),
+		loss:   make(map[PathFingerprint]float64),
+	}
+}
+
+func (s *RedundantSelector) Path(_ context.Context) *Path {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.set) == 0 {
+		return nil
+	}
+	return s.set[0]
+}
+
+func (s *RedundantSelector) Initialize(local, remote UDPAddr, paths []*Path) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.paths = paths
+	s.choose()
+}
+
+func (s *RedundantSelector) Refresh(paths []*Path) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.paths = paths
+	s.choose()
+}
+
+func (s *RedundantSelector) PathDown(pf PathFingerprint, pi PathInterface) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, p := range s.set {
+		if pf == p.Fingerprint || (p.Metadata != nil && isInterfaceOnPath(p, pi)) {
+			s.choose()
+			return
+		}
+	}
+}
+
+func (s *RedundantSelector) Close() error {
+	return nil
+}
+
+func (s *RedundantSelector) explainPath(path *Path) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return fmt.Sprintf("first of %d disjoint paths", len(s.set))
+}
+
+// redundantCopy is a copy of a packet to be sent in a slot.
+type redundantCopy struct {
+	slot uint8
+	path *Path
+}
+
+// copies returns the paths on which the next packet is to be sent, and the
+// generation of the set of paths.
+func (s *RedundantSelector) copies() (uint8, []redundantCopy) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	slots := make([]int, len(s.set))
+	for i := range slots {
+		slots[i] = i
+	}
+	sort.SliceStable(slots, func(i, j int) bool {
+		return s.loss[s.set[slots[i]].Fingerprint] < s.loss[s.set[slots[j]].Fingerprint]
+	})
+	copies := make([]redundantCopy, 0, len(slots))
+	lossAll := 1.0
+	for _, slot := range slots {
+		path := s.set[slot]
+		copies = append(copies, redundantCopy{slot: uint8(slot), path: path})
+		lossAll *= s.loss[path.Fingerprint]
+		if len(copies) >= s.config.MaxCopies ||
+			(len(copies) >= s.config.MinCopies && lossAll <= s.config.TargetLoss) {
+			break
+		}
+	}
+	return s.generation, copies
+}
+
+// report updates the loss estimates from the number of copies expected and
+// received in each slot, as reported by the receiver.
+func (s *RedundantSelector) report(generation uint8, expected, received []uint32) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if generation != s.generation {
+		return // outdated
+	}
+	for slot, path := range s.set {
+		exp := expected[slot] - s.lastExpected[slot]
+		recv := received[slot] - s.lastReceived[slot]
+		if int32(exp) < redundancyMinSamples || int32(recv) < 0 || recv > exp {
+			continue // not enough samples, or reordered report
+		}
+		sample := float64(exp-recv) / float64(exp)
+		s.loss[path.Fingerprint] += redundancyLossWeight * (sample - s.loss[path.Fingerprint])
+		s.lastExpected[slot] = expected[slot]
+		s.lastReceived[slot] = received[slot]
+	}
+}
+
+// choose selects the set of disjoint paths. Greedily picks the path sharing
+// the fewest interfaces with the paths already picked, preferring paths without
+// recent down notifications.
+func (s *RedundantSelector) choose() {
+	remaining := append([]*Path(nil), s.paths...)
+	down := make(map[PathFingerprint]bool, len(remaining))
+	for _, p := range remaining {
+		down[p.Fingerprint] = stats.IsNotifiedDown(p)
+	}
+	used := make(map[PathInterface]struct{})
+	set := make([]*Path, 0, maxRedundancyCopies)
+	for len(set) < maxRedundancyCopies && len(remaining) > 0 {
+		best, bestShared := 0, -1
+		for i, p := range remaining {
+			shared := 0
+			if p.Metadata != nil {
+				for _, pi := range p.Metadata.Interfaces {
+					if _, ok := used[pi]; ok {
+						shared++
+					}
+				}
+			}
+			if down[p.Fingerprint] {
+				shared += 1 << 16 // after all alive paths
+			}
+			if bestShared < 0 || shared < bestShared {
+				best, bestShared = i, shared
+			}
+		}
+		p := remaining[best]
+		set = append(set, p)
+		remaining = append(remaining[:best], remaining[best+1:]...)
+		if p.Metadata != nil {
+			for _, pi := range p.Metadata.Interfaces {
+				used[pi] = struct{}{}
+			}
+		}
+	}
+
+	if pathSetEqual(set, s.set) {
+		return
+	}
+	s.set = set
+	s.generation++
+	s.lastExpected = [maxRedundancyCopies]uint32{}
+	s.lastReceived = [maxRedundancyCopies]uint32{}
+}
+
+func pathSetEqual(a, b []*Path) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Fingerprint != b[i].Fingerprint {
+			return false
+		}
+	}
+	return true
+}
+
+type redundancyHeader struct {
+	typ        byte
+	generation uint8
+	slot       uint8
+	// slots is the bitmask of the slots of all copies of the packet.
+	slots   uint8
+	session uint32
+	seq     uint32
+}
+
+func (h redundancyHeader) appendTo(b []byte) []byte {
+	b = append(b, redundancyMagic[:]...)
+	b = append(b, h.typ, h.generation, h.slot, h.slots)
+	b = binary.BigEndian.AppendUint32(b, h.session)
+	b = binary.BigEndian.AppendUint32(b, h.seq)
+	return b
+}
+
+// parseRedundancyHeader checks whether b starts with a redundancy header and
+// returns the header and the remaining payload.
+func parseRedundancyHeader(b []byte) (redundancyHeader, []byte, bool) {
+	if len(b) < redundancyHeaderLen || !bytes.Equal(b[:len(redundancyMagic)], redundancyMagic[:]) {
+		return redundancyHeader{}, nil, false
+	}
+	b = b[len(redundancyMagic):]
+	h := redundancyHeader{
+		typ:        b[0],
+		generation: b[1],
+		slot:       b[2],
+		slots:      b[3],
+		session:    binary.BigEndian.Uint32(b[4:]),
+		seq:        binary.BigEndian.Uint32(b[8:]),
+	}
+	if h.typ != redundancyData && h.typ != redundancyReport {
+		return redundancyHeader{}, nil, false
+	}
+	return h, b[12:], true
+}
+
+// redundantSender numbers the packets sent to a remote.
+type redundantSender struct {
+	mutex   sync.Mutex
+	session uint32
+	seq     uint32
+}
+
+func newRedundantSender() *redundantSender {
+	var b [4]byte
+	mustRandRead(b[:])
+	return &redundantSender{session: binary.BigEndian.Uint32(b[:])}
+}
+
+// next returns the header for the next packet.
+func (s *redundantSender) next(generation uint8) redundancyHeader {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.seq++
+	return redundancyHeader{
+		typ:        redundancyData,
+		generation: generation,
+		slot:       redundancyNoSlot,
+		session:    s.session,
+		seq:        s.seq,
+	}
+}
+
+// wrap returns b with the header for the next packet on a single path.
+func (s *redundantSender) wrap(b []byte) []byte {
+	h := s.next(0)
+	return append(h.appendTo(make([]byte, 0, redundancyHeaderLen+len(b))), b...)
+}
+
+// redundantReceiver removes the duplicates of the packets received from a
+// remote and counts the copies expected and received in each slot.
+type redundantReceiver struct {
+	session    uint32
+	generation uint8
+	expected   [maxRedundancyCopies]uint32
+	received   [maxRedundancyCopies]uint32
+	valid      bool
+	highest    uint32
+	// packets tracks the packets with the last redundancyWindowSize sequence
+	// numbers up to highest, indexed by sequence number.
+	packets    [redundancyWindowSize]redundantPacket
+	lastReport time.Time
+}
+
+type redundantPacket struct {
+	seq        uint32
+	generation uint8
+	// slots and arrived are bitmasks of the slots of the copies sent and
+	// received.
+	slots   uint8
+	arrived uint8
+	first   time.Time
+	used    bool
+	settled bool
+}
+
+// receive processes a copy of a data packet, and returns false if it's a
+// duplicate or too old.
+func (r *redundantReceiver) receive(h redundancyHeader, now time.Time) bool {
+	if h.session != r.session {
+		*r = redundantReceiver{session: h.session, generation: h.generation}
+	}
+	if d := int8(h.generation - r.generation); d > 0 {
+		r.generation = h.generation
+		r.expected = [maxRedundancyCopies]uint32{}
+		r.received = [maxRedundancyCopies]uint32{}
+	}
+	var arrived uint8
+	if h.slot < maxRedundancyCopies {
+		arrived = 1 << h.slot
+	}
+	d := int32(h.seq - r.highest)
+	if r.valid && d <= -redundancyWindowSize {
+		return false
+	}
+	p := &r.packets[h.seq%redundancyWindowSize]
+	if p.used && p.seq == h.seq {
+		if !p.settled {
+			p.arrived |= arrived
+		}
+		return false
+	}
+	if p.used {
+		r.settle(p)
+	}
+	*p = redundantPacket{
+		seq:        h.seq,
+		generation: h.generation,
+		slots:      h.slots,
+		arrived:    arrived,
+		first:      now,
+		used:       true,
+	}
+	if !r.valid || d > 0 {
+		r.valid = true
+		r.highest = h.seq
+	}
+	return true
+}
+
+// settle counts the copies expected and received for a packet.
+func (r *redundantReceiver) settle(p *redundantPacket) {
+	if p.settled {
+		return
+	}
+	p.settled = true
+	if p.generation != r.generation {
+		return
+	}
+	for slot := 0; slot < maxRedundancyCopies; slot++ {
+		if p.slots&(1<<slot) != 0 {
+			r.expected[slot]++
+			if p.arrived&(1<<slot) != 0 {
+				r.received[slot]++
+			}
+		}
+	}
+}
+
+// report returns the report message, if a report is due.
+func (r *redundantReceiver) report(now time.Time) []byte {
+	if now.Sub(r.lastReport) < redundancyReportInterval {
+		return nil
+	}
+	r.lastReport = now
+	for i := range r.packets {
+		if p := &r.packets[i]; p.used && now.Sub(p.first) >= redundancySettleTime {
+			r.settle(p)
+		}
+	}
+	h := redundancyHeader{
+		typ:        redundancyReport,
+		generation: r.generation,
+		session:    r.session,
+	}
+	msg := h.appendTo(make([]byte, 0, redundancyReportLen))
+	for slot := range r.expected {
+		msg = binary.BigEndian.AppendUint32(msg, r.expected[slot])
+		msg = binary.BigEndian.AppendUint32(msg, r.received[slot])
+	}
+	return msg
+}
+
+func parseRedundancyReport(b []byte) (expected, received []uint32, ok bool) {
+	if len(b) != 8*maxRedundancyCopies {
+		return nil, nil, false
+	}
+	expected = make([]uint32, maxRedundancyCopies)
+	received = make([]uint32, maxRedundancyCopies)
+	for slot := range expected {
+		expected[slot] = binary.BigEndian.Uint32(b[8*slot:])
+		received[slot] = binary.BigEndian.Uint32(b[8*slot+4:])
+	}
+	return expected, received, true
+}
+
+// dialRedundancy is the redundant transmission state of a dialed connection.
+type dialRedundancy struct {
+	selector *RedundantSelector
+	sender   *redundantSender
+
+	mutex    sync.Mutex
+	receiver redundantReceiver
+}
+
+// receive processes a packet received from the remote. Returns the payload to
+// pass on, or false if the packet is consumed.
+func (r *dialRedundancy) receive(payload []byte) ([]byte, bool) {
+	h, data, ok := parseRedundancyHeader(payload)
+	if !ok {
+		return payload, true
+	}
+	if h.typ == redundancyReport {
+		if expected, received, ok := parseRedundancyReport(data); ok && h.session == r.sender.session {
+			r.selector.report(h.generation, expected, received)
+		}
+		return nil, false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.receiver.receive(h, time.Now()) {
+		return nil, false
+	}
+	return data, true
+}
+
+// listenRedundancy is the redundant transmission state of a listening
+// connection, for each remote that has sent packets with redundancy header.
+type listenRedundancy struct {
+	mutex     sync.Mutex
+	remotes   map[UDPAddr]*redundantRemote
+	lastSweep time.Time
+	timeNow   func() time.Time
+}
+
+type redundantRemote struct {
+	receiver redundantReceiver
+	sender   *redundantSender
+	seen     time.Time
+}
+
+func newListenRedundancy() *listenRedundancy {
+	return &listenRedundancy{
+		remotes: make(map[UDPAddr]*redundantRemote),
+		timeNow: time.Now,
+	}
+}
+
+// receive processes a packet received from remote. Returns the payload to pass
+// on, or false if the packet is consumed, and the loss report to send back to
+// remote, if any.
+func (r *listenRedundancy) receive(remote UDPAddr, payload []byte) ([]byte, bool, []byte) {
+	h, data, ok := parseRedundancyHeader(payload)
+	if !ok {
+		return payload, true, nil
+	}
+	if h.typ != redundancyData {
+		return nil, false, nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := r.timeNow()
+	e, ok := r.remotes[remote]
+	if !ok {
+		if len(r.remotes) >= maxRedundancyRemotes {
+			r.sweep(now)
+			if len(r.remotes) >= maxRedundancyRemotes {
+				return data, true, nil
+			}
+		}
+		e = &redundantRemote{sender: newRedundantSender()}
+		r.remotes[remote] = e
+	}
+	e.seen = now
+	fresh := e.receiver.receive(h, now)
+	report := e.receiver.report(now)
+	return data, fresh, report
+}
+
+// wrap returns b with the redundancy header, if remote uses redundant
+// transmission, or b unchanged otherwise.
+func (r *listenRedundancy) wrap(remote UDPAddr, b []byte) []byte {
+	r.mutex.Lock()
+	e, ok := r.remotes[remote]
+	r.mutex.Unlock()
+	if !ok {
+		return b
+	}
+	return e.sender.wrap(b)
+}
+
+// sweep removes the remotes that have been idle for longer than
+// redundancyRemoteIdleTimeout. To bound the effort when flooded, this scans
+// the table at most once per redundancyReportInterval.
+func (r *listenRedundancy) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < redundancyReportInterval {
+		return
+	}
+	r.lastSweep = now
+	for remote, e := range r.remotes {
+		if now.Sub(e.seen) > redundancyRemoteIdleTimeout {
+			delete(r.remotes, remote)
+		}
+	}
+}
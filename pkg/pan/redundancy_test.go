@@ -0,0 +1,237 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedundancyHeader(t *testing.T) {
+	h := redundancyHeader{
+		typ:        redundancyData,
+		generation: 3,
+		slot:       1,
+		slots:      0b011,
+		session:    0xdeadbeef,
+		seq:        42,
+	}
+	b := append(h.appendTo(nil), "payload"...)
+	parsed, payload, ok := parseRedundancyHeader(b)
+	require.True(t, ok)
+	assert.Equal(t, h, parsed)
+	assert.Equal(t, "payload", string(payload))
+
+	_, _, ok = parseRedundancyHeader([]byte("payload without any header"))
+	assert.False(t, ok)
+	_, _, ok = parseRedundancyHeader(b[:redundancyHeaderLen-1])
+	assert.False(t, ok)
+}
+
+func TestRedundantReceiver(t *testing.T) {
+	now := time.Now()
+	data := func(seq uint32, slot uint8, slots uint8) redundancyHeader {
+		return redundancyHeader{typ: redundancyData, slot: slot, slots: slots, session: 1, seq: seq}
+	}
+
+	t.Run("duplicates", func(t *testing.T) {
+		var r redundantReceiver
+		assert.True(t, r.receive(data(10, 0, 0b11), now))
+		assert.False(t, r.receive(data(10, 1, 0b11), now), "duplicate")
+		assert.True(t, r.receive(data(12, 0, 0b11), now))
+		assert.True(t, r.receive(data(11, 0, 0b11), now), "reordered")
+		assert.False(t, r.receive(data(11, 1, 0b11), now), "duplicate")
+		assert.True(t, r.receive(data(10+redundancyWindowSize, 0, 0b11), now))
+		assert.False(t, r.receive(data(10, 0, 0b11), now), "too old")
+		assert.True(t, r.receive(data(12+redundancyWindowSize, 0, 0b11), now))
+		assert.False(t, r.receive(data(11, 1, 0b11), now), "too old")
+
+		h := data(10, 0, 0b11)
+		h.session = 2
+		assert.True(t, r.receive(h, now), "new session")
+	})
+
+	t.Run("loss", func(t *testing.T) {
+		var r redundantReceiver
+		for seq := uint32(1); seq <= 10; seq++ {
+			assert.True(t, r.receive(data(seq, 0, 0b11), now))
+			if seq%2 == 0 {
+				assert.False(t, r.receive(data(seq, 1, 0b11), now))
+			}
+		}
+		// a copy received after the packet was settled is not counted
+		report := r.report(now.Add(redundancySettleTime))
+		require.NotNil(t, report)
+		assert.False(t, r.receive(data(1, 1, 0b11), now))
+		assert.Nil(t, r.report(now.Add(redundancySettleTime)), "rate limited")
+
+		h, body, ok := parseRedundancyHeader(report)
+		require.True(t, ok)
+		assert.Equal(t, redundancyReport, h.typ)
+		assert.Equal(t, uint32(1), h.session)
+		expected, received, ok := parseRedundancyReport(body)
+		require.True(t, ok)
+		assert.Equal(t, []uint32{10, 10}, expected[:2])
+		assert.Equal(t, []uint32{10, 5}, received[:2])
+	})
+}
+
+func TestRedundantSelector(t *testing.T) {
+	stats = newPathStatsDB()
+	asA := MustParseIA("1-ff00:0:110")
+	asB := MustParseIA("1-ff00:0:111")
+	asC := MustParseIA("1-ff00:0:112")
+	makePath := func(fingerprint PathFingerprint, interfaces ...PathInterface) *Path {
+		return &Path{
+			Source:      asA,
+			Destination: asC,
+			Fingerprint: fingerprint,
+			Metadata:    &PathMetadata{Interfaces: interfaces},
+		}
+	}
+	// a and b share the interfaces to B, c is disjoint from both
+	a := makePath("a", PathInterface{asA, 1}, PathInterface{asB, 1}, PathInterface{asB, 2}, PathInterface{asC, 2})
+	b := makePath("b", PathInterface{asA, 1}, PathInterface{asB, 1}, PathInterface{asB, 3}, PathInterface{asC, 3})
+	c := makePath("c", PathInterface{asA, 4}, PathInterface{asC, 4})
+
+	slotsOf := func(copies []redundantCopy) []PathFingerprint {
+		var ret []PathFingerprint
+		for _, cp := range copies {
+			ret = append(ret, cp.path.Fingerprint)
+		}
+		return ret
+	}
+
+	s := NewRedundantSelector(RedundancyConfig{MinCopies: 2, MaxCopies: 3, TargetLoss: 0.01})
+	s.Initialize(UDPAddr{}, UDPAddr{}, []*Path{a, b, c})
+	assert.Equal(t, []*Path{a, c, b}, s.set, "disjoint paths first")
+	assert.Equal(t, a, s.Path(context.Background()))
+	generation, copies := s.copies()
+	assert.Equal(t, []PathFingerprint{"a", "c"}, slotsOf(copies))
+
+	// loss on a; b and c (without measurements) are used instead
+	s.report(generation, []uint32{100, 100, 0}, []uint32{50, 100, 0})
+	assert.InDelta(t, 0.125, s.loss["a"], 1e-9)
+	_, copies = s.copies()
+	assert.Equal(t, []PathFingerprint{"c", "b"}, slotsOf(copies))
+
+	// loss on all paths; the third copy is needed to reach the target loss
+	s.report(generation, []uint32{100, 200, 100}, []uint32{50, 150, 50})
+	_, copies = s.copies()
+	assert.Equal(t, []PathFingerprint{"a", "c", "b"}, slotsOf(copies))
+
+	s.report(generation+1, []uint32{1000, 1000, 1000}, []uint32{0, 0, 0})
+	assert.InDelta(t, 0.125, s.loss["c"], 1e-9, "report for other generation is ignored")
+
+	// down notification for c, which is then only used last
+	pi := PathInterface{asA, 4}
+	stats.recordPathDown(c.Fingerprint, pi)
+	s.PathDown(c.Fingerprint, pi)
+	assert.Equal(t, []*Path{a, b, c}, s.set)
+	assert.NotEqual(t, generation, s.generation)
+}
+
+func TestRedundancyLoopback(t *testing.T) {
+	stats = newPathStatsDB()
+	p := newLoopbackPair(t)
+
+	// three paths with the same forwarding path; all copies sent on b are lost
+	var paths []*Path
+	for i, fp := range []PathFingerprint{"a", "b", "c"} {
+		path := *p.pathAB
+		path.Fingerprint = fp
+		path.Metadata = &PathMetadata{
+			Interfaces: []PathInterface{{IA: p.addrA.IA, IfID: IfID(i + 1)}, {IA: p.addrB.IA, IfID: IfID(i + 1)}},
+		}
+		paths = append(paths, &path)
+	}
+	emulator := NewEmulator(1)
+	emulator.SetPath("b", Impairment{Loss: 1})
+
+	selector := NewRedundantSelector(RedundancyConfig{MinCopies: 2, MaxCopies: 2})
+	selector.Initialize(p.addrA, p.addrB, paths)
+	client := &dialedConn{
+		baseUDPConn: baseUDPConn{raw: p.a.raw, emulator: emulator},
+		local:       p.addrA,
+		remote:      p.addrB,
+		selector:    selector,
+		redundancy:  &dialRedundancy{selector: selector, sender: newRedundantSender()},
+	}
+	client.intercept = client.interceptPacket
+
+	server := &listenConn{
+		baseUDPConn: baseUDPConn{raw: p.b.raw},
+		local:       p.addrB,
+		selector:    NewDefaultReplySelector(),
+		redundancy:  newListenRedundancy(),
+	}
+	server.intercept = server.interceptPacket
+	// a report is due, and all packets are settled, on every packet received
+	now := time.Now()
+	server.redundancy.timeNow = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	const numPackets = 20
+	done := make(chan []string, 1)
+	go func() {
+		var received []string
+		buf := make([]byte, 100)
+		for len(received) < numPackets {
+			_ = server.SetReadDeadline(time.Now().Add(time.Second))
+			n, remote, err := server.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			received = append(received, string(buf[:n]))
+			if len(received) == numPackets {
+				_, _ = server.WriteTo([]byte("done"), remote)
+			}
+		}
+		done <- received
+	}()
+
+	var sent []string
+	for i := 0; i < numPackets; i++ {
+		msg := fmt.Sprintf("packet %d", i)
+		sent = append(sent, msg)
+		n, err := client.Write([]byte(msg))
+		require.NoError(t, err)
+		require.Equal(t, len(msg), n)
+		time.Sleep(time.Millisecond) // avoid overflowing the socket buffers
+	}
+	assert.Equal(t, sent, <-done, "each packet received exactly once")
+
+	// the reply has the redundancy header, which is removed by the client
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 100)
+	n, err := client.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "done", string(buf[:n]))
+
+	// the reports have been processed while reading
+	assert.Greater(t, selector.loss["b"], 0.0)
+	assert.Zero(t, selector.loss["a"])
+	_, copies := selector.copies()
+	require.Len(t, copies, 2)
+	assert.Equal(t, PathFingerprint("a"), copies[0].path.Fingerprint)
+	assert.Equal(t, PathFingerprint("c"), copies[1].path.Fingerprint)
+}
@@ -60,6 +60,29 @@ func (r *refresher) subscribe(ctx context.Context, dst IA, s refreshee) ([]*Path
 	return paths, nil
 }
 
+// prefetch keeps the paths to dst refreshed, even if there is no subscriber
+// for dst, until stopPrefetch is called.
+// Returns false if paths to dst are already prefetched.
+func (r *refresher) prefetch(dst IA) bool {
+	r.subscribersMutex.Lock()
+	defer r.subscribersMutex.Unlock()
+	subs, ok := r.subscribers[dst]
+	for _, s := range subs {
+		if s == refreshee(prefetchRefreshee{}) {
+			return false
+		}
+	}
+	r.subscribers[dst] = append(subs, prefetchRefreshee{})
+	if !ok {
+		r.newSubscription <- (len(r.subscribers) == 1)
+	}
+	return true
+}
+
+func (r *refresher) stopPrefetch(dst IA) {
+	r.unsubscribe(dst, prefetchRefreshee{})
+}
+
 func (r *refresher) unsubscribe(ia IA, s refreshee) {
 	r.subscribersMutex.Lock()
 	defer r.subscribersMutex.Unlock()
@@ -141,12 +164,9 @@ func (r *refresher) nextRefresh(prevRefresh time.Time) time.Time {
 	}
 	nextRefresh := prevRefresh.Add(pathRefreshInterval)
 
-	expiry := r.pool.earliestPathExpiry()
-	randOffset := time.Duration(rand.Intn(10)) * time.Second // avoid everbody refreshing simultaneously
-	expiryRefresh := expiry.Add(-pathRefreshLeadTime + randOffset)
-
-	if expiryRefresh.Before(nextRefresh) {
-		nextRefresh = expiryRefresh
+	if refresh, ok := r.pool.earliestRefresh(); ok && refresh.Before(nextRefresh) {
+		randOffset := time.Duration(rand.Intn(10)) * time.Second // avoid everbody refreshing simultaneously
+		nextRefresh = refresh.Add(randOffset)
 	}
 
 	// if there are still paths that expire very soon (or have already expired),
@@ -159,6 +179,12 @@ func (r *refresher) nextRefresh(prevRefresh time.Time) time.Time {
 	return nextRefresh
 }
 
+// prefetchRefreshee is the placeholder subscriber for prefetched destinations.
+// The refreshed paths are only kept in the pool.
+type prefetchRefreshee struct{}
+
+func (prefetchRefreshee) refresh(dst IA, paths []*Path) {}
+
 // resetTimer resets the timer, as described in godoc for time.Timer.Reset.
 //
 // This cannot be done concurrent to other receives from the Timer's channel or
@@ -20,6 +20,7 @@ import (
 	"net"
 	"net/netip"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
@@ -30,12 +31,14 @@ import (
 )
 
 // hostContext contains the information needed to connect to the host's local SCION stack,
-// i.e. the connection to sciond.
+// i.e. the connection to sciond, or the topology and path provider when
+// running without sciond.
 type hostContext struct {
 	ia            IA
-	sciond        daemon.Connector
+	paths         PathProvider
 	topology      snet.Topology
-	hostInLocalAS net.IP
+	hostInLocalAS netip.Addr
+	borderRouters []netip.Addr
 }
 
 const (
@@ -53,14 +56,25 @@ func (e HostContextError) Error() string {
 	return fmt.Sprintf("error initializing SCION host context: '%v'", e.Cause)
 }
 
-var singletonHostContext hostContext
-var initOnce = sync.OnceValue(mustInitHostContext)
+// The singleton hostContext is initialized on first use, or explicitly with
+// UseTopologyFile. Once initialized, it is never replaced.
+var (
+	hostMutex            sync.Mutex
+	singletonHostContext hostContext
+	hostInitialized      bool
+	hostInitErr          error
+)
 
 // host initialises and returns the singleton hostContext.
 func getHost() (*hostContext, error) {
-	err := initOnce()
-	if err != nil {
-		return nil, err
+	hostMutex.Lock()
+	defer hostMutex.Unlock()
+	if !hostInitialized {
+		hostInitErr = mustInitHostContext()
+		hostInitialized = true
+	}
+	if hostInitErr != nil {
+		return nil, hostInitErr
 	}
 	return &singletonHostContext, nil
 }
@@ -75,6 +89,13 @@ func mustInitHostContext() error {
 }
 
 func initHostContext() (hostContext, error) {
+	if topologyFile, ok := os.LookupEnv("SCION_TOPOLOGY"); ok {
+		provider, err := pathProviderFromEnv()
+		if err != nil {
+			return hostContext{}, err
+		}
+		return initHostContextFromTopology(topologyFile, provider)
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), initTimeout)
 	defer cancel()
 	sciondConn, err := findSciond(ctx)
@@ -95,9 +116,10 @@ func initHostContext() (hostContext, error) {
 	}
 	return hostContext{
 		ia:            IA(localIA),
-		sciond:        sciondConn,
+		paths:         daemonPathProvider{conn: sciondConn},
 		topology:      topo,
 		hostInLocalAS: hostInLocalAS,
+		borderRouters: queryBorderRouters(ctx, sciondConn),
 	}, nil
 }
 
@@ -114,36 +136,99 @@ func findSciond(ctx context.Context) (daemon.Connector, error) {
 }
 
 // findAnyHostInLocalAS returns the IP address of some (infrastructure) host in the local AS.
-func findAnyHostInLocalAS(ctx context.Context, sciondConn daemon.Connector) (net.IP, error) {
+func findAnyHostInLocalAS(ctx context.Context, sciondConn daemon.Connector) (netip.Addr, error) {
 	addr, err := daemon.TopoQuerier{Connector: sciondConn}.UnderlayAnycast(ctx, addr.SvcCS)
 	if err != nil {
-		return nil, err
+		return netip.Addr{}, err
 	}
-	return addr.IP, nil
+	ip, _ := netip.AddrFromSlice(addr.IP)
+	return ip.Unmap(), nil
+}
+
+// queryBorderRouters returns the addresses of the border routers of the local
+// AS from sciond. These are only additional candidates for the default local
+// IP, so this is best effort; if sciond does not answer, the error is logged
+// and no border routers are returned.
+func queryBorderRouters(ctx context.Context, sciondConn daemon.Connector) []netip.Addr {
+	interfaces, err := sciondConn.Interfaces(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: unable to query the border router interfaces from SCIOND: %v\n", err)
+		return nil
+	}
+	return borderRouterAddrs(interfaces)
+}
+
+// borderRouterAddrs returns the distinct IP addresses of the border routers,
+// given the underlay addresses of all interfaces of the local AS.
+func borderRouterAddrs(interfaces map[uint16]netip.AddrPort) []netip.Addr {
+	addrs := make([]netip.Addr, 0, len(interfaces))
+	for _, a := range interfaces {
+		if !slices.Contains(addrs, a.Addr().Unmap()) {
+			addrs = append(addrs, a.Addr().Unmap())
+		}
+	}
+	slices.SortFunc(addrs, netip.Addr.Compare)
+	return addrs
 }
 
 // defaultLocalIP returns _a_ IP of this host in the local AS.
+// This is the IP of the interface over which the host reaches the control
+// service or, e.g. on an IPv6-only host in an AS with an IPv4 control service,
+// any of the border routers. If remote is valid, i.e. for a destination in the
+// local AS, the interface over which remote is reached is preferred.
+// If family is valid, e.g. the unspecified address "0.0.0.0" or "::", only an
+// IP of the same address family is returned.
 //
 // The purpose of this function is to workaround not being able to bind to
 // wildcard addresses in snet.
 // See note on wildcard addresses in the package documentation.
-func defaultLocalIP() (netip.Addr, error) {
+func defaultLocalIP(family, remote netip.Addr) (netip.Addr, error) {
 	host, err := getHost()
 	if err != nil {
 		return netip.Addr{}, err
 	}
-	stdIP, err := addrutil.ResolveLocal(host.hostInLocalAS)
-	ip, ok := netip.AddrFromSlice(stdIP)
-	if err != nil || !ok {
-		return netip.Addr{}, fmt.Errorf("unable to resolve default local address %w", err)
+	candidates := make([]netip.Addr, 0, 2+len(host.borderRouters))
+	if remote.IsValid() && !remote.IsUnspecified() {
+		candidates = append(candidates, remote.Unmap())
+	}
+	candidates = append(candidates, host.hostInLocalAS)
+	candidates = append(candidates, host.borderRouters...)
+
+	err = fmt.Errorf("no %s host in the local AS", addressFamily(family))
+	for _, c := range candidates {
+		if !c.IsValid() || (family.IsValid() && c.Is4() != family.Unmap().Is4()) {
+			continue
+		}
+		var stdIP net.IP
+		stdIP, err = addrutil.ResolveLocal(c.AsSlice())
+		if err != nil {
+			continue
+		}
+		if ip, ok := netip.AddrFromSlice(stdIP); ok && ip.Unmap().Is4() == c.Is4() {
+			return ip.Unmap(), nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("unable to resolve default local address %w", err)
+}
+
+// addressFamily returns "IPv4" or "IPv6" for a valid ip, or "IP" otherwise.
+func addressFamily(ip netip.Addr) string {
+	switch {
+	case !ip.IsValid():
+		return "IP"
+	case ip.Unmap().Is4():
+		return "IPv4"
+	default:
+		return "IPv6"
 	}
-	return ip.Unmap(), nil
 }
 
 // defaultLocalAddr fills in a missing or unspecified IP field with defaultLocalIP.
-func defaultLocalAddr(local netip.AddrPort) (netip.AddrPort, error) {
+// An unspecified IP, "0.0.0.0" or "::", selects the address family of the default
+// local IP. The optional remote is a destination in the local AS.
+func defaultLocalAddr(local netip.AddrPort, remote netip.Addr) (netip.AddrPort, error) {
 	if !local.Addr().IsValid() || local.Addr().IsUnspecified() {
-		localIP, err := defaultLocalIP()
+		localIP, err := defaultLocalIP(local.Addr(), remote)
 		if err != nil {
 			return netip.AddrPort{}, err
 		}
@@ -153,8 +238,32 @@ func defaultLocalAddr(local netip.AddrPort) (netip.AddrPort, error) {
 }
 
 func (h *hostContext) queryPaths(ctx context.Context, dst IA) ([]*Path, error) {
+	paths, err := h.paths.Paths(ctx, h.ia, dst)
+	if err != nil {
+		return nil, err
+	}
+	// the provider may return a slice that it shares with other callers
+	paths = append([]*Path(nil), paths...)
+	for i, p := range paths {
+		// fill in the next hop for paths from providers that don't know the
+		// local topology
+		if !p.ForwardingPath.underlay.IsValid() && p.Metadata != nil && len(p.Metadata.Interfaces) > 0 {
+			withUnderlay := *p
+			withUnderlay.ForwardingPath.underlay, _ = h.topology.Interface(uint16(p.Metadata.Interfaces[0].IfID))
+			paths[i] = &withUnderlay
+		}
+	}
+	return paths, nil
+}
+
+// daemonPathProvider is the PathProvider querying paths from sciond.
+type daemonPathProvider struct {
+	conn daemon.Connector
+}
+
+func (d daemonPathProvider) Paths(ctx context.Context, src, dst IA) ([]*Path, error) {
 	flags := daemon.PathReqFlags{Refresh: false, Hidden: false}
-	snetPaths, err := h.sciond.Paths(ctx, addr.IA(dst), 0, flags)
+	snetPaths, err := d.conn.Paths(ctx, addr.IA(dst), addr.IA(src), flags)
 	if err != nil {
 		return nil, err
 	}
@@ -173,7 +282,7 @@ func (h *hostContext) queryPaths(ctx context.Context, dst IA) ([]*Path, error) {
 		}
 		underlay := p.UnderlayNextHop().AddrPort()
 		paths[i] = &Path{
-			Source:      h.ia,
+			Source:      src,
 			Destination: dst,
 			Metadata:    metadata,
 			Fingerprint: pathSequenceFromInterfaces(metadata.Interfaces).Fingerprint(),
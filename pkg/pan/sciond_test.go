@@ -0,0 +1,199 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/scionproto/scion/pkg/daemon"
+	"github.com/scionproto/scion/pkg/snet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestHostContext replaces the host context for the duration of the test.
+// The paths cached in the global path pool are dropped before and after the
+// test.
+func useTestHostContext(t *testing.T, h hostContext) {
+	clearPool := func() {
+		pool.entriesMutex.Lock()
+		defer pool.entriesMutex.Unlock()
+		clear(pool.entries)
+	}
+	hostMutex.Lock()
+	prevHost, prevInitialized, prevErr := singletonHostContext, hostInitialized, hostInitErr
+	singletonHostContext, hostInitialized, hostInitErr = h, true, nil
+	hostMutex.Unlock()
+	clearPool()
+	t.Cleanup(func() {
+		hostMutex.Lock()
+		singletonHostContext, hostInitialized, hostInitErr = prevHost, prevInitialized, prevErr
+		hostMutex.Unlock()
+		clearPool()
+	})
+}
+
+func TestBorderRouterAddrs(t *testing.T) {
+	interfaces := map[uint16]netip.AddrPort{
+		1: netip.MustParseAddrPort("[::1]:31002"),
+		2: netip.MustParseAddrPort("10.0.0.1:31002"),
+		3: netip.MustParseAddrPort("[::ffff:10.0.0.1]:31004"),
+		4: netip.MustParseAddrPort("[::1]:31004"),
+	}
+	assert.Equal(t,
+		[]netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("::1")},
+		borderRouterAddrs(interfaces))
+	assert.Empty(t, borderRouterAddrs(nil))
+}
+
+// interfacesConnector is a daemon.Connector answering only Interfaces.
+type interfacesConnector struct {
+	daemon.Connector
+	interfaces map[uint16]netip.AddrPort
+	err        error
+}
+
+func (c interfacesConnector) Interfaces(context.Context) (map[uint16]netip.AddrPort, error) {
+	return c.interfaces, c.err
+}
+
+func TestQueryBorderRouters(t *testing.T) {
+	conn := interfacesConnector{interfaces: map[uint16]netip.AddrPort{
+		1: netip.MustParseAddrPort("10.0.0.1:31002"),
+	}}
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("10.0.0.1")},
+		queryBorderRouters(context.Background(), conn))
+
+	conn = interfacesConnector{err: errors.New("permission denied")}
+	assert.Empty(t, queryBorderRouters(context.Background(), conn), "best effort")
+}
+
+func TestDefaultLocalIP(t *testing.T) {
+	v4 := netip.MustParseAddr("127.0.0.1")
+	v6 := netip.MustParseAddr("::1")
+
+	t.Run("dual stack", func(t *testing.T) {
+		useTestHostContext(t, hostContext{
+			ia:            MustParseIA("1-ff00:0:110"),
+			hostInLocalAS: v6,
+			borderRouters: []netip.Addr{v4},
+		})
+		cases := []struct {
+			name           string
+			family, remote netip.Addr
+			expected       netip.Addr
+		}{
+			{"any", netip.Addr{}, netip.Addr{}, v6},
+			{"IPv4 wildcard", netip.IPv4Unspecified(), netip.Addr{}, v4},
+			{"IPv6 wildcard", netip.IPv6Unspecified(), netip.Addr{}, v6},
+			{"IPv4 remote", netip.Addr{}, v4, v4},
+			{"IPv4 remote, IPv6 wildcard", netip.IPv6Unspecified(), v4, v6},
+		}
+		for _, c := range cases {
+			ip, err := defaultLocalIP(c.family, c.remote)
+			require.NoError(t, err, c.name)
+			assert.Equal(t, c.expected, ip, c.name)
+		}
+
+		local, err := defaultLocalAddr(netip.MustParseAddrPort("0.0.0.0:1234"), netip.Addr{})
+		require.NoError(t, err)
+		assert.Equal(t, netip.AddrPortFrom(v4, 1234), local)
+		local, err = defaultLocalAddr(netip.MustParseAddrPort("[::2]:1234"), netip.Addr{})
+		require.NoError(t, err)
+		assert.Equal(t, netip.MustParseAddrPort("[::2]:1234"), local, "specified IP not changed")
+	})
+
+	t.Run("IPv6 only", func(t *testing.T) {
+		useTestHostContext(t, hostContext{
+			ia:            MustParseIA("1-ff00:0:110"),
+			hostInLocalAS: v6,
+			borderRouters: []netip.Addr{v6},
+		})
+		ip, err := defaultLocalIP(netip.Addr{}, netip.Addr{})
+		require.NoError(t, err)
+		assert.Equal(t, v6, ip)
+		_, err = defaultLocalIP(netip.IPv4Unspecified(), netip.Addr{})
+		assert.ErrorContains(t, err, "no IPv4 host in the local AS")
+	})
+}
+
+// TestIPv6Only runs a dialed and a listening connection on an IPv6-only host,
+// where the border routers are only reachable over IPv6.
+func TestIPv6Only(t *testing.T) {
+	p := newLoopbackPairAt(t, netip.MustParseAddr("::1"))
+	peer, peerAddr := p.b, p.addrB
+
+	v4Path := testLoopbackPath(t, p.addrA.IA, peerAddr.IA, netip.MustParseAddrPort("127.0.0.1:9"))
+	v4Path.Fingerprint = "3 4"
+	v6Path := testLoopbackPath(t, p.addrA.IA, peerAddr.IA, netip.AddrPortFrom(peerAddr.IP, peerAddr.Port))
+	useTestHostContext(t, hostContext{
+		ia: p.addrA.IA,
+		paths: PathProviderFunc(func(ctx context.Context, src, dst IA) ([]*Path, error) {
+			return []*Path{v4Path, v6Path}, nil
+		}),
+		topology: snet.Topology{
+			PortRange: snet.TopologyPortRange{Start: 31000, End: 32767},
+			Interface: func(uint16) (netip.AddrPort, bool) { return netip.AddrPort{}, false },
+		},
+		hostInLocalAS: netip.MustParseAddr("::1"),
+		borderRouters: []netip.Addr{netip.MustParseAddr("::1")},
+	})
+	ctx := context.Background()
+
+	t.Run("dial", func(t *testing.T) {
+		conn, err := DialUDP(ctx, netip.AddrPort{}, peerAddr)
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.Equal(t, netip.MustParseAddr("::1"), conn.LocalAddr().(UDPAddr).IP)
+
+		_, err = conn.Write([]byte("hello"))
+		require.NoError(t, err, "IPv4 path must not be used")
+		buf := make([]byte, 100)
+		require.NoError(t, peer.SetReadDeadline(time.Now().Add(time.Second)))
+		n, remote, _, err := peer.readMsg(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(buf[:n]))
+		assert.Equal(t, conn.LocalAddr(), remote)
+	})
+
+	t.Run("listen", func(t *testing.T) {
+		conn, err := ListenUDP(ctx, netip.MustParseAddrPort("[::]:0"))
+		require.NoError(t, err)
+		defer conn.Close()
+		local := conn.LocalAddr().(UDPAddr)
+		assert.Equal(t, netip.MustParseAddr("::1"), local.IP, "wildcard resolved to IPv6")
+
+		toListener := testLoopbackPath(t, peerAddr.IA, local.IA, netip.AddrPortFrom(local.IP, local.Port))
+		_, err = peer.writeMsg(peerAddr, local, toListener, []byte("ping"), decidedBy("test"))
+		require.NoError(t, err)
+		buf := make([]byte, 100)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, remote, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(buf[:n]))
+		assert.Equal(t, peerAddr, remote)
+
+		_, err = conn.WriteTo([]byte("pong"), remote)
+		require.NoError(t, err)
+		require.NoError(t, peer.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, _, err = peer.readMsg(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "pong", string(buf[:n]))
+	})
+}
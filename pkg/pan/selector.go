@@ -119,6 +119,21 @@ func (s *DefaultSelector) Close() error {
 	return nil
 }
 
+func (s *DefaultSelector) explainPath(path *Path) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := pathIndex(s.paths, path)
+	switch {
+	case i < 0:
+		return "path no longer known"
+	case i == 0:
+		return fmt.Sprintf("first of %d paths in policy order", len(s.paths))
+	default:
+		return fmt.Sprintf("path %d of %d in policy order, after failover from down notifications", i+1, len(s.paths))
+	}
+}
+
 type PingingSelector struct {
 	// Interval for pinging. Must be positive.
 	Interval time.Duration
@@ -182,6 +197,27 @@ func (s *PingingSelector) reselectPath() {
 	s.current = stats.LowestLatency(s.remote, s.paths)
 }
 
+func (s *PingingSelector) explainPath(path *Path) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if rtt, ok := stats.Latency(s.remote, path.Fingerprint); ok {
+		return fmt.Sprintf("lowest latency of %d paths, RTT %s", len(s.paths), rtt)
+	}
+	return fmt.Sprintf("lowest latency of %d paths, RTT not measured", len(s.paths))
+}
+
+// pathIndex returns the index of the path with the fingerprint of path in
+// paths, or -1.
+func pathIndex(paths []*Path, path *Path) int {
+	for i, p := range paths {
+		if p.Fingerprint == path.Fingerprint {
+			return i
+		}
+	}
+	return -1
+}
+
 func (s *PingingSelector) ensureRunning() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
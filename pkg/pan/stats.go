@@ -84,6 +84,20 @@ func (s *pathStatsDB) RecordLatency(dst scionAddr, p PathFingerprint, latency ti
 	s.destinations[dst] = dstStats
 }
 
+// Latency returns the most recent latency recorded for the path to dst.
+// Latency records not younger than a recorded down notification for the path
+// are ignored.
+func (s *pathStatsDB) Latency(dst scionAddr, p PathFingerprint) (time.Duration, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	samples := s.destinations[dst].Latency[p]
+	if len(samples) == 0 || !samples[0].Time.After(s.paths[p].IsNotifiedDown) {
+		return 0, false
+	}
+	return samples[0].Value, true
+}
+
 // LowestLatency returns the index of the path with lowest recorded latency.
 // In case of ties, lower index paths are preferred.
 // Path liveness is taken into account; latency records not younger than a
@@ -150,6 +164,15 @@ func (s *pathStatsDB) IsMoreAlive(a, b *Path) bool {
 	return newestA.Before(oldestB.Add(-pathDownNotificationTimeout)) // XXX: what is this value, what does it mean?
 }
 
+// IsNotifiedDown checks whether there are recent down notifications for path
+// p, i.e. notifications received within pathDownNotificationTimeout.
+func (s *pathStatsDB) IsNotifiedDown(p *Path) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return time.Since(s.newestDownNotification(p)) < pathDownNotificationTimeout
+}
+
 // newestDownNotification returns the time of the newest relevant down
 // notification for path p.
 func (s *pathStatsDB) newestDownNotification(p *Path) time.Time {
@@ -0,0 +1,99 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/snet"
+	"github.com/scionproto/scion/private/topology"
+)
+
+// UseTopologyFile configures this package to run without a SCION daemon.
+// The local ISD-AS and the border router addresses are loaded from the
+// topology.json file of the local AS, and paths are looked up with provider.
+//
+// This must be called before any other function of this package that opens a
+// connection or looks up paths; it fails once the host context is initialized.
+// Alternatively, the topology file and a static path file can be set with the
+// SCION_TOPOLOGY and SCION_PATHS environment variables.
+func UseTopologyFile(topologyFile string, provider PathProvider) error {
+	if provider == nil {
+		panic("nil path provider not allowed")
+	}
+	hostMutex.Lock()
+	defer hostMutex.Unlock()
+	if hostInitialized {
+		return errors.New("host context already initialized, UseTopologyFile must be called first")
+	}
+	hostCtx, err := initHostContextFromTopology(topologyFile, provider)
+	if err != nil {
+		return HostContextError{Cause: err}
+	}
+	singletonHostContext = hostCtx
+	hostInitialized = true
+	return nil
+}
+
+func initHostContextFromTopology(topologyFile string, provider PathProvider) (hostContext, error) {
+	topo, err := topology.FromJSONFile(topologyFile)
+	if err != nil {
+		return hostContext{}, fmt.Errorf("unable to load topology %s: %w", topologyFile, err)
+	}
+	start, end := topo.PortRange()
+	// resolve all interfaces now, the topology is not reloaded
+	interfaces := make(map[uint16]netip.AddrPort)
+	for _, ifID := range topo.IfIDs() {
+		if a, ok := topo.UnderlayNextHop(ifID); ok {
+			interfaces[uint16(ifID)] = a.AddrPort()
+		}
+	}
+	hostInLocalAS, err := topo.UnderlayAnycast(addr.SvcCS)
+	if err != nil {
+		return hostContext{}, fmt.Errorf("no control service in topology %s: %w", topologyFile, err)
+	}
+	hostIP, _ := netip.AddrFromSlice(hostInLocalAS.IP)
+	return hostContext{
+		ia:    IA(topo.IA()),
+		paths: provider,
+		topology: snet.Topology{
+			LocalIA: topo.IA(),
+			PortRange: snet.TopologyPortRange{
+				Start: start,
+				End:   end,
+			},
+			Interface: func(ifID uint16) (netip.AddrPort, bool) {
+				a, ok := interfaces[ifID]
+				return a, ok
+			},
+		},
+		hostInLocalAS: hostIP.Unmap(),
+		borderRouters: borderRouterAddrs(interfaces),
+	}, nil
+}
+
+// pathProviderFromEnv returns the StaticPathProvider for the path file set in
+// SCION_PATHS. Without path file, only the local AS is reachable.
+func pathProviderFromEnv() (PathProvider, error) {
+	pathFile, ok := os.LookupEnv("SCION_PATHS")
+	if !ok {
+		return NewStaticPathProvider(nil), nil
+	}
+	return LoadStaticPathFile(pathFile)
+}
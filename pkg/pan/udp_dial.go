@@ -16,8 +16,11 @@ package pan
 
 import (
 	"context"
+	"io"
 	"net"
 	"net/netip"
+	"sync"
+	"time"
 
 	"github.com/scionproto/scion/pkg/snet"
 )
@@ -39,9 +42,20 @@ type Conn interface {
 	// ReadVia reads a message and returns the (return-)path via which the
 	// message was received.
 	ReadVia(b []byte) (int, *Path, error)
+	// WriteBatch writes multiple messages to the remote address, using paths
+	// from the path policy and selector. Where supported, this uses a single
+	// system call for the batch. Returns the number of messages written.
+	WriteBatch(msgs []Message) (int, error)
+	// ReadBatch reads at least one and at most len(msgs) messages. Where
+	// supported, this uses a single system call for the batch. Returns the
+	// number of messages read.
+	ReadBatch(msgs []Message) (int, error)
 
 	GetPath() *Path
 	GetPathWithCtx(ctx context.Context) *Path
+	// Stats returns a snapshot of the statistics of the connection, with the
+	// counters for each path used and the paths chosen by the selector.
+	Stats() ConnStats
 }
 
 // DialUDP opens a SCION/UDP socket, connected to the remote address.
@@ -66,13 +80,18 @@ func DialUDP(
 		return nil, err
 	}
 
-	local, err = defaultLocalAddr(local)
+	var localRemote netip.Addr
+	if remote.IA == host.ia {
+		localRemote = remote.IP
+	}
+	local, err = defaultLocalAddr(local, localRemote)
 	if err != nil {
 		return nil, err
 	}
+	connStats := newConnStats()
 	sn := snet.SCIONNetwork{
 		Topology:    host.topology,
-		SCMPHandler: o.scmpHandler,
+		SCMPHandler: statsSCMPHandler{handler: o.scmpHandler, stats: connStats},
 	}
 	conn, err := sn.OpenRaw(ctx, net.UDPAddrFromAddrPort(local))
 	if err != nil {
@@ -84,22 +103,37 @@ func DialUDP(
 		IP:   ipport.Addr(),
 		Port: ipport.Port(),
 	}
+	var redundancy *dialRedundancy
+	if o.redundancy != nil {
+		selector := NewRedundantSelector(*o.redundancy)
+		o.selector = selector
+		redundancy = &dialRedundancy{
+			selector: selector,
+			sender:   newRedundantSender(),
+		}
+	}
 	var subscriber *pathRefreshSubscriber
 	if remote.IA != localUDPAddr.IA {
-		subscriber, err = openPathRefreshSubscriber(ctx, localUDPAddr, remote, o.policy, o.selector)
+		subscriber, err = openPathRefreshSubscriber(ctx, localUDPAddr, remote, o.policy, o.selector, o.expiryMargin)
 		if err != nil {
 			return nil, err
 		}
 	}
-	return &dialedConn{
+	c := &dialedConn{
 		baseUDPConn: baseUDPConn{
-			raw: conn,
+			raw:       conn,
+			capture:   o.capture,
+			emulator:  o.emulator,
+			connStats: connStats,
 		},
 		local:      localUDPAddr,
 		remote:     remote,
 		subscriber: subscriber,
 		selector:   o.selector,
-	}, nil
+		redundancy: redundancy,
+	}
+	c.intercept = c.interceptPacket
+	return c, nil
 }
 
 type ConnOptions func(*connOptions)
@@ -131,16 +165,65 @@ func WithPolicy(policy Policy) ConnOptions {
 	}
 }
 
+// WithCapture enables capturing all packets sent and received on the
+// connection. The packets are written to w in the pcapng format.
+// This overrides the capture file set with the SCION_PAN_CAPTURE environment
+// variable.
+func WithCapture(w io.Writer) ConnOptions {
+	return func(o *connOptions) {
+		if w == nil {
+			panic("nil capture writer not allowed")
+		}
+		o.capture = newPacketCapture(w)
+	}
+}
+
+// WithEmulator attaches a network Emulator, impairing the packets sent on the
+// connection. This is intended for testing.
+func WithEmulator(emulator *Emulator) ConnOptions {
+	return func(o *connOptions) {
+		o.emulator = emulator
+	}
+}
+
+// WithRedundancy enables redundant transmission: each packet written is sent
+// over multiple disjoint paths at once and duplicates are removed when
+// reading. This replaces the path selector with a RedundantSelector.
+// The remote must use a ListenConn with WithListenRedundancy.
+func WithRedundancy(config RedundancyConfig) ConnOptions {
+	return func(o *connOptions) {
+		o.redundancy = &config
+	}
+}
+
+// WithExpiryMargin sets the time before the expiry of a path at which the
+// connection stops using the path, if other paths are available. Defaults to
+// 30 seconds.
+func WithExpiryMargin(margin time.Duration) ConnOptions {
+	return func(o *connOptions) {
+		if margin < 0 {
+			panic("negative expiry margin not allowed")
+		}
+		o.expiryMargin = margin
+	}
+}
+
 type connOptions struct {
-	scmpHandler snet.SCMPHandler
-	selector    Selector
-	policy      Policy
+	scmpHandler  snet.SCMPHandler
+	selector     Selector
+	policy       Policy
+	capture      *packetCapture
+	emulator     *Emulator
+	redundancy   *RedundancyConfig
+	expiryMargin time.Duration
 }
 
 func applyConnOpts(opts []ConnOptions) connOptions {
 	o := connOptions{
-		scmpHandler: DefaultSCMPHandler{},
-		selector:    NewDefaultSelector(),
+		scmpHandler:  DefaultSCMPHandler{},
+		selector:     NewDefaultSelector(),
+		capture:      envPacketCapture(),
+		expiryMargin: defaultPathExpiryMargin,
 	}
 	for _, opt := range opts {
 		if opt != nil {
@@ -157,6 +240,7 @@ type dialedConn struct {
 	remote     UDPAddr
 	subscriber *pathRefreshSubscriber
 	selector   Selector
+	redundancy *dialRedundancy
 }
 
 func (c *dialedConn) SetPolicy(policy Policy) {
@@ -177,6 +261,18 @@ func (c *dialedConn) GetPathWithCtx(ctx context.Context) *Path {
 	return c.selector.Path(ctx)
 }
 
+// candidatePaths returns all known paths to the remote, including those not
+// allowed by the current policy. The selector may use any of these after a
+// refresh or a change of policy.
+func (c *dialedConn) candidatePaths() []*Path {
+	if c.subscriber == nil {
+		return nil
+	}
+	c.subscriber.mutex.Lock()
+	defer c.subscriber.mutex.Unlock()
+	return append([]*Path(nil), c.subscriber.paths...)
+}
+
 func (c *dialedConn) RemoteAddr() net.Addr {
 	return c.remote
 }
@@ -186,18 +282,141 @@ func (c *dialedConn) Write(b []byte) (int, error) {
 }
 
 func (c *dialedConn) WriteWithCtx(ctx context.Context, b []byte) (int, error) {
-	var path *Path
-	if c.local.IA != c.remote.IA {
-		path = c.selector.Path(ctx)
-		if path == nil {
-			return 0, errNoPathTo(c.remote.IA)
-		}
+	if c.redundancy != nil {
+		return c.writeRedundant(b)
+	}
+	path, err := c.selectPath(ctx)
+	if err != nil {
+		return 0, err
 	}
-	return c.baseUDPConn.writeMsg(c.local, c.remote, path, b)
+	return c.baseUDPConn.writeMsg(c.local, c.remote, path, b, selectedBy(c.capture, c.selector, path))
 }
 
 func (c *dialedConn) WriteVia(path *Path, b []byte) (int, error) {
-	return c.baseUDPConn.writeMsg(c.local, c.remote, path, b)
+	if c.redundancy != nil {
+		if _, err := c.baseUDPConn.writeMsg(c.local, c.remote, path, c.redundancy.sender.wrap(b), decidedBy("WriteVia")); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	return c.baseUDPConn.writeMsg(c.local, c.remote, path, b, decidedBy("WriteVia"))
+}
+
+// writeRedundant sends b on the paths chosen by the RedundantSelector.
+// Succeeds if at least one copy was sent.
+func (c *dialedConn) writeRedundant(b []byte) (int, error) {
+	if c.local.IA == c.remote.IA {
+		if _, err := c.baseUDPConn.writeMsg(c.local, c.remote, nil, c.redundancy.sender.wrap(b), decidedBy("redundant")); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	generation, copies := c.redundancy.selector.copies()
+	if len(copies) == 0 {
+		return 0, errNoPathTo(c.remote.IA)
+	}
+	now := time.Now()
+	valid := copies[:0]
+	for _, cp := range copies {
+		if !cp.path.expiresBefore(now) {
+			valid = append(valid, cp)
+		}
+	}
+	if len(valid) == 0 {
+		return 0, errPathExpiredTo(c.remote.IA)
+	}
+	copies = valid
+	if c.connStats != nil {
+		c.connStats.selected(copies[0].path)
+	}
+	h := c.redundancy.sender.next(generation)
+	for _, cp := range copies {
+		h.slots |= 1 << cp.slot
+	}
+	pkt := make([]byte, redundancyHeaderLen+len(b))
+	copy(pkt[redundancyHeaderLen:], b)
+	var firstErr error
+	sent := 0
+	for _, cp := range copies {
+		h.slot = cp.slot
+		h.appendTo(pkt[:0])
+		decision := pathDecision{copy: sent + 1, copies: len(copies)}
+		if _, err := c.baseUDPConn.writeMsg(c.local, c.remote, cp.path, pkt, decision); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		sent++
+	}
+	if sent == 0 {
+		return 0, firstErr
+	}
+	return len(b), nil
+}
+
+func (c *dialedConn) WriteBatch(msgs []Message) (int, error) {
+	if c.redundancy != nil {
+		// each message is sent on multiple paths; write individually
+		for i := range msgs {
+			if _, err := c.writeRedundant(msgs[i].Buffer); err != nil {
+				return i, err
+			}
+		}
+		return len(msgs), nil
+	}
+	return c.baseUDPConn.writeBatch(c.local, msgs, func(*Message) (UDPAddr, *Path, pathDecision, error) {
+		path, err := c.selectPath(context.TODO())
+		if err != nil {
+			return UDPAddr{}, nil, pathDecision{}, err
+		}
+		return c.remote, path, selectedBy(c.capture, c.selector, path), nil
+	})
+}
+
+// selectPath returns the path chosen by the selector for the next packet, or
+// nil if the remote is in the local AS. Fails if the selector has no path, or
+// only an expired path.
+func (c *dialedConn) selectPath(ctx context.Context) (*Path, error) {
+	if c.local.IA == c.remote.IA {
+		return nil, nil
+	}
+	path := c.selector.Path(ctx)
+	if path == nil {
+		return nil, errNoPathTo(c.remote.IA)
+	}
+	if path.expiresBefore(time.Now()) {
+		return nil, errPathExpiredTo(c.remote.IA)
+	}
+	if c.connStats != nil {
+		c.connStats.selected(path)
+	}
+	return path, nil
+}
+
+func (c *dialedConn) ReadBatch(msgs []Message) (int, error) {
+	fwPaths := make([]ForwardingPath, len(msgs))
+	for {
+		n, err := c.baseUDPConn.readBatch(msgs, fwPaths)
+		if err != nil {
+			return 0, err
+		}
+		// connected! Ignore spurious packets from wrong source
+		k := 0
+		for i := 0; i < n; i++ {
+			if msgs[i].Addr != c.remote {
+				continue
+			}
+			if k != i {
+				msgs[k].Buffer, msgs[i].Buffer = msgs[i].Buffer, msgs[k].Buffer
+				msgs[k].N, msgs[k].Addr = msgs[i].N, msgs[i].Addr
+			}
+			k++
+		}
+		if k > 0 {
+			return k, nil
+		}
+	}
 }
 
 func (c *dialedConn) Read(b []byte) (int, error) {
@@ -230,6 +449,41 @@ func (c *dialedConn) ReadVia(b []byte) (int, *Path, error) {
 	}
 }
 
+// interceptPacket handles the control messages for source address validation
+// and redundant transmission, and removes duplicates and the redundancy
+// header if enabled.
+func (c *dialedConn) interceptPacket(remote UDPAddr, fw ForwardingPath, payload []byte) ([]byte, bool) {
+	if c.answerValidation(remote, fw, payload) {
+		return nil, false
+	}
+	if c.redundancy != nil && remote == c.remote {
+		return c.redundancy.receive(payload)
+	}
+	return payload, true
+}
+
+// answerValidation answers the source address validation challenges of the
+// remote, see WithSourceValidation. The response is sent on the path chosen by
+// the selector, regardless of the path on which the challenge was received.
+func (c *dialedConn) answerValidation(remote UDPAddr, _ ForwardingPath, payload []byte) bool {
+	if remote != c.remote {
+		return false
+	}
+	typ, cookie, ok := parseValidationMessage(payload)
+	if !ok || typ != validationChallenge {
+		return false
+	}
+	var path *Path
+	if c.local.IA != c.remote.IA {
+		if path = c.selector.Path(context.TODO()); path == nil {
+			return true
+		}
+	}
+	// not using Write, the response is never sent redundantly
+	_, _ = c.baseUDPConn.writeMsg(c.local, c.remote, path, validationResponseFor(cookie), decidedBy("source address validation"))
+	return true
+}
+
 func (c *dialedConn) Close() error {
 	if c.subscriber != nil {
 		_ = c.subscriber.Close()
@@ -243,47 +497,144 @@ func (c *dialedConn) Close() error {
 // pathRefreshSubscriber is the glue between a connection and the global path
 // pool. It gets the paths to dst and sets the filtered path set on the
 // target Selector.
+// Paths expiring within the expiry margin are removed from the path set, if
+// other paths are available. For this, the target is refreshed whenever a
+// path in the set reaches its expiry margin, without waiting for new paths
+// from the pool.
 type pathRefreshSubscriber struct {
-	remoteIA IA
-	policy   Policy
-	target   Selector
+	localIP      netip.Addr
+	remoteIA     IA
+	expiryMargin time.Duration
+
+	mutex       sync.Mutex
+	policy      Policy
+	target      Selector
+	paths       []*Path
+	expiryTimer *time.Timer
+	closed      bool
 }
 
 func openPathRefreshSubscriber(ctx context.Context, local, remote UDPAddr, policy Policy,
-	target Selector) (*pathRefreshSubscriber, error) {
+	target Selector, expiryMargin time.Duration) (*pathRefreshSubscriber, error) {
 
 	s := &pathRefreshSubscriber{
-		remoteIA: remote.IA,
-		policy:   policy,
-		target:   target,
+		localIP:      local.IP,
+		remoteIA:     remote.IA,
+		expiryMargin: expiryMargin,
+		policy:       policy,
+		target:       target,
 	}
 	paths, err := pool.subscribe(ctx, remote.IA, s)
 	if err != nil {
 		return nil, err
 	}
-	s.target.Initialize(local, remote, filtered(s.policy, paths))
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.paths = paths
+	s.target.Initialize(local, remote, s.usablePaths())
 	return s, nil
 }
 
 func (s *pathRefreshSubscriber) Close() error {
 	pool.unsubscribe(s.remoteIA, s)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	if s.expiryTimer != nil {
+		s.expiryTimer.Stop()
+	}
 	return nil
 }
 
 func (s *pathRefreshSubscriber) setPolicy(policy Policy) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	s.policy = policy
-	paths := pool.cachedPaths(s.remoteIA)
-	s.target.Refresh(filtered(s.policy, paths))
+	s.paths = pool.cachedPaths(s.remoteIA)
+	s.target.Refresh(s.usablePaths())
 }
 
 func (s *pathRefreshSubscriber) refresh(dst IA, paths []*Path) {
-	s.target.Refresh(filtered(s.policy, paths))
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.paths = paths
+	s.target.Refresh(s.usablePaths())
 }
 
 func (s *pathRefreshSubscriber) PathDown(pf PathFingerprint, pi PathInterface) {
 	s.target.PathDown(pf, pi)
 }
 
+// refreshExpiring is invoked when a path reaches its expiry margin, or
+// expires.
+func (s *pathRefreshSubscriber) refreshExpiring() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	s.target.Refresh(s.usablePaths())
+}
+
+// usablePaths returns the paths reachable from the local IP, filtered by the
+// policy, without the paths expiring within the expiry margin. If there are no such paths, the paths
+// that have not expired yet are returned, or if all paths have expired, all
+// paths. Schedules the next refresh for expiring paths.
+// Assumes that the mutex is held.
+func (s *pathRefreshSubscriber) usablePaths() []*Path {
+	now := time.Now()
+	paths := filtered(s.policy, reachablePaths(s.localIP, s.paths))
+	usable, next := pathsExpiringAfter(paths, now, s.expiryMargin)
+	if len(usable) == 0 {
+		usable, next = pathsExpiringAfter(paths, now, 0)
+	}
+	if len(usable) == 0 {
+		usable = paths
+	}
+	if s.expiryTimer != nil {
+		s.expiryTimer.Stop()
+		s.expiryTimer = nil
+	}
+	if !next.IsZero() {
+		s.expiryTimer = time.AfterFunc(next.Sub(now), s.refreshExpiring)
+	}
+	return usable
+}
+
+// reachablePaths returns the paths with a first hop border router that can be
+// reached from the local IP, i.e. that has an underlay address of the same
+// address family. The border routers of an AS can be a mix of IPv4 and IPv6
+// hosts, but the socket is bound to a single local IP.
+func reachablePaths(local netip.Addr, paths []*Path) []*Path {
+	reachable := make([]*Path, 0, len(paths))
+	for _, p := range paths {
+		underlay := p.ForwardingPath.underlay.Addr()
+		if local.IsValid() && underlay.IsValid() && underlay.Unmap().Is4() != local.Unmap().Is4() {
+			continue
+		}
+		reachable = append(reachable, p)
+	}
+	return reachable
+}
+
+// pathsExpiringAfter returns the paths valid for at least margin after now,
+// and the earliest time at which one of these reaches this margin.
+func pathsExpiringAfter(paths []*Path, now time.Time, margin time.Duration) ([]*Path, time.Time) {
+	deadline := now.Add(margin)
+	var next time.Time
+	usable := make([]*Path, 0, len(paths))
+	for _, p := range paths {
+		if !p.Expiry.IsZero() && !p.Expiry.After(deadline) {
+			continue
+		}
+		usable = append(usable, p)
+		if !p.Expiry.IsZero() && (next.IsZero() || p.Expiry.Add(-margin).Before(next)) {
+			next = p.Expiry.Add(-margin)
+		}
+	}
+	return usable, next
+}
+
 func filtered(policy Policy, paths []*Path) []*Path {
 	if policy != nil {
 		return policy.Filter(paths)
@@ -0,0 +1,106 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathsExpiringAfter(t *testing.T) {
+	now := time.Now()
+	a := &Path{Fingerprint: "a", Expiry: now.Add(time.Minute)}
+	b := &Path{Fingerprint: "b", Expiry: now.Add(time.Hour)}
+	c := &Path{Fingerprint: "c"}
+	expired := &Path{Fingerprint: "expired", Expiry: now.Add(-time.Second)}
+
+	usable, next := pathsExpiringAfter([]*Path{a, b, c, expired}, now, 30*time.Second)
+	assert.Equal(t, []*Path{a, b, c}, usable)
+	assert.Equal(t, a.Expiry.Add(-30*time.Second), next)
+
+	usable, next = pathsExpiringAfter([]*Path{a, b, c, expired}, now, 10*time.Minute)
+	assert.Equal(t, []*Path{b, c}, usable)
+	assert.Equal(t, b.Expiry.Add(-10*time.Minute), next)
+
+	usable, next = pathsExpiringAfter([]*Path{c}, now, time.Minute)
+	assert.Equal(t, []*Path{c}, usable)
+	assert.True(t, next.IsZero(), "no expiry, nothing to schedule")
+}
+
+func TestPathRefreshSubscriberExpiry(t *testing.T) {
+	remote := UDPAddr{IA: MustParseIA("1-ff00:0:111")}
+	now := time.Now()
+	expiring := &Path{Fingerprint: "expiring", Destination: remote.IA, Expiry: now.Add(200 * time.Millisecond)}
+	valid := &Path{Fingerprint: "valid", Destination: remote.IA, Expiry: now.Add(time.Hour)}
+
+	selector := NewDefaultSelector()
+	s := &pathRefreshSubscriber{
+		remoteIA:     remote.IA,
+		expiryMargin: 100 * time.Millisecond,
+		target:       selector,
+	}
+	defer s.Close()
+
+	s.refresh(remote.IA, []*Path{expiring, valid})
+	assert.Equal(t, expiring, selector.Path(context.Background()))
+	assert.Eventually(t, func() bool {
+		return selector.Path(context.Background()) == valid
+	}, time.Second, 10*time.Millisecond, "should switch before expiry, without new paths")
+
+	// only expiring paths: keep using them until they expire
+	s.refresh(remote.IA, []*Path{expiring})
+	assert.Equal(t, expiring, selector.Path(context.Background()))
+}
+
+func TestDialedConnExpiredPath(t *testing.T) {
+	local := UDPAddr{IA: MustParseIA("1-ff00:0:110")}
+	remote := UDPAddr{IA: MustParseIA("1-ff00:0:111")}
+	expired := &Path{
+		Source:      local.IA,
+		Destination: remote.IA,
+		Fingerprint: "expired",
+		Expiry:      time.Now().Add(-time.Second),
+	}
+	selector := NewDefaultSelector()
+	selector.Initialize(local, remote, []*Path{expired})
+	c := &dialedConn{
+		local:    local,
+		remote:   remote,
+		selector: selector,
+	}
+	_, err := c.Write([]byte("hello"))
+	assert.True(t, errors.Is(err, ErrPathExpired), "expected ErrPathExpired, got %v", err)
+	assert.True(t, errors.Is(err, ErrNoPath))
+	_, err = c.WriteBatch([]Message{{Buffer: []byte("hello")}})
+	assert.True(t, errors.Is(err, ErrPathExpired), "expected ErrPathExpired, got %v", err)
+}
+
+func TestReachablePaths(t *testing.T) {
+	src, dst := MustParseIA("1-ff00:0:110"), MustParseIA("1-ff00:0:111")
+	v4 := testLoopbackPath(t, src, dst, netip.MustParseAddrPort("10.0.0.1:31002"))
+	v6 := testLoopbackPath(t, src, dst, netip.MustParseAddrPort("[2001:db8::1]:31002"))
+	mapped := testLoopbackPath(t, src, dst, netip.MustParseAddrPort("[::ffff:10.0.0.2]:31002"))
+	unknown := testLoopbackPath(t, src, dst, netip.AddrPort{})
+	paths := []*Path{v4, v6, mapped, unknown}
+
+	assert.Equal(t, []*Path{v4, mapped, unknown}, reachablePaths(netip.MustParseAddr("10.0.0.3"), paths))
+	assert.Equal(t, []*Path{v6, unknown}, reachablePaths(netip.MustParseAddr("2001:db8::3"), paths))
+	assert.Equal(t, paths, reachablePaths(netip.Addr{}, paths))
+}
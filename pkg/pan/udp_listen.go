@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/netip"
 	"os"
@@ -61,6 +62,18 @@ type ListenConn interface {
 	// WriteToVia writes a message to the remote address via the given path.
 	// This bypasses selector used for WriteTo.
 	WriteToVia(b []byte, dst UDPAddr, path *Path) (int, error)
+	// WriteBatch writes multiple messages, each to its Addr, using paths from
+	// the reply path selector, or the message's Path if set. Where supported,
+	// this uses a single system call for the batch. Returns the number of
+	// messages written.
+	WriteBatch(msgs []Message) (int, error)
+	// ReadBatch reads at least one and at most len(msgs) messages. Where
+	// supported, this uses a single system call for the batch. Returns the
+	// number of messages read.
+	ReadBatch(msgs []Message) (int, error)
+	// Stats returns a snapshot of the statistics of the connection, with the
+	// counters for each path used.
+	Stats() ConnStats
 }
 
 func ListenUDP(
@@ -75,15 +88,16 @@ func ListenUDP(
 		return nil, err
 	}
 
-	local, err = defaultLocalAddr(local)
+	local, err = defaultLocalAddr(local, netip.Addr{})
 	if err != nil {
 		return nil, err
 	}
 
 	stats.subscribe(o.selector)
+	connStats := newConnStats()
 	sn := snet.SCIONNetwork{
 		Topology:    host.topology,
-		SCMPHandler: o.scmpHandler,
+		SCMPHandler: statsSCMPHandler{handler: o.scmpHandler, stats: connStats},
 	}
 	conn, err := sn.OpenRaw(ctx, net.UDPAddrFromAddrPort(local))
 	if err != nil {
@@ -101,13 +115,25 @@ func ListenUDP(
 		fmt.Printf("Listening addr=%s\n", localUDPAddr)
 	}
 
-	return &listenConn{
+	c := &listenConn{
 		baseUDPConn: baseUDPConn{
-			raw: conn,
+			raw:       conn,
+			capture:   o.capture,
+			emulator:  o.emulator,
+			connStats: connStats,
 		},
 		local:    localUDPAddr,
 		selector: o.selector,
-	}, nil
+		filter:   o.filter,
+	}
+	if o.sourceValidation {
+		c.validator = newSourceValidator()
+	}
+	if o.redundancy {
+		c.redundancy = newListenRedundancy()
+	}
+	c.intercept = c.interceptPacket
+	return c, nil
 }
 
 type ListenConnOptions func(*listenConnOptions)
@@ -132,15 +158,79 @@ func WithReplySelector(selector ReplySelector) ListenConnOptions {
 	}
 }
 
+// WithListenCapture enables capturing all packets sent and received on the
+// ListenConn. The packets are written to w in the pcapng format.
+// This overrides the capture file set with the SCION_PAN_CAPTURE environment
+// variable.
+func WithListenCapture(w io.Writer) ListenConnOptions {
+	return func(o *listenConnOptions) {
+		if w == nil {
+			panic("nil capture writer not allowed")
+		}
+		o.capture = newPacketCapture(w)
+	}
+}
+
+// WithListenEmulator attaches a network Emulator, impairing the packets sent on the
+// connection. This is intended for testing.
+func WithListenEmulator(emulator *Emulator) ListenConnOptions {
+	return func(o *listenConnOptions) {
+		o.emulator = emulator
+	}
+}
+
+// WithInboundFilter sets a filter for the packets received on the ListenConn.
+// Packets rejected by the filter are dropped before their path is recorded in
+// the ReplySelector.
+func WithInboundFilter(filter InboundFilter) ListenConnOptions {
+	return func(o *listenConnOptions) {
+		if filter == nil {
+			panic("nil inbound filter not allowed")
+		}
+		o.filter = filter
+	}
+}
+
+// WithSourceValidation enables the source address validation for the
+// ListenConn. The reply path for a remote is only recorded in the
+// ReplySelector once the remote has proven, with a return routability check,
+// that it receives packets sent on the reverse of this path.
+// Packets from remotes without any validated path are dropped; applications
+// need to retransmit, as they would for lost packets. Remotes must use a
+// Conn created with DialUDP (or DialQUIC), which answers the check
+// transparently.
+func WithSourceValidation() ListenConnOptions {
+	return func(o *listenConnOptions) {
+		o.sourceValidation = true
+	}
+}
+
+// WithListenRedundancy enables redundant transmission for remotes using a Conn
+// with WithRedundancy. Duplicates of the packets received from such remotes
+// are removed and the loss on each path is reported back to the remote.
+// Replies to these remotes carry the redundancy header, but are sent on a
+// single path. Packets from other remotes are not affected.
+func WithListenRedundancy() ListenConnOptions {
+	return func(o *listenConnOptions) {
+		o.redundancy = true
+	}
+}
+
 type listenConnOptions struct {
-	scmpHandler snet.SCMPHandler
-	selector    ReplySelector
+	scmpHandler      snet.SCMPHandler
+	selector         ReplySelector
+	capture          *packetCapture
+	emulator         *Emulator
+	filter           InboundFilter
+	sourceValidation bool
+	redundancy       bool
 }
 
 func apply(opts []ListenConnOptions) listenConnOptions {
 	o := listenConnOptions{
 		scmpHandler: DefaultSCMPHandler{},
 		selector:    NewDefaultReplySelector(),
+		capture:     envPacketCapture(),
 	}
 	for _, opt := range opts {
 		if opt != nil {
@@ -153,8 +243,11 @@ func apply(opts []ListenConnOptions) listenConnOptions {
 type listenConn struct {
 	baseUDPConn
 
-	local    UDPAddr
-	selector ReplySelector
+	local      UDPAddr
+	selector   ReplySelector
+	filter     InboundFilter
+	validator  *sourceValidator
+	redundancy *listenRedundancy
 }
 
 func (c *listenConn) LocalAddr() net.Addr {
@@ -167,13 +260,139 @@ func (c *listenConn) ReadFrom(b []byte) (int, net.Addr, error) {
 }
 
 func (c *listenConn) ReadFromVia(b []byte) (int, UDPAddr, *Path, error) {
-	n, remote, fwPath, err := c.baseUDPConn.readMsg(b)
-	if err != nil {
-		return n, UDPAddr{}, nil, err
+	for {
+		n, remote, fwPath, err := c.baseUDPConn.readMsg(b)
+		if err != nil {
+			return n, UDPAddr{}, nil, err
+		}
+		path, err := reversePathFromForwardingPath(remote.IA, c.local.IA, fwPath)
+		if err != nil {
+			continue // just drop the packet if there is something wrong with the path
+		}
+		if !c.receive(remote, path) {
+			continue
+		}
+		return n, remote, path, nil
+	}
+}
+
+func (c *listenConn) ReadBatch(msgs []Message) (int, error) {
+	fwPaths := make([]ForwardingPath, len(msgs))
+	for {
+		n, err := c.baseUDPConn.readBatch(msgs, fwPaths)
+		if err != nil {
+			return 0, err
+		}
+		k := 0
+		for i := 0; i < n; i++ {
+			path, err := reversePathFromForwardingPath(msgs[i].Addr.IA, c.local.IA, fwPaths[i])
+			if err != nil || !c.receive(msgs[i].Addr, path) {
+				continue // drop packets with a bad path, as in ReadFromVia
+			}
+			if k != i {
+				msgs[k].Buffer, msgs[i].Buffer = msgs[i].Buffer, msgs[k].Buffer
+				msgs[k].N, msgs[k].Addr = msgs[i].N, msgs[i].Addr
+			}
+			msgs[k].Path = path
+			k++
+		}
+		if k > 0 {
+			return k, nil
+		}
+	}
+}
+
+func (c *listenConn) WriteBatch(msgs []Message) (int, error) {
+	if c.redundancy != nil {
+		// the redundancy header is added per remote; write individually
+		for i := range msgs {
+			var err error
+			if msgs[i].Path != nil {
+				_, err = c.WriteToVia(msgs[i].Buffer, msgs[i].Addr, msgs[i].Path)
+			} else {
+				_, err = c.WriteTo(msgs[i].Buffer, msgs[i].Addr)
+			}
+			if err != nil {
+				return i, err
+			}
+		}
+		return len(msgs), nil
+	}
+	return c.baseUDPConn.writeBatch(c.local, msgs, func(m *Message) (UDPAddr, *Path, pathDecision, error) {
+		if m.Path != nil || c.local.IA == m.Addr.IA {
+			return m.Addr, m.Path, decidedBy("WriteBatch with path"), nil
+		}
+		path, err := c.selectPath(context.TODO(), m.Addr)
+		if err != nil {
+			return UDPAddr{}, nil, pathDecision{}, err
+		}
+		return m.Addr, path, selectedBy(c.capture, c.selector, path), nil
+	})
+}
+
+// receive applies the inbound filter and the source address validation to a
+// packet received from remote on path, and records the path in the
+// ReplySelector if accepted.
+// Returns false if the packet is to be dropped.
+func (c *listenConn) receive(remote UDPAddr, path *Path) bool {
+	if c.filter != nil && !c.filter.Accept(remote, path) {
+		return false
+	}
+	if c.validator != nil && path != nil {
+		pathOK, remoteOK := c.validator.check(remote, path.Fingerprint)
+		if !pathOK {
+			challenge := c.validator.challenge(remote, path.Fingerprint)
+			_, _ = c.baseUDPConn.writeMsg(c.local, remote, path, challenge, decidedBy("source address validation"))
+			// Pass the packet on if there is a validated path to this remote, but
+			// do not record this path.
+			return remoteOK
+		}
 	}
-	path, err := reversePathFromForwardingPath(remote.IA, c.local.IA, fwPath)
 	c.selector.Record(remote, path)
-	return n, remote, path, err
+	return true
+}
+
+// interceptPacket handles the control messages for source address validation
+// and redundant transmission, and removes duplicates and the redundancy
+// header if enabled.
+func (c *listenConn) interceptPacket(remote UDPAddr, fw ForwardingPath, payload []byte) ([]byte, bool) {
+	if c.validator != nil && c.interceptValidation(remote, fw, payload) {
+		return nil, false
+	}
+	if c.redundancy == nil {
+		return payload, true
+	}
+	payload, ok, report := c.redundancy.receive(remote, payload)
+	if report != nil {
+		path, err := reversePathFromForwardingPath(remote.IA, c.local.IA, fw)
+		if err == nil {
+			_, _ = c.baseUDPConn.writeMsg(c.local, remote, path, report, decidedBy("redundancy report"))
+		}
+	}
+	return payload, ok
+}
+
+// interceptValidation consumes the source address validation messages. For
+// valid responses, the path is recorded in the ReplySelector.
+func (c *listenConn) interceptValidation(remote UDPAddr, fw ForwardingPath, payload []byte) bool {
+	typ, cookie, ok := parseValidationMessage(payload)
+	if !ok {
+		return false
+	}
+	if typ != validationResponse {
+		return true
+	}
+	path, err := reversePathFromForwardingPath(remote.IA, c.local.IA, fw)
+	if err != nil || path == nil {
+		return true
+	}
+	if c.filter != nil && !c.filter.Accept(remote, path) {
+		return true
+	}
+	if c.validator.verify(remote, path.Fingerprint, cookie) {
+		c.selector.Record(remote, path)
+	}
+	return true
 }
 
 func (c *listenConn) WriteTo(b []byte, dst net.Addr) (int, error) {
@@ -185,18 +404,54 @@ func (c *listenConn) WriteToWithCtx(ctx context.Context, b []byte, dst net.Addr)
 	if !ok {
 		return 0, errBadDstAddress
 	}
-	var path *Path
-	if c.local.IA != sdst.IA {
-		path = c.selector.Path(ctx, sdst)
-		if path == nil {
-			return 0, errNoPathTo(sdst.IA)
-		}
+	path, err := c.selectPath(ctx, sdst)
+	if err != nil {
+		return 0, err
 	}
-	return c.WriteToVia(b, sdst, path)
+	return c.writeMsg(sdst, path, b, selectedBy(c.capture, c.selector, path))
 }
 
 func (c *listenConn) WriteToVia(b []byte, dst UDPAddr, path *Path) (int, error) {
-	return c.baseUDPConn.writeMsg(c.local, dst, path, b)
+	return c.writeMsg(dst, path, b, decidedBy("WriteToVia"))
+}
+
+// ReplyPath returns the path that the reply path selector currently chooses
+// for messages to the remote address, or nil if the remote is in the local AS
+// or no valid path is known.
+// This is not part of the ListenConn interface; check for it with a type
+// assertion, like for GetPath of a Conn.
+func (c *listenConn) ReplyPath(remote UDPAddr) *Path {
+	path, _ := c.selectPath(context.Background(), remote)
+	return path
+}
+
+// selectPath returns the reply path chosen by the selector for the next packet
+// to dst, or nil if dst is in the local AS. Fails if the selector has no path,
+// or only an expired path.
+func (c *listenConn) selectPath(ctx context.Context, dst UDPAddr) (*Path, error) {
+	if c.local.IA == dst.IA {
+		return nil, nil
+	}
+	path := c.selector.Path(ctx, dst)
+	if path == nil {
+		return nil, errNoPathTo(dst.IA)
+	}
+	if path.expiresBefore(time.Now()) {
+		return nil, errPathExpiredTo(dst.IA)
+	}
+	return path, nil
+}
+
+// writeMsg sends b to dst via path, adding the redundancy header if dst uses
+// redundant transmission.
+func (c *listenConn) writeMsg(dst UDPAddr, path *Path, b []byte, decision pathDecision) (int, error) {
+	if c.redundancy == nil {
+		return c.baseUDPConn.writeMsg(c.local, dst, path, b, decision)
+	}
+	if _, err := c.baseUDPConn.writeMsg(c.local, dst, path, c.redundancy.wrap(dst, b), decision); err != nil {
+		return 0, err
+	}
+	return len(b), nil
 }
 
 func (c *listenConn) Close() error {
@@ -227,6 +482,13 @@ func (s *DefaultReplySelector) Path(_ context.Context, remote UDPAddr) *Path {
 	if !ok || len(r.paths) == 0 {
 		return nil
 	}
+	// the most recently used path that has not expired
+	now := time.Now()
+	for _, p := range r.paths {
+		if !p.expiresBefore(now) {
+			return p
+		}
+	}
 	return r.paths[0]
 }
 
@@ -248,6 +510,10 @@ func (s *DefaultReplySelector) PathDown(PathFingerprint, PathInterface) {
 	// TODO failover.
 }
 
+func (s *DefaultReplySelector) explainPath(path *Path) string {
+	return "most recently used reply path"
+}
+
 func (s *DefaultReplySelector) Close() error {
 	return nil
 }
@@ -15,11 +15,91 @@
 package pan
 
 import (
+	"net/netip"
 	"testing"
+	"time"
 
+	snetpath "github.com/scionproto/scion/pkg/snet/path"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+type recordingFilter struct {
+	accepted []*Path
+}
+
+func (f *recordingFilter) Accept(remote UDPAddr, path *Path) bool {
+	f.accepted = append(f.accepted, path)
+	return true
+}
+
+// TestListenConnDropsUndecodablePath checks that packets with a path that
+// cannot be reversed are dropped, before the inbound filter, instead of being
+// returned without a path or with an error.
+func TestListenConnDropsUndecodablePath(t *testing.T) {
+	p := newLoopbackPair(t)
+	// only the path meta header, without info and hop fields; this can be sent,
+	// but not reversed
+	badPath := &Path{
+		Source:      p.addrA.IA,
+		Destination: p.addrB.IA,
+		ForwardingPath: ForwardingPath{
+			dataplanePath: snetpath.SCION{Raw: make([]byte, 4)},
+			underlay:      netip.AddrPortFrom(p.addrB.IP, p.addrB.Port),
+		},
+	}
+	send := func(path *Path, payload string) {
+		t.Helper()
+		_, err := p.a.writeMsg(p.addrA, p.addrB, path, []byte(payload), decidedBy("test"))
+		require.NoError(t, err)
+	}
+	newServer := func() (*listenConn, *recordingFilter) {
+		filter := &recordingFilter{}
+		server := &listenConn{
+			baseUDPConn: baseUDPConn{raw: p.b.raw},
+			local:       p.addrB,
+			selector:    NewDefaultReplySelector(),
+			filter:      filter,
+		}
+		require.NoError(t, server.SetReadDeadline(time.Now().Add(time.Second)))
+		return server, filter
+	}
+
+	t.Run("ReadFromVia", func(t *testing.T) {
+		server, filter := newServer()
+		send(badPath, "bad")
+		send(p.pathAB, "good")
+		buf := make([]byte, 100)
+		n, remote, path, err := server.ReadFromVia(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "good", string(buf[:n]))
+		assert.Equal(t, p.addrA, remote)
+		require.NotNil(t, path)
+		assert.Equal(t, []*Path{path}, filter.accepted)
+	})
+
+	t.Run("ReadBatch", func(t *testing.T) {
+		server, filter := newServer()
+		send(badPath, "bad")
+		send(p.pathAB, "good")
+		msgs := make([]Message, 2)
+		for i := range msgs {
+			msgs[i].Buffer = make([]byte, 100)
+		}
+		var received []string
+		for len(received) == 0 || received[len(received)-1] != "good" {
+			n, err := server.ReadBatch(msgs)
+			require.NoError(t, err)
+			for _, m := range msgs[:n] {
+				require.NotNil(t, m.Path)
+				received = append(received, string(m.Buffer[:m.N]))
+			}
+		}
+		assert.Equal(t, []string{"good"}, received)
+		assert.Len(t, filter.accepted, 1)
+	})
+}
+
 func TestPathsMRU(t *testing.T) {
 	const maxSize = 3
 	cases := []struct {
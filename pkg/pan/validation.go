@@ -0,0 +1,241 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// Source address validation is a return routability check, performed by a
+// ListenConn before it records the reply path for a remote.
+//
+// When a packet from a remote arrives on a path that has not been validated,
+// the listener replies with a challenge on the reverse of this path. The
+// challenge contains a cookie, an HMAC over the remote address and the path
+// fingerprint, keyed with a rotating secret; the listener does not keep any
+// state for unvalidated remotes. The remote echoes the cookie back in a
+// response on the path that it uses to send. If the response arrives on the
+// path for which the cookie was issued, the remote is validated for this
+// path and the path is recorded in the ReplySelector.
+//
+// A Conn created with DialUDP answers challenges transparently, always on the
+// path chosen by its own selector. This ensures that a spoofed packet from an
+// off-path attacker, claiming the client's address with a forged path, cannot
+// get the forged path validated with the help of the client.
+//
+// The challenge and response messages are marked by validationMagic; they
+// are not passed to the application.
+
+// validationMagic marks the source address validation messages.
+var validationMagic = [8]byte{0xd4, 0x50, 0x41, 0x4e, 0x53, 0x41, 0x56, 0x8e}
+
+const (
+	validationChallenge byte = 1
+	validationResponse  byte = 2
+
+	// validationCookieLen is the length of the cookie, consisting of the
+	// 4 byte epoch and the truncated HMAC.
+	validationCookieLen = 4 + 16
+	validationMsgLen    = len(validationMagic) + 1 + validationCookieLen
+
+	// validationSecretRotation is the interval after which the secret for the
+	// cookies is replaced. Cookies are accepted for up to twice this time.
+	validationSecretRotation = 30 * time.Second
+	// validationLifetime is the time after which a validated path for a remote
+	// expires, if no packets are received from the remote on this path.
+	validationLifetime = 10 * time.Minute
+	// maxValidatedRemotes bounds the number of validated remotes tracked.
+	// Once reached, expired entries are removed; if there are none, no further
+	// remotes are validated.
+	maxValidatedRemotes = 1 << 16
+)
+
+// sourceValidator keeps the secrets for the validation cookies and tracks the
+// validated remotes for a ListenConn.
+type sourceValidator struct {
+	mutex      sync.Mutex
+	epoch      uint32
+	secret     [32]byte
+	prevSecret [32]byte
+	validated  map[UDPAddr]map[PathFingerprint]time.Time
+	lastSweep  time.Time
+	timeNow    func() time.Time
+}
+
+func newSourceValidator() *sourceValidator {
+	return &sourceValidator{
+		validated: make(map[UDPAddr]map[PathFingerprint]time.Time),
+		timeNow:   time.Now,
+	}
+}
+
+// check returns whether the remote is validated for the path with
+// fingerprint pf and whether the remote is validated for any path.
+func (v *sourceValidator) check(remote UDPAddr, pf PathFingerprint) (pathOK, remoteOK bool) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	paths, ok := v.validated[remote]
+	if !ok {
+		return false, false
+	}
+	now := v.timeNow()
+	seen, ok := paths[pf]
+	if ok && now.Sub(seen) < validationLifetime {
+		paths[pf] = now
+		return true, true
+	}
+	for _, seen := range paths {
+		if now.Sub(seen) < validationLifetime {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// challenge returns the challenge message for the remote on the path with
+// fingerprint pf.
+func (v *sourceValidator) challenge(remote UDPAddr, pf PathFingerprint) []byte {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.rotate()
+	msg := make([]byte, 0, validationMsgLen)
+	msg = append(msg, validationMagic[:]...)
+	msg = append(msg, validationChallenge)
+	msg = binary.BigEndian.AppendUint32(msg, v.epoch)
+	msg = append(msg, validationMAC(v.secret[:], v.epoch, remote, pf)...)
+	return msg
+}
+
+// verify checks the cookie in a response from remote, received on the path
+// with fingerprint pf. If the cookie is valid, the remote is marked as
+// validated for this path.
+func (v *sourceValidator) verify(remote UDPAddr, pf PathFingerprint, cookie []byte) bool {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.rotate()
+	epoch := binary.BigEndian.Uint32(cookie)
+	var secret []byte
+	switch epoch {
+	case v.epoch:
+		secret = v.secret[:]
+	case v.epoch - 1:
+		secret = v.prevSecret[:]
+	default:
+		return false
+	}
+	if !hmac.Equal(cookie[4:], validationMAC(secret, epoch, remote, pf)) {
+		return false
+	}
+
+	now := v.timeNow()
+	paths, ok := v.validated[remote]
+	if !ok {
+		if len(v.validated) >= maxValidatedRemotes {
+			v.sweep(now)
+			if len(v.validated) >= maxValidatedRemotes {
+				return false
+			}
+		}
+		paths = make(map[PathFingerprint]time.Time)
+		v.validated[remote] = paths
+	}
+	paths[pf] = now
+	return true
+}
+
+// rotate replaces the secret if the current epoch has passed.
+func (v *sourceValidator) rotate() {
+	epoch := uint32(v.timeNow().Unix() / int64(validationSecretRotation/time.Second))
+	if epoch == v.epoch {
+		return
+	}
+	if epoch == v.epoch+1 {
+		v.prevSecret = v.secret
+	} else {
+		mustRandRead(v.prevSecret[:])
+	}
+	mustRandRead(v.secret[:])
+	v.epoch = epoch
+}
+
+// sweep removes the expired validations. To bound the effort when flooded,
+// this scans the table at most once per validationSecretRotation.
+func (v *sourceValidator) sweep(now time.Time) {
+	if now.Sub(v.lastSweep) < validationSecretRotation {
+		return
+	}
+	v.lastSweep = now
+	for remote, paths := range v.validated {
+		for pf, seen := range paths {
+			if now.Sub(seen) >= validationLifetime {
+				delete(paths, pf)
+			}
+		}
+		if len(paths) == 0 {
+			delete(v.validated, remote)
+		}
+	}
+}
+
+func validationMAC(secret []byte, epoch uint32, remote UDPAddr, pf PathFingerprint) []byte {
+	mac := hmac.New(sha256.New, secret)
+	var b [8 + 16 + 2 + 4]byte
+	binary.BigEndian.PutUint64(b[0:], uint64(remote.IA))
+	ip := remote.IP.As16()
+	copy(b[8:], ip[:])
+	binary.BigEndian.PutUint16(b[24:], remote.Port)
+	binary.BigEndian.PutUint32(b[26:], epoch)
+	mac.Write(b[:])
+	mac.Write([]byte(pf))
+	return mac.Sum(nil)[:validationCookieLen-4]
+}
+
+func mustRandRead(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+}
+
+// parseValidationMessage checks whether b is a source address validation
+// message, and returns its type and cookie.
+func parseValidationMessage(b []byte) (byte, []byte, bool) {
+	if len(b) != validationMsgLen || !bytes.Equal(b[:len(validationMagic)], validationMagic[:]) {
+		return 0, nil, false
+	}
+	typ := b[len(validationMagic)]
+	if typ != validationChallenge && typ != validationResponse {
+		return 0, nil, false
+	}
+	return typ, b[len(validationMagic)+1:], true
+}
+
+// validationResponseFor returns the response message for the cookie of a
+// challenge.
+func validationResponseFor(cookie []byte) []byte {
+	msg := make([]byte, 0, validationMsgLen)
+	msg = append(msg, validationMagic[:]...)
+	msg = append(msg, validationResponse)
+	msg = append(msg, cookie...)
+	return msg
+}
@@ -0,0 +1,134 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pan
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceValidator(t *testing.T) {
+	remote := UDPAddr{IA: MustParseIA("1-ff00:0:111"), IP: netip.MustParseAddr("10.0.0.1"), Port: 1234}
+	other := remote
+	other.Port++
+
+	v := newSourceValidator()
+	now := time.Now()
+	v.timeNow = func() time.Time { return now }
+
+	challenge := func(remote UDPAddr, pf PathFingerprint) []byte {
+		typ, cookie, ok := parseValidationMessage(v.challenge(remote, pf))
+		require.True(t, ok)
+		require.Equal(t, validationChallenge, typ)
+		return cookie
+	}
+
+	pathOK, remoteOK := v.check(remote, "1 2")
+	assert.False(t, pathOK)
+	assert.False(t, remoteOK)
+
+	cookie := challenge(remote, "1 2")
+	assert.False(t, v.verify(remote, "3 4", cookie), "response on other path")
+	assert.False(t, v.verify(other, "1 2", cookie), "response from other remote")
+	corrupted := append([]byte(nil), cookie...)
+	corrupted[len(corrupted)-1] ^= 1
+	assert.False(t, v.verify(remote, "1 2", corrupted))
+
+	assert.True(t, v.verify(remote, "1 2", cookie))
+	pathOK, remoteOK = v.check(remote, "1 2")
+	assert.True(t, pathOK)
+	assert.True(t, remoteOK)
+	pathOK, remoteOK = v.check(remote, "3 4")
+	assert.False(t, pathOK)
+	assert.True(t, remoteOK)
+
+	t.Run("rotation", func(t *testing.T) {
+		cookie := challenge(other, "1 2")
+		now = now.Add(validationSecretRotation)
+		assert.True(t, v.verify(other, "1 2", cookie), "previous secret still valid")
+		cookie = challenge(other, "3 4")
+		now = now.Add(2 * validationSecretRotation)
+		assert.False(t, v.verify(other, "3 4", cookie), "expired")
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		now = now.Add(validationLifetime)
+		pathOK, remoteOK := v.check(remote, "1 2")
+		assert.False(t, pathOK)
+		assert.False(t, remoteOK)
+	})
+}
+
+func TestSourceValidationLoopback(t *testing.T) {
+	p := newLoopbackPair(t)
+
+	selector := NewDefaultSelector()
+	selector.Initialize(p.addrA, p.addrB, []*Path{p.pathAB})
+	client := &dialedConn{
+		baseUDPConn: baseUDPConn{raw: p.a.raw},
+		local:       p.addrA,
+		remote:      p.addrB,
+		selector:    selector,
+	}
+	client.intercept = client.interceptPacket
+
+	replySelector := NewDefaultReplySelector()
+	server := &listenConn{
+		baseUDPConn: baseUDPConn{raw: p.b.raw},
+		local:       p.addrB,
+		selector:    replySelector,
+		validator:   newSourceValidator(),
+	}
+	server.intercept = server.interceptPacket
+
+	received := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 100)
+		n, remote, _, err := server.ReadFromVia(buf)
+		if err != nil || remote != p.addrA {
+			received <- ""
+			return
+		}
+		received <- string(buf[:n])
+	}()
+
+	// The first packet is dropped by the server, which sends a challenge.
+	_, err := client.Write([]byte("first"))
+	require.NoError(t, err)
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+	_, err = client.Read(make([]byte, 100))
+	require.True(t, errors.Is(err, os.ErrDeadlineExceeded), "challenge must not be passed to application")
+
+	require.Eventually(t, func() bool {
+		return replySelector.Path(context.Background(), p.addrA) != nil
+	}, time.Second, 10*time.Millisecond, "path should be recorded after validation")
+	assert.Equal(t, PathFingerprint("2 1"), replySelector.Path(context.Background(), p.addrA).Fingerprint)
+
+	_, err = client.Write([]byte("second"))
+	require.NoError(t, err)
+	select {
+	case msg := <-received:
+		assert.Equal(t, "second", msg)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
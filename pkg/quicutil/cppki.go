@@ -0,0 +1,248 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quicutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+const (
+	// DefaultTRCDir is the directory in which the SCION endhost stack keeps
+	// the TRCs of the local ISD.
+	DefaultTRCDir = "/etc/scion/certs"
+
+	// resolveTimeout limits the resolution of the server name to determine
+	// the expected ISD-AS of the server.
+	resolveTimeout = 5 * time.Second
+)
+
+// TRCVerifier verifies TLS certificates with the SCION control-plane PKI
+// (CP-PKI). A server authenticates with its AS certificate chain (AS
+// certificate and CA certificate, e.g. cp-as.pem and cp-as.key, see
+// LoadASCertificate), which must verify against the root certificates of an
+// active TRC of its ISD. The certified ISD-AS must match the ISD-AS of the
+// server address.
+//
+// The TRCs are trust anchors, loaded from local files; the signatures of the
+// TRCs are not verified, just as for the certificates in a CA bundle.
+type TRCVerifier struct {
+	trcs map[addr.ISD][]*cppki.TRC // sorted by ID
+	now  func() time.Time          // for testing; time.Now if nil
+}
+
+// LoadTRCs returns a TRCVerifier for the TRCs in the *.trc files in the
+// directories, e.g. DefaultTRCDir, or the certs directory of an AS in the gen/
+// directory of a local topology. The files may be PEM or DER encoded.
+func LoadTRCs(dirs ...string) (*TRCVerifier, error) {
+	var trcs []*cppki.TRC
+	for _, dir := range dirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.trc"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			trc, err := loadTRC(file)
+			if err != nil {
+				return nil, err
+			}
+			trcs = append(trcs, trc)
+		}
+	}
+	if len(trcs) == 0 {
+		return nil, fmt.Errorf("no TRCs found in %v", dirs)
+	}
+	return NewTRCVerifier(trcs...)
+}
+
+func loadTRC(file string) (*cppki.TRC, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(raw); block != nil {
+		if block.Type != "TRC" {
+			return nil, fmt.Errorf("unexpected PEM block %q in %s", block.Type, file)
+		}
+		raw = block.Bytes
+	}
+	signed, err := cppki.DecodeSignedTRC(raw)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse TRC in %s: %w", file, err)
+	}
+	return &signed.TRC, nil
+}
+
+// NewTRCVerifier returns a TRCVerifier for the given TRCs.
+func NewTRCVerifier(trcs ...*cppki.TRC) (*TRCVerifier, error) {
+	v := &TRCVerifier{trcs: make(map[addr.ISD][]*cppki.TRC)}
+	for _, trc := range trcs {
+		if err := trc.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid TRC %s: %w", trc.ID, err)
+		}
+		isd := trc.ID.ISD
+		duplicate := slices.ContainsFunc(v.trcs[isd], func(other *cppki.TRC) bool {
+			return other.ID == trc.ID
+		})
+		if !duplicate {
+			v.trcs[isd] = append(v.trcs[isd], trc)
+		}
+	}
+	for _, isdTRCs := range v.trcs {
+		slices.SortFunc(isdTRCs, func(a, b *cppki.TRC) int {
+			if a.ID.Base != b.ID.Base {
+				return int(a.ID.Base) - int(b.ID.Base)
+			}
+			return int(a.ID.Serial) - int(b.ID.Serial)
+		})
+	}
+	return v, nil
+}
+
+// ISDs returns the ISDs for which TRCs are available.
+func (v *TRCVerifier) ISDs() []addr.ISD {
+	isds := make([]addr.ISD, 0, len(v.trcs))
+	for isd := range v.trcs {
+		isds = append(isds, isd)
+	}
+	slices.Sort(isds)
+	return isds
+}
+
+// activeTRCs returns the TRCs of the ISD against which certificates are
+// verified: the latest TRC and, during its grace period, its predecessor.
+func (v *TRCVerifier) activeTRCs(isd addr.ISD, now time.Time) ([]*cppki.TRC, error) {
+	isdTRCs := v.trcs[isd]
+	if len(isdTRCs) == 0 {
+		return nil, fmt.Errorf("no TRC for ISD %d", isd)
+	}
+	latest := isdTRCs[len(isdTRCs)-1]
+	if !latest.Validity.Contains(now) {
+		return nil, fmt.Errorf("TRC %s not valid at %s, validity %s", latest.ID, now, latest.Validity)
+	}
+	active := []*cppki.TRC{latest}
+	if len(isdTRCs) > 1 && latest.InGracePeriod(now) {
+		predecessor := isdTRCs[len(isdTRCs)-2]
+		if predecessor.ID.Base == latest.ID.Base && predecessor.ID.Serial == latest.ID.Serial-1 {
+			active = append(active, predecessor)
+		}
+	}
+	return active, nil
+}
+
+// VerifyChain verifies that the certificate chain is a valid AS certificate
+// chain for the ISD-AS ia, against the active TRCs of its ISD.
+func (v *TRCVerifier) VerifyChain(chain []*x509.Certificate, ia pan.IA) error {
+	if len(chain) == 0 {
+		return errors.New("no certificate")
+	}
+	certIA, err := cppki.ExtractIA(chain[0].Subject)
+	if err != nil {
+		return fmt.Errorf("no ISD-AS in certificate: %w", err)
+	}
+	if certIA != addr.IA(ia) {
+		return fmt.Errorf("certificate is for ISD-AS %s, expected %s", certIA, addr.IA(ia))
+	}
+	now := time.Now()
+	if v.now != nil {
+		now = v.now()
+	}
+	trcs, err := v.activeTRCs(certIA.ISD(), now)
+	if err != nil {
+		return err
+	}
+	err = cppki.VerifyChain(chain, cppki.VerifyOptions{TRC: trcs, CurrentTime: now})
+	if err != nil {
+		return fmt.Errorf("certificate chain of %s not valid: %w", certIA, err)
+	}
+	return nil
+}
+
+// TLSConfig returns a client TLS configuration that verifies the certificate
+// chain of the server with VerifyChain, instead of verifying it against the
+// system roots. The certificate must be for the ISD-AS ia. If ia is zero, the
+// ISD-AS is taken from the server name, i.e. the (mangled) SCION address
+// as set by pan.Dialer; a host name is resolved with pan.ResolveUDPAddr.
+// No application protocols (NextProtos) are set.
+func (v *TRCVerifier) TLSConfig(ia pan.IA) *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true, // verified in VerifyConnection
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return v.verifyConnection(cs, ia)
+		},
+	}
+}
+
+func (v *TRCVerifier) verifyConnection(cs tls.ConnectionState, ia pan.IA) error {
+	if ia.IsZero() {
+		remote, err := serverNameAddr(cs.ServerName)
+		if err != nil {
+			return fmt.Errorf("unable to determine ISD-AS of server: %w", err)
+		}
+		ia = remote.IA
+	}
+	if len(cs.PeerCertificates) > 0 &&
+		!slices.Contains(cs.PeerCertificates[0].ExtKeyUsage, x509.ExtKeyUsageServerAuth) {
+		return errors.New("certificate not valid for server authentication")
+	}
+	return v.VerifyChain(cs.PeerCertificates, ia)
+}
+
+func serverNameAddr(serverName string) (pan.UDPAddr, error) {
+	if serverName == "" {
+		return pan.UDPAddr{}, errors.New("no server name")
+	}
+	host := pan.UnmangleSCIONAddr(serverName)
+	if remote, err := pan.ParseUDPAddr(host); err == nil {
+		return remote, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	return pan.ResolveUDPAddr(ctx, host)
+}
+
+// LoadASCertificate loads the AS certificate chain and the corresponding
+// private key of an AS, e.g. cp-as.pem and cp-as.key in the crypto/as
+// directory of the AS, for use as server certificate verified with a
+// TRCVerifier.
+func LoadASCertificate(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	chain := make([]*x509.Certificate, len(cert.Certificate))
+	for i, raw := range cert.Certificate {
+		if chain[i], err = x509.ParseCertificate(raw); err != nil {
+			return nil, err
+		}
+	}
+	if err := cppki.ValidateChain(chain); err != nil {
+		return nil, fmt.Errorf("invalid AS certificate chain in %s: %w", certFile, err)
+	}
+	return &cert, nil
+}
@@ -0,0 +1,259 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quicutil
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/scionproto/scion/pkg/addr"
+	"github.com/scionproto/scion/pkg/scrypto/cppki"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// testPKI is a minimal CP-PKI for one ISD with a single core AS, which is the
+// voter and root, and issues the AS certificates.
+type testPKI struct {
+	t        *testing.T
+	core     addr.IA
+	validity cppki.Validity
+	trc      cppki.SignedTRC
+	caCert   *x509.Certificate
+	caKey    crypto.Signer
+}
+
+func newTestPKI(t *testing.T, core addr.IA, validity cppki.Validity) *testPKI {
+	t.Helper()
+	p := &testPKI{t: t, core: core, validity: validity}
+	timestamping := []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}
+	sensitive, _ := p.createCert(&x509.Certificate{
+		Subject:            p.name("sensitive"),
+		ExtKeyUsage:        timestamping,
+		UnknownExtKeyUsage: []asn1.ObjectIdentifier{cppki.OIDExtKeyUsageSensitive},
+	}, nil, nil)
+	regular, _ := p.createCert(&x509.Certificate{
+		Subject:            p.name("regular"),
+		ExtKeyUsage:        timestamping,
+		UnknownExtKeyUsage: []asn1.ObjectIdentifier{cppki.OIDExtKeyUsageRegular},
+	}, nil, nil)
+	root, rootKey := p.createCert(&x509.Certificate{
+		Subject:               p.name("root"),
+		KeyUsage:              x509.KeyUsageCertSign,
+		ExtKeyUsage:           timestamping,
+		UnknownExtKeyUsage:    []asn1.ObjectIdentifier{cppki.OIDExtKeyUsageRoot},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            1,
+	}, nil, nil)
+	p.caCert, p.caKey = p.createCert(&x509.Certificate{
+		Subject:               p.name("ca"),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            0,
+		MaxPathLenZero:        true,
+	}, root, rootKey)
+
+	p.trc = cppki.SignedTRC{TRC: cppki.TRC{
+		Version:           1,
+		ID:                cppki.TRCID{ISD: core.ISD(), Base: 1, Serial: 1},
+		Validity:          validity,
+		Quorum:            1,
+		CoreASes:          []addr.AS{core.AS()},
+		AuthoritativeASes: []addr.AS{core.AS()},
+		Description:       "test TRC",
+		Certificates:      []*x509.Certificate{sensitive, regular, root},
+	}}
+	raw, err := p.trc.TRC.Encode()
+	require.NoError(t, err)
+	p.trc.TRC, err = cppki.DecodeTRC(raw)
+	require.NoError(t, err)
+	return p
+}
+
+func (p *testPKI) name(cn string) pkix.Name {
+	return pkix.Name{
+		CommonName: fmt.Sprintf("%s %s", p.core, cn),
+		ExtraNames: []pkix.AttributeTypeAndValue{{Type: cppki.OIDNameIA, Value: p.core.String()}},
+	}
+}
+
+// createCert creates a certificate from the template, signed by parent or
+// self-signed if parent is nil.
+func (p *testPKI) createCert(template, parent *x509.Certificate,
+	parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+
+	p.t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(p.t, err)
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(p.t, err)
+	skid := sha1.Sum(pub)
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	require.NoError(p.t, err)
+	template.SerialNumber = serial
+	template.SubjectKeyId = skid[:]
+	template.NotBefore = p.validity.NotBefore
+	template.NotAfter = p.validity.NotAfter
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(p.t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(p.t, err)
+	return cert, key
+}
+
+// issueAS issues an AS certificate for ia and writes the chain and the key to
+// files in dir, as cp-as.pem and cp-as.key.
+func (p *testPKI) issueAS(ia addr.IA, dir string) (certFile, keyFile string) {
+	p.t.Helper()
+	subject := p.name("AS")
+	subject.ExtraNames[0].Value = ia.String()
+	cert, key := p.createCert(&x509.Certificate{
+		Subject:  subject,
+		KeyUsage: x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth,
+			x509.ExtKeyUsageTimeStamping,
+		},
+	}, p.caCert, p.caKey)
+
+	certFile = filepath.Join(dir, "cp-as.pem")
+	keyFile = filepath.Join(dir, "cp-as.key")
+	var chainPEM []byte
+	for _, c := range []*x509.Certificate{cert, p.caCert} {
+		chainPEM = append(chainPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	require.NoError(p.t, os.WriteFile(certFile, chainPEM, 0o600))
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(p.t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	require.NoError(p.t, os.WriteFile(keyFile, keyPEM, 0o600))
+	return certFile, keyFile
+}
+
+// writeTRC writes the TRC to dir, PEM encoded like the TRCs of the SCION
+// endhost stack.
+func (p *testPKI) writeTRC(dir string) {
+	p.t.Helper()
+	raw, err := p.trc.Encode()
+	require.NoError(p.t, err)
+	file := filepath.Join(dir, fmt.Sprintf("ISD%d-B1-S1.trc", p.core.ISD()))
+	require.NoError(p.t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "TRC", Bytes: raw}), 0o600))
+}
+
+func TestTRCVerifier(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	validity := cppki.Validity{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(24 * time.Hour)}
+	core := addr.MustParseIA("1-ff00:0:110")
+	ia := addr.MustParseIA("1-ff00:0:111")
+
+	trcDir := t.TempDir()
+	pki := newTestPKI(t, core, validity)
+	pki.writeTRC(trcDir)
+	certFile, keyFile := pki.issueAS(ia, t.TempDir())
+	v, err := LoadTRCs(trcDir)
+	require.NoError(t, err)
+	assert.Equal(t, []addr.ISD{1}, v.ISDs())
+	cert, err := LoadASCertificate(certFile, keyFile)
+	require.NoError(t, err)
+
+	t.Run("handshake", func(t *testing.T) {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		require.NoError(t, err)
+		serverConf := &tls.Config{Certificates: []tls.Certificate{*cert}, NextProtos: []string{"test"}}
+		ql, err := quic.Listen(conn, serverConf, nil)
+		require.NoError(t, err)
+		defer ql.Close()
+		go func() {
+			for {
+				if _, err := ql.Accept(context.Background()); err != nil {
+					return
+				}
+			}
+		}()
+
+		dial := func(serverIA addr.IA, confIA pan.IA) error {
+			server := fmt.Sprintf("%s,%s", serverIA, conn.LocalAddr())
+			tlsConf := v.TLSConfig(confIA)
+			tlsConf.NextProtos = []string{"test"}
+			tlsConf.ServerName = pan.MangleSCIONAddr(server)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			qconn, err := quic.DialAddr(ctx, conn.LocalAddr().String(), tlsConf, nil)
+			if err != nil {
+				return err
+			}
+			return qconn.CloseWithError(0x0, "ok")
+		}
+		other := addr.MustParseIA("1-ff00:0:112")
+		assert.NoError(t, dial(ia, 0), "IA from server name")
+		assert.NoError(t, dial(other, pan.IA(ia)), "explicit IA")
+		assert.ErrorContains(t, dial(other, 0), "expected 1-ff00:0:112")
+		assert.ErrorContains(t, dial(ia, pan.IA(other)), "expected 1-ff00:0:112")
+	})
+
+	chain := []*x509.Certificate{cert.Leaf, pki.caCert}
+
+	t.Run("untrusted", func(t *testing.T) {
+		otherPKI := newTestPKI(t, core, validity)
+		otherCertFile, otherKeyFile := otherPKI.issueAS(ia, t.TempDir())
+		otherCert, err := LoadASCertificate(otherCertFile, otherKeyFile)
+		require.NoError(t, err)
+		assert.Error(t, v.VerifyChain([]*x509.Certificate{otherCert.Leaf, otherPKI.caCert}, pan.IA(ia)))
+
+		otherISD := newTestPKI(t, addr.MustParseIA("2-ff00:0:210"), validity)
+		otherCertFile, otherKeyFile = otherISD.issueAS(addr.MustParseIA("2-ff00:0:211"), t.TempDir())
+		otherCert, err = LoadASCertificate(otherCertFile, otherKeyFile)
+		require.NoError(t, err)
+		err = v.VerifyChain([]*x509.Certificate{otherCert.Leaf, otherISD.caCert}, pan.IA(addr.MustParseIA("2-ff00:0:211")))
+		assert.ErrorContains(t, err, "no TRC for ISD 2")
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		require.NoError(t, v.VerifyChain(chain, pan.IA(ia)))
+		expired := *v
+		expired.now = func() time.Time { return validity.NotAfter.Add(time.Minute) }
+		assert.ErrorContains(t, expired.VerifyChain(chain, pan.IA(ia)), "not valid")
+	})
+
+	t.Run("no TRCs", func(t *testing.T) {
+		_, err := LoadTRCs(t.TempDir())
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,223 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quicutil
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+var (
+	// DatagramProto is a quic application layer protocol that transports
+	// unreliable messages, each in a single QUIC datagram (RFC 9221).
+	// Datagrams must be enabled in the quic.Config on both sides, this is the
+	// default for pan.DialQUIC and pan.ListenQUIC without a quic.Config.
+	DatagramProto = "qd"
+
+	// ErrDatagramsNotSupported is returned by NewDatagramConn if the peer
+	// does not support QUIC datagrams.
+	ErrDatagramsNotSupported = errors.New("QUIC datagrams not supported by peer")
+)
+
+const (
+	// defaultMaxDatagramSize is the maximum datagram size for QUIC
+	// connections for which the packet size is not known; the default packet
+	// size of quic-go, 1280 bytes, minus the overhead of the QUIC packet.
+	defaultMaxDatagramSize = 1280 - (1 + 20 + 4 + 16 + 3)
+)
+
+func init() {
+	pan.RegisterQUICNetwork("quic-datagram", pan.QUICNetwork{
+		NextProtos:      []string{DatagramProto},
+		EnableDatagrams: true,
+		NewConn: func(connection *pan.QUICConn) (net.Conn, error) {
+			return NewDatagramConn(connection)
+		},
+	})
+}
+
+// datagramConnection is an interface that abstracts over quic.Conn and pan.QUICConn.
+type datagramConnection interface {
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+	SendDatagram([]byte) error
+	ReceiveDatagram(context.Context) ([]byte, error)
+	ConnectionState() quic.ConnectionState
+	CloseWithError(quic.ApplicationErrorCode, string) error
+}
+
+// DatagramListener is a wrapper for a pan.QUICListener, returning
+// DatagramConn connections from Accept.
+type DatagramListener struct {
+	*pan.QUICListener
+}
+
+func (l DatagramListener) Accept() (net.Conn, error) {
+	ctx := context.Background()
+	connection, err := l.Listener.Accept(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewDatagramConn(connection)
+}
+
+// DatagramConn implements net.Conn with message semantics over the unreliable
+// datagrams of a QUIC connection (RFC 9221), like a connected UDP socket.
+// Each Write sends a single datagram, each Read returns a single datagram.
+// Datagrams are encrypted and congestion controlled, but may be lost or
+// reordered; they are not retransmitted.
+type DatagramConn struct {
+	Connection   datagramConnection
+	mutex        sync.Mutex // protects the fields below
+	readDeadline time.Time
+	// readCtx is the context of the pending Reads, with the read deadline. It
+	// is cancelled when the deadline changes, so that the Reads start over
+	// with the new deadline.
+	readCtx    context.Context
+	readCancel context.CancelFunc
+	maxSize    int // limit reported by SendDatagram, if any
+}
+
+// NewDatagramConn returns a DatagramConn for the connection, which must have
+// been established with datagrams enabled.
+func NewDatagramConn(connection datagramConnection) (*DatagramConn, error) {
+	if !connection.ConnectionState().SupportsDatagrams {
+		_ = connection.CloseWithError(0x101, ErrDatagramsNotSupported.Error())
+		return nil, ErrDatagramsNotSupported
+	}
+	return &DatagramConn{Connection: connection}, nil
+}
+
+func (c *DatagramConn) LocalAddr() net.Addr {
+	return c.Connection.LocalAddr()
+}
+
+func (c *DatagramConn) RemoteAddr() net.Addr {
+	return c.Connection.RemoteAddr()
+}
+
+func (c *DatagramConn) GetPath() *pan.Path {
+	quicConn, ok := c.Connection.(*pan.QUICConn)
+	if !ok {
+		return nil
+	}
+	return quicConn.UnderlayConn.GetPath()
+}
+
+// MaxDatagramSize returns the maximum size of a message that can be sent with
+// a single Write. For a pan.QUICConn, this is derived from the QUIC packet
+// size and the MTU of the current path, see pan.QUICConn.MaxDatagramSize.
+func (c *DatagramConn) MaxDatagramSize() int {
+	size := defaultMaxDatagramSize
+	if quicConn, ok := c.Connection.(*pan.QUICConn); ok {
+		size = quicConn.MaxDatagramSize()
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.maxSize > 0 {
+		size = min(size, c.maxSize)
+	}
+	return size
+}
+
+// Read reads the next datagram. If b is too small, the remainder of the
+// datagram is discarded.
+func (c *DatagramConn) Read(b []byte) (int, error) {
+	for {
+		ctx := c.readContext()
+		msg, err := c.Connection.ReceiveDatagram(ctx)
+		if err == nil {
+			return copy(b, msg), nil
+		}
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			return 0, os.ErrDeadlineExceeded
+		case errors.Is(ctx.Err(), context.Canceled):
+			continue // deadline changed
+		default:
+			return 0, err
+		}
+	}
+}
+
+// Write sends b in a single datagram. Fails with a *quic.DatagramTooLargeError
+// if b is larger than MaxDatagramSize.
+func (c *DatagramConn) Write(b []byte) (int, error) {
+	err := c.Connection.SendDatagram(b)
+	var tooLarge *quic.DatagramTooLargeError
+	if errors.As(err, &tooLarge) {
+		c.mutex.Lock()
+		c.maxSize = int(tooLarge.MaxDatagramPayloadSize)
+		c.mutex.Unlock()
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *DatagramConn) Close() error {
+	c.mutex.Lock()
+	if c.readCancel != nil {
+		c.readCancel()
+	}
+	c.mutex.Unlock()
+	return c.Connection.CloseWithError(0x0, "ok")
+}
+
+func (c *DatagramConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for Read calls, including Reads that are
+// already blocked.
+func (c *DatagramConn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.readDeadline = t
+	if c.readCancel != nil {
+		c.readCancel()
+	}
+	c.readCtx, c.readCancel = nil, nil
+	return nil
+}
+
+// SetWriteDeadline has no effect; Write does not block.
+func (c *DatagramConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// readContext returns the context for Read, which expires at the read
+// deadline and is cancelled when the deadline is changed.
+func (c *DatagramConn) readContext() context.Context {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.readCtx == nil {
+		if c.readDeadline.IsZero() {
+			c.readCtx, c.readCancel = context.WithCancel(context.Background())
+		} else {
+			c.readCtx, c.readCancel = context.WithDeadline(context.Background(), c.readDeadline)
+		}
+	}
+	return c.readCtx
+}
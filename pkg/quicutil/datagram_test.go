@@ -0,0 +1,143 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quicutil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var datagramQUICConfig = &quic.Config{EnableDatagrams: true}
+
+func dialTestDatagramConnection(t *testing.T, address string) *quic.Conn {
+	t.Helper()
+	tlsConf := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{DatagramProto}}
+	conn, err := quic.DialAddr(context.Background(), address, tlsConf, datagramQUICConfig)
+	require.NoError(t, err)
+	return conn
+}
+
+func TestDatagramConn(t *testing.T) {
+	l := DatagramListener{
+		QUICListener: newTestQUICListenerWithConfig(t, []string{DatagramProto}, datagramQUICConfig),
+	}
+	client, err := NewDatagramConn(dialTestDatagramConnection(t, l.Addr().String()))
+	require.NoError(t, err)
+	defer client.Close()
+	accepted, err := l.Accept()
+	require.NoError(t, err)
+	server := accepted.(*DatagramConn)
+	defer server.Close()
+
+	buf := make([]byte, 1500)
+	for _, msg := range []string{"hello", "world"} {
+		_, err := client.Write([]byte(msg))
+		require.NoError(t, err)
+		require.NoError(t, server.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, err := server.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, msg, string(buf[:n]), "one message per datagram")
+	}
+	_, err = server.Write([]byte("reply"))
+	require.NoError(t, err)
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := client.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "reply", string(buf[:n]))
+
+	t.Run("too large", func(t *testing.T) {
+		assert.Equal(t, defaultMaxDatagramSize, client.MaxDatagramSize())
+		_, err := client.Write(make([]byte, 2000))
+		var tooLarge *quic.DatagramTooLargeError
+		require.True(t, errors.As(err, &tooLarge), "unexpected error %v", err)
+		expected := min(defaultMaxDatagramSize, int(tooLarge.MaxDatagramPayloadSize))
+		assert.Equal(t, expected, client.MaxDatagramSize(), "size limit cached")
+		_, err = client.Write(make([]byte, client.MaxDatagramSize()))
+		require.NoError(t, err)
+		require.NoError(t, server.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, err := server.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, client.MaxDatagramSize(), n)
+	})
+
+	t.Run("read deadline", func(t *testing.T) {
+		require.NoError(t, server.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+		_, err := server.Read(buf)
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		require.NoError(t, server.SetReadDeadline(time.Now().Add(-time.Second)))
+		_, err = server.Read(buf)
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded, "deadline in the past")
+	})
+
+	t.Run("deadline for pending read", func(t *testing.T) {
+		require.NoError(t, server.SetReadDeadline(time.Time{}))
+		readErr := make(chan error, 1)
+		go func() {
+			_, err := server.Read(make([]byte, 1500))
+			readErr <- err
+		}()
+		time.Sleep(20 * time.Millisecond) // let Read block without deadline
+		require.NoError(t, server.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+		select {
+		case err := <-readErr:
+			assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		case <-time.After(5 * time.Second):
+			t.Fatal("pending Read not unblocked by SetReadDeadline")
+		}
+	})
+
+	t.Run("deadline extended for pending read", func(t *testing.T) {
+		require.NoError(t, server.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+		received := make(chan string, 1)
+		go func() {
+			n, err := server.Read(buf)
+			if err != nil {
+				received <- err.Error()
+				return
+			}
+			received <- string(buf[:n])
+		}()
+		require.NoError(t, server.SetReadDeadline(time.Time{}))
+		time.Sleep(100 * time.Millisecond) // past the original deadline
+		_, err := client.Write([]byte("late"))
+		require.NoError(t, err)
+		select {
+		case msg := <-received:
+			assert.Equal(t, "late", msg)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no datagram received")
+		}
+	})
+}
+
+func TestDatagramConnNotSupported(t *testing.T) {
+	l := newTestQUICListener(t, []string{DatagramProto}) // datagrams not enabled
+	connection := dialTestDatagramConnection(t, l.Addr().String())
+	_, err := NewDatagramConn(connection)
+	assert.ErrorIs(t, err, ErrDatagramsNotSupported)
+	select {
+	case <-connection.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not closed")
+	}
+}
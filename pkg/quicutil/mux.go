@@ -0,0 +1,521 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quicutil
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+var (
+	// MuxProto is a quic application layer protocol that transports any number
+	// of opaque, bi-directional data streams over a single quic connection.
+	// Each stream is intended as a drop-in replacement for a TCP connection.
+	//
+	// The "protocol" is:
+	//  - the dialing peer opens a bidirectional stream for each logical
+	//    connection and writes a single header byte (0x00) to it, so that
+	//    the listening peer learns about the stream before any data is sent.
+	//  - closing a stream sends a FIN and stops reading. As the quic connection
+	//    stays open, there is no need for the shutdown signalling of
+	//    SingleStreamProto.
+	MuxProto = "qm"
+)
+
+const (
+	muxStreamHeader = 0x00
+	// muxHeaderTimeout is the time a listener waits for the header of a new
+	// stream.
+	muxHeaderTimeout = 10 * time.Second
+	// defaultMuxIdleTimeout is the default time after which a MuxDialer closes
+	// a connection without open streams.
+	defaultMuxIdleTimeout = 30 * time.Second
+	// muxStreamErrorCode is the stream error code for aborted streams.
+	muxStreamErrorCode = quic.StreamErrorCode(0x101)
+)
+
+// muxConnection is an interface that abstracts over quic.Conn and pan.QUICConn.
+type muxConnection interface {
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+	OpenStreamSync(context.Context) (*quic.Stream, error)
+	AcceptStream(context.Context) (*quic.Stream, error)
+	CloseWithError(quic.ApplicationErrorCode, string) error
+	Context() context.Context
+}
+
+// MuxListener is a wrapper for a pan.QUICListener, returning each stream
+// opened by a MuxDialer as a MuxStream from Accept. Each peer uses a single
+// quic connection for any number of streams.
+type MuxListener struct {
+	*pan.QUICListener
+	streams     chan *MuxStream
+	done        chan struct{}
+	closeOnce   sync.Once
+	mutex       sync.Mutex // protects err and connections
+	err         error
+	connections map[muxConnection]struct{}
+}
+
+// NewMuxListener starts accepting connections and streams on the listener.
+// The tls.Config of the listener should include MuxProto in its NextProtos.
+func NewMuxListener(l *pan.QUICListener) *MuxListener {
+	ml := &MuxListener{
+		QUICListener: l,
+		streams:      make(chan *MuxStream),
+		done:         make(chan struct{}),
+		connections:  make(map[muxConnection]struct{}),
+	}
+	go ml.acceptConnections()
+	return ml
+}
+
+// Accept waits for and returns the next stream.
+func (l *MuxListener) Accept() (net.Conn, error) {
+	select {
+	case s := <-l.streams:
+		return s, nil
+	case <-l.done:
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		return nil, l.err
+	}
+}
+
+// Close closes the listener and all the accepted connections.
+func (l *MuxListener) Close() error {
+	var err error
+	l.shutdown(net.ErrClosed, func() {
+		err = l.QUICListener.Close()
+	})
+	return err
+}
+
+// shutdown stops accepting with the given error and closes all connections.
+func (l *MuxListener) shutdown(reason error, closeListener func()) {
+	l.closeOnce.Do(func() {
+		l.mutex.Lock()
+		l.err = reason
+		connections := l.connections
+		l.connections = nil
+		l.mutex.Unlock()
+		close(l.done)
+		for c := range connections {
+			_ = c.CloseWithError(0x0, "ok")
+		}
+		closeListener()
+	})
+}
+
+func (l *MuxListener) acceptConnections() {
+	for {
+		connection, err := l.Listener.Accept(context.Background())
+		if err != nil {
+			l.shutdown(err, func() {})
+			return
+		}
+		if !l.track(connection) {
+			_ = connection.CloseWithError(0x0, "ok")
+			return
+		}
+		go l.acceptStreams(connection)
+	}
+}
+
+func (l *MuxListener) acceptStreams(connection muxConnection) {
+	defer l.untrack(connection)
+	for {
+		stream, err := connection.AcceptStream(context.Background())
+		if err != nil {
+			return // connection closed
+		}
+		go l.readHeader(connection, stream)
+	}
+}
+
+func (l *MuxListener) readHeader(connection muxConnection, stream *quic.Stream) {
+	var header [1]byte
+	_ = stream.SetReadDeadline(time.Now().Add(muxHeaderTimeout))
+	_, err := io.ReadFull(stream, header[:])
+	if err != nil || header[0] != muxStreamHeader {
+		abortStream(stream)
+		return
+	}
+	_ = stream.SetReadDeadline(time.Time{})
+	select {
+	case l.streams <- newMuxStream(connection, stream, nil):
+	case <-l.done:
+		abortStream(stream)
+	}
+}
+
+func (l *MuxListener) track(connection muxConnection) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.connections == nil {
+		return false
+	}
+	l.connections[connection] = struct{}{}
+	return true
+}
+
+func (l *MuxListener) untrack(connection muxConnection) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.connections, connection)
+}
+
+// MuxDialer dials streams to peers with a MuxListener. It keeps one quic
+// connection per peer address, that is shared by all the streams to this
+// peer. A connection is closed after it has not had any open streams for the
+// IdleTimeout; if the connection dies, the next dial transparently
+// establishes a new one.
+//
+// The zero value is a MuxDialer without any options.
+type MuxDialer struct {
+	// Local is the local address. See note on wildcard addresses in the
+	// pan package documentation.
+	Local netip.AddrPort
+	// Policy is the path policy for the connections.
+	Policy pan.Policy
+	// NewSelector, if set, creates the path selector for each connection.
+	NewSelector func() pan.Selector
+	// TLSConfig is the TLS configuration for the connections. If it does not
+	// define any application protocols (NextProtos), MuxProto is used.
+	// If nil, a configuration that does NOT verify the server certificate is
+	// used, like for shttp.
+	TLSConfig *tls.Config
+	// QUICConfig is the configuration for the connections, may be nil.
+	QUICConfig *quic.Config
+	// IdleTimeout is the time after which a connection without open streams
+	// is closed. The default is 30 seconds.
+	IdleTimeout time.Duration
+
+	mutex       sync.Mutex // protects connections and closed
+	connections map[string]*muxDialerConn
+	closed      bool
+	// dial establishes a new connection; for testing. If nil, pan.DialQUIC
+	// is used.
+	dial func(ctx context.Context, address string) (muxConnection, error)
+}
+
+// muxDialerConn is a pooled connection of a MuxDialer.
+type muxDialerConn struct {
+	ready      chan struct{} // closed once connection or err are set
+	connection muxConnection
+	err        error
+	streams    int // number of open streams, protected by MuxDialer.mutex
+	idleTimer  *time.Timer
+}
+
+// DialContext opens a new stream to the address, on the pooled connection to
+// the address if there is one. The network is ignored, so that DialContext
+// can be used in place of net.Dialer.DialContext.
+// The address is resolved with pan.ResolveUDPAddr, after reverting a mangled
+// SCION address (see pan.UnmangleSCIONAddr).
+func (d *MuxDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	address = pan.UnmangleSCIONAddr(address)
+	for retry := false; ; retry = true {
+		mc, err := d.getConn(ctx, address)
+		if err != nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+		}
+		stream, err := openMuxStream(ctx, mc.connection)
+		if err == nil {
+			return newMuxStream(mc.connection, stream, func() { d.release(address, mc) }), nil
+		}
+		d.release(address, mc)
+		// If the pooled connection died, retry once on a new connection.
+		if retry || mc.connection.Context().Err() == nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Addr: mc.connection.RemoteAddr(), Err: err}
+		}
+		d.evict(address, mc)
+	}
+}
+
+// Close closes all pooled connections, including the connections of open
+// streams.
+func (d *MuxDialer) Close() error {
+	d.mutex.Lock()
+	connections := d.connections
+	d.connections = nil
+	d.closed = true
+	d.mutex.Unlock()
+	for _, mc := range connections {
+		select {
+		case <-mc.ready:
+			if mc.connection != nil {
+				_ = mc.connection.CloseWithError(0x0, "ok")
+			}
+		default: // closed by getConn, once established
+		}
+	}
+	return nil
+}
+
+// getConn returns the established connection to the address, dialing a new
+// one if necessary. The connection's stream count is incremented; the caller
+// must call release.
+func (d *MuxDialer) getConn(ctx context.Context, address string) (*muxDialerConn, error) {
+	d.mutex.Lock()
+	if d.closed {
+		d.mutex.Unlock()
+		return nil, net.ErrClosed
+	}
+	if d.connections == nil {
+		d.connections = make(map[string]*muxDialerConn)
+	}
+	mc, ok := d.connections[address]
+	if ok && mc.dead() {
+		delete(d.connections, address)
+		ok = false
+	}
+	if !ok {
+		mc = &muxDialerConn{ready: make(chan struct{})}
+		d.connections[address] = mc
+	}
+	mc.streams++
+	if mc.idleTimer != nil {
+		mc.idleTimer.Stop()
+		mc.idleTimer = nil
+	}
+	d.mutex.Unlock()
+
+	if !ok {
+		d.establish(ctx, address, mc)
+	} else {
+		select {
+		case <-mc.ready:
+		case <-ctx.Done():
+			d.release(address, mc)
+			return nil, ctx.Err()
+		}
+	}
+	if mc.err != nil {
+		return nil, mc.err
+	}
+	return mc, nil
+}
+
+// establish dials the connection for the new pool entry mc.
+func (d *MuxDialer) establish(ctx context.Context, address string, mc *muxDialerConn) {
+	dial := d.dial
+	if dial == nil {
+		dial = d.dialQUIC
+	}
+	connection, err := dial(ctx, address)
+
+	d.mutex.Lock()
+	pooled := d.connections[address] == mc
+	if err == nil && !pooled {
+		_ = connection.CloseWithError(0x0, "ok")
+		connection, err = nil, net.ErrClosed
+	}
+	if err != nil && pooled {
+		delete(d.connections, address)
+	}
+	mc.connection, mc.err = connection, err
+	d.mutex.Unlock()
+	close(mc.ready)
+
+	if err == nil {
+		go func() {
+			<-connection.Context().Done()
+			d.evict(address, mc)
+		}()
+	}
+}
+
+func (d *MuxDialer) dialQUIC(ctx context.Context, address string) (muxConnection, error) {
+	remote, err := pan.ResolveUDPAddr(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	var tlsConf *tls.Config
+	if d.TLSConfig != nil {
+		tlsConf = d.TLSConfig.Clone()
+	} else {
+		tlsConf = &tls.Config{InsecureSkipVerify: true}
+	}
+	if len(tlsConf.NextProtos) == 0 {
+		tlsConf.NextProtos = []string{MuxProto}
+	}
+	opts := []pan.ConnOptions{pan.WithPolicy(d.Policy)}
+	if d.NewSelector != nil {
+		opts = append(opts, pan.WithSelector(d.NewSelector()))
+	}
+	return pan.DialQUIC(ctx, d.Local, remote, pan.MangleSCIONAddr(address), tlsConf, d.QUICConfig, opts...)
+}
+
+// release decrements the stream count of the connection and starts the idle
+// timer once there are no open streams.
+func (d *MuxDialer) release(address string, mc *muxDialerConn) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	mc.streams--
+	if mc.streams > 0 || d.connections[address] != mc || mc.connection == nil {
+		return
+	}
+	idleTimeout := d.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = defaultMuxIdleTimeout
+	}
+	mc.idleTimer = time.AfterFunc(idleTimeout, func() {
+		d.mutex.Lock()
+		idle := mc.streams == 0 && d.connections[address] == mc
+		if idle {
+			delete(d.connections, address)
+		}
+		d.mutex.Unlock()
+		if idle {
+			_ = mc.connection.CloseWithError(0x0, "idle")
+		}
+	})
+}
+
+// evict removes the connection from the pool.
+func (d *MuxDialer) evict(address string, mc *muxDialerConn) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.connections[address] == mc {
+		delete(d.connections, address)
+	}
+	if mc.idleTimer != nil {
+		mc.idleTimer.Stop()
+		mc.idleTimer = nil
+	}
+}
+
+// dead returns true if the connection was established and has been closed
+// since.
+func (mc *muxDialerConn) dead() bool {
+	select {
+	case <-mc.ready:
+		return mc.connection == nil || mc.connection.Context().Err() != nil
+	default:
+		return false
+	}
+}
+
+func openMuxStream(ctx context.Context, connection muxConnection) (*quic.Stream, error) {
+	stream, err := connection.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stream.Write([]byte{muxStreamHeader}); err != nil {
+		abortStream(stream)
+		return nil, err
+	}
+	return stream, nil
+}
+
+func abortStream(stream *quic.Stream) {
+	stream.CancelRead(muxStreamErrorCode)
+	stream.CancelWrite(muxStreamErrorCode)
+}
+
+// MuxStream is a single bi-directional stream on a quic connection shared
+// with other streams, as returned by MuxListener and MuxDialer.
+// It implements net.Conn, intending to be a drop-in replacement for a TCP
+// connection.
+type MuxStream struct {
+	Connection muxConnection
+	stream     *quic.Stream
+	closeOnce  sync.Once
+	onClose    func()
+}
+
+func newMuxStream(connection muxConnection, stream *quic.Stream, onClose func()) *MuxStream {
+	return &MuxStream{
+		Connection: connection,
+		stream:     stream,
+		onClose:    onClose,
+	}
+}
+
+func (s *MuxStream) LocalAddr() net.Addr {
+	return s.Connection.LocalAddr()
+}
+
+func (s *MuxStream) RemoteAddr() net.Addr {
+	return s.Connection.RemoteAddr()
+}
+
+// GetPath returns the path currently used by the connection of the stream,
+// if it was dialed with pan.DialQUIC.
+func (s *MuxStream) GetPath() *pan.Path {
+	quicConn, ok := s.Connection.(*pan.QUICConn)
+	if !ok {
+		return nil
+	}
+	return quicConn.UnderlayConn.GetPath()
+}
+
+func (s *MuxStream) Read(p []byte) (int, error) {
+	return s.stream.Read(p)
+}
+
+func (s *MuxStream) Write(p []byte) (int, error) {
+	return s.stream.Write(p)
+}
+
+func (s *MuxStream) SetDeadline(t time.Time) error {
+	return s.stream.SetDeadline(t)
+}
+
+func (s *MuxStream) SetReadDeadline(t time.Time) error {
+	return s.stream.SetReadDeadline(t)
+}
+
+func (s *MuxStream) SetWriteDeadline(t time.Time) error {
+	return s.stream.SetWriteDeadline(t)
+}
+
+// CloseRead aborts receiving on this stream.
+// It will ask the peer to stop transmitting stream data.
+// This is analogous e.g. to net.TCPConn.CloseRead.
+func (s *MuxStream) CloseRead() error {
+	s.stream.CancelRead(0x0)
+	return nil
+}
+
+// CloseWrite closes the stream for writing.
+// This is analogous e.g. to net.TCPConn.CloseWrite
+func (s *MuxStream) CloseWrite() error {
+	return s.stream.Close()
+}
+
+// Close closes the stream in both directions. Data already written is still
+// delivered, as the quic connection remains open.
+func (s *MuxStream) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.stream.CancelRead(0x0)
+		err = s.stream.Close()
+		if s.onClose != nil {
+			s.onClose()
+		}
+	})
+	return err
+}
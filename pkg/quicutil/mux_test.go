@@ -0,0 +1,199 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quicutil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMuxListener returns a MuxListener on a plain UDP socket on loopback.
+func newTestMuxListener(t *testing.T) *MuxListener {
+	t.Helper()
+	l := NewMuxListener(newTestQUICListener(t, []string{MuxProto}))
+	t.Cleanup(func() { _ = l.Close() })
+	return l
+}
+
+// newTestMuxDialer returns a MuxDialer dialing plain quic connections and the
+// list of the connections it dialed.
+func newTestMuxDialer(t *testing.T) (*MuxDialer, func() []*quic.Conn) {
+	var mutex sync.Mutex
+	var dialed []*quic.Conn
+	d := &MuxDialer{
+		dial: func(ctx context.Context, address string) (muxConnection, error) {
+			tlsConf := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{MuxProto}}
+			conn, err := quic.DialAddr(ctx, address, tlsConf, nil)
+			if err != nil {
+				return nil, err
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			dialed = append(dialed, conn)
+			return conn, nil
+		},
+	}
+	t.Cleanup(func() { _ = d.Close() })
+	return d, func() []*quic.Conn {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]*quic.Conn(nil), dialed...)
+	}
+}
+
+// echo serves the streams accepted on l, writing a greeting and then echoing.
+func echo(l *MuxListener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			_, _ = conn.Write([]byte("hi "))
+			_, _ = io.Copy(conn, conn)
+		}()
+	}
+}
+
+func TestMux(t *testing.T) {
+	l := newTestMuxListener(t)
+	go echo(l)
+	address := l.Addr().String()
+	ctx := context.Background()
+
+	t.Run("shared connection", func(t *testing.T) {
+		d, dialed := newTestMuxDialer(t)
+		var streams []net.Conn
+		for i := 0; i < 3; i++ {
+			conn, err := d.DialContext(ctx, "tcp", address)
+			require.NoError(t, err)
+			streams = append(streams, conn)
+		}
+		assert.Len(t, dialed(), 1)
+		for i, conn := range streams {
+			// the listener writes first, so it must have learned of the stream
+			buf := make([]byte, 3)
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+			_, err := io.ReadFull(conn, buf)
+			require.NoError(t, err, i)
+			assert.Equal(t, "hi ", string(buf))
+
+			msg := []byte{byte('a' + i)}
+			_, err = conn.Write(msg)
+			require.NoError(t, err)
+			_, err = io.ReadFull(conn, buf[:1])
+			require.NoError(t, err)
+			assert.Equal(t, msg, buf[:1])
+			assert.Equal(t, address, conn.RemoteAddr().String())
+			assert.Nil(t, conn.(*MuxStream).GetPath())
+		}
+		for _, conn := range streams {
+			assert.NoError(t, conn.Close())
+		}
+	})
+
+	t.Run("idle eviction", func(t *testing.T) {
+		d, dialed := newTestMuxDialer(t)
+		d.IdleTimeout = 50 * time.Millisecond
+		conn, err := d.DialContext(ctx, "tcp", address)
+		require.NoError(t, err)
+		time.Sleep(2 * d.IdleTimeout)
+		assert.NoError(t, dialed()[0].Context().Err(), "not idle while stream is open")
+
+		assert.NoError(t, conn.Close())
+		assert.NoError(t, conn.Close(), "close is idempotent")
+		assert.Eventually(t, func() bool { return dialed()[0].Context().Err() != nil },
+			time.Second, 10*time.Millisecond)
+
+		conn, err = d.DialContext(ctx, "tcp", address)
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.Len(t, dialed(), 2)
+	})
+
+	t.Run("reconnect", func(t *testing.T) {
+		d, dialed := newTestMuxDialer(t)
+		conn, err := d.DialContext(ctx, "tcp", address)
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, dialed()[0].CloseWithError(0x0, "test"))
+
+		conn2, err := d.DialContext(ctx, "tcp", address)
+		require.NoError(t, err)
+		defer conn2.Close()
+		assert.Len(t, dialed(), 2)
+		buf := make([]byte, 3)
+		require.NoError(t, conn2.SetReadDeadline(time.Now().Add(time.Second)))
+		_, err = io.ReadFull(conn2, buf)
+		assert.NoError(t, err)
+	})
+
+	t.Run("concurrent dials", func(t *testing.T) {
+		d, dialed := newTestMuxDialer(t)
+		var wg sync.WaitGroup
+		var failed atomic.Int32
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				conn, err := d.DialContext(ctx, "tcp", address)
+				if err != nil {
+					failed.Add(1)
+					return
+				}
+				conn.Close()
+			}()
+		}
+		wg.Wait()
+		assert.Zero(t, failed.Load())
+		assert.Len(t, dialed(), 1)
+	})
+
+	t.Run("dialer closed", func(t *testing.T) {
+		d, _ := newTestMuxDialer(t)
+		require.NoError(t, d.Close())
+		_, err := d.DialContext(ctx, "tcp", address)
+		assert.True(t, errors.Is(err, net.ErrClosed), "unexpected error %v", err)
+	})
+}
+
+func TestMuxListenerClose(t *testing.T) {
+	l := newTestMuxListener(t)
+	d, dialed := newTestMuxDialer(t)
+	conn, err := d.DialContext(context.Background(), "tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	accepted, err := l.Accept()
+	require.NoError(t, err)
+	defer accepted.Close()
+
+	require.NoError(t, l.Close())
+	_, err = l.Accept()
+	assert.True(t, errors.Is(err, net.ErrClosed), "unexpected error %v", err)
+	assert.Eventually(t, func() bool { return dialed()[0].Context().Err() != nil },
+		time.Second, 10*time.Millisecond, "connections closed")
+}
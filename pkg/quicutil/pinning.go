@@ -0,0 +1,256 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quicutil
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+var (
+	// ErrHostNotConfirmed is returned by TrustStore.VerifyConnection if the
+	// key of a new host was rejected by TrustStore.ConfirmNewHost.
+	ErrHostNotConfirmed = errors.New("key of new host not confirmed")
+)
+
+const fingerprintPrefix = "sha256:"
+
+// PinMismatchError is returned by TrustStore.VerifyConnection if the key of
+// the server does not match the key pinned for the host.
+type PinMismatchError struct {
+	Host   string
+	Pinned string
+	Got    string
+	Path   string
+}
+
+func (e *PinMismatchError) Error() string {
+	return fmt.Sprintf("key of host %s does not match the key pinned in %s: got %s, pinned %s; "+
+		"this may be a man-in-the-middle attack, or the host key may have changed; "+
+		"if you are sure that the key has changed, remove the pin with "+
+		"\"scion-quicpin remove '%s'\"",
+		e.Host, e.Path, e.Got, e.Pinned, e.Host)
+}
+
+// KeyFingerprint returns the fingerprint of the public key of the certificate,
+// the base64 encoded SHA-256 hash of its SubjectPublicKeyInfo.
+// As only the key is pinned, a server can renew its (self-signed) certificate
+// as long as it keeps its key, see LoadOrGenerateSelfSignedCert.
+func KeyFingerprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return fingerprintPrefix + base64.RawStdEncoding.EncodeToString(hash[:])
+}
+
+// DefaultTrustStorePath returns the default path of the trust store,
+// quic_known_hosts in the scion-apps directory of the user's configuration
+// directory (e.g. ~/.config/scion-apps/quic_known_hosts).
+func DefaultTrustStorePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "scion-apps", "quic_known_hosts"), nil
+}
+
+// TrustStore pins the server key fingerprints of hosts on first use (TOFU),
+// similar to the known_hosts file of ssh. Hosts are identified by the address
+// that was dialed without the port, i.e. the SCION address (ISD-AS,IP) or the
+// hostname, as this is the server name of the TLS connection. Hosts given with
+// a port, e.g. to Pin or Lookup, are pinned and looked up without it.
+//
+// The file contains one line per host, with the host and the fingerprint
+// separated by whitespace. Empty lines and lines starting with # are ignored.
+type TrustStore struct {
+	// ConfirmNewHost is called before the key of a host without a pin is
+	// pinned. If it returns false, the connection is rejected. If nil, all
+	// new keys are pinned.
+	ConfirmNewHost func(host, fingerprint string) bool
+
+	path  string
+	mutex sync.Mutex // protects pins and the file
+	pins  map[string]string
+}
+
+// LoadTrustStore loads the trust store from the file. A missing file is
+// treated as an empty store; the file is created once the first key is
+// pinned.
+func LoadTrustStore(path string) (*TrustStore, error) {
+	s := &TrustStore{
+		path: path,
+		pins: make(map[string]string),
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], fingerprintPrefix) {
+			return nil, fmt.Errorf("%s:%d: invalid line, expected host and %s fingerprint",
+				path, lineno, strings.TrimSuffix(fingerprintPrefix, ":"))
+		}
+		s.pins[normalizeHost(fields[0])] = fields[1]
+	}
+	return s, scanner.Err()
+}
+
+// Path returns the path of the file of the trust store.
+func (s *TrustStore) Path() string {
+	return s.path
+}
+
+// Lookup returns the fingerprint pinned for the host.
+func (s *TrustStore) Lookup(host string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	fingerprint, ok := s.pins[normalizeHost(host)]
+	return fingerprint, ok
+}
+
+// Hosts returns the sorted list of the hosts with a pinned key.
+func (s *TrustStore) Hosts() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	hosts := make([]string, 0, len(s.pins))
+	for host := range s.pins {
+		hosts = append(hosts, host)
+	}
+	slices.Sort(hosts)
+	return hosts
+}
+
+// Pin pins the fingerprint for the host, replacing any previous pin, and
+// saves the trust store.
+func (s *TrustStore) Pin(host, fingerprint string) error {
+	if !strings.HasPrefix(fingerprint, fingerprintPrefix) || strings.ContainsAny(fingerprint, " \t") {
+		return fmt.Errorf("invalid fingerprint %q", fingerprint)
+	}
+	host = normalizeHost(host)
+	if host == "" || strings.ContainsAny(host, " \t#") {
+		return fmt.Errorf("invalid host %q", host)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pins[host] = fingerprint
+	return s.save()
+}
+
+// Remove removes the pin for the host and saves the trust store. Returns
+// false if there was no pin for the host.
+func (s *TrustStore) Remove(host string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	host = normalizeHost(host)
+	if _, ok := s.pins[host]; !ok {
+		return false, nil
+	}
+	delete(s.pins, host)
+	return true, s.save()
+}
+
+// TLSConfig returns a client TLS configuration that verifies the server key
+// with VerifyConnection, instead of verifying the certificate chain.
+// No application protocols (NextProtos) are set.
+func (s *TrustStore) TLSConfig() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true, // verified in VerifyConnection
+		VerifyConnection:   s.VerifyConnection,
+	}
+}
+
+// VerifyConnection verifies the key of the server against the key pinned for
+// the server name of the connection, and pins the key if the host is new.
+// It returns a *PinMismatchError if the key does not match.
+// This is intended to be used as tls.Config.VerifyConnection, see TLSConfig.
+func (s *TrustStore) VerifyConnection(cs tls.ConnectionState) error {
+	host := normalizeHost(cs.ServerName)
+	if host == "" {
+		return errors.New("no server name to verify the pinned key")
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no server certificate")
+	}
+	got := KeyFingerprint(cs.PeerCertificates[0])
+	s.mutex.Lock()
+	pinned, ok := s.pins[host]
+	s.mutex.Unlock()
+	if ok {
+		if pinned != got {
+			return &PinMismatchError{Host: host, Pinned: pinned, Got: got, Path: s.path}
+		}
+		return nil
+	}
+	if s.ConfirmNewHost != nil && !s.ConfirmNewHost(host, got) {
+		return ErrHostNotConfirmed
+	}
+	return s.Pin(host, got)
+}
+
+// save writes the trust store to its file. The caller must hold the mutex.
+func (s *TrustStore) save() error {
+	hosts := make([]string, 0, len(s.pins))
+	for host := range s.pins {
+		hosts = append(hosts, host)
+	}
+	slices.Sort(hosts)
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, "# Pinned QUIC server keys, see scion-quicpin")
+	for _, host := range hosts {
+		fmt.Fprintf(buf, "%s %s\n", host, s.pins[host])
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// normalizeHost returns the host in the form used as key in the trust store,
+// without the port; mangled SCION addresses, as used for the TLS server name,
+// are reverted.
+func normalizeHost(host string) string {
+	host = pan.UnmangleSCIONAddr(strings.TrimSpace(host))
+	if a, err := pan.ParseUDPAddr(host); err == nil {
+		return fmt.Sprintf("%s,%s", a.IA, a.IP)
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
@@ -0,0 +1,209 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quicutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+func mustGenerateLeaf(t *testing.T) *x509.Certificate {
+	t.Helper()
+	cert, err := GenerateSelfSignedCert()
+	require.NoError(t, err)
+	return cert.Leaf
+}
+
+func TestTrustStore(t *testing.T) {
+	host := "1-ff00:0:110,[10.0.0.1]:443"
+	fingerprint := "sha256:AAAA"
+
+	t.Run("load and save", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dir", "known_hosts")
+		s, err := LoadTrustStore(path)
+		require.NoError(t, err, "missing file is empty store")
+		assert.Empty(t, s.Hosts())
+
+		require.NoError(t, s.Pin(host, fingerprint))
+		require.NoError(t, s.Pin("example.org:443", "sha256:BBBB"))
+		assert.Error(t, s.Pin(host, "md5:AAAA"))
+		assert.Error(t, s.Pin("bad host", fingerprint))
+
+		s, err = LoadTrustStore(path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1-ff00:0:110,10.0.0.1", "example.org"}, s.Hosts(), "pinned without port")
+		for _, h := range []string{host, "1-ff00:0:110,10.0.0.1", "1-ff00:0:110,10.0.0.1:80", pan.MangleSCIONAddr(host)} {
+			got, ok := s.Lookup(h)
+			assert.True(t, ok, h)
+			assert.Equal(t, fingerprint, got, h)
+		}
+
+		ok, err := s.Remove(pan.MangleSCIONAddr(host))
+		require.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = s.Remove(host)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		s, err = LoadTrustStore(path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"example.org"}, s.Hosts())
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "known_hosts")
+		require.NoError(t, os.WriteFile(path, []byte("# comment\n\nexample.org:443\n"), 0o600))
+		_, err := LoadTrustStore(path)
+		assert.ErrorContains(t, err, ":3:")
+	})
+
+	t.Run("verify connection", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "known_hosts")
+		s, err := LoadTrustStore(path)
+		require.NoError(t, err)
+		leaf := mustGenerateLeaf(t)
+		// the server name, as set by pan.DialQUIC, does not contain the port
+		cs := tls.ConnectionState{
+			ServerName:       "1-ff00_0_110,10.0.0.1",
+			PeerCertificates: []*x509.Certificate{leaf},
+		}
+
+		require.NoError(t, s.VerifyConnection(cs), "first use")
+		pinned, ok := s.Lookup(host)
+		require.True(t, ok)
+		assert.Equal(t, KeyFingerprint(leaf), pinned)
+		assert.NoError(t, s.VerifyConnection(cs), "same key")
+
+		cs.PeerCertificates = []*x509.Certificate{mustGenerateLeaf(t)}
+		err = s.VerifyConnection(cs)
+		var mismatch *PinMismatchError
+		require.True(t, errors.As(err, &mismatch), "unexpected error %v", err)
+		assert.Equal(t, pinned, mismatch.Pinned)
+		assert.Equal(t, path, mismatch.Path)
+		assert.Contains(t, err.Error(), "scion-quicpin remove")
+
+		cs.ServerName = "example.org"
+		s.ConfirmNewHost = func(host, fingerprint string) bool { return false }
+		assert.ErrorIs(t, s.VerifyConnection(cs), ErrHostNotConfirmed)
+		_, ok = s.Lookup("example.org:443")
+		assert.False(t, ok)
+	})
+}
+
+const testTopology = `{
+  "isd_as": "1-ff00:0:110",
+  "mtu": 1472,
+  "dispatched_ports": "30041-30041",
+  "control_service": {
+    "cs1-ff00:0:110-1": {"addr": "127.0.0.1:31000"}
+  }
+}`
+
+var useTestTopologyOnce sync.Once
+
+// useTestTopology configures pan to run without a SCION daemon, in a local
+// AS without border routers. Within the local AS, packets are sent to the
+// end host port 30041, so the peers must listen on this port on different
+// loopback addresses.
+func useTestTopology(t *testing.T) {
+	t.Helper()
+	useTestTopologyOnce.Do(func() {
+		topologyFile := filepath.Join(t.TempDir(), "topology.json")
+		require.NoError(t, os.WriteFile(topologyFile, []byte(testTopology), 0o600))
+		require.NoError(t, pan.UseTopologyFile(topologyFile, pan.NewStaticPathProvider(nil)))
+	})
+}
+
+func TestTrustStoreDial(t *testing.T) {
+	useTestTopology(t)
+	cert := MustGenerateSelfSignedCert()
+	tlsConf := &tls.Config{
+		Certificates: cert,
+		NextProtos:   SingleStreamProtos,
+	}
+	ql, err := pan.ListenQUIC(context.Background(), netip.MustParseAddrPort("127.0.0.1:30041"), tlsConf, nil)
+	require.NoError(t, err)
+	l := &SingleStreamListener{QUICListener: ql}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	store, err := LoadTrustStore(filepath.Join(t.TempDir(), "known_hosts"))
+	require.NoError(t, err)
+	d := &pan.Dialer{
+		Local:     netip.MustParseAddrPort("127.0.0.2:30041"),
+		TLSConfig: store.TLSConfig(),
+		Timeout:   5 * time.Second,
+	}
+	address := l.Addr().String()
+	dial := func() error {
+		conn, err := d.DialContext(context.Background(), "quic", address)
+		if err != nil {
+			return err
+		}
+		return conn.(*SingleStream).CloseWithError(0x0, "ok")
+	}
+
+	// pinned with the address as dialed, like with scion-quicpin add
+	require.NoError(t, store.Pin(address, "sha256:AAAA"))
+	err = dial()
+	assert.ErrorContains(t, err, "does not match the key pinned")
+
+	ok, err := store.Remove(address)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, dial(), "first use")
+	assert.Equal(t, []string{"1-ff00:0:110,127.0.0.1"}, store.Hosts())
+	pinned, ok := store.Lookup(address)
+	require.True(t, ok)
+	assert.Equal(t, KeyFingerprint(cert[0].Leaf), pinned)
+	assert.NoError(t, dial(), "pinned key")
+}
+
+func TestLoadOrGenerateSelfSignedCert(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "server.key")
+	cert, err := LoadOrGenerateSelfSignedCert(keyFile)
+	require.NoError(t, err)
+	info, err := os.Stat(keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	again, err := LoadOrGenerateSelfSignedCert(keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, KeyFingerprint(cert.Leaf), KeyFingerprint(again.Leaf))
+
+	require.NoError(t, os.WriteFile(keyFile, []byte("garbage"), 0o600))
+	_, err = LoadOrGenerateSelfSignedCert(keyFile)
+	assert.Error(t, err)
+}
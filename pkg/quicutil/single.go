@@ -17,6 +17,7 @@ package quicutil
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"sync"
@@ -27,13 +28,22 @@ import (
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
 )
 
+// replyPather is implemented by a pan.ListenConn that reports the path used
+// to reply to a remote, like the ListenConn returned by pan.ListenUDP.
+type replyPather interface {
+	ReplyPath(remote pan.UDPAddr) *pan.Path
+}
+
 // quicConnection is an interface that abstracts over quic.Conn and pan.QUICConn.
 // This allows SingleStream to work with both raw QUIC connections and PAN-wrapped connections.
 type quicConnection interface {
 	LocalAddr() net.Addr
 	RemoteAddr() net.Addr
+	OpenStream() (*quic.Stream, error)
+	AcceptStream(context.Context) (*quic.Stream, error)
 	OpenUniStream() (*quic.SendStream, error)
 	AcceptUniStream(context.Context) (*quic.ReceiveStream, error)
+	ConnectionState() quic.ConnectionState
 	CloseWithError(quic.ApplicationErrorCode, string) error
 }
 
@@ -46,7 +56,8 @@ var (
 	// have any API that allows to wait until the send buffer is drained and save
 	// shutdown (of the UDP socket, or the application) is possible.
 	// See https://github.com/lucas-clemente/quic-go/issues/3291.
-	// TODO: simplify this once possible (as a protocol breaking change)
+	// TODO: drop the OK-signal once possible (as a protocol breaking change,
+	// see also SingleStreamProtoV2, which still needs it)
 	//
 	// The "protocol" is:
 	//  - each peer opens a unidirectional stream for sending data
@@ -55,22 +66,117 @@ var (
 	//    The signal is opening and directly closing a second unidirectional
 	//    stream.
 	SingleStreamProto = "qs"
+
+	// SingleStreamProtoV2 is the second version of SingleStreamProto, using a
+	// single bi-directional quic stream. Half-closing the stream maps
+	// directly to the FIN (CloseWrite) and STOP_SENDING (CloseRead) of the
+	// quic stream. This replaces the two unidirectional data streams of
+	// SingleStreamProto, and the workaround for the order in which these
+	// are opened and accepted.
+	//
+	// The OK-signal cannot be dropped in this version: closing the
+	// connection discards all data not yet acknowledged by the peer, and
+	// quic-go has no API to wait until the data and the FIN of a stream are
+	// acknowledged (the stream's Context is done on Close, not on
+	// acknowledgement). The acknowledgement must therefore come from the
+	// application of the peer.
+	//
+	// The "protocol" is:
+	//  - the dialing peer opens a bidirectional stream and writes a single
+	//    header byte (0x02) to it, so that the listening peer learns about
+	//    the stream before any data is sent.
+	//  - once the data was read in full, or reading was aborted (CloseRead),
+	//    each peer acknowledges this by opening and directly closing a
+	//    unidirectional stream (the OK-signal).
+	//  - a peer closes the connection with application error code 0 once it
+	//    has received the acknowledgement. The peer treats this as a successful
+	//    close, even if its own acknowledgement was still in flight.
+	//    Any other application error code and the reason are passed to the
+	//    peer, see SingleStream.CloseWithError.
+	SingleStreamProtoV2 = "qs2"
+
+	// SingleStreamProtos are the application protocols for SingleStream, in
+	// order of preference. Use this in the NextProtos of the tls.Config on
+	// both sides to negotiate SingleStreamProtoV2 with peers that support it,
+	// and fall back to SingleStreamProto otherwise.
+	SingleStreamProtos = []string{SingleStreamProtoV2, SingleStreamProto}
+)
+
+const (
+	singleStreamV2Header = 0x02
+	// singleStreamHeaderTimeout is the time a SingleStreamListener waits for
+	// the stream of a new SingleStreamProtoV2 connection, before closing it.
+	singleStreamHeaderTimeout = 10 * time.Second
 )
 
+func init() {
+	pan.RegisterQUICNetwork("quic", pan.QUICNetwork{
+		NextProtos: SingleStreamProtos,
+		NewConn: func(connection *pan.QUICConn) (net.Conn, error) {
+			return NewSingleStream(connection)
+		},
+	})
+}
+
 // SingleStreamListener is a wrapper for a quic.Listener, returning
 // SingleStream connections from Accept. This allows to use quic in contexts
 // where a (TCP-)net.Listener is expected.
+//
+// Connections are accepted in the background once Accept is first called,
+// so that a client that does not open its stream does not hold up others.
+// A SingleStreamListener must not be copied after first use.
 type SingleStreamListener struct {
 	*pan.QUICListener
+
+	acceptOnce sync.Once
+	streams    chan *SingleStream
+	ctx        context.Context // done once the listener failed, with err
+	cancel     context.CancelFunc
+	err        error
 }
 
-func (l SingleStreamListener) Accept() (net.Conn, error) {
-	ctx := context.Background()
-	connection, err := l.Listener.Accept(ctx)
+func (l *SingleStreamListener) Accept() (net.Conn, error) {
+	l.acceptOnce.Do(func() {
+		l.streams = make(chan *SingleStream)
+		l.ctx, l.cancel = context.WithCancel(context.Background())
+		go l.acceptConnections()
+	})
+	select {
+	case s := <-l.streams:
+		return s, nil
+	case <-l.ctx.Done():
+		return nil, l.err
+	}
+}
+
+// acceptConnections accepts the connections of the listener and waits for
+// their streams, each in its own goroutine.
+func (l *SingleStreamListener) acceptConnections() {
+	for {
+		connection, err := l.Listener.Accept(context.Background())
+		if err != nil {
+			l.err = err
+			l.cancel()
+			return
+		}
+		go l.acceptStream(connection)
+	}
+}
+
+func (l *SingleStreamListener) acceptStream(connection *quic.Conn) {
+	ctx, cancel := context.WithTimeout(l.ctx, singleStreamHeaderTimeout)
+	s, err := AcceptSingleStream(ctx, connection)
+	cancel()
 	if err != nil {
-		return nil, err
+		_ = connection.CloseWithError(0x101, "stream error")
+		return
+	}
+	s.replyPather, _ = l.Conn.(replyPather)
+	select {
+	case l.streams <- s:
+	case <-l.ctx.Done():
+		_ = connection.CloseWithError(0x0, "ok")
 	}
-	return NewSingleStream(connection)
 }
 
 // SingleStream implements an opaque, bi-directional data stream using QUIC,
@@ -80,17 +186,38 @@ func (l SingleStreamListener) Accept() (net.Conn, error) {
 //   - on the client side: quic.Dial and then immediately NewSingleStream(sess)
 //     with the obtained connection
 //   - on the listener side: quic.Listener wrapped in SingleStreamListener, which
-//     returns SingleStream from Accept.
+//     returns SingleStream from Accept, or AcceptSingleStream with the
+//     accepted connection.
+//
+// The protocol version, SingleStreamProto or SingleStreamProtoV2, is
+// determined by the application protocol negotiated in the TLS handshake.
 type SingleStream struct {
 	Connection    quicConnection
+	stream        *quic.Stream // only for SingleStreamProtoV2
 	sendStream    *quic.SendStream
 	receiveStream *quic.ReceiveStream
+	replyPather   replyPather // for the reply path, only from SingleStreamListener
 	readDeadline  time.Time
 	mutex         sync.Mutex // mutex protects receiveStream for await
 	onceOK        sync.Once
 }
 
+// NewSingleStream returns the SingleStream on a newly established connection.
+// For SingleStreamProtoV2, this must only be used on the dialing side.
 func NewSingleStream(connection quicConnection) (*SingleStream, error) {
+	if negotiatedV2(connection) {
+		stream, err := connection.OpenStream()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := stream.Write([]byte{singleStreamV2Header}); err != nil {
+			return nil, err
+		}
+		return &SingleStream{
+			Connection: connection,
+			stream:     stream,
+		}, nil
+	}
 	sendStream, err := connection.OpenUniStream()
 	if err != nil {
 		return nil, err
@@ -102,23 +229,67 @@ func NewSingleStream(connection quicConnection) (*SingleStream, error) {
 	}, nil
 }
 
+// AcceptSingleStream returns the SingleStream on a connection accepted by a
+// quic.Listener. For SingleStreamProtoV2, this waits for the stream opened
+// by the dialing peer, until the context is done.
+func AcceptSingleStream(ctx context.Context, connection quicConnection) (*SingleStream, error) {
+	if !negotiatedV2(connection) {
+		return NewSingleStream(connection)
+	}
+	stream, err := acceptSingleStreamV2(ctx, connection)
+	if err != nil {
+		_ = connection.CloseWithError(0x101, "stream error")
+		return nil, err
+	}
+	return &SingleStream{
+		Connection: connection,
+		stream:     stream,
+	}, nil
+}
+
+func acceptSingleStreamV2(ctx context.Context, connection quicConnection) (*quic.Stream, error) {
+	stream, err := connection.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetReadDeadline(deadline)
+	}
+	var header [1]byte
+	if _, err := io.ReadFull(stream, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != singleStreamV2Header {
+		return nil, fmt.Errorf("invalid stream header %#x", header[0])
+	}
+	return stream, stream.SetReadDeadline(time.Time{})
+}
+
+func negotiatedV2(connection quicConnection) bool {
+	return connection.ConnectionState().TLS.NegotiatedProtocol == SingleStreamProtoV2
+}
+
 func (s *SingleStream) LocalAddr() net.Addr {
 	return s.Connection.LocalAddr()
 }
 
+// GetPath returns the path currently used to send to the peer; on the dialing
+// side the path of the pan.QUICConn, on the listener side the reply path of
+// the SingleStreamListener. Returns nil if the path is unknown, or if the
+// peer is in the local AS.
 func (s *SingleStream) GetPath() *pan.Path {
 	if s.Connection == nil {
 		// XXX(JordiSubira): To be refactored when proper support
 		// for retrieving path information.
 		return nil
 	}
-	quicConn, ok := s.Connection.(*pan.QUICConn)
-	if !ok {
-		// XXX(JordiSubira): To be refactored when proper support
-		// for retrieving path information.
-		return nil
+	if quicConn, ok := s.Connection.(*pan.QUICConn); ok {
+		return quicConn.UnderlayConn.GetPath()
+	}
+	if remote, ok := s.Connection.RemoteAddr().(pan.UDPAddr); ok && s.replyPather != nil {
+		return s.replyPather.ReplyPath(remote)
 	}
-	return quicConn.UnderlayConn.GetPath()
+	return nil
 }
 
 func (s *SingleStream) RemoteAddr() net.Addr {
@@ -129,6 +300,9 @@ func (s *SingleStream) SetDeadline(t time.Time) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.readDeadline = t
+	if s.stream != nil {
+		return s.stream.SetDeadline(t)
+	}
 	if s.receiveStream != nil {
 		return s.receiveStream.SetReadDeadline(t)
 	}
@@ -139,6 +313,9 @@ func (s *SingleStream) SetReadDeadline(t time.Time) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.readDeadline = t
+	if s.stream != nil {
+		return s.stream.SetReadDeadline(t)
+	}
 	if s.receiveStream != nil {
 		return s.receiveStream.SetReadDeadline(t)
 	}
@@ -146,15 +323,23 @@ func (s *SingleStream) SetReadDeadline(t time.Time) error {
 }
 
 func (s *SingleStream) SetWriteDeadline(t time.Time) error {
+	if s.stream != nil {
+		return s.stream.SetWriteDeadline(t)
+	}
 	return s.sendStream.SetWriteDeadline(t)
 }
 
 func (s *SingleStream) Read(p []byte) (int, error) {
-	err := s.awaitReceiveStream()
-	if err != nil {
-		return 0, err
+	var n int
+	var err error
+	if s.stream != nil {
+		n, err = s.stream.Read(p)
+	} else {
+		if err := s.awaitReceiveStream(); err != nil {
+			return 0, err
+		}
+		n, err = s.receiveStream.Read(p)
 	}
-	n, err := s.receiveStream.Read(p)
 	if errors.Is(err, io.EOF) || (n == 0 && err != nil) {
 		s.sendOKSignal()
 	}
@@ -162,6 +347,9 @@ func (s *SingleStream) Read(p []byte) (int, error) {
 }
 
 func (s *SingleStream) Write(p []byte) (int, error) {
+	if s.stream != nil {
+		return s.stream.Write(p)
+	}
 	return s.sendStream.Write(p)
 }
 
@@ -201,7 +389,7 @@ func (s *SingleStream) awaitOKSignal(ctx context.Context) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	// ensure we've accepted the actual receive stream first.
-	if s.receiveStream == nil {
+	if s.stream == nil && s.receiveStream == nil {
 		stream, err := s.Connection.AcceptUniStream(ctx)
 		if err != nil {
 			return err
@@ -222,7 +410,9 @@ func (s *SingleStream) awaitOKSignal(ctx context.Context) error {
 func (s *SingleStream) CloseRead() error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	if s.receiveStream != nil {
+	if s.stream != nil {
+		s.stream.CancelRead(quic.StreamErrorCode(0x0))
+	} else if s.receiveStream != nil {
 		s.receiveStream.CancelRead(quic.StreamErrorCode(0x0))
 	}
 	s.sendOKSignal()
@@ -232,6 +422,9 @@ func (s *SingleStream) CloseRead() error {
 // CloseWrite closes the stream for writing.
 // This is analogous e.g. to net.TCPConn.CloseWrite
 func (s *SingleStream) CloseWrite() error {
+	if s.stream != nil {
+		return s.stream.Close()
+	}
 	return s.sendStream.Close()
 }
 
@@ -247,11 +440,31 @@ func (s *SingleStream) CloseSync(ctx context.Context) error {
 	_ = s.CloseRead()
 	// Await the OK-signal
 	if err := s.awaitOKSignal(ctx); err != nil {
+		if s.stream != nil && isClosedByPeer(err) {
+			_ = s.Connection.CloseWithError(0x0, "ok") // release resources
+			return nil
+		}
 		return s.Connection.CloseWithError(0x101, "shutdown error")
 	}
 	return s.Connection.CloseWithError(0x0, "ok")
 }
 
+// CloseWithError aborts the stream and closes the connection immediately,
+// without waiting for outstanding data to be delivered. The code and the
+// reason are passed to the peer; its pending and subsequent operations fail
+// with a *quic.ApplicationError.
+func (s *SingleStream) CloseWithError(code quic.ApplicationErrorCode, reason string) error {
+	return s.Connection.CloseWithError(code, reason)
+}
+
+// isClosedByPeer returns true if err signals that the peer has closed the
+// connection with application error code 0, i.e. after the OK-signal of
+// SingleStreamProtoV2.
+func isClosedByPeer(err error) bool {
+	var appErr *quic.ApplicationError
+	return errors.As(err, &appErr) && appErr.Remote && appErr.ErrorCode == 0x0
+}
+
 func (s *SingleStream) Close() error {
 	ctx := context.Background()
 	// Block until read deadline -- a bit arbitrary, but ok?
@@ -0,0 +1,192 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quicutil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// newTestQUICListener returns a QUIC listener on a plain UDP socket on
+// loopback, wrapped as a pan.QUICListener.
+func newTestQUICListener(t *testing.T, nextProtos []string) *pan.QUICListener {
+	t.Helper()
+	return newTestQUICListenerWithConfig(t, nextProtos, nil)
+}
+
+// newTestQUICListenerWithConfig is newTestQUICListener with a quic.Config.
+func newTestQUICListenerWithConfig(t *testing.T, nextProtos []string, quicConf *quic.Config) *pan.QUICListener {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	tlsConf := &tls.Config{
+		Certificates: MustGenerateSelfSignedCert(),
+		NextProtos:   nextProtos,
+	}
+	ql, err := quic.Listen(conn, tlsConf, quicConf)
+	require.NoError(t, err)
+	l := &pan.QUICListener{Listener: ql, Conn: conn}
+	t.Cleanup(func() { _ = l.Close() })
+	return l
+}
+
+func dialTestSingleStream(t *testing.T, address string, nextProtos []string) *SingleStream {
+	t.Helper()
+	tlsConf := &tls.Config{InsecureSkipVerify: true, NextProtos: nextProtos}
+	conn, err := quic.DialAddr(context.Background(), address, tlsConf, nil)
+	require.NoError(t, err)
+	s, err := NewSingleStream(conn)
+	require.NoError(t, err)
+	return s
+}
+
+func TestSingleStream(t *testing.T) {
+	cases := []struct {
+		name           string
+		listenerProtos []string
+		dialerProtos   []string
+		v2             bool
+	}{
+		{"v2", SingleStreamProtos, SingleStreamProtos, true},
+		{"v1 dialer", SingleStreamProtos, []string{SingleStreamProto}, false},
+		{"v1 listener", []string{SingleStreamProto}, SingleStreamProtos, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l := &SingleStreamListener{QUICListener: newTestQUICListener(t, c.listenerProtos)}
+			serverErr := make(chan error, 1)
+			go func() {
+				serverErr <- func() error {
+					conn, err := l.Accept()
+					if err != nil {
+						return err
+					}
+					// the listener writes first
+					if _, err := conn.Write([]byte("hello ")); err != nil {
+						return err
+					}
+					request, err := io.ReadAll(conn)
+					if err != nil {
+						return err
+					}
+					if _, err := conn.Write(request); err != nil {
+						return err
+					}
+					return conn.Close()
+				}()
+			}()
+
+			s := dialTestSingleStream(t, l.Addr().String(), c.dialerProtos)
+			assert.Equal(t, c.v2, s.stream != nil)
+			require.NoError(t, s.SetDeadline(time.Now().Add(5*time.Second)))
+			_, err := s.Write([]byte("world"))
+			require.NoError(t, err)
+			require.NoError(t, s.CloseWrite())
+			response, err := io.ReadAll(s)
+			require.NoError(t, err)
+			assert.Equal(t, "hello world", string(response))
+			assert.NoError(t, s.Close())
+			assert.NoError(t, <-serverErr)
+		})
+	}
+}
+
+func TestSingleStreamCloseWithError(t *testing.T) {
+	l := &SingleStreamListener{QUICListener: newTestQUICListener(t, SingleStreamProtos)}
+	s := dialTestSingleStream(t, l.Addr().String(), SingleStreamProtos)
+	_, err := s.Write([]byte("x"))
+	require.NoError(t, err)
+
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	require.NoError(t, conn.(*SingleStream).CloseWithError(0x42, "go away"))
+
+	require.NoError(t, s.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = io.ReadAll(s)
+	var appErr *quic.ApplicationError
+	require.True(t, errors.As(err, &appErr), "unexpected error %v", err)
+	assert.True(t, appErr.Remote)
+	assert.Equal(t, quic.ApplicationErrorCode(0x42), appErr.ErrorCode)
+	assert.Equal(t, "go away", appErr.ErrorMessage)
+}
+
+func TestSingleStreamListenerSilentClient(t *testing.T) {
+	l := &SingleStreamListener{QUICListener: newTestQUICListener(t, SingleStreamProtos)}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	// completes the handshake, but never opens the stream
+	tlsConf := &tls.Config{InsecureSkipVerify: true, NextProtos: SingleStreamProtos}
+	silent, err := quic.DialAddr(context.Background(), l.Addr().String(), tlsConf, nil)
+	require.NoError(t, err)
+	defer silent.CloseWithError(0x0, "ok")
+	time.Sleep(10 * time.Millisecond)
+
+	good := dialTestSingleStream(t, l.Addr().String(), SingleStreamProtos)
+	defer good.CloseWithError(0x0, "ok")
+	select {
+	case conn := <-accepted:
+		defer conn.(*SingleStream).CloseWithError(0x0, "ok")
+		assert.Equal(t, good.LocalAddr().(*net.UDPAddr).Port, conn.RemoteAddr().(*net.UDPAddr).Port)
+	case <-time.After(time.Second):
+		t.Fatal("accept blocked by client not opening its stream")
+	}
+
+	require.NoError(t, l.Close())
+	_, err = l.Accept()
+	assert.Error(t, err, "closed listener")
+}
+
+func TestSingleStreamListenerInvalidHeader(t *testing.T) {
+	l := &SingleStreamListener{QUICListener: newTestQUICListener(t, SingleStreamProtos)}
+	tlsConf := &tls.Config{InsecureSkipVerify: true, NextProtos: SingleStreamProtos}
+
+	bad, err := quic.DialAddr(context.Background(), l.Addr().String(), tlsConf, nil)
+	require.NoError(t, err)
+	stream, err := bad.OpenStream()
+	require.NoError(t, err)
+	_, err = stream.Write([]byte("GET /"))
+	require.NoError(t, err)
+
+	good := dialTestSingleStream(t, l.Addr().String(), SingleStreamProtos)
+	defer good.CloseWithError(0x0, "ok")
+	_, err = good.Write([]byte("x"))
+	require.NoError(t, err)
+
+	conn, err := l.Accept()
+	require.NoError(t, err, "listener not failed by invalid connection")
+	defer conn.(*SingleStream).CloseWithError(0x0, "ok")
+	assert.Equal(t, good.LocalAddr().(*net.UDPAddr).Port, conn.RemoteAddr().(*net.UDPAddr).Port)
+	select {
+	case <-bad.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("invalid connection not closed")
+	}
+}
@@ -22,8 +22,11 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"math/big"
+	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -49,6 +52,67 @@ func GenerateSelfSignedCert() (*tls.Certificate, error) {
 	return createCertificate(priv)
 }
 
+// LoadOrGenerateSelfSignedCert returns a self-signed dummy certificate for the
+// private key in keyFile. If the file does not exist, a new key is generated
+// and stored in keyFile.
+// Unlike with GenerateSelfSignedCert, the key, and so its fingerprint, stays
+// the same across restarts of a server; clients can pin it, see TrustStore.
+func LoadOrGenerateSelfSignedCert(keyFile string) (*tls.Certificate, error) {
+	priv, err := loadKey(keyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		priv, err = rsaGenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		err = storeKey(keyFile, priv)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return createCertificate(priv)
+}
+
+func loadKey(keyFile string) (*rsa.PrivateKey, error) {
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("no PEM encoded private key in %s", keyFile)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key in %s: %w", keyFile, err)
+	}
+	priv, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T in %s", key, keyFile)
+	}
+	return priv, nil
+}
+
+func storeKey(keyFile string, priv *rsa.PrivateKey) error {
+	privBytes, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return fmt.Errorf("unable to marshal private key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0o700); err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes})
+	// O_EXCL: don't overwrite a key created concurrently
+	f, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(keyPEM); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func rsaGenerateKey() (*rsa.PrivateKey, error) {
 	return rsa.GenerateKey(rand.Reader, 2048)
 }
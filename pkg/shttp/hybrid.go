@@ -0,0 +1,358 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+const (
+	// StrictSCIONHeader is the response header with which a server declares
+	// that it must only be contacted over SCION. The directives are as for the
+	// Strict-Transport-Security header (HSTS): max-age=<seconds> and,
+	// optionally, includeSubDomains.
+	StrictSCIONHeader = "Strict-SCION"
+
+	// DefaultHeadStart is the default time by which a HybridTransport starts
+	// dialing a host over SCION before it also dials over TCP/IP.
+	DefaultHeadStart = 300 * time.Millisecond
+	// DefaultHybridCacheTTL is the default time for which a HybridTransport
+	// remembers whether a host was reached over SCION or over TCP/IP.
+	DefaultHybridCacheTTL = 10 * time.Minute
+)
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// HybridTransport is a RoundTripper for HTTP that prefers SCION and falls back
+// to TCP/IP. For a new host, a dial over SCION (resolved with the pan
+// resolver) races against a TCP dial (resolved with DNS), which is started
+// after a head start of the SCION dial, or as soon as the SCION dial fails,
+// e.g. because the host has no SCION address. The first established connection
+// is used, and the winner is remembered for the host.
+//
+// A host that sends the Strict-SCION header over SCION is, like with HSTS,
+// only contacted over SCION until the directive expires.
+//
+// The zero value is ready to use.
+type HybridTransport struct {
+	// SCIONDialer dials the connections over SCION. If nil, a Dialer with
+	// the default configuration is used.
+	SCIONDialer *Dialer
+	// IPDialer dials the TCP connections. If nil, a net.Dialer with the
+	// configuration of net/http.DefaultTransport is used.
+	IPDialer *net.Dialer
+	// HeadStart is the time by which the SCION dial is started before the
+	// TCP dial. If zero, DefaultHeadStart is used; if negative, both dials are
+	// started at once.
+	HeadStart time.Duration
+	// CacheTTL is the time for which the result of a race is remembered for
+	// a host. If zero, DefaultHybridCacheTTL is used.
+	CacheTTL time.Duration
+
+	initOnce  sync.Once
+	scionDial dialFunc
+	ipDial    dialFunc
+	hybrid    *http.Transport
+	scion     *http.Transport
+
+	mutex  sync.Mutex
+	hosts  map[string]hybridHost
+	strict map[string]strictHost
+	now    func() time.Time // for testing; time.Now if nil
+}
+
+// hybridHost is the remembered result of a race for a host.
+type hybridHost struct {
+	scion   bool
+	expires time.Time
+}
+
+// strictHost is a Strict-SCION directive received from a host.
+type strictHost struct {
+	includeSubDomains bool
+	expires           time.Time
+}
+
+func (t *HybridTransport) init() {
+	t.initOnce.Do(func() {
+		if t.scionDial == nil {
+			d := t.SCIONDialer
+			if d == nil {
+				d = &Dialer{}
+			}
+			t.scionDial = d.DialContext
+		}
+		if t.ipDial == nil {
+			d := t.IPDialer
+			if d == nil {
+				d = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+			}
+			t.ipDial = d.DialContext
+		}
+		t.hybrid = DefaultTransport.Clone()
+		t.hybrid.DialContext = t.dial
+		t.scion = DefaultTransport.Clone()
+		t.scion.DialContext = t.scionDial
+	})
+}
+
+// RoundTrip implements http.RoundTripper. Requests to hosts that declared
+// Strict-SCION are only sent over SCION.
+func (t *HybridTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.init()
+	host := req.URL.Hostname()
+	transport := t.hybrid
+	if t.IsStrict(host) {
+		transport = t.scion
+	}
+	var overSCION atomic.Bool
+	ctx := httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			_, ok := info.Conn.RemoteAddr().(pan.UDPAddr)
+			overSCION.Store(ok)
+		},
+	})
+	resp, err := transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if value := resp.Header.Get(StrictSCIONHeader); value != "" && overSCION.Load() {
+		t.setStrict(host, value)
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections over SCION and TCP/IP.
+func (t *HybridTransport) CloseIdleConnections() {
+	t.init()
+	t.hybrid.CloseIdleConnections()
+	t.scion.CloseIdleConnections()
+}
+
+// IsStrict returns whether the host declared, with the Strict-SCION header,
+// that it must only be contacted over SCION.
+func (t *HybridTransport) IsStrict(host string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := t.currentTime()
+	if s, ok := t.strict[host]; ok && now.Before(s.expires) {
+		return true
+	}
+	for domain := host; ; {
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			return false
+		}
+		domain = domain[i+1:]
+		if s, ok := t.strict[domain]; ok && s.includeSubDomains && now.Before(s.expires) {
+			return true
+		}
+	}
+}
+
+func (t *HybridTransport) setStrict(host, value string) {
+	maxAge, includeSubDomains, err := parseStrictSCION(value)
+	if err != nil {
+		return // invalid header is ignored, as for HSTS
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if maxAge == 0 {
+		delete(t.strict, host)
+		return
+	}
+	if t.strict == nil {
+		t.strict = make(map[string]strictHost)
+	}
+	t.strict[host] = strictHost{
+		includeSubDomains: includeSubDomains,
+		expires:           t.currentTime().Add(maxAge),
+	}
+}
+
+// parseStrictSCION parses the value of the Strict-SCION header, with the
+// syntax of the Strict-Transport-Security header.
+func parseStrictSCION(value string) (maxAge time.Duration, includeSubDomains bool, err error) {
+	hasMaxAge := false
+	for _, directive := range strings.Split(value, ";") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "max-age":
+			seconds, err := strconv.ParseUint(strings.Trim(strings.TrimSpace(arg), `"`), 10, 32)
+			if err != nil {
+				return 0, false, fmt.Errorf("invalid max-age %q", arg)
+			}
+			maxAge = time.Duration(seconds) * time.Second
+			hasMaxAge = true
+		case "includesubdomains":
+			includeSubDomains = true
+		}
+	}
+	if !hasMaxAge {
+		return 0, false, errors.New("missing max-age")
+	}
+	return maxAge, includeSubDomains, nil
+}
+
+// dial dials addr over SCION or TCP/IP, as remembered for the host or else by
+// racing both.
+func (t *HybridTransport) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pan.ParseUDPAddr(pan.UnmangleSCIONAddr(addr)); err == nil {
+		return t.scionDial(ctx, network, addr) // raw SCION address
+	}
+	if t.IsStrict(host) {
+		return t.scionDial(ctx, network, addr)
+	}
+	if scion, ok := t.cached(host); ok {
+		dial := t.ipDial
+		if scion {
+			dial = t.scionDial
+		}
+		if conn, err := dial(ctx, network, addr); err == nil {
+			return conn, nil
+		}
+		t.forget(host)
+	}
+	conn, scion, err := t.race(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	t.remember(host, scion)
+	return conn, nil
+}
+
+type dialResult struct {
+	conn  net.Conn
+	scion bool
+	err   error
+}
+
+// race dials addr over SCION and, after the head start, over TCP/IP, and
+// returns the first established connection.
+func (t *HybridTransport) race(ctx context.Context, network, addr string) (net.Conn, bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, 2)
+	dial := func(scion bool) {
+		dial, name := t.ipDial, "TCP/IP"
+		if scion {
+			dial, name = t.scionDial, "SCION"
+		}
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			err = fmt.Errorf("dialing over %s: %w", name, err)
+		}
+		results <- dialResult{conn: conn, scion: scion, err: err}
+	}
+	go dial(true)
+	pending, ipStarted := 1, false
+	startIP := func() {
+		if !ipStarted {
+			ipStarted = true
+			pending++
+			go dial(false)
+		}
+	}
+
+	headStart := time.NewTimer(t.headStart())
+	defer headStart.Stop()
+	var errs []error
+	for {
+		select {
+		case <-headStart.C:
+			startIP()
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				go closeLosers(results, pending)
+				return r.conn, r.scion, nil
+			}
+			errs = append(errs, r.err)
+			startIP()
+			if pending == 0 {
+				return nil, false, errors.Join(errs...)
+			}
+		}
+	}
+}
+
+// closeLosers closes the connections of the pending dials that lost a race.
+func closeLosers(results <-chan dialResult, pending int) {
+	for i := 0; i < pending; i++ {
+		if r := <-results; r.err == nil {
+			_ = r.conn.Close()
+		}
+	}
+}
+
+func (t *HybridTransport) headStart() time.Duration {
+	if t.HeadStart == 0 {
+		return DefaultHeadStart
+	}
+	return t.HeadStart
+}
+
+func (t *HybridTransport) cached(host string) (scion bool, ok bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	h, ok := t.hosts[host]
+	if !ok || !t.currentTime().Before(h.expires) {
+		return false, false
+	}
+	return h.scion, true
+}
+
+func (t *HybridTransport) remember(host string, scion bool) {
+	ttl := t.CacheTTL
+	if ttl == 0 {
+		ttl = DefaultHybridCacheTTL
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.hosts == nil {
+		t.hosts = make(map[string]hybridHost)
+	}
+	t.hosts[host] = hybridHost{scion: scion, expires: t.currentTime().Add(ttl)}
+}
+
+func (t *HybridTransport) forget(host string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.hosts, host)
+}
+
+func (t *HybridTransport) currentTime() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
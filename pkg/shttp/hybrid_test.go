@@ -0,0 +1,190 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+func TestParseStrictSCION(t *testing.T) {
+	testCases := []struct {
+		value             string
+		maxAge            time.Duration
+		includeSubDomains bool
+		valid             bool
+	}{
+		{"max-age=3600", time.Hour, false, true},
+		{`max-age="60"; includeSubDomains`, time.Minute, true, true},
+		{" IncludeSubDomains ; Max-Age=0", 0, true, true},
+		{"includeSubDomains", 0, false, false},
+		{"max-age=-1", 0, false, false},
+		{"max-age=soon", 0, false, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			maxAge, includeSubDomains, err := parseStrictSCION(tc.value)
+			if !tc.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.maxAge, maxAge)
+			assert.Equal(t, tc.includeSubDomains, includeSubDomains)
+		})
+	}
+}
+
+// hybridTest is a HybridTransport for which the SCION and the TCP/IP
+// connections go to two local test servers, which reply with "scion" and "ip".
+type hybridTest struct {
+	transport   *HybridTransport
+	scionDelay  atomic.Int64 // time.Duration
+	scionFail   atomic.Bool
+	scionDials  atomic.Int32
+	ipDials     atomic.Int32
+	strict      atomic.Value // string, Strict-SCION header of the SCION server
+	currentTime time.Time
+}
+
+func newHybridTest(t *testing.T) *hybridTest {
+	ht := &hybridTest{currentTime: time.Now()}
+	ht.strict.Store("")
+	scionServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strict := ht.strict.Load().(string); strict != "" {
+			w.Header().Set(StrictSCIONHeader, strict)
+		}
+		_, _ = io.WriteString(w, "scion")
+	}))
+	t.Cleanup(scionServer.Close)
+	ipServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(StrictSCIONHeader, "max-age=3600")
+		_, _ = io.WriteString(w, "ip")
+	}))
+	t.Cleanup(ipServer.Close)
+
+	remote, err := pan.ParseUDPAddr("1-ff00:0:110,127.0.0.1:80")
+	require.NoError(t, err)
+	ht.transport = &HybridTransport{
+		HeadStart: 50 * time.Millisecond,
+		CacheTTL:  time.Minute,
+		now:       func() time.Time { return ht.currentTime },
+		scionDial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			ht.scionDials.Add(1)
+			select {
+			case <-time.After(time.Duration(ht.scionDelay.Load())):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if ht.scionFail.Load() {
+				return nil, errors.New("no SCION")
+			}
+			conn, err := net.Dial("tcp", scionServer.Listener.Addr().String())
+			if err != nil {
+				return nil, err
+			}
+			return &pathConn{Conn: conn, remote: remote}, nil
+		},
+		ipDial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			ht.ipDials.Add(1)
+			return net.Dial("tcp", ipServer.Listener.Addr().String())
+		},
+	}
+	t.Cleanup(ht.transport.CloseIdleConnections)
+	return ht
+}
+
+func (ht *hybridTest) get(t *testing.T, host string) (string, error) {
+	t.Helper()
+	ht.transport.CloseIdleConnections() // dial for every request
+	client := &http.Client{Transport: ht.transport}
+	resp, err := client.Get("http://" + host + "/")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body), nil
+}
+
+func TestHybridTransport(t *testing.T) {
+	t.Run("prefer SCION", func(t *testing.T) {
+		ht := newHybridTest(t)
+		body, err := ht.get(t, "www.example.org")
+		require.NoError(t, err)
+		assert.Equal(t, "scion", body)
+		assert.EqualValues(t, 0, ht.ipDials.Load(), "SCION wins within head start")
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		ht := newHybridTest(t)
+		ht.scionDelay.Store(int64(time.Second))
+		body, err := ht.get(t, "www.example.org")
+		require.NoError(t, err)
+		assert.Equal(t, "ip", body, "slow SCION")
+		assert.False(t, ht.transport.IsStrict("www.example.org"), "Strict-SCION over IP ignored")
+
+		ht.scionDelay.Store(0)
+		body, err = ht.get(t, "www.example.org")
+		require.NoError(t, err)
+		assert.Equal(t, "ip", body, "cached")
+		assert.EqualValues(t, 1, ht.scionDials.Load())
+
+		ht.currentTime = ht.currentTime.Add(2 * time.Minute)
+		body, err = ht.get(t, "www.example.org")
+		require.NoError(t, err)
+		assert.Equal(t, "scion", body, "cache expired")
+
+		ht.scionFail.Store(true)
+		body, err = ht.get(t, "other.example.org")
+		require.NoError(t, err)
+		assert.Equal(t, "ip", body, "no SCION")
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		ht := newHybridTest(t)
+		ht.strict.Store("max-age=3600; includeSubDomains")
+		body, err := ht.get(t, "example.org")
+		require.NoError(t, err)
+		assert.Equal(t, "scion", body)
+		assert.True(t, ht.transport.IsStrict("example.org"))
+		assert.True(t, ht.transport.IsStrict("www.example.org"))
+		assert.False(t, ht.transport.IsStrict("example.com"))
+
+		ht.scionFail.Store(true)
+		_, err = ht.get(t, "www.example.org")
+		assert.Error(t, err, "never over IP")
+		assert.EqualValues(t, 0, ht.ipDials.Load())
+
+		ht.currentTime = ht.currentTime.Add(2 * time.Hour)
+		assert.False(t, ht.transport.IsStrict("example.org"), "expired")
+		body, err = ht.get(t, "www.example.org")
+		require.NoError(t, err)
+		assert.Equal(t, "ip", body)
+	})
+}
@@ -0,0 +1,123 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shttp
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/scionproto/scion/pkg/addr"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+type peerContextKey struct{}
+
+type peer struct {
+	addr pan.UDPAddr
+	path func() *pan.Path
+}
+
+// ConnContext attaches the SCION address of the peer and its path, if the
+// connection provides it (GetPath, like quicutil.SingleStream), to the
+// context. Requests on the connection can then be inspected with PeerAddr and
+// PeerPath. This is used as http.Server.ConnContext by Server.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	remote, ok := c.RemoteAddr().(pan.UDPAddr)
+	if !ok {
+		return ctx
+	}
+	var path func() *pan.Path
+	if pc, ok := c.(interface{ GetPath() *pan.Path }); ok {
+		path = pc.GetPath
+	}
+	return ContextWithPeer(ctx, remote, path)
+}
+
+// ContextWithPeer returns a copy of ctx with the SCION address of the peer
+// and a function returning the current path to the peer, as read by PeerAddr
+// and PeerPath. path may be nil.
+func ContextWithPeer(ctx context.Context, remote pan.UDPAddr, path func() *pan.Path) context.Context {
+	return context.WithValue(ctx, peerContextKey{}, peer{addr: remote, path: path})
+}
+
+// PeerAddr returns the SCION address of the client that sent the request to
+// a Server (or shttp3.Server). Returns false if the request was not received
+// over SCION.
+func PeerAddr(r *http.Request) (pan.UDPAddr, bool) {
+	p, ok := r.Context().Value(peerContextKey{}).(peer)
+	return p.addr, ok
+}
+
+// PeerPath returns the path currently used to reply to the client that sent
+// the request to a Server (or shttp3.Server). This path can change during the
+// lifetime of the connection. Returns nil if the path is unknown, or if the
+// client is in the local AS.
+func PeerPath(r *http.Request) *pan.Path {
+	p, ok := r.Context().Value(peerContextKey{}).(peer)
+	if !ok || p.path == nil {
+		return nil
+	}
+	return p.path()
+}
+
+// IARules are access rules by the ISD-AS of the client, see RestrictIA.
+type IARules struct {
+	// Allow lists the ISD-ASes from which requests are accepted. If empty,
+	// requests from all ISD-ASes not in Deny are accepted. An ISD or AS of 0
+	// is a wildcard, e.g. 1-0 matches all ASes in ISD 1.
+	Allow []pan.IA
+	// Deny lists the ISD-ASes from which requests are rejected. Takes
+	// precedence over Allow. Wildcards as for Allow.
+	Deny []pan.IA
+}
+
+// Allows returns whether the rules accept requests from ia.
+func (rules IARules) Allows(ia pan.IA) bool {
+	for _, d := range rules.Deny {
+		if iaMatches(d, ia) {
+			return false
+		}
+	}
+	if len(rules.Allow) == 0 {
+		return true
+	}
+	for _, a := range rules.Allow {
+		if iaMatches(a, ia) {
+			return true
+		}
+	}
+	return false
+}
+
+func iaMatches(pattern, ia pan.IA) bool {
+	p, a := addr.IA(pattern), addr.IA(ia)
+	return (p.ISD() == 0 || p.ISD() == a.ISD()) && (p.AS() == 0 || p.AS() == a.AS())
+}
+
+// RestrictIA returns a handler that serves requests with h if the ISD-AS of
+// the client, see PeerAddr, is allowed by the rules. Other requests, including
+// requests not received over SCION, are rejected with 403 Forbidden.
+func RestrictIA(rules IARules, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote, ok := PeerAddr(r)
+		if !ok || !rules.Allows(remote.IA) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,143 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shttp
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// pathConn is a net.Conn with a SCION remote address and a path.
+type pathConn struct {
+	net.Conn
+	remote pan.UDPAddr
+	path   *pan.Path
+}
+
+func (c *pathConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *pathConn) GetPath() *pan.Path {
+	return c.path
+}
+
+func TestPeer(t *testing.T) {
+	remote, err := pan.ParseUDPAddr("1-ff00:0:110,10.0.0.1:1234")
+	require.NoError(t, err)
+	conn := &pathConn{remote: remote, path: &pan.Path{Destination: remote.IA}}
+	ctx := ConnContext(context.Background(), conn)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	addr, ok := PeerAddr(r)
+	assert.True(t, ok)
+	assert.Equal(t, remote, addr)
+	assert.Same(t, conn.path, PeerPath(r))
+
+	conn.path = &pan.Path{Destination: remote.IA}
+	assert.Same(t, conn.path, PeerPath(r), "current path")
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	_, ok = PeerAddr(r)
+	assert.False(t, ok)
+	assert.Nil(t, PeerPath(r))
+}
+
+func TestRestrictIA(t *testing.T) {
+	rules := IARules{
+		Allow: []pan.IA{pan.MustParseIA("1-0"), pan.MustParseIA("2-ff00:0:210")},
+		Deny:  []pan.IA{pan.MustParseIA("1-ff00:0:111")},
+	}
+	handler := RestrictIA(rules, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testCases := []struct {
+		remote   string
+		expected int
+	}{
+		{"1-ff00:0:110,10.0.0.1:1234", http.StatusOK},
+		{"1-ff00:0:111,10.0.0.1:1234", http.StatusForbidden},
+		{"2-ff00:0:210,10.0.0.1:1234", http.StatusOK},
+		{"2-ff00:0:211,10.0.0.1:1234", http.StatusForbidden},
+		{"", http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.remote, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.remote != "" {
+				remote, err := pan.ParseUDPAddr(tc.remote)
+				require.NoError(t, err)
+				r = r.WithContext(ContextWithPeer(r.Context(), remote, nil))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
+
+// singleConnListener is a net.Listener returning a single connection.
+type singleConnListener struct {
+	conns chan net.Conn
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	c, ok := <-l.conns
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	return c, nil
+}
+
+func (l *singleConnListener) Close() error {
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr {
+	return &net.UDPAddr{}
+}
+
+func TestServerServe(t *testing.T) {
+	remote, err := pan.ParseUDPAddr("1-ff00:0:110,10.0.0.1:1234")
+	require.NoError(t, err)
+	client, server := net.Pipe()
+	defer client.Close()
+	l := &singleConnListener{conns: make(chan net.Conn, 1)}
+	l.conns <- &pathConn{Conn: server, remote: remote}
+	close(l.conns)
+
+	rules := IARules{Allow: []pan.IA{remote.IA}}
+	srv := &Server{Server: &http.Server{
+		Handler: RestrictIA(rules, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+	}}
+	go func() { _ = srv.Serve(l) }()
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, "http://www.example.org/", nil)
+	require.NoError(t, err)
+	go func() { _ = req.Write(client) }()
+	resp, err := http.ReadResponse(bufio.NewReader(client), req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "peer attached to the request context")
+}
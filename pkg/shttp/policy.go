@@ -0,0 +1,177 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shttp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"reflect"
+	"sync"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+type policyContextKey struct{}
+
+// WithPolicy returns a copy of ctx with the path policy for requests made with
+// this context by a PolicyTransport.
+func WithPolicy(ctx context.Context, policy pan.Policy) context.Context {
+	return context.WithValue(ctx, policyContextKey{}, policy)
+}
+
+// PolicyFromContext returns the path policy set with WithPolicy.
+func PolicyFromContext(ctx context.Context) (pan.Policy, bool) {
+	policy, ok := ctx.Value(policyContextKey{}).(pan.Policy)
+	return policy, ok
+}
+
+// PolicyTransport is a RoundTripper for HTTP over SCION with a path policy per
+// request, set on the request context with WithPolicy.
+// Connections are pooled per policy: each policy value has its own
+// RoundTripper, so that a request is never sent over a connection dialed for a
+// different policy. Policies should therefore be reused across requests, as
+// every new policy value (e.g. a new pan.ACL) has a new connection pool.
+//
+// The number of pools is bounded by MaxPolicies; the pool of the least
+// recently used policy is dropped, and its idle connections closed, to make
+// room for a new one.
+//
+// Unlike Dialer.SetPolicy, which changes the policy of all connections of a
+// transport, this allows to use different policies, e.g. per site.
+type PolicyTransport struct {
+	// NewTransport returns the RoundTripper for requests with the policy, or
+	// for requests without a policy if the policy is nil.
+	// If nil, the transport returned by shttp.NewTransport is used.
+	NewTransport func(policy pan.Policy) http.RoundTripper
+	// MaxPolicies is the maximum number of policies for which a RoundTripper
+	// is kept. If zero, DefaultMaxPolicies is used.
+	MaxPolicies int
+
+	mutex      sync.Mutex
+	transports map[any]*policyTransportEntry
+	uses       uint64
+}
+
+// DefaultMaxPolicies is the default for PolicyTransport.MaxPolicies.
+const DefaultMaxPolicies = 16
+
+type policyTransportEntry struct {
+	rt      http.RoundTripper
+	lastUse uint64
+}
+
+// RoundTrip implements http.RoundTripper, using the RoundTripper for the
+// policy of the request.
+func (t *PolicyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	policy, _ := PolicyFromContext(req.Context())
+	return t.transport(policy).RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of all policies.
+func (t *PolicyTransport) CloseIdleConnections() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, e := range t.transports {
+		closeIdleConnections(e.rt)
+	}
+}
+
+func (t *PolicyTransport) transport(policy pan.Policy) http.RoundTripper {
+	key := policyKey(policy)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.uses++
+	if e, ok := t.transports[key]; ok {
+		e.lastUse = t.uses
+		return e.rt
+	}
+	if t.transports == nil {
+		t.transports = make(map[any]*policyTransportEntry)
+	}
+	maxPolicies := t.MaxPolicies
+	if maxPolicies <= 0 {
+		maxPolicies = DefaultMaxPolicies
+	}
+	for len(t.transports) >= maxPolicies {
+		t.evictLocked()
+	}
+	var rt http.RoundTripper
+	if t.NewTransport != nil {
+		rt = t.NewTransport(policy)
+	} else {
+		rt, _ = NewTransport(nil, policy)
+	}
+	t.transports[key] = &policyTransportEntry{rt: rt, lastUse: t.uses}
+	return rt
+}
+
+// evictLocked drops the RoundTripper of the least recently used policy,
+// closing its idle connections. Connections still in use by a request are
+// returned to the dropped pool afterwards, and closed by its idle timeout.
+func (t *PolicyTransport) evictLocked() {
+	var oldestKey any
+	var oldest *policyTransportEntry
+	for k, e := range t.transports {
+		if oldest == nil || e.lastUse < oldest.lastUse {
+			oldestKey, oldest = k, e
+		}
+	}
+	delete(t.transports, oldestKey)
+	closeIdleConnections(oldest.rt)
+}
+
+func closeIdleConnections(rt http.RoundTripper) {
+	if c, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// policyKey returns a map key identifying the policy. Policies that are not
+// comparable, like pan.PolicyChain, are identified by their formatted value.
+func policyKey(policy pan.Policy) any {
+	if policy == nil || reflect.ValueOf(policy).Comparable() {
+		return policy
+	}
+	return fmt.Sprintf("%T %#v", policy, policy)
+}
+
+// ConnPath returns the path currently used by a connection to a SCION host,
+// like the connections of Dialer, or nil if the path is not known.
+// A TLS connection is unwrapped to get the path of the underlying connection.
+func ConnPath(conn net.Conn) *pan.Path {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if pc, ok := conn.(interface{ GetPath() *pan.Path }); ok {
+		return pc.GetPath()
+	}
+	return nil
+}
+
+// WithPathTrace returns a copy of ctx with an httptrace.ClientTrace that calls
+// gotPath with the path of the connection used for a request made with this
+// context, once the connection is obtained; gotPath is called with nil if the
+// path is not known, e.g. for a host in the local AS.
+func WithPathTrace(ctx context.Context, gotPath func(path *pan.Path)) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			gotPath(ConnPath(info.Conn))
+		},
+	})
+}
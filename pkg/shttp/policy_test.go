@@ -0,0 +1,135 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestPolicyTransport(t *testing.T) {
+	created := 0
+	transport := &PolicyTransport{
+		NewTransport: func(policy pan.Policy) http.RoundTripper {
+			created++
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return httptest.NewRecorder().Result(), nil
+			})
+		},
+	}
+	roundTrip := func(policy pan.Policy) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "http://www.example.org/", nil)
+		if policy != nil {
+			req = req.WithContext(WithPolicy(req.Context(), policy))
+		}
+		_, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+	}
+
+	roundTrip(nil)
+	roundTrip(nil)
+	assert.Equal(t, 1, created, "no policy")
+
+	roundTrip(pan.LowestLatency{})
+	roundTrip(pan.LowestLatency{})
+	roundTrip(pan.LeastHops{})
+	assert.Equal(t, 3, created, "comparable policies")
+
+	chain := func() pan.Policy {
+		return pan.PolicyChain{pan.LeastHops{}, pan.LowestLatency{}}
+	}
+	roundTrip(chain())
+	roundTrip(chain())
+	roundTrip(pan.PolicyChain{pan.LowestLatency{}, pan.LeastHops{}})
+	assert.Equal(t, 5, created, "non-comparable policies")
+
+	policy, ok := PolicyFromContext(WithPolicy(context.Background(), pan.LeastHops{}))
+	assert.True(t, ok)
+	assert.Equal(t, pan.LeastHops{}, policy)
+	_, ok = PolicyFromContext(context.Background())
+	assert.False(t, ok)
+}
+
+type closeIdleRecorder struct {
+	roundTripperFunc
+	closed *int
+}
+
+func (r closeIdleRecorder) CloseIdleConnections() {
+	*r.closed++
+}
+
+func TestPolicyTransportMaxPolicies(t *testing.T) {
+	closed := map[pan.Policy]*int{}
+	transport := &PolicyTransport{
+		MaxPolicies: 2,
+		NewTransport: func(policy pan.Policy) http.RoundTripper {
+			closed[policy] = new(int)
+			return closeIdleRecorder{
+				roundTripperFunc: func(req *http.Request) (*http.Response, error) {
+					return httptest.NewRecorder().Result(), nil
+				},
+				closed: closed[policy],
+			}
+		},
+	}
+	roundTrip := func(policy pan.Policy) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "http://www.example.org/", nil)
+		_, err := transport.RoundTrip(req.WithContext(WithPolicy(req.Context(), policy)))
+		require.NoError(t, err)
+	}
+
+	roundTrip(pan.LeastHops{})
+	roundTrip(pan.LowestLatency{})
+	roundTrip(pan.LeastHops{}) // LowestLatency is now the least recently used
+	roundTrip(pan.HighestMTU{})
+	assert.Len(t, transport.transports, 2)
+	assert.Equal(t, 1, *closed[pan.LowestLatency{}], "evicted")
+	assert.Equal(t, 0, *closed[pan.LeastHops{}])
+
+	roundTrip(pan.LowestLatency{})
+	assert.Equal(t, 1, *closed[pan.LeastHops{}], "evicted")
+	assert.Equal(t, 0, *closed[pan.HighestMTU{}])
+}
+
+func TestWithPathTrace(t *testing.T) {
+	remote, err := pan.ParseUDPAddr("1-ff00:0:110,10.0.0.1:1234")
+	require.NoError(t, err)
+	conn := &pathConn{remote: remote, path: &pan.Path{Destination: remote.IA}}
+
+	var got *pan.Path
+	ctx := WithPathTrace(context.Background(), func(path *pan.Path) {
+		got = path
+	})
+	httptrace.ContextClientTrace(ctx).GotConn(httptrace.GotConnInfo{Conn: conn})
+	assert.Same(t, conn.path, got)
+	assert.Nil(t, ConnPath(conn.Conn))
+}
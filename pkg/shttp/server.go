@@ -19,14 +19,24 @@ import (
 	"crypto/tls"
 	"net"
 	"net/http"
+	"sync"
 
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
 	"github.com/netsec-ethz/scion-apps/pkg/quicutil"
 )
 
-// Server wraps a http.Server making it work with SCION
+// Server wraps a http.Server making it work with SCION.
+// The SCION address and path of the client are attached to the context of
+// each request, see PeerAddr and PeerPath.
 type Server struct {
 	*http.Server
+	// KeyFile, if set, is the file of the persistent private key of the
+	// server's self-signed certificate, so that clients can pin the key.
+	// The key is generated if the file does not exist.
+	// If empty, a new key is generated on each start.
+	KeyFile string
+
+	connContextOnce sync.Once
 }
 
 // ListenAndServe listens for HTTP connections on the SCION address addr and calls Serve
@@ -53,42 +63,73 @@ func ListenAndServeTLS(addr, certFile, keyFile string, handler http.Handler) err
 	return s.ListenAndServeTLS(certFile, keyFile)
 }
 
+// Serve accepts connections on the listener l, which should be a
+// quicutil.SingleStreamListener on a pan.QUICListener, e.g. to listen with
+// custom options. Like ListenAndServe, this attaches the SCION address and
+// path of the client to the context of each request.
 func (srv *Server) Serve(l net.Listener) error {
-	// Providing a custom listener defeats the purpose of this library.
-	panic("not implemented")
+	srv.setConnContext()
+	return srv.Server.Serve(l)
 }
 
+// ServeTLS is Serve with TLS over the connections of l, see
+// http.Server.ServeTLS.
 func (srv *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
-	// Providing a custom listener defeats the purpose of this library.
-	panic("not implemented")
+	srv.setConnContext()
+	return srv.Server.ServeTLS(l, certFile, keyFile)
 }
 
 // ListenAndServe listens for QUIC connections on srv.Addr and
 // calls Serve to handle incoming requests
 func (srv *Server) ListenAndServe() error {
-	listener, err := listen(srv.Addr)
+	listener, err := srv.listen()
 	if err != nil {
 		return err
 	}
 	defer listener.Close()
-	return srv.Server.Serve(listener)
+	return srv.Serve(listener)
 }
 
 func (srv *Server) ListenAndServeTLS(certFile, keyFile string) error {
-	listener, err := listen(srv.Addr)
+	listener, err := srv.listen()
 	if err != nil {
 		return err
 	}
 	defer listener.Close()
-	return srv.Server.ServeTLS(listener, certFile, keyFile)
+	return srv.ServeTLS(listener, certFile, keyFile)
+}
+
+// setConnContext sets ConnContext of the http.Server to attach the peer to
+// the request context, chained with any ConnContext set by the user.
+func (srv *Server) setConnContext() {
+	srv.connContextOnce.Do(func() {
+		userConnContext := srv.Server.ConnContext
+		srv.Server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+			ctx = ConnContext(ctx, c)
+			if userConnContext != nil {
+				ctx = userConnContext(ctx, c)
+			}
+			return ctx
+		}
+	})
 }
 
-func listen(addr string) (net.Listener, error) {
+func (srv *Server) listen() (net.Listener, error) {
+	var certs []tls.Certificate
+	if srv.KeyFile != "" {
+		cert, err := quicutil.LoadOrGenerateSelfSignedCert(srv.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		certs = []tls.Certificate{*cert}
+	} else {
+		certs = quicutil.MustGenerateSelfSignedCert()
+	}
 	tlsCfg := &tls.Config{
-		NextProtos:   []string{quicutil.SingleStreamProto},
-		Certificates: quicutil.MustGenerateSelfSignedCert(),
+		NextProtos:   quicutil.SingleStreamProtos,
+		Certificates: certs,
 	}
-	laddr, err := pan.ParseOptionalIPPort(addr)
+	laddr, err := pan.ParseOptionalIPPort(srv.Addr)
 	if err != nil {
 		return nil, err
 	}
@@ -96,5 +137,5 @@ func listen(addr string) (net.Listener, error) {
 	if err != nil {
 		return nil, err
 	}
-	return quicutil.SingleStreamListener{QUICListener: quicListener}, nil
+	return &quicutil.SingleStreamListener{QUICListener: quicListener}, nil
 }
@@ -17,7 +17,6 @@ package shttp
 
 import (
 	"context"
-	"crypto/tls"
 	"net"
 	"net/http"
 	"net/netip"
@@ -62,34 +61,42 @@ func NewTransport(quicCfg *quic.Config, policy pan.Policy) (*http.Transport, *Di
 	return transport, dialer
 }
 
-// Dialer dials an insecure, single-stream QUIC connection over SCION (just pretend it's TCP).
+// Dialer dials a single-stream QUIC connection over SCION (just pretend it's TCP).
 // This is the Dialer used for shttp.DefaultTransport.
+//
+// Without a TrustStore, the connection is insecure, the server certificate is
+// not verified.
 type Dialer struct {
 	Local      netip.AddrPort
 	QuicConfig *quic.Config
 	Policy     pan.Policy
+	// TrustStore, if set, verifies the server key, pinning it on first use.
+	TrustStore *quicutil.TrustStore
 	sessions   []*pan.QUICConn
 }
 
-// DialContext dials an insecure, single-stream QUIC connection over SCION. This can be used
+// DialContext dials a single-stream QUIC connection over SCION. This can be used
 // as the DialContext function in net/http.Transport.
+// The connection is dialed with a pan.Dialer, on the "quic" network.
 func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
-	tlsCfg := &tls.Config{
-		NextProtos:         []string{quicutil.SingleStreamProto},
-		InsecureSkipVerify: true,
+	dialer := pan.Dialer{
+		Local:      d.Local,
+		Policy:     d.Policy,
+		QUICConfig: d.QuicConfig,
 	}
-
-	remote, err := pan.ResolveUDPAddr(ctx, addr)
-	if err != nil {
-		return nil, err
+	if d.TrustStore != nil {
+		dialer.TLSConfig = d.TrustStore.TLSConfig()
 	}
-
-	session, err := pan.DialQUIC(ctx, d.Local, remote, addr, tlsCfg, d.QuicConfig, pan.WithPolicy(d.Policy))
+	conn, err := dialer.DialContext(ctx, "quic", addr)
 	if err != nil {
 		return nil, err
 	}
-	d.sessions = append(d.sessions, session)
-	return quicutil.NewSingleStream(session)
+	if s, ok := conn.(*quicutil.SingleStream); ok {
+		if session, ok := s.Connection.(*pan.QUICConn); ok {
+			d.sessions = append(d.sessions, session)
+		}
+	}
+	return conn, nil
 }
 
 func (d *Dialer) SetPolicy(policy pan.Policy) {
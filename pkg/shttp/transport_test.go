@@ -39,11 +39,15 @@ func TestMangleSCIONAddrURL(t *testing.T) {
 	}{
 		{"foo", "foo"},
 		{"foo:80", "foo:80"},
-		{"1-ff00:0:110,127.0.0.1", "[1-ff00:0:110,127.0.0.1]"},
-		{"1-ff00:0:110,127.0.0.1:80", "[1-ff00:0:110,127.0.0.1]:80"},
-		{"1-ff00:0:110,::1", "[1-ff00:0:110,::1]"},
-		{"1-ff00:0:110,[::1]", "[1-ff00:0:110,::1]"},
-		{"1-ff00:0:110,[::1]:80", "[1-ff00:0:110,::1]:80"},
+		{"1-ff00:0:110,127.0.0.1", "1-ff00_0_110,127.0.0.1"},
+		{"1-ff00:0:110,127.0.0.1:80", "1-ff00_0_110,127.0.0.1:80"},
+		{"1-ff00:0:110,[127.0.0.1]:80", "1-ff00_0_110,127.0.0.1:80"},
+		{"[1-ff00:0:110,127.0.0.1]:80", "1-ff00_0_110,127.0.0.1:80"},
+		{"1-ff00:0:110,::1", "1-ff00_0_110,__1"},
+		{"1-ff00:0:110,[::1]", "1-ff00_0_110,__1"},
+		{"1-ff00:0:110,[::1]:80", "1-ff00_0_110,__1:80"},
+		{"[1-ff00:0:110,::1]:80", "1-ff00_0_110,__1:80"},
+		{"1-ff00:0:110,[2001:db8::1]:80", "1-ff00_0_110,2001_db8__1:80"},
 	}
 
 	urlPatterns := hostURLPatterns()
@@ -76,6 +80,8 @@ func TestRoundTripper(t *testing.T) {
 		{"1-ff00:0:110,::1", "1-ff00:0:110,[::1]:443"},
 		{"1-ff00:0:110,[::1]", "1-ff00:0:110,[::1]:443"},
 		{"1-ff00:0:110,[::1]:80", "1-ff00:0:110,[::1]:80"},
+		{"[1-ff00:0:110,::1]:80", "1-ff00:0:110,[::1]:80"},
+		{"1-ff00:0:110,[2001:db8::1]:80", "1-ff00:0:110,[2001:db8::1]:80"},
 	}
 
 	urlPatterns := hostURLPatterns()
@@ -104,7 +110,7 @@ func TestRoundTripper(t *testing.T) {
 			remote := pan.UDPAddr{IA: hostIA, IP: hostIP, Port: uint16(port)}
 			assert.Equal(t, expected, remote.String())
 		} else {
-			remote, err := pan.ParseUDPAddr(addr)
+			remote, err := pan.ParseUDPAddr(pan.UnmangleSCIONAddr(addr))
 			require.NoError(t, err)
 			assert.Equal(t, expected, remote.String())
 		}
@@ -0,0 +1,342 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shttp3
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/netsec-ethz/scion-apps/pkg/shttp"
+)
+
+// defaultAltSvcMaxAge is the freshness of an Alt-Svc entry without ma
+// parameter, see RFC 7838.
+const defaultAltSvcMaxAge = 24 * time.Hour
+
+// AltSvcHandler returns a handler that advertises the server s with an
+// Alt-Svc header on each response, before serving the request with h. This is
+// meant for the handler of an shttp.Server running alongside s, so that an
+// UpgradeTransport switches to HTTP/3 for later requests.
+func (s *Server) AltSvcHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = s.SetQUICHeaders(w.Header()) // not listening (yet), nothing to advertise
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ListenAndServeWithSHTTP serves handler with HTTP/3 on the SCION/UDP address
+// addr, and with an shttp.Server on shttpAddr that advertises the HTTP/3
+// server with Alt-Svc headers. Returns the first error of either server.
+func ListenAndServeWithSHTTP(shttpAddr, addr, certFile, keyFile string, handler http.Handler) error {
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		return err
+	}
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	s := &Server{
+		Server: &http3.Server{
+			Addr:    addr,
+			Handler: handler,
+		},
+	}
+	errs := make(chan error, 2)
+	go func() {
+		errs <- s.ListenAndServeTLS(certFile, keyFile)
+	}()
+	go func() {
+		errs <- shttp.ListenAndServe(shttpAddr, s.AltSvcHandler(handler))
+	}()
+	return <-errs
+}
+
+// UpgradeTransport is a RoundTripper for HTTP over SCION that upgrades from
+// HTTP over a QUIC single-stream connection (shttp) to HTTP/3, when the server
+// advertises an HTTP/3 alternative service with an Alt-Svc header (see
+// Server.AltSvcHandler). The alternative services are remembered per origin
+// until they expire (ma parameter), and later requests to the origin are sent
+// over HTTP/3. If a request over HTTP/3 fails, the alternative service is
+// forgotten. The request is retried over shttp if it is idempotent, or if it
+// failed before any of it was sent (see httptrace.ClientTrace.WroteHeaders)
+// and its body can be replayed; otherwise the error is returned, as the
+// server may already have processed the request.
+//
+// The zero value is ready to use.
+type UpgradeTransport struct {
+	// Transport is the RoundTripper for requests without an alternative
+	// service. If nil, shttp.DefaultTransport is used.
+	Transport http.RoundTripper
+	// HTTP3 is the RoundTripper for requests to https origins with an
+	// alternative service. If nil, DefaultTransport is used.
+	HTTP3 http.RoundTripper
+	// InsecureHTTP3 is the RoundTripper for requests to http origins with an
+	// alternative service. These requests are sent as https requests, as
+	// HTTP/3 requires TLS, but as for http over shttp, the server certificate
+	// is not verified. If nil, an http3.Transport with InsecureSkipVerify is
+	// used.
+	InsecureHTTP3 http.RoundTripper
+
+	initOnce sync.Once
+	mutex    sync.Mutex
+	altSvc   map[string]altService // by origin, see originKey
+	now      func() time.Time      // for testing; time.Now if nil
+}
+
+// altService is an HTTP/3 alternative service of an origin.
+type altService struct {
+	host    string // empty for the host of the origin
+	port    string
+	expires time.Time
+}
+
+func (t *UpgradeTransport) init() {
+	t.initOnce.Do(func() {
+		if t.Transport == nil {
+			t.Transport = shttp.DefaultTransport
+		}
+		if t.HTTP3 == nil {
+			t.HTTP3 = DefaultTransport
+		}
+		if t.InsecureHTTP3 == nil {
+			t.InsecureHTTP3 = &http3.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true,
+					ClientSessionCache: tls.NewLRUClientSessionCache(0),
+				},
+				Dial: (&Dialer{}).Dial,
+			}
+		}
+	})
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *UpgradeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.init()
+	origin := originKey(req.URL)
+	if alt, ok := t.alternative(origin); ok {
+		resp, sent, err := t.roundTripAlt(req, alt)
+		if err == nil {
+			t.update(origin, resp.Header)
+			return resp, nil
+		}
+		t.forget(origin)
+		if sent && !isIdempotent(req) {
+			return nil, err
+		}
+		if req, err = rewindRequest(req); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.update(origin, resp.Header)
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the underlying
+// transports.
+func (t *UpgradeTransport) CloseIdleConnections() {
+	t.init()
+	for _, rt := range []http.RoundTripper{t.Transport, t.HTTP3, t.InsecureHTTP3} {
+		if c, ok := rt.(interface{ CloseIdleConnections() }); ok {
+			c.CloseIdleConnections()
+		}
+	}
+}
+
+// roundTripAlt sends the request for the origin to its alternative service.
+// On error, sent reports whether any part of the request may have been sent.
+func (t *UpgradeTransport) roundTripAlt(req *http.Request, alt altService) (resp *http.Response, sent bool, err error) {
+	host := alt.host
+	if host == "" {
+		host = req.URL.Hostname()
+	}
+	var written atomic.Bool
+	trace := &httptrace.ClientTrace{
+		WroteHeaders: func() { written.Store(true) },
+	}
+	altReq := req.Clone(httptrace.WithClientTrace(req.Context(), trace))
+	if altReq.Body != nil && altReq.Body != http.NoBody {
+		// for RoundTrippers that don't report WroteHeaders
+		altReq.Body = &readTracker{ReadCloser: altReq.Body, read: &written}
+	}
+	if altReq.Host == "" {
+		altReq.Host = req.URL.Host // the authority is still the origin
+	}
+	altReq.URL.Host = net.JoinHostPort(host, alt.port)
+	rt := t.HTTP3
+	if req.URL.Scheme == "http" {
+		altReq.URL.Scheme = "https"
+		rt = t.InsecureHTTP3
+	}
+	resp, err = rt.RoundTrip(altReq)
+	return resp, written.Load(), err
+}
+
+// readTracker is a request body that records whether it was read from.
+type readTracker struct {
+	io.ReadCloser
+	read *atomic.Bool
+}
+
+func (r *readTracker) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.read.Store(true)
+	}
+	return n, err
+}
+
+// isIdempotent returns true if the request can be sent again, even if it
+// was already processed by the server, like net/http retries requests: for
+// the idempotent methods (RFC 9110, Section 9.2.2), or with an
+// Idempotency-Key header.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, hasKey := req.Header["Idempotency-Key"]
+	_, hasXKey := req.Header["X-Idempotency-Key"]
+	return hasKey || hasXKey
+}
+
+// rewindRequest returns the request with a fresh body to retry it, if the body
+// can be replayed.
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("shttp3: cannot retry request with body over shttp")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	newReq := *req
+	newReq.Body = body
+	return &newReq, nil
+}
+
+func (t *UpgradeTransport) alternative(origin string) (altService, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	alt, ok := t.altSvc[origin]
+	if !ok || !t.currentTime().Before(alt.expires) {
+		return altService{}, false
+	}
+	return alt, true
+}
+
+// update updates the alternative service of the origin from the Alt-Svc
+// header of a response. Responses without Alt-Svc header do not change the
+// alternative service.
+func (t *UpgradeTransport) update(origin string, header http.Header) {
+	values := header.Values("Alt-Svc")
+	if len(values) == 0 {
+		return
+	}
+	alt, clear, ok := parseAltSvc(strings.Join(values, ","), t.currentTime())
+	if !ok && !clear {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if clear {
+		delete(t.altSvc, origin)
+		return
+	}
+	if t.altSvc == nil {
+		t.altSvc = make(map[string]altService)
+	}
+	t.altSvc[origin] = alt
+}
+
+func (t *UpgradeTransport) forget(origin string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.altSvc, origin)
+}
+
+func (t *UpgradeTransport) currentTime() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+// originKey returns the origin of the URL, with explicit port.
+func originKey(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return u.Scheme + "://" + net.JoinHostPort(u.Hostname(), port)
+}
+
+// parseAltSvc parses the value of an Alt-Svc header (RFC 7838), received at
+// time now, and returns the first HTTP/3 alternative. Returns clear if the
+// header clears all alternatives.
+func parseAltSvc(value string, now time.Time) (alt altService, clear bool, ok bool) {
+	if strings.TrimSpace(value) == "clear" {
+		return altService{}, true, false
+	}
+	for _, entry := range strings.Split(value, ",") {
+		params := strings.Split(entry, ";")
+		protocol, authority, found := strings.Cut(strings.TrimSpace(params[0]), "=")
+		if !found || protocol != http3.NextProtoH3 {
+			continue
+		}
+		authority, err := strconv.Unquote(strings.TrimSpace(authority))
+		if err != nil {
+			continue
+		}
+		host, port, err := net.SplitHostPort(authority)
+		if err != nil {
+			continue
+		}
+		maxAge := defaultAltSvcMaxAge
+		for _, param := range params[1:] {
+			name, arg, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.TrimSpace(name) == "ma" {
+				seconds, err := strconv.ParseUint(strings.Trim(strings.TrimSpace(arg), `"`), 10, 32)
+				if err == nil {
+					maxAge = time.Duration(seconds) * time.Second
+				}
+			}
+		}
+		return altService{host: host, port: port, expires: now.Add(maxAge)}, false, true
+	}
+	return altService{}, false, false
+}
@@ -0,0 +1,209 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shttp3
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAltSvc(t *testing.T) {
+	now := time.Now()
+	testCases := []struct {
+		value    string
+		expected altService
+		clear    bool
+		ok       bool
+	}{
+		{`h3=":443"; ma=2592000`, altService{port: "443", expires: now.Add(2592000 * time.Second)}, false, true},
+		{`h3-29=":8443", h3="alt.example.org:8443"`, altService{host: "alt.example.org", port: "8443", expires: now.Add(24 * time.Hour)}, false, true},
+		{`h3=":443"; persist=1; ma="60"`, altService{port: "443", expires: now.Add(time.Minute)}, false, true},
+		{`clear`, altService{}, true, false},
+		{`h2=":443"`, altService{}, false, false},
+		{`h3=443`, altService{}, false, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			alt, clear, ok := parseAltSvc(tc.value, now)
+			assert.Equal(t, tc.expected, alt)
+			assert.Equal(t, tc.clear, clear)
+			assert.Equal(t, tc.ok, ok)
+		})
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestUpgradeTransport(t *testing.T) {
+	currentTime := time.Now()
+	altSvc := `h3=":8443"; ma=60`
+	var requests []string
+	h3Fail := false
+	respond := func(name string) roundTripperFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			requests = append(requests, name+" "+req.URL.String()+" "+req.Host)
+			if name != "shttp" && h3Fail {
+				return nil, errors.New("no HTTP/3")
+			}
+			w := httptest.NewRecorder()
+			if altSvc != "" {
+				w.Header().Set("Alt-Svc", altSvc)
+			}
+			return w.Result(), nil
+		}
+	}
+	transport := &UpgradeTransport{
+		Transport:     respond("shttp"),
+		HTTP3:         respond("h3"),
+		InsecureHTTP3: respond("insecure-h3"),
+		now:           func() time.Time { return currentTime },
+	}
+	roundTrip := func(method, url string) {
+		t.Helper()
+		req, err := http.NewRequest(method, url, strings.NewReader("body"))
+		require.NoError(t, err)
+		_, err = transport.RoundTrip(req)
+		require.NoError(t, err)
+	}
+	expectRequests := func(expected ...string) {
+		t.Helper()
+		assert.Equal(t, expected, requests)
+		requests = nil
+	}
+
+	roundTrip(http.MethodGet, "http://www.example.org/a")
+	roundTrip(http.MethodGet, "http://www.example.org:80/b")
+	roundTrip(http.MethodGet, "https://www.example.org/c")
+	roundTrip(http.MethodGet, "https://www.example.org/d")
+	expectRequests(
+		"shttp http://www.example.org/a www.example.org",
+		"insecure-h3 https://www.example.org:8443/b www.example.org:80",
+		"shttp https://www.example.org/c www.example.org",
+		"h3 https://www.example.org:8443/d www.example.org",
+	)
+
+	currentTime = currentTime.Add(2 * time.Minute)
+	roundTrip(http.MethodGet, "https://www.example.org/expired")
+	expectRequests("shttp https://www.example.org/expired www.example.org")
+
+	h3Fail = true
+	altSvc = ""
+	roundTrip(http.MethodPost, "https://www.example.org/fallback")
+	roundTrip(http.MethodGet, "https://www.example.org/forgotten")
+	expectRequests(
+		"h3 https://www.example.org:8443/fallback www.example.org",
+		"shttp https://www.example.org/fallback www.example.org",
+		"shttp https://www.example.org/forgotten www.example.org",
+	)
+
+	h3Fail = false
+	altSvc = `h3=":8443"`
+	roundTrip(http.MethodGet, "https://www.example.org/advertised")
+	altSvc = "clear"
+	roundTrip(http.MethodGet, "https://www.example.org/clear")
+	roundTrip(http.MethodGet, "https://www.example.org/cleared")
+	expectRequests(
+		"shttp https://www.example.org/advertised www.example.org",
+		"h3 https://www.example.org:8443/clear www.example.org",
+		"shttp https://www.example.org/cleared www.example.org",
+	)
+}
+
+func TestUpgradeTransportFallback(t *testing.T) {
+	errH3 := errors.New("no HTTP/3")
+	failDial := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errH3
+	})
+	failAfterHeaders := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if trace := httptrace.ContextClientTrace(req.Context()); trace != nil && trace.WroteHeaders != nil {
+			trace.WroteHeaders()
+		}
+		return nil, errH3
+	})
+	failAfterBody := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		_, _ = io.ReadAll(req.Body)
+		return nil, errH3
+	})
+	testCases := []struct {
+		name     string
+		method   string
+		header   http.Header
+		body     io.Reader
+		h3       roundTripperFunc
+		fallback bool
+	}{
+		{"not sent", http.MethodPost, nil, strings.NewReader("body"), failDial, true},
+		{"not sent, body not replayable", http.MethodPost, nil, io.MultiReader(strings.NewReader("body")), failDial, false},
+		{"headers sent", http.MethodPost, nil, nil, failAfterHeaders, false},
+		{"body sent", http.MethodPost, nil, strings.NewReader("body"), failAfterBody, false},
+		{"headers sent, idempotent", http.MethodGet, nil, nil, failAfterHeaders, true},
+		{"body sent, idempotent", http.MethodPut, nil, strings.NewReader("body"), failAfterBody, true},
+		{"body sent, idempotency key", http.MethodPost, http.Header{"Idempotency-Key": {"1"}}, strings.NewReader("body"), failAfterBody, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var body string
+			fallback := false
+			transport := &UpgradeTransport{
+				Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					fallback = true
+					if req.Body != nil {
+						b, err := io.ReadAll(req.Body)
+						require.NoError(t, err)
+						body = string(b)
+					}
+					w := httptest.NewRecorder()
+					w.Header().Set("Alt-Svc", `h3=":8443"`)
+					return w.Result(), nil
+				}),
+				HTTP3: tc.h3,
+			}
+			req, err := http.NewRequest(http.MethodGet, "https://www.example.org/", nil)
+			require.NoError(t, err)
+			_, err = transport.RoundTrip(req)
+			require.NoError(t, err, "learn alternative service")
+
+			fallback = false
+			req, err = http.NewRequest(tc.method, "https://www.example.org/", tc.body)
+			require.NoError(t, err)
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+			_, err = transport.RoundTrip(req)
+			assert.Equal(t, tc.fallback, fallback)
+			if tc.fallback {
+				require.NoError(t, err)
+				if tc.body != nil {
+					assert.Equal(t, "body", body, "body replayed")
+				}
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
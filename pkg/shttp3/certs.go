@@ -0,0 +1,83 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shttp3
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertificateReloader loads a certificate and its key from files and reloads
+// them when the files change, e.g. when a renewed certificate is installed,
+// without restarting the server. Use GetCertificate as
+// tls.Config.GetCertificate.
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mutex   sync.Mutex
+	cert    *tls.Certificate
+	modTime [2]time.Time // of certFile and keyFile, when cert was loaded
+}
+
+// NewCertificateReloader loads the certificate and key from the files.
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	r := &CertificateReloader{certFile: certFile, keyFile: keyFile}
+	modTime, err := r.statFiles()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the certificate, reloaded if the files were modified
+// since they were last loaded. If reloading fails, e.g. because only one of
+// the files was replaced yet, the previous certificate is returned and loading
+// is retried on the next call.
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if modTime, err := r.statFiles(); err == nil && modTime != r.modTime {
+		_ = r.load(modTime)
+	}
+	return r.cert, nil
+}
+
+func (r *CertificateReloader) load(modTime [2]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+func (r *CertificateReloader) statFiles() ([2]time.Time, error) {
+	var modTime [2]time.Time
+	for i, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTime, err
+		}
+		modTime[i] = info.ModTime()
+	}
+	return modTime, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shttp3
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netsec-ethz/scion-apps/pkg/quicutil"
+)
+
+// writeCert writes a new self-signed certificate and its key to the files,
+// with the given modification time, and returns the DER encoded certificate.
+func writeCert(t *testing.T, certFile, keyFile string, modTime time.Time) []byte {
+	t.Helper()
+	cert := quicutil.MustGenerateSelfSignedCert()[0]
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+	return cert.Certificate[0]
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	modTime := time.Now().Add(-time.Hour)
+
+	_, err := NewCertificateReloader(certFile, keyFile)
+	assert.Error(t, err, "no files")
+
+	first := writeCert(t, certFile, keyFile, modTime)
+	r, err := NewCertificateReloader(certFile, keyFile)
+	require.NoError(t, err)
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, first, cert.Certificate[0])
+
+	second := writeCert(t, certFile, keyFile, modTime.Add(time.Minute))
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, second, cert.Certificate[0], "reloaded")
+
+	// only the certificate replaced, key does not match yet
+	third := writeCert(t, filepath.Join(dir, "cert3.pem"), filepath.Join(dir, "key3.pem"), modTime)
+	require.NoError(t, os.Rename(filepath.Join(dir, "cert3.pem"), certFile))
+	require.NoError(t, os.Chtimes(certFile, modTime.Add(2*time.Minute), modTime.Add(2*time.Minute)))
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, second, cert.Certificate[0], "previous certificate while reloading fails")
+
+	require.NoError(t, os.Rename(filepath.Join(dir, "key3.pem"), keyFile))
+	require.NoError(t, os.Chtimes(keyFile, modTime.Add(2*time.Minute), modTime.Add(2*time.Minute)))
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, third, cert.Certificate[0], "reloaded after key replaced")
+}
@@ -17,53 +17,242 @@ package shttp3
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"io"
 	"net"
 	"net/http"
+	"slices"
+	"sync"
 
+	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
 
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsec-ethz/scion-apps/pkg/shttp"
 )
 
-// Server wraps a http3.Server making it work with SCION
+// Server wraps a http3.Server making it work with SCION.
+// The SCION address and path of the client are attached to the context of
+// each request, see shttp.PeerAddr and shttp.PeerPath.
+//
+// Unlike for http3.Server, 0-RTT is disabled unless Allow0RTT is set, and
+// Shutdown and Close also close the SCION sockets of the server.
 type Server struct {
 	*http3.Server
+	// ListenOptions are passed to pan.ListenUDP, e.g. pan.WithReplySelector
+	// or pan.WithInboundFilter with a pan.Firewall.
+	ListenOptions []pan.ListenConnOptions
+	// Allow0RTT accepts requests in 0-RTT data, which saves a round trip for
+	// resumed connections, but can be replayed by an attacker. Requests in
+	// 0-RTT data with a method that is not safe (e.g. POST) are rejected with
+	// 425 Too Early, so that the client retries them after the handshake.
+	// Overrides Allow0RTT of QUICConfig.
+	Allow0RTT bool
+
+	setupOnce sync.Once
+	mutex     sync.Mutex
+	closed    bool
+	closers   []io.Closer // listeners and SCION sockets, closed by Close and Shutdown
 }
 
 // ListenAndServe listens on the SCION/UDP address addr and calls the handler
 // for HTTP/3 requests on incoming connections. http.DefaultServeMux is used
-// when handler is nil.
+// when handler is nil. The certificate is reloaded when the files change.
 func ListenAndServe(addr string, certFile, keyFile string, handler http.Handler) error {
-	var err error
-	certs := make([]tls.Certificate, 1)
-	certs[0], err = tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		return err
-	}
 	s := &Server{
 		Server: &http3.Server{
 			Addr:    addr,
 			Handler: handler,
-			TLSConfig: &tls.Config{
-				Certificates: certs,
-			},
 		},
 	}
-	return s.ListenAndServe()
+	return s.ListenAndServeTLS(certFile, keyFile)
 }
 
 // ListenAndServe listens on the UDP address s.Addr and calls s.Handler to
 // handle HTTP/3 requests on incoming connections.
+// If s.Port is not set, it is set to the port of the listening address, to be
+// advertised with SetQUICHeaders (see AltSvcHandler).
+//
+// ListenAndServe always returns a non-nil error. After Shutdown or Close, the
+// returned error is http.ErrServerClosed.
 func (s *Server) ListenAndServe() error {
+	if s.TLSConfig == nil {
+		return errors.New("shttp3: use of Server without TLSConfig")
+	}
+	return s.listenAndServe(s.TLSConfig)
+}
+
+// ListenAndServeTLS is like ListenAndServe, with the certificate and key
+// loaded from files instead of the certificates of s.TLSConfig. The
+// certificate is reloaded when the files change, see CertificateReloader.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	tlsCfg := &tls.Config{}
+	if s.TLSConfig != nil {
+		tlsCfg = s.TLSConfig.Clone()
+		tlsCfg.Certificates = nil
+	}
+	tlsCfg.GetCertificate = reloader.GetCertificate
+	return s.listenAndServe(tlsCfg)
+}
+
+func (s *Server) listenAndServe(tlsCfg *tls.Config) error {
 	laddr, err := pan.ParseOptionalIPPort(s.Addr)
 	if err != nil {
 		return err
 	}
-	sconn, err := pan.ListenUDP(context.Background(), laddr)
+	sconn, err := pan.ListenUDP(context.Background(), laddr, s.ListenOptions...)
 	if err != nil {
 		return err
 	}
-	return s.Server.Serve(sconn)
+	quicCfg := &quic.Config{}
+	if s.QUICConfig != nil {
+		quicCfg = s.QUICConfig.Clone()
+	}
+	quicCfg.Allow0RTT = s.Allow0RTT
+	if s.EnableDatagrams {
+		quicCfg.EnableDatagrams = true
+	}
+	ln, err := quic.ListenEarly(sconn, http3.ConfigureTLSConfig(tlsCfg), quicCfg)
+	if err != nil {
+		_ = sconn.Close()
+		return err
+	}
+	if !s.track(ln, sconn) {
+		return http.ErrServerClosed
+	}
+	if s.Port == 0 {
+		// the port of the SCION address is not recognized by http3.Server
+		s.Port = int(sconn.LocalAddr().(pan.UDPAddr).Port)
+	}
+	s.setup(sconn)
+	err = s.Server.ServeListener(ln)
+	if !errors.Is(err, http.ErrServerClosed) {
+		// Otherwise, the sockets are closed by Shutdown or Close, once the
+		// connections are drained.
+		s.untrack(ln, sconn)
+	}
+	return err
+}
+
+// track registers the closers to be closed by Shutdown or Close. If the
+// server is already closed, the closers are closed immediately and false is
+// returned.
+func (s *Server) track(closers ...io.Closer) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		closeAll(closers)
+		return false
+	}
+	s.closers = append(s.closers, closers...)
+	return true
+}
+
+// untrack closes the closers and removes them from the registered closers.
+func (s *Server) untrack(closers ...io.Closer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	closeAll(closers)
+	s.closers = slices.DeleteFunc(s.closers, func(c io.Closer) bool {
+		return slices.Contains(closers, c)
+	})
+}
+
+func closeAll(closers []io.Closer) {
+	for _, c := range closers {
+		_ = c.Close()
+	}
+}
+
+// Shutdown gracefully shuts down the server, see http3.Server.Shutdown: the
+// server stops accepting connections, sends a GOAWAY frame and waits for the
+// running requests to complete, until ctx is done. The SCION sockets are
+// closed afterwards.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.setClosed()
+	err := s.Server.Shutdown(ctx)
+	s.closeTracked()
+	return err
+}
+
+// Close immediately closes the server, aborting the running requests, see
+// http3.Server.Close, and closes the SCION sockets.
+func (s *Server) Close() error {
+	s.setClosed()
+	err := s.Server.Close()
+	s.closeTracked()
+	return err
+}
+
+func (s *Server) setClosed() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+}
+
+func (s *Server) closeTracked() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	closeAll(s.closers)
+	s.closers = nil
+}
+
+// setup sets ConnContext of the http3.Server to attach the peer to the request
+// context, chained with any ConnContext set by the user, and restricts
+// requests in 0-RTT data if Allow0RTT is set.
+func (s *Server) setup(sconn pan.ListenConn) {
+	s.setupOnce.Do(func() {
+		userConnContext := s.Server.ConnContext
+		replyPather, _ := sconn.(interface{ ReplyPath(pan.UDPAddr) *pan.Path })
+		s.Server.ConnContext = func(ctx context.Context, c *quic.Conn) context.Context {
+			if remote, ok := c.RemoteAddr().(pan.UDPAddr); ok {
+				var path func() *pan.Path
+				if replyPather != nil {
+					path = func() *pan.Path {
+						return replyPather.ReplyPath(remote)
+					}
+				}
+				ctx = shttp.ContextWithPeer(ctx, remote, path)
+			}
+			if userConnContext != nil {
+				ctx = userConnContext(ctx, c)
+			}
+			return ctx
+		}
+		if s.Allow0RTT {
+			s.Server.Handler = rejectUnsafeEarlyData(s.Server.Handler)
+		}
+	})
+}
+
+// rejectUnsafeEarlyData rejects requests received in 0-RTT data, i.e. before
+// the handshake is complete, with 425 Too Early (RFC 8470), unless the method
+// is safe (and thus idempotent), as the request could be a replay.
+// http.DefaultServeMux is used when h is nil.
+func rejectUnsafeEarlyData(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && !r.TLS.HandshakeComplete && !isSafeMethod(r.Method) {
+			http.Error(w, http.StatusText(http.StatusTooEarly), http.StatusTooEarly)
+			return
+		}
+		if h == nil {
+			http.DefaultServeMux.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
 }
 
 func (s *Server) Serve(conn net.PacketConn) error {
@@ -0,0 +1,339 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shttp3
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsec-ethz/scion-apps/pkg/quicutil"
+)
+
+func TestRejectUnsafeEarlyData(t *testing.T) {
+	handler := rejectUnsafeEarlyData(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	testCases := []struct {
+		method            string
+		handshakeComplete bool
+		expected          int
+	}{
+		{http.MethodGet, false, http.StatusOK},
+		{http.MethodHead, false, http.StatusOK},
+		{http.MethodPost, false, http.StatusTooEarly},
+		{http.MethodDelete, false, http.StatusTooEarly},
+		{http.MethodPost, true, http.StatusOK},
+	}
+	for _, tc := range testCases {
+		name := tc.method
+		if tc.handshakeComplete {
+			name += " after handshake"
+		}
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "https://www.example.org/", nil)
+			r.TLS = &tls.ConnectionState{HandshakeComplete: tc.handshakeComplete}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
+
+const testTopology = `{
+  "isd_as": "1-ff00:0:110",
+  "mtu": 1472,
+  "dispatched_ports": "30041-30041",
+  "control_service": {
+    "cs1-ff00:0:110-1": {"addr": "127.0.0.1:31000"}
+  }
+}`
+
+var useTestTopologyOnce sync.Once
+
+// useTestTopology configures pan to run without a SCION daemon, in a local
+// AS without border routers. Within the local AS, packets are sent to the
+// end host port 30041, so the server and each client listen on this port on
+// different loopback addresses.
+func useTestTopology(t *testing.T) {
+	t.Helper()
+	useTestTopologyOnce.Do(func() {
+		topologyFile := filepath.Join(t.TempDir(), "topology.json")
+		require.NoError(t, os.WriteFile(topologyFile, []byte(testTopology), 0o600))
+		require.NoError(t, pan.UseTopologyFile(topologyFile, pan.NewStaticPathProvider(nil)))
+	})
+}
+
+const testServerAddr = "127.0.1.1:30041"
+
+// testServerURL is the URL of the test server, see startTestServer.
+var testServerURL = "https://" + pan.MangleSCIONAddr("1-ff00:0:110,"+testServerAddr) + "/"
+
+// startTestServer starts the server on loopback and returns the channel on
+// which the result of ListenAndServe is sent.
+func startTestServer(t *testing.T, s *Server) <-chan error {
+	t.Helper()
+	useTestTopology(t)
+	s.Addr = testServerAddr
+	s.TLSConfig = &tls.Config{Certificates: quicutil.MustGenerateSelfSignedCert()}
+	served := make(chan error, 1)
+	go func() {
+		served <- s.ListenAndServe()
+	}()
+	t.Cleanup(func() { _ = s.Close() })
+	return served
+}
+
+// lastTestClient is the last byte of the loopback address of the last dialed
+// connection, see newTestTransport.
+var lastTestClient atomic.Uint32
+
+// newTestTransport returns an HTTP/3 transport dialing each connection from a
+// new loopback address, as all connections use the end host port.
+func newTestTransport(t *testing.T) *http3.Transport {
+	t.Helper()
+	transport := &http3.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			ClientSessionCache: tls.NewLRUClientSessionCache(0),
+		},
+		Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+			local := fmt.Sprintf("127.0.1.%d:30041", lastTestClient.Add(1)+1)
+			return (&Dialer{Local: netip.MustParseAddrPort(local)}).Dial(ctx, addr, tlsCfg, cfg)
+		},
+	}
+	t.Cleanup(func() { _ = transport.Close() })
+	return transport
+}
+
+// get sends a request to the test server and returns the body of the
+// response, or an error for a response other than 200 OK.
+func get(transport http.RoundTripper, method, path string) (string, error) {
+	return getTimeout(transport, method, path, 5*time.Second)
+}
+
+func getTimeout(transport http.RoundTripper, method, path string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, testServerURL+path, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(resp.Status)
+	}
+	return string(body), nil
+}
+
+// blockingHandler serves "/" directly and blocks requests to "/block" until
+// released, signalling on started once such a request arrived.
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+}
+
+func (h *blockingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/block" {
+		h.started <- struct{}{}
+		select {
+		case <-h.release:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	_, _ = io.WriteString(w, "ok")
+}
+
+// receive returns the error received on errs, failing the test if it takes
+// longer than a second, well below the timeout of a request (see get).
+func receive(t *testing.T, errs <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+		return nil
+	}
+}
+
+// assertSocketClosed asserts that the SCION socket of the test server is
+// closed, by binding its address.
+func assertSocketClosed(t *testing.T) {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", net.UDPAddrFromAddrPort(netip.MustParseAddrPort(testServerAddr)))
+	if assert.NoError(t, err, "socket closed") {
+		_ = conn.Close()
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	t.Run("drain", func(t *testing.T) {
+		handler := newBlockingHandler()
+		s := &Server{Server: &http3.Server{Handler: handler}}
+		served := startTestServer(t, s)
+		client := newTestTransport(t)
+
+		body, err := get(client, http.MethodGet, "")
+		require.NoError(t, err)
+		assert.Equal(t, "ok", body)
+
+		inflight := make(chan error, 1)
+		go func() {
+			body, err := get(client, http.MethodGet, "block")
+			if err == nil && body != "ok" {
+				err = errors.New("unexpected body " + body)
+			}
+			inflight <- err
+		}()
+		<-handler.started
+
+		shutdown := make(chan error, 1)
+		go func() {
+			shutdown <- s.Shutdown(context.Background())
+		}()
+		select {
+		case err := <-shutdown:
+			t.Fatalf("Shutdown returned with request in flight: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		_, err = getTimeout(newTestTransport(t), http.MethodGet, "", 500*time.Millisecond)
+		assert.Error(t, err, "new connection refused")
+
+		close(handler.release)
+		assert.NoError(t, <-inflight, "in-flight request completed")
+		assert.NoError(t, <-shutdown)
+		assert.ErrorIs(t, <-served, http.ErrServerClosed)
+		assertSocketClosed(t)
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		handler := newBlockingHandler()
+		s := &Server{Server: &http3.Server{Handler: handler}}
+		served := startTestServer(t, s)
+		client := newTestTransport(t)
+
+		inflight := make(chan error, 1)
+		go func() {
+			_, err := get(client, http.MethodGet, "block")
+			inflight <- err
+		}()
+		<-handler.started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+		assert.Error(t, receive(t, inflight), "request aborted")
+		assert.ErrorIs(t, <-served, http.ErrServerClosed)
+		assertSocketClosed(t)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		handler := newBlockingHandler()
+		s := &Server{Server: &http3.Server{Handler: handler}}
+		served := startTestServer(t, s)
+		client := newTestTransport(t)
+
+		inflight := make(chan error, 1)
+		go func() {
+			_, err := get(client, http.MethodGet, "block")
+			inflight <- err
+		}()
+		<-handler.started
+
+		assert.NoError(t, s.Close())
+		assert.Error(t, receive(t, inflight), "request aborted")
+		assert.ErrorIs(t, <-served, http.ErrServerClosed)
+		assertSocketClosed(t)
+		_, err := getTimeout(newTestTransport(t), http.MethodGet, "", 500*time.Millisecond)
+		assert.Error(t, err, "new connection refused")
+	})
+
+	t.Run("closed before listening", func(t *testing.T) {
+		s := &Server{Server: &http3.Server{}}
+		require.NoError(t, s.Close())
+		served := startTestServer(t, s)
+		assert.ErrorIs(t, <-served, http.ErrServerClosed)
+	})
+}
+
+func TestServer0RTT(t *testing.T) {
+	for _, allow0RTT := range []bool{true, false} {
+		name := "allowed"
+		if !allow0RTT {
+			name = "not allowed"
+		}
+		t.Run(name, func(t *testing.T) {
+			var mutex sync.Mutex
+			var early []bool
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mutex.Lock()
+				early = append(early, !r.TLS.HandshakeComplete)
+				mutex.Unlock()
+				_, _ = io.WriteString(w, "ok")
+			})
+			s := &Server{Server: &http3.Server{Handler: handler}, Allow0RTT: allow0RTT}
+			served := startTestServer(t, s)
+			client := newTestTransport(t)
+
+			// obtain a session ticket, then resume the connection
+			_, err := get(client, http.MethodGet, "")
+			require.NoError(t, err)
+			client.CloseIdleConnections()
+			body, err := get(client, http3.MethodGet0RTT, "")
+			require.NoError(t, err)
+			assert.Equal(t, "ok", body)
+
+			mutex.Lock()
+			assert.Equal(t, []bool{false, allow0RTT}, early, "request in 0-RTT data")
+			mutex.Unlock()
+			require.NoError(t, s.Close())
+			assert.ErrorIs(t, <-served, http.ErrServerClosed)
+		})
+	}
+}
@@ -19,17 +19,28 @@ package shttp3
 import (
 	"context"
 	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
 	"net/netip"
+	"sync"
 
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
 
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsec-ethz/scion-apps/pkg/shttp"
 )
 
 // DefaultTransport is the default RoundTripper that can be used for HTTP/3
 // over SCION.
+// TLS sessions are cached, so that connections can be resumed, and requests
+// with method http3.MethodGet0RTT or http3.MethodHead0RTT can be sent in 0-RTT
+// data to servers that allow it.
 var DefaultTransport = &http3.Transport{
+	TLSClientConfig: &tls.Config{
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	},
 	Dial: (&Dialer{
 		Policy: nil,
 	}).Dial,
@@ -47,7 +58,7 @@ type Dialer struct {
 func (d *Dialer) Dial(ctx context.Context, addr string, tlsCfg *tls.Config,
 	cfg *quic.Config) (*quic.Conn, error) {
 
-	remote, err := pan.ResolveUDPAddr(ctx, addr)
+	remote, err := pan.ResolveUDPAddr(ctx, pan.UnmangleSCIONAddr(addr))
 	if err != nil {
 		return nil, err
 	}
@@ -56,6 +67,12 @@ func (d *Dialer) Dial(ctx context.Context, addr string, tlsCfg *tls.Config,
 		return nil, err
 	}
 	d.sessions = append(d.sessions, session)
+	key := connKey(session.LocalAddr(), session.RemoteAddr())
+	dialed.Store(key, session)
+	go func() {
+		<-session.Context().Done()
+		dialed.Delete(key)
+	}()
 	return session.Conn, nil
 }
 
@@ -65,3 +82,52 @@ func (d *Dialer) SetPolicy(policy pan.Policy) {
 		s.UnderlayConn.SetPolicy(policy)
 	}
 }
+
+// dialed holds the open connections dialed by any Dialer, by connKey, to look
+// up their path in ConnPath.
+var dialed sync.Map
+
+func connKey(local, remote net.Addr) string {
+	return local.String() + " " + remote.String()
+}
+
+// NewPolicyTransport returns a shttp.PolicyTransport for HTTP/3 over SCION,
+// with a path policy per request set with shttp.WithPolicy and connections
+// pooled per policy.
+func NewPolicyTransport(quicCfg *quic.Config) *shttp.PolicyTransport {
+	return &shttp.PolicyTransport{
+		NewTransport: func(policy pan.Policy) http.RoundTripper {
+			return &http3.Transport{
+				TLSClientConfig: &tls.Config{
+					ClientSessionCache: tls.NewLRUClientSessionCache(0),
+				},
+				QUICConfig: quicCfg,
+				Dial:       (&Dialer{Policy: policy}).Dial,
+			}
+		},
+	}
+}
+
+// ConnPath returns the path currently used by a connection dialed by a
+// Dialer, or nil if the path is not known. The connection is identified by
+// its addresses, so this also works for the placeholder connection passed to
+// httptrace.ClientTrace.GotConn by http3.Transport.
+func ConnPath(conn net.Conn) *pan.Path {
+	session, ok := dialed.Load(connKey(conn.LocalAddr(), conn.RemoteAddr()))
+	if !ok {
+		return nil
+	}
+	return session.(*pan.QUICConn).UnderlayConn.GetPath()
+}
+
+// WithPathTrace returns a copy of ctx with an httptrace.ClientTrace that calls
+// gotPath with the path of the connection used for a request made with this
+// context, once the connection is obtained; gotPath is called with nil if the
+// path is not known, e.g. for a host in the local AS.
+func WithPathTrace(ctx context.Context, gotPath func(path *pan.Path)) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			gotPath(ConnPath(info.Conn))
+		},
+	})
+}
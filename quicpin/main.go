@@ -0,0 +1,167 @@
+// Copyright 2026 ETH Zurich
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// scion-quicpin manages the pinned QUIC server keys of the trust store
+// used by netcat, shttp and other applications with trust on first use.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsec-ethz/scion-apps/pkg/quicutil"
+)
+
+func main() {
+	defaultPath, _ := quicutil.DefaultTrustStorePath()
+	file := kingpin.Flag("file", "Trust store file").Default(defaultPath).String()
+
+	kingpin.Command("list", "List the pinned hosts and their key fingerprints").Default()
+
+	addCmd := kingpin.Command("add", "Pin the key fingerprint for a host, replacing any previous pin")
+	addHost := addCmd.Arg("host", "Host address, as dialed, e.g. 17-ffaa:1:a,[10.0.0.1]:1234; the port is ignored").Required().String()
+	addFingerprint := addCmd.Arg("fingerprint", "Key fingerprint, sha256:...").Required().String()
+
+	removeCmd := kingpin.Command("remove", "Remove the pin of a host")
+	removeHost := removeCmd.Arg("host", "Host address").Required().String()
+
+	fetchCmd := kingpin.Command("fetch", "Connect to a host and show the fingerprint of its key")
+	fetchHost := fetchCmd.Arg("host", "Host address").Required().String()
+	fetchPin := fetchCmd.Flag("pin", "Pin the fetched key fingerprint").Bool()
+	fetchALPN := fetchCmd.Flag("alpn", "Application protocols offered to the host").
+		Default(quicutil.SingleStreamProtoV2, quicutil.SingleStreamProto, quicutil.MuxProto, quicutil.DatagramProto, "h3").Strings()
+
+	keyCmd := kingpin.Command("key", "Show the fingerprint of a server key file, generating the key if it does not exist")
+	keyFile := keyCmd.Arg("file", "Server key file").Required().String()
+
+	cmd := kingpin.Parse()
+	if *file == "" && cmd != keyCmd.FullCommand() {
+		fmt.Fprintln(os.Stderr, "ERROR: no trust store file, specify --file")
+		os.Exit(1)
+	}
+
+	var err error
+	switch cmd {
+	case addCmd.FullCommand():
+		err = add(*file, *addHost, *addFingerprint)
+	case removeCmd.FullCommand():
+		err = remove(*file, *removeHost)
+	case fetchCmd.FullCommand():
+		err = fetch(*file, *fetchHost, *fetchALPN, *fetchPin)
+	case keyCmd.FullCommand():
+		err = key(*keyFile)
+	default:
+		err = list(*file)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		os.Exit(1)
+	}
+}
+
+func list(file string) error {
+	store, err := quicutil.LoadTrustStore(file)
+	if err != nil {
+		return err
+	}
+	for _, host := range store.Hosts() {
+		fingerprint, _ := store.Lookup(host)
+		fmt.Println(host, fingerprint)
+	}
+	return nil
+}
+
+func add(file, host, fingerprint string) error {
+	store, err := quicutil.LoadTrustStore(file)
+	if err != nil {
+		return err
+	}
+	return store.Pin(host, fingerprint)
+}
+
+func remove(file, host string) error {
+	store, err := quicutil.LoadTrustStore(file)
+	if err != nil {
+		return err
+	}
+	ok, err := store.Remove(host)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("no pin for host %s in %s", host, file)
+	}
+	return nil
+}
+
+func fetch(file, host string, alpn []string, pin bool) error {
+	var fingerprint string
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: true, // only show the key
+		NextProtos:         alpn,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("no server certificate")
+			}
+			fingerprint = quicutil.KeyFingerprint(cs.PeerCertificates[0])
+			return nil
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	remote, err := pan.ResolveUDPAddr(ctx, pan.UnmangleSCIONAddr(host))
+	if err != nil {
+		return err
+	}
+	conn, err := pan.DialQUIC(ctx, netip.AddrPort{}, remote, pan.MangleSCIONAddr(host), tlsCfg, nil)
+	if err != nil {
+		return err
+	}
+	_ = conn.CloseWithError(0x0, "ok")
+
+	store, err := quicutil.LoadTrustStore(file)
+	if err != nil {
+		return err
+	}
+	pinned, ok := store.Lookup(host)
+	switch {
+	case !ok:
+		fmt.Println(host, fingerprint, "(not pinned)")
+	case pinned == fingerprint:
+		fmt.Println(host, fingerprint, "(pinned)")
+	default:
+		fmt.Println(host, fingerprint, "(MISMATCH, pinned "+pinned+")")
+	}
+	if pin {
+		return store.Pin(host, fingerprint)
+	}
+	return nil
+}
+
+func key(file string) error {
+	cert, err := quicutil.LoadOrGenerateSelfSignedCert(file)
+	if err != nil {
+		return err
+	}
+	fmt.Println(quicutil.KeyFingerprint(cert.Leaf))
+	return nil
+}
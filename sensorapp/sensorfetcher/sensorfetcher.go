@@ -42,6 +42,7 @@ func main() {
 	preference := flag.String("preference", "", "Preference sorting order for paths. "+
 		"Comma-separated list of available sorting options: "+
 		strings.Join(pan.AvailablePreferencePolicies, "|"))
+	redundancy := flag.Int("redundancy", 0, "Send the request over this many disjoint paths at once (0: single path)")
 
 	flag.Parse()
 
@@ -54,7 +55,14 @@ func main() {
 	check(err)
 	serverAddr, err := pan.ResolveUDPAddr(context.TODO(), *serverAddrStr)
 	check(err)
-	conn, err := pan.DialUDP(context.Background(), netip.AddrPort{}, serverAddr, pan.WithPolicy(policy))
+	opts := []pan.ConnOptions{pan.WithPolicy(policy)}
+	if *redundancy > 0 {
+		opts = append(opts, pan.WithRedundancy(pan.RedundancyConfig{
+			MinCopies: *redundancy,
+			MaxCopies: *redundancy,
+		}))
+	}
+	conn, err := pan.DialUDP(context.Background(), netip.AddrPort{}, serverAddr, opts...)
 	check(err)
 
 	receivePacketBuffer := make([]byte, 2500)
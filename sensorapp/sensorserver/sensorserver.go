@@ -81,7 +81,7 @@ func main() {
 	flag.Parse()
 
 	local := netip.AddrPortFrom(netip.Addr{}, uint16(*port))
-	conn, err := pan.ListenUDP(context.Background(), local)
+	conn, err := pan.ListenUDP(context.Background(), local, pan.WithListenRedundancy())
 	check(err)
 
 	receivePacketBuffer := make([]byte, 2500)
@@ -57,26 +57,63 @@ const (
 	mungedScionAddrHostIndex = 3
 )
 
+// PathUsage is the usage of SCION for a domain, as served on /pathUsage.
 // This is at the moment just for presentation purposes and needs to be
 // rewritten in the end...
-var pathStats = PathUsageStats{
-	data: make(map[string]*PathUsage),
-}
-
 type PathUsage struct {
-	path     pan.Path
 	Received int64
 	Path     string
 	Strategy string
 	Domain   string
 }
 
+// PathUsageStats records the PathUsage of the domains tunnelled over SCION,
+// and serves them on /pathUsage.
 type PathUsageStats struct {
-	sync.Mutex
+	mutex sync.Mutex
 	// For simplicity before the Hotnets Demo: We assume that here is one path used per domain
 	data map[string]*PathUsage
 }
 
+func newPathUsageStats() *PathUsageStats {
+	return &PathUsageStats{
+		data: make(map[string]*PathUsage),
+	}
+}
+
+// record adds n bytes received from the domain via path.
+func (s *PathUsageStats) record(domain string, n int, path *pan.Path) {
+	shortPath := pathToShortPath(path)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	pu, ok := s.data[domain]
+	if !ok {
+		pu = &PathUsage{
+			Strategy: "Shortest Path", // TODO: This may be configured by the user
+			Domain:   domain,
+		}
+		s.data[domain] = pu
+	}
+	pu.Received += int64(n)
+	pu.Path = shortPath
+}
+
+func (s *PathUsageStats) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	data := make([]PathUsage, 0, len(s.data))
+	for _, v := range s.data {
+		data = append(data, *v)
+	}
+	s.mutex.Unlock()
+	j, err := json.Marshal(data)
+	if err != nil {
+		fmt.Println("verbose: ", "error serializing path statistics")
+		http.Error(w, "error serializing path statistics", 500)
+		return
+	}
+	_, _ = w.Write(j)
+}
+
 //go:embed skip.pac
 var skipPAC string
 var skipPACtemplate = template.Must(template.New("skip.pac").Parse(skipPAC))
@@ -91,24 +128,25 @@ func main() {
 	kingpin.Flag("bind", "Address to bind on").Default("localhost:8888").TCPVar(&bindAddress)
 	kingpin.Parse()
 
-	transport, dialer := shttp.NewTransport(nil, nil)
-
+	policy := &currentPolicy{}
 	proxy := &proxyHandler{
-		transport: transport,
-		dialer:    dialer,
+		transport: &shttp.PolicyTransport{},
+		policy:    policy,
 	}
+	pathStats := newPathUsageStats()
 	tunnelHandler := &tunnelHandler{
-		dialer: dialer,
+		policy:    policy,
+		pathStats: pathStats,
 	}
 	policyHandler := &policyHandler{
-		output: dialer,
+		output: policy,
 	}
 
 	mux := http.NewServeMux()
 	apiMux := http.NewServeMux()
 	apiMux.HandleFunc("/skip.pac", handleWPAD)
 	apiMux.HandleFunc("/scionHosts", handleHostListRequest)
-	apiMux.HandleFunc("/pathUsage", handlePathUsageRequest)
+	apiMux.Handle("/pathUsage", pathStats)
 	apiMux.HandleFunc("/r", handleRedirectBackOrError)
 
 	apiMux.HandleFunc("/resolve", handleHostResolutionRequest)
@@ -129,20 +167,6 @@ func main() {
 	log.Fatal(server.ListenAndServe())
 }
 
-func handlePathUsageRequest(w http.ResponseWriter, req *http.Request) {
-	data := make([]*PathUsage, 0)
-	for _, v := range pathStats.data {
-		data = append(data, v)
-	}
-	j, err := json.Marshal(data)
-	if err != nil {
-		fmt.Println("verbose: ", "error serializing path statistics")
-		http.Error(w, "error serializing path statistics", 500)
-		return
-	}
-	_, _ = w.Write(j)
-}
-
 func handleWPAD(w http.ResponseWriter, req *http.Request) {
 	buf := &bytes.Buffer{}
 	err := skipPACtemplate.Execute(buf,
@@ -254,6 +278,25 @@ func isSCIONEnabled(ctx context.Context, host string) (bool, error) {
 	return true, nil
 }
 
+// currentPolicy is the path policy set by the user, used for new requests and
+// tunnels.
+type currentPolicy struct {
+	mutex  sync.Mutex
+	policy pan.Policy
+}
+
+func (p *currentPolicy) SetPolicy(policy pan.Policy) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.policy = policy
+}
+
+func (p *currentPolicy) Policy() pan.Policy {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.policy
+}
+
 type policyHandler struct {
 	output interface{ SetPolicy(pan.Policy) }
 }
@@ -306,39 +349,20 @@ func (h *policyHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 type proxyHandler struct {
 	transport http.RoundTripper
-	dialer    *shttp.Dialer
+	policy    *currentPolicy
 }
 
 func (h *proxyHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	host := demunge(req.Host)
 	req.Host = host
 	req.URL.Host = host
+	if policy := h.policy.Policy(); policy != nil {
+		req = req.WithContext(shttp.WithPolicy(req.Context(), policy))
+	}
 
-	// TODO(JordiSubira): This code snippet needs to be adapted and polished
-	// to add path usage information for HTTP(no S) connections.
-	//
-	// domain := req.URL.Hostname()
-	// policy := h.dialer.Policy
-	// sequence, ok := policy.(pan.Sequence)
-	// var pathUsage *PathUsage
-	// if ok {
-	// 	pu, ok := pathStats.data[domain]
-	// 	if !ok {
-	// 		pathUsage = &PathUsage{
-	// 			Received: 0,
-	// 			Strategy: "Geofenced", // TODO: This may be configured by the user
-	// 			Path:     sequenceToPath(sequence),
-	// 			Domain:   domain,
-	// 		}
-
-	// 		pathStats.Lock()
-	// 		pathStats.data[domain] = pathUsage
-	// 		pathStats.Unlock()
-	// 	} else {
-	// 		pathUsage = pu
-	// 		pathUsage.Path = sequenceToPath(sequence)
-	// 	}
-	// }
+	// TODO(JordiSubira): Record the path usage for HTTP(no S) connections in
+	// the PathUsageStats, as for the tunnelled connections; e.g. with the
+	// "Geofenced" strategy and the path of the sequence of the policy.
 
 	resp, err := h.transport.RoundTrip(req)
 	if err != nil {
@@ -373,7 +397,8 @@ func interceptConnect(connect, next http.Handler) http.HandlerFunc {
 }
 
 type tunnelHandler struct {
-	dialer *shttp.Dialer
+	policy    *currentPolicy
+	pathStats *PathUsageStats
 }
 
 func (h *tunnelHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -389,7 +414,8 @@ func (h *tunnelHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		// CONNECT via SCION
 		ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second)
 		defer cancel()
-		destConn, err = h.dialer.DialContext(ctx, "", req.Host)
+		dialer := &shttp.Dialer{Policy: h.policy.Policy()}
+		destConn, err = dialer.DialContext(ctx, "", req.Host)
 		if panConn, ok := destConn.(*quicutil.SingleStream); ok {
 			pathF = panConn.GetPath
 		}
@@ -416,13 +442,20 @@ func (h *tunnelHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 	// This is at the moment just for presentation purposes and needs to be
 	// rewritten in the end...
-	go transfer(destConn, clientConn, nil, req.URL.Hostname()) // We just count the received bytes for now
-	go transfer(clientConn, destConn, pathF, req.URL.Hostname())
+	var record func(n int)
+	if pathF != nil {
+		domain := req.URL.Hostname()
+		record = func(n int) {
+			h.pathStats.record(domain, n, pathF())
+		}
+	}
+	go transfer(destConn, clientConn, nil) // We just count the received bytes for now
+	go transfer(clientConn, destConn, record)
 
 }
 
 func pathToShortPath(path *pan.Path) string {
-	if path == nil {
+	if path == nil || path.Metadata == nil {
 		return ""
 	}
 	if len(path.Metadata.Interfaces) == 0 {
@@ -440,41 +473,21 @@ func pathToShortPath(path *pan.Path) string {
 	return b.String()
 }
 
-func transfer(dst io.WriteCloser, src io.ReadCloser, pathF func() *pan.Path, domain string) {
+// transfer copies from src to dst, calling record, if not nil, with the
+// number of bytes of each read from src.
+func transfer(dst io.WriteCloser, src io.ReadCloser, record func(n int)) {
 	defer dst.Close()
 	defer src.Close()
 	buf := make([]byte, 1024)
 	var written int64
 
-	var pathUsage *PathUsage
-	if pathF != nil {
-		path := pathF()
-		pu, ok := pathStats.data[domain]
-		if !ok {
-			pathUsage = &PathUsage{
-				path:     *path,
-				Received: 0,
-				Strategy: "Shortest Path", // TODO: This may be configured by the user
-				Path:     pathToShortPath(path),
-				Domain:   domain,
-			}
-
-			pathStats.Lock()
-			pathStats.data[domain] = pathUsage
-			pathStats.Unlock()
-		} else {
-			pathUsage = pu
-			pathUsage.Path = pathToShortPath(path)
-		}
+	if record != nil {
+		record(0)
 	}
-
 	for {
 		nr, er := src.Read(buf)
-		if pathUsage != nil {
-			pathUsage.Received += int64(nr)
-		}
-		if pathF != nil && pathUsage != nil {
-			pathUsage.Path = pathToShortPath(pathF())
+		if record != nil {
+			record(nr)
 		}
 
 		if nr > 0 {
@@ -502,9 +515,9 @@ func demunge(host string) string {
 	parts := mungedScionAddr.FindStringSubmatch(host)
 	if parts != nil {
 		// directly apply mangling as in pan.MangleSCIONAddr
-		return fmt.Sprintf("[%s-%s,%s]",
+		return fmt.Sprintf("%s-%s,%s",
 			parts[mungedScionAddrIAIndex],
-			strings.ReplaceAll(parts[mungedScionAddrASIndex], "_", ":"),
+			parts[mungedScionAddrASIndex],
 			parts[mungedScionAddrHostIndex],
 		)
 	}
@@ -43,7 +43,7 @@ func dialSCION(ctx context.Context,
 		return nil, err
 	}
 	tlsConf := &tls.Config{
-		NextProtos:         []string{quicutil.SingleStreamProto},
+		NextProtos:         quicutil.SingleStreamProtos,
 		InsecureSkipVerify: true,
 	}
 	quicConf := &quic.Config{
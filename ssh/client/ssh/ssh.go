@@ -199,13 +199,13 @@ func (client *Client) StartTunnel(local netip.AddrPort, addr string) error {
 	var localListener net.Listener
 	if strings.Contains(addr, ",") {
 		tlsConf := &tls.Config{
-			NextProtos: []string{quicutil.SingleStreamProto},
+			NextProtos: quicutil.SingleStreamProtos,
 		}
 		ql, err := pan.ListenQUIC(context.Background(), local, tlsConf, nil)
 		if err != nil {
 			return err
 		}
-		localListener = quicutil.SingleStreamListener{QUICListener: ql}
+		localListener = &quicutil.SingleStreamListener{QUICListener: ql}
 	} else {
 		// That's right, TCP listen on UDPAddr. XXX replace with netip.AddrPort once available
 		tl, err := net.Listen("tcp", local.String())
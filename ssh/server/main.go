@@ -17,10 +17,13 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
 	golog "log"
 	"net/netip"
 	"os"
 	"strconv"
+	"strings"
+	"unicode"
 
 	log "github.com/inconshreveable/log15"
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -72,6 +75,58 @@ func updateConfigFromFile(conf *serverconfig.ServerConfig, pth string) {
 	}
 }
 
+// newFirewall creates the inbound firewall from the AllowISDAS, DenyISDAS,
+// PathACL, MaxPacketRate and MaxRemotes options.
+func newFirewall(conf *serverconfig.ServerConfig) (*pan.Firewall, error) {
+	parseIAs := func(s string) ([]pan.IA, error) {
+		fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+		ias := make([]pan.IA, len(fields))
+		for i, f := range fields {
+			ia, err := pan.ParseIA(f)
+			if err != nil {
+				return nil, err
+			}
+			ias[i] = ia
+		}
+		return ias, nil
+	}
+	allow, err := parseIAs(conf.AllowISDAS)
+	if err != nil {
+		return nil, fmt.Errorf("AllowISDAS: %w", err)
+	}
+	deny, err := parseIAs(conf.DenyISDAS)
+	if err != nil {
+		return nil, fmt.Errorf("DenyISDAS: %w", err)
+	}
+	var acl *pan.ACL
+	if strings.TrimSpace(conf.PathACL) != "" {
+		entries := strings.Split(conf.PathACL, ",")
+		for i := range entries {
+			entries[i] = strings.TrimSpace(entries[i])
+		}
+		a, err := pan.NewACL(entries)
+		if err != nil {
+			return nil, fmt.Errorf("PathACL: %w", err)
+		}
+		acl = &a
+	}
+	rate, err := strconv.ParseFloat(conf.MaxPacketRate, 64)
+	if err != nil {
+		return nil, fmt.Errorf("MaxPacketRate: %w", err)
+	}
+	maxRemotes, err := strconv.Atoi(conf.MaxRemotes)
+	if err != nil {
+		return nil, fmt.Errorf("MaxRemotes: %w", err)
+	}
+	return pan.NewFirewall(pan.FirewallConfig{
+		Allow:      allow,
+		Deny:       deny,
+		ACL:        acl,
+		Rate:       rate,
+		MaxRemotes: maxRemotes,
+	}), nil
+}
+
 func main() {
 	kingpin.Parse()
 	log.Debug("Starting SCION SSH server...")
@@ -92,13 +147,17 @@ func main() {
 	local := netip.AddrPortFrom(netip.Addr{}, uint16(port))
 	tlsConf := &tls.Config{
 		Certificates: quicutil.MustGenerateSelfSignedCert(),
-		NextProtos:   []string{quicutil.SingleStreamProto},
+		NextProtos:   quicutil.SingleStreamProtos,
+	}
+	firewall, err := newFirewall(conf)
+	if err != nil {
+		golog.Panicf("Invalid firewall configuration: %v", err)
 	}
-	ql, err := pan.ListenQUIC(context.Background(), local, tlsConf, nil)
+	ql, err := pan.ListenQUIC(context.Background(), local, tlsConf, nil, pan.WithInboundFilter(firewall))
 	if err != nil {
 		golog.Panicf("Failed to listen (%v)", err)
 	}
-	listener := quicutil.SingleStreamListener{QUICListener: ql}
+	listener := &quicutil.SingleStreamListener{QUICListener: ql}
 
 	log.Debug("Starting to wait for connections")
 	for {
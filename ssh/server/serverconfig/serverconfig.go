@@ -22,6 +22,14 @@ type ServerConfig struct {
 	PubkeyAuthentication   string `regex:"(yes|no)"`
 	HostKey                string `regex:".*"`
 	MaxAuthTries           string `regex:"[1-9]\\d*"`
+	// Inbound firewall, see pan.FirewallConfig.
+	// AllowISDAS and DenyISDAS are lists of ISD-ASes separated by commas or
+	// spaces, PathACL is a list of ACL entries separated by commas.
+	AllowISDAS    string `regex:".*"`
+	DenyISDAS     string `regex:".*"`
+	PathACL       string `regex:".*"`
+	MaxPacketRate string `regex:"\\d+(\\.\\d+)?"`
+	MaxRemotes    string `regex:"\\d+"`
 }
 
 // Create creates a new ServerConfig with the default values.
@@ -32,5 +40,7 @@ func Create() *ServerConfig {
 		PasswordAuthentication: "yes",
 		PubkeyAuthentication:   "yes",
 		HostKey:                "/etc/ssh/ssh_host_key",
+		MaxPacketRate:          "0",
+		MaxRemotes:             "0",
 	}
 }
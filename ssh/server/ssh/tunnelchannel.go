@@ -88,7 +88,7 @@ func handleSCIONQUICTunnel(perms *ssh.Permissions, newChannel ssh.NewChannel) er
 		return fmt.Errorf("could not resolve remote address: %w", err)
 	}
 	tlsConf := &tls.Config{
-		NextProtos:         []string{quicutil.SingleStreamProto},
+		NextProtos:         quicutil.SingleStreamProtos,
 		InsecureSkipVerify: true,
 	}
 	sess, err := pan.DialQUIC(ctx, netip.AddrPort{}, remote, "", tlsConf, nil)
@@ -102,7 +102,9 @@ func forwardTLS(hosts map[string]struct{}) error {
 // forwardTLS forwards traffic for sess to the corresponding TCP/IP host
 // identified by SNI.
 func forwardTLSSession(hosts map[string]struct{}, sess *quic.Conn) {
-	clientConn, err := quicutil.NewSingleStream(sess)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	clientConn, err := quicutil.AcceptSingleStream(ctx, sess)
+	cancel()
 	if err != nil {
 		return
 	}
@@ -162,7 +164,7 @@ func transfer(dst io.WriteCloser, src io.ReadCloser) {
 
 func listen(laddr netip.AddrPort) (*pan.QUICListener, error) {
 	tlsCfg := &tls.Config{
-		NextProtos:   []string{quicutil.SingleStreamProto},
+		NextProtos:   quicutil.SingleStreamProtos,
 		Certificates: quicutil.MustGenerateSelfSignedCert(),
 	}
 	return pan.ListenQUIC(context.Background(), laddr, tlsCfg, nil)